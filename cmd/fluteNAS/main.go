@@ -2,57 +2,84 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
+	"flag"
+	"flutelake/fluteNAS/cmd/fluteNAS/options"
 	flutenasf "flutelake/fluteNAS/frontend/flute-nas"
 	"flutelake/fluteNAS/pkg/api"
 	"flutelake/fluteNAS/pkg/controller"
 	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/backup"
 	"flutelake/fluteNAS/pkg/module/cache"
+	"flutelake/fluteNAS/pkg/module/certs"
 	"flutelake/fluteNAS/pkg/module/db"
 	"flutelake/fluteNAS/pkg/module/flog"
 	"flutelake/fluteNAS/pkg/module/metricsvm"
 	"flutelake/fluteNAS/pkg/module/node"
+	"flutelake/fluteNAS/pkg/module/ratelimit"
 	"flutelake/fluteNAS/pkg/module/victoriametrics"
 	"flutelake/fluteNAS/pkg/server/apiserver"
 	"flutelake/fluteNAS/pkg/server/terminal"
 	"flutelake/fluteNAS/pkg/util"
+	"flutelake/fluteNAS/pkg/version"
+	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	"gorm.io/gorm"
 )
 
-func init() {
+// type FluteNAS struct {
+// 	// http api server
+// 	server *apiserver.Apiserver
+// 	// ssl cert
+// 	publicKey  *util.LinkedRune
+// 	privateKey *util.LinkedRune
+// }
+
+func main() {
 	// init logger settings
 	flog.NewLogger(1000)
 
-	// init api router
-	dataPath, err := initDataDir()
+	opts, err := options.Load(os.Args[1:])
 	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
 		flog.Fatal(err)
 	}
+	if opts.ShowVersion {
+		fmt.Println(version.Get())
+		return
+	}
+	flog.Infof("starting %s", version.Get())
 
-	// init database
-	err = initDB(dataPath)
+	dataPath, err := initDataDir(opts.DataDir)
 	if err != nil {
 		flog.Fatal(err)
 	}
-}
 
-// type FluteNAS struct {
-// 	// http api server
-// 	server *apiserver.Apiserver
-// 	// ssl cert
-// 	publicKey  *util.LinkedRune
-// 	privateKey *util.LinkedRune
-// }
+	// init database
+	err = initDB(dataPath, opts.MigrateDownTo)
+	if err != nil {
+		flog.Fatal(err)
+	}
+	if opts.MigrateDownTo >= 0 {
+		flog.Infof("database rolled back to schema version %d", opts.MigrateDownTo)
+		db.Close()
+		return
+	}
 
-func main() {
+	// 磁盘挂载和共享目录的根目录
+	node.SetMountRoot(opts.MountRoot)
 
 	c := cache.NewMemoryCache()
 
-	server := apiserver.NewApiserver(c)
+	server := apiserver.NewApiserver(c, opts.ListenAddress)
 	// 前端文件
 	server.SetFrontendFS(flutenasf.FrontendFiles)
 	privateKey, publicKey, err := util.GenerateRSAKeyPair(2048)
@@ -65,8 +92,10 @@ func main() {
 	// 	privateKey: privateKey,
 	// }
 
-	ctx, cancel := context.WithCancel(context.Background())
-	terms := terminal.NewWebTerminal(600)
+	// SIGTERM/SIGINT 时停止接收新请求，并依次停止各个组件
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	terms := terminal.NewWebTerminal(opts.Terminal.Timeout, opts.Terminal.RecordPath)
 
 	// init db host table data
 	initSelfHost()
@@ -74,59 +103,222 @@ func main() {
 	// init os settings
 	initOS()
 
+	sessionKey, err := initSessionKey(dataPath)
+	if err != nil {
+		flog.Fatal(err)
+	}
+
+	certManager, err := initTLS(server, dataPath, opts.TLS)
+	if err != nil {
+		flog.Fatal(err)
+	}
+
+	// 限流和请求体大小需要在注册路由之前设置
+	server.SetMaxBodyBytes(opts.Limits.MaxBodyBytes)
+	server.SetRateLimits(rateLimits(opts.Limits.RateLimits))
+	server.SetAllowedOrigins(opts.Security.AllowedOrigins)
+	server.SetDevMode(opts.Security.DevMode)
+	trustedProxies, err := util.ParseNetworks(opts.Security.TrustedProxies)
+	if err != nil {
+		flog.Fatal(err)
+	}
+	server.SetTrustedProxies(trustedProxies)
+
+	backupDir := opts.Backup.Dir
+	if !filepath.IsAbs(backupDir) {
+		backupDir = filepath.Join(dataPath, backupDir)
+	}
+	dbBackups := backup.NewDatabase(db.Instance(), backupDir, backup.Retention{
+		Hourly: opts.Backup.Hourly,
+		Daily:  opts.Backup.Daily,
+		Weekly: opts.Backup.Weekly,
+	})
+
+	cron := controller.NewCronJob()
+
 	// register apis
-	api.RegisterHandlersV1(server, privateKey, publicKey, c, terms)
+	api.RegisterHandlersV1(server, privateKey, publicKey, c, terms, sessionKey, certManager, opts.MountRoot, opts.VictoriaMetricsURL, dataPath, dbBackups, cron)
 
 	// start terminal service
 	go terms.Start(ctx.Done())
+	terms.SetCheckOrigin(server.CheckOrigin)
 	server.HandleFunc("/ws/v1/terminal", terms.WebSocketHandler)
 
 	// start controller manager
-	cron := controller.NewCronJob()
-	err = initController(cron)
+	err = initController(cron, opts.MountRoot, opts.Audit.RetentionDays)
 	if err != nil {
 		flog.Fatal(err)
 	}
+	if opts.Backup.Enabled {
+		err = cron.AddJob("backupDatabase", opts.Backup.Schedule, controller.NewDatabaseBackupController(dbBackups).Do)
+		if err != nil {
+			flog.Fatal(err)
+		}
+	}
+	// 应用通过接口修改并保存的调度和暂停状态
+	if err := cron.LoadSettings(db.Instance()); err != nil {
+		flog.Fatal(err)
+	}
 	go cron.Start()
+	// 启动时同步一次所有对象，之后由接口和定时全量同步加入队列
+	if err := controller.ResyncAll(); err != nil {
+		flog.Errorf("initial resync failed: %v", err)
+	}
+	controller.StartReconcilers(1)
 
-	go victoriametrics.Launch()
+	// victoriametrics 自己监听SIGTERM并落盘，退出前需要等待它结束
+	vmDone := make(chan struct{})
+	go func() {
+		defer close(vmDone)
+		victoriametrics.Launch()
+	}()
 	time.Sleep(time.Second * 1)
 	metricsvm.Init()
 	metricsvm.InitPushFromEnv()
 
 	if err := server.Run(ctx); err != nil {
-		cancel()
-		flog.Fatal(err)
+		flog.Errorf("api server stopped: %v", err)
 	}
+	stop()
+	shutdown(cron, terms, vmDone)
 }
 
-func initDataDir() (string, error) {
-	r, e := os.Getwd()
-	if e != nil {
-		return "", e
-	}
-	p := filepath.Join(r, ".flute")
-	_, e = os.Stat(p)
-	if e != nil {
-		if os.IsNotExist(e) {
-			return p, os.Mkdir(p, 0o644)
-		} else {
-			return p, e
+// shutdown 等待控制器当前的任务执行完成，关闭终端连接，最后关闭数据库
+func shutdown(cron *controller.CronJob, terms *terminal.WebTerminal, vmDone <-chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := cron.Shutdown(ctx); err != nil {
+		flog.Warnf("wait for running controllers failed: %v", err)
+	}
+	if err := controller.ShutdownReconcilers(ctx); err != nil {
+		flog.Warnf("wait for running reconcilers failed: %v", err)
+	}
+	terms.Close()
+
+	select {
+	case <-vmDone:
+	case <-ctx.Done():
+		flog.Warnf("wait for victoriametrics to stop timeout")
+	}
+
+	if err := db.Close(); err != nil {
+		flog.Errorf("close database failed: %v", err)
+	}
+	flog.Infof("flute-nas stopped")
+}
+
+// 全量同步的默认调度，可以通过 /v1/jobs/schedule 修改
+const resyncSchedule = "@every 5m"
+
+// 停止各个组件的最长等待时间，需要小于 systemd 的 TimeoutStopSec
+const shutdownTimeout = time.Second * 30
+
+// initDataDir 创建数据目录，相对路径基于当前工作目录
+func initDataDir(dir string) (string, error) {
+	p, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	return p, os.MkdirAll(p, 0o700)
+}
+
+// initTLS 启用https时，证书不存在则在数据目录下生成自签名证书
+func initTLS(server *apiserver.Apiserver, pStr string, opts options.TLSOptions) (*certs.Manager, error) {
+	if !opts.Enabled {
+		flog.Warnf("https is disabled")
+		return nil, nil
+	}
+
+	m := certs.NewManager(filepath.Join(pStr, "tls"))
+	created, err := m.EnsureSelfSigned(certs.LocalHosts())
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		flog.Infof("generated self-signed tls certificate %s", m.CertFile())
+	}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	server.SetTLS(m.GetCertificate)
+	if opts.RedirectAddress != "" {
+		server.SetHTTPRedirect(opts.RedirectAddress)
+	}
+
+	// systemctl reload 发送SIGHUP，重新加载手动替换的证书文件
+	go func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGHUP)
+		for range ch {
+			if err := m.Reload(); err != nil {
+				flog.Errorf("reload tls certificate failed: %v", err)
+				continue
+			}
+			flog.Infof("tls certificate reloaded")
 		}
+	}()
+	return m, nil
+}
+
+// initSessionKey 读取加密会话数据的密钥，不存在时随机生成
+func initSessionKey(pStr string) ([]byte, error) {
+	p := filepath.Join(pStr, "session.key")
+	key, err := os.ReadFile(p)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("invalid session key length %d in %s", len(key), p)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
 	}
-	return p, nil
+	return key, os.WriteFile(p, key, 0o600)
 }
 
-func initDB(pStr string) error {
-	db.InitDB(pStr)
+func initDB(pStr string, migrateDownTo int) error {
+	if err := db.InitDB(pStr); err != nil {
+		return err
+	}
+
+	// 先执行版本迁移，处理 AutoMigrate 不能完成的修改，执行前备份数据库
+	fresh, err := db.IsEmpty(db.Instance())
+	if err != nil {
+		return err
+	}
+	migrator, err := db.NewMigrator(db.Instance(), model.Migrations, filepath.Join(pStr, "migration-backups"))
+	if err != nil {
+		return err
+	}
+	if migrateDownTo >= 0 {
+		return migrator.DownTo(migrateDownTo)
+	}
+	if err := migrator.Up(fresh); err != nil {
+		return err
+	}
+	flog.Infof("database schema version %d", migrator.Latest())
 
 	// Migrate the table schema
-	err := db.Instance().AutoMigrate(
+	err = db.Instance().AutoMigrate(
 		&model.MountPoint{},
 		&model.Host{},
 		&model.SambaUser{},
 		&model.SambaShare{},
 		&model.NFSExport{},
+		&model.UserRole{},
+		&model.APIToken{},
+		&model.UserTOTP{},
+		&model.LoginAttempt{},
+		&model.Session{},
+		&model.AuditLog{},
+		&model.UserPreference{},
+		&model.JobSetting{},
 	// &Network{},
 	// &Host{},
 	// &Operation{},
@@ -138,32 +330,37 @@ func initDB(pStr string) error {
 	return nil
 }
 
-func initController(cron *controller.CronJob) error {
-	// 15s 检查一次挂载点
-	err := cron.AddJob("checkMountPoint", "@every 15s", controller.NewStorageDeviceController().MountPoint)
-	if err != nil {
-		return err
-	}
-
-	// 15s 检查一次samba user
-	err = cron.AddJob("sambaUser", "@every 15s", controller.NewSambaUsereController().Do)
-	if err != nil {
-		return err
+func initController(cron *controller.CronJob, mountRoot string, auditRetentionDays int) error {
+	mountPoints := controller.NewStorageDeviceController(mountRoot, node.NewHostExecutor)
+	sambaUsers := controller.NewSambaUsereController(node.NewHostExecutor)
+	sambaShares := controller.NewSambaShareController(mountRoot, node.NewHostExecutor)
+	nfsShares := controller.NewNFSShareController(node.NewHostExecutor)
+	// 接口修改对象后把对象加入队列立即处理，定时全量同步作为兜底
+	reconcilers := []struct {
+		job string
+		r   *controller.Reconciler
+	}{
+		{"checkMountPoint", controller.NewReconciler(controller.ReconcilerMountPoint, mountPoints.Reconcile, mountPoints.Keys)},
+		{"sambaUser", controller.NewReconciler(controller.ReconcilerSambaUser, sambaUsers.Reconcile, sambaUsers.Keys)},
+		{"sambaShare", controller.NewReconciler(controller.ReconcilerSambaShare, sambaShares.Reconcile, sambaShares.Keys)},
+		{"nfsShare", controller.NewReconciler(controller.ReconcilerNFSShare, nfsShares.Reconcile, nfsShares.Keys)},
 	}
-
-	// 15s 检查一次samba share
-	err = cron.AddJob("sambaShare", "@every 15s", controller.NewSambaShareController().Do)
-	if err != nil {
-		return err
+	for _, rc := range reconcilers {
+		if err := controller.Register(rc.r); err != nil {
+			return err
+		}
+		if err := cron.AddJob(rc.job, resyncSchedule, rc.r.Resync); err != nil {
+			return err
+		}
 	}
 
-	// 15s 检查一次nfs share
-	err = cron.AddJob("nfsShare", "@every 15s", controller.NewNFSShareController().Do)
+	err := cron.AddJob("collectMetrics", "@every 15s", node.CollectSelfMonitoringMetrics)
 	if err != nil {
 		return err
 	}
 
-	err = cron.AddJob("collectMetrics", "@every 15s", node.CollectSelfMonitoringMetrics)
+	// 每天凌晨清理过期的审计日志
+	err = cron.AddJob("cleanAuditLogs", "0 3 * * *", controller.NewAuditLogController(auditRetentionDays).Do)
 	if err != nil {
 		return err
 	}
@@ -180,10 +377,11 @@ func initSelfHost() {
 	}
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		// 收集本机信息
-		osRelease, version := node.GetOS(model.LocalHost)
-		kernelVersion := node.GetKernelVersion(model.LocalHost)
-		arch := node.GetArch(model.LocalHost)
-		hostname := node.GetHostname(model.LocalHost)
+		ctx := context.Background()
+		osRelease, version := node.GetOS(ctx, model.LocalHost)
+		kernelVersion := node.GetKernelVersion(ctx, model.LocalHost)
+		arch := node.GetArch(ctx, model.LocalHost)
+		hostname := node.GetHostname(ctx, model.LocalHost)
 		sshPort, err := node.GetLocalHostSshPort()
 		if err != nil {
 			flog.Fatalf("Error get ssh port: %v", err)
@@ -221,3 +419,11 @@ func initOS() {
 		flog.Fatalf("Error adding shell OSC 133 support: %v", err)
 	}
 }
+
+func rateLimits(limits map[string]ratelimit.Limit) map[apiserver.RateClass]ratelimit.Limit {
+	out := make(map[apiserver.RateClass]ratelimit.Limit, len(limits))
+	for class, limit := range limits {
+		out[apiserver.RateClass(class)] = limit
+	}
+	return out
+}
@@ -1,3 +1,416 @@
 package options
 
-// todo 1. 挂载目录可配置，目前使用的固定路径/mnt
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"flutelake/fluteNAS/pkg/module/ratelimit"
+	"flutelake/fluteNAS/pkg/util"
+
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// 未通过 --config 或 FLUTE_CONFIG 指定时，工作目录下存在该文件则加载
+const DefaultConfigFile = "config.yml"
+
+// Options 服务的启动参数
+// 优先级: 命令行参数 > 环境变量 > 配置文件 > 默认值
+type Options struct {
+	// 配置文件路径，只能通过命令行参数或环境变量指定
+	ConfigFile string `yaml:"-"`
+	// 输出版本信息后退出，不加载配置
+	ShowVersion bool `yaml:"-"`
+	// 把数据库回滚到指定的迁移版本后退出，-1表示不回滚，用于降级到旧版本之前执行
+	MigrateDownTo int `yaml:"-"`
+
+	// http(s)服务监听地址
+	ListenAddress string `yaml:"listenAddress"`
+	// 数据目录，保存数据库、会话密钥和证书等
+	DataDir string `yaml:"dataDir"`
+	// 磁盘挂载点和共享目录所在的根目录
+	MountRoot string `yaml:"mountRoot"`
+	// VictoriaMetrics 查询地址
+	VictoriaMetricsURL string `yaml:"victoriaMetricsURL"`
+
+	Terminal TerminalOptions `yaml:"terminal"`
+	TLS      TLSOptions      `yaml:"tls"`
+	Audit    AuditOptions    `yaml:"audit"`
+	Backup   BackupOptions   `yaml:"backup"`
+	Limits   LimitOptions    `yaml:"limits"`
+	Security SecurityOptions `yaml:"security"`
+}
+
+type TerminalOptions struct {
+	// 终端连接的超时时间，单位秒
+	Timeout int `yaml:"timeout"`
+	// 终端录像和历史命令的保存目录
+	RecordPath string `yaml:"recordPath"`
+}
+
+type TLSOptions struct {
+	// 是否启用https，证书不存在时在数据目录下生成自签名证书
+	Enabled bool `yaml:"enabled"`
+	// 启用https后，在该地址上把http请求重定向到https，为空表示不启用
+	RedirectAddress string `yaml:"redirectAddress"`
+}
+
+type AuditOptions struct {
+	// 审计日志的保留天数
+	RetentionDays int `yaml:"retentionDays"`
+}
+
+type BackupOptions struct {
+	// 是否定时备份数据库
+	Enabled bool `yaml:"enabled"`
+	// 备份文件的目录，建议设置为数据盘上的目录，相对路径基于数据目录
+	Dir string `yaml:"dir"`
+	// 备份的cron表达式
+	Schedule string `yaml:"schedule"`
+	// 按小时、天、周保留的备份数量
+	Hourly int `yaml:"hourly"`
+	Daily  int `yaml:"daily"`
+	Weekly int `yaml:"weekly"`
+}
+
+type LimitOptions struct {
+	// json请求体的大小上限，单位字节，上传文件不受限制
+	MaxBodyBytes int64 `yaml:"maxBodyBytes"`
+	// 按会话或客户端IP限流，key为限流分类: default、expensive、login，rate为0表示不限流
+	RateLimits map[string]ratelimit.Limit `yaml:"rateLimits"`
+}
+
+type SecurityOptions struct {
+	// 允许跨域访问接口的来源，例如 https://nas.example.com，同源请求不需要配置
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+	// 开发模式允许任意来源的跨域请求并且不检查CSRF token，只用于本地调试前端
+	DevMode bool `yaml:"devMode"`
+	// 可信的反向代理IP或网段，只有来自这些地址的请求才按 X-Forwarded-For 识别客户端IP
+	TrustedProxies []string `yaml:"trustedProxies"`
+}
+
+func NewOptions() *Options {
+	return &Options{
+		MigrateDownTo:      -1,
+		ListenAddress:      ":8088",
+		DataDir:            ".flute",
+		MountRoot:          "/mnt",
+		VictoriaMetricsURL: "http://127.0.0.1:8086",
+		Terminal: TerminalOptions{
+			Timeout:    600,
+			RecordPath: "/data/.kunlun-ssh-records",
+		},
+		TLS: TLSOptions{
+			Enabled: true,
+		},
+		Audit: AuditOptions{
+			RetentionDays: 180,
+		},
+		Backup: BackupOptions{
+			Enabled:  true,
+			Dir:      "backups",
+			Schedule: "@hourly",
+			Hourly:   24,
+			Daily:    7,
+			Weekly:   4,
+		},
+		Limits: LimitOptions{
+			MaxBodyBytes: 1 << 20,
+			RateLimits: map[string]ratelimit.Limit{
+				"default":   {Rate: 20, Burst: 50},
+				"expensive": {Rate: 1, Burst: 10},
+				"login":     {Rate: 0.5, Burst: 10},
+			},
+		},
+	}
+}
+
+// Load 依次加载配置文件、环境变量和命令行参数
+func Load(args []string) (*Options, error) {
+	o := NewOptions()
+
+	// 先解析一次命令行参数，获取配置文件路径以及显式设置过的参数
+	flags := NewOptions()
+	fs := flag.NewFlagSet("flute-nas", flag.ContinueOnError)
+	flags.AddFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.ShowVersion {
+		return flags, nil
+	}
+
+	configFile := flags.ConfigFile
+	if configFile == "" {
+		configFile = os.Getenv("FLUTE_CONFIG")
+	}
+	if configFile != "" {
+		if err := o.loadFile(configFile, true); err != nil {
+			return nil, err
+		}
+	} else if err := o.loadFile(DefaultConfigFile, false); err != nil {
+		return nil, err
+	}
+
+	if err := o.loadEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	// 只覆盖命令行中显式设置的参数
+	o.ConfigFile = configFile
+	fs.Visit(func(f *flag.Flag) {
+		o.applyFlag(flags, f.Name)
+	})
+
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.ConfigFile, "config", o.ConfigFile, "path of the yaml config file, env FLUTE_CONFIG")
+	fs.BoolVar(&o.ShowVersion, "version", o.ShowVersion, "print version information and exit")
+	fs.IntVar(&o.MigrateDownTo, "migrate-down-to", o.MigrateDownTo, "roll back database migrations to the given schema version and exit, run before downgrading flute-nas")
+	fs.StringVar(&o.ListenAddress, "listen-address", o.ListenAddress, "address of the http(s) server, env FLUTE_LISTEN_ADDRESS")
+	fs.StringVar(&o.DataDir, "data-dir", o.DataDir, "directory of the database, session key and certificates, env FLUTE_DATA_DIR")
+	fs.StringVar(&o.MountRoot, "mount-root", o.MountRoot, "root directory of disk mount points and shares, env FLUTE_MOUNT_ROOT")
+	fs.StringVar(&o.VictoriaMetricsURL, "victoria-metrics-url", o.VictoriaMetricsURL, "query url of VictoriaMetrics, env FLUTE_VICTORIA_METRICS_URL")
+	fs.IntVar(&o.Terminal.Timeout, "terminal-timeout", o.Terminal.Timeout, "timeout of web terminal connections in seconds, env FLUTE_TERMINAL_TIMEOUT")
+	fs.StringVar(&o.Terminal.RecordPath, "terminal-record-path", o.Terminal.RecordPath, "directory of web terminal records, env FLUTE_TERMINAL_RECORD_PATH")
+	fs.BoolVar(&o.TLS.Enabled, "tls", o.TLS.Enabled, "serve https, env FLUTE_TLS")
+	fs.StringVar(&o.TLS.RedirectAddress, "http-redirect-address", o.TLS.RedirectAddress, "address to redirect http requests to https, env FLUTE_HTTP_REDIRECT_ADDRESS")
+	fs.Int64Var(&o.Limits.MaxBodyBytes, "max-body-bytes", o.Limits.MaxBodyBytes, "maximum size of json request bodies in bytes, env FLUTE_MAX_BODY_BYTES")
+	fs.Var(stringList{&o.Security.AllowedOrigins}, "allowed-origins", "comma separated origins allowed to call the api cross origin, env FLUTE_ALLOWED_ORIGINS")
+	fs.BoolVar(&o.Security.DevMode, "dev-mode", o.Security.DevMode, "allow cross origin requests from any origin and skip csrf checks, for frontend development only, env FLUTE_DEV_MODE")
+	fs.Var(stringList{&o.Security.TrustedProxies}, "trusted-proxies", "comma separated IPs or CIDRs of reverse proxies whose X-Forwarded-For header is trusted, env FLUTE_TRUSTED_PROXIES")
+	fs.IntVar(&o.Audit.RetentionDays, "audit-retention-days", o.Audit.RetentionDays, "days to keep audit logs, env FLUTE_AUDIT_RETENTION_DAYS")
+	fs.BoolVar(&o.Backup.Enabled, "backup", o.Backup.Enabled, "back up the database periodically, env FLUTE_BACKUP")
+	fs.StringVar(&o.Backup.Dir, "backup-dir", o.Backup.Dir, "directory of database backups, relative to the data dir, env FLUTE_BACKUP_DIR")
+	fs.StringVar(&o.Backup.Schedule, "backup-schedule", o.Backup.Schedule, "cron schedule of database backups, env FLUTE_BACKUP_SCHEDULE")
+}
+
+// applyFlag 把命令行中设置的参数值复制到o
+func (o *Options) applyFlag(flags *Options, name string) {
+	switch name {
+	case "migrate-down-to":
+		o.MigrateDownTo = flags.MigrateDownTo
+	case "listen-address":
+		o.ListenAddress = flags.ListenAddress
+	case "data-dir":
+		o.DataDir = flags.DataDir
+	case "mount-root":
+		o.MountRoot = flags.MountRoot
+	case "victoria-metrics-url":
+		o.VictoriaMetricsURL = flags.VictoriaMetricsURL
+	case "terminal-timeout":
+		o.Terminal.Timeout = flags.Terminal.Timeout
+	case "terminal-record-path":
+		o.Terminal.RecordPath = flags.Terminal.RecordPath
+	case "tls":
+		o.TLS.Enabled = flags.TLS.Enabled
+	case "http-redirect-address":
+		o.TLS.RedirectAddress = flags.TLS.RedirectAddress
+	case "max-body-bytes":
+		o.Limits.MaxBodyBytes = flags.Limits.MaxBodyBytes
+	case "allowed-origins":
+		o.Security.AllowedOrigins = flags.Security.AllowedOrigins
+	case "dev-mode":
+		o.Security.DevMode = flags.Security.DevMode
+	case "trusted-proxies":
+		o.Security.TrustedProxies = flags.Security.TrustedProxies
+	case "audit-retention-days":
+		o.Audit.RetentionDays = flags.Audit.RetentionDays
+	case "backup":
+		o.Backup.Enabled = flags.Backup.Enabled
+	case "backup-dir":
+		o.Backup.Dir = flags.Backup.Dir
+	case "backup-schedule":
+		o.Backup.Schedule = flags.Backup.Schedule
+	}
+}
+
+// loadFile 加载yaml配置文件，required为false时文件不存在不报错
+func (o *Options) loadFile(path string, required bool) error {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		if !required && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read config file %s failed: %v", path, err)
+	}
+	if err := yaml.Unmarshal(bs, o); err != nil {
+		return fmt.Errorf("parse config file %s failed: %v", path, err)
+	}
+	return nil
+}
+
+// loadEnv 使用 FLUTE_ 前缀的环境变量覆盖配置
+func (o *Options) loadEnv(lookup func(string) (string, bool)) error {
+	strs := map[string]*string{
+		"FLUTE_LISTEN_ADDRESS":        &o.ListenAddress,
+		"FLUTE_DATA_DIR":              &o.DataDir,
+		"FLUTE_MOUNT_ROOT":            &o.MountRoot,
+		"FLUTE_VICTORIA_METRICS_URL":  &o.VictoriaMetricsURL,
+		"FLUTE_TERMINAL_RECORD_PATH":  &o.Terminal.RecordPath,
+		"FLUTE_HTTP_REDIRECT_ADDRESS": &o.TLS.RedirectAddress,
+		"FLUTE_BACKUP_DIR":            &o.Backup.Dir,
+		"FLUTE_BACKUP_SCHEDULE":       &o.Backup.Schedule,
+	}
+	for key, p := range strs {
+		if v, ok := lookup(key); ok && v != "" {
+			*p = v
+		}
+	}
+
+	if v, ok := lookup("FLUTE_TERMINAL_TIMEOUT"); ok && v != "" {
+		timeout, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid FLUTE_TERMINAL_TIMEOUT %q: %v", v, err)
+		}
+		o.Terminal.Timeout = timeout
+	}
+	if v, ok := lookup("FLUTE_MAX_BODY_BYTES"); ok && v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid FLUTE_MAX_BODY_BYTES %q: %v", v, err)
+		}
+		o.Limits.MaxBodyBytes = n
+	}
+	if v, ok := lookup("FLUTE_AUDIT_RETENTION_DAYS"); ok && v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid FLUTE_AUDIT_RETENTION_DAYS %q: %v", v, err)
+		}
+		o.Audit.RetentionDays = days
+	}
+	if v, ok := lookup("FLUTE_TLS"); ok && v != "" {
+		enabled, err := parseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid FLUTE_TLS %q: %v", v, err)
+		}
+		o.TLS.Enabled = enabled
+	}
+	if v, ok := lookup("FLUTE_BACKUP"); ok && v != "" {
+		enabled, err := parseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid FLUTE_BACKUP %q: %v", v, err)
+		}
+		o.Backup.Enabled = enabled
+	}
+	if v, ok := lookup("FLUTE_ALLOWED_ORIGINS"); ok && v != "" {
+		o.Security.AllowedOrigins = splitList(v)
+	}
+	if v, ok := lookup("FLUTE_TRUSTED_PROXIES"); ok && v != "" {
+		o.Security.TrustedProxies = splitList(v)
+	}
+	if v, ok := lookup("FLUTE_DEV_MODE"); ok && v != "" {
+		dev, err := parseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid FLUTE_DEV_MODE %q: %v", v, err)
+		}
+		o.Security.DevMode = dev
+	}
+	return nil
+}
+
+// parseBool 在 strconv.ParseBool 的基础上支持 on/off
+func parseBool(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+func (o *Options) Validate() error {
+	if o.MigrateDownTo < -1 {
+		return fmt.Errorf("invalid migrate down version %d", o.MigrateDownTo)
+	}
+	if o.ListenAddress == "" {
+		return errors.New("listen address is required")
+	}
+	if o.DataDir == "" {
+		return errors.New("data dir is required")
+	}
+	if o.MountRoot == "" || !filepath.IsAbs(o.MountRoot) {
+		return fmt.Errorf("mount root %q must be an absolute path", o.MountRoot)
+	}
+	o.MountRoot = filepath.Clean(o.MountRoot)
+	if o.Terminal.Timeout <= 0 {
+		return fmt.Errorf("terminal timeout %d must be positive", o.Terminal.Timeout)
+	}
+	if o.Terminal.RecordPath == "" {
+		return errors.New("terminal record path is required")
+	}
+	if o.Audit.RetentionDays <= 0 {
+		return fmt.Errorf("audit retention days %d must be positive", o.Audit.RetentionDays)
+	}
+	if o.Backup.Dir == "" {
+		return errors.New("backup dir is required")
+	}
+	if _, err := cron.ParseStandard(o.Backup.Schedule); err != nil {
+		return fmt.Errorf("invalid backup schedule %q: %v", o.Backup.Schedule, err)
+	}
+	if o.Backup.Hourly < 0 || o.Backup.Daily < 0 || o.Backup.Weekly < 0 {
+		return errors.New("backup retention counts must not be negative")
+	}
+	if o.Limits.MaxBodyBytes <= 0 {
+		return fmt.Errorf("max body bytes %d must be positive", o.Limits.MaxBodyBytes)
+	}
+	for _, origin := range o.Security.AllowedOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" {
+			return fmt.Errorf("allowed origin %q must be like https://host[:port]", origin)
+		}
+	}
+	if _, err := util.ParseNetworks(o.Security.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid trusted proxies: %v", err)
+	}
+	for class, limit := range o.Limits.RateLimits {
+		switch class {
+		case "default", "expensive", "login":
+		default:
+			return fmt.Errorf("unknown rate limit class %q", class)
+		}
+		if limit.Rate < 0 || limit.Burst < 0 {
+			return fmt.Errorf("rate limit of %s must not be negative", class)
+		}
+	}
+	return nil
+}
+
+// stringList 逗号分隔的命令行参数
+type stringList struct {
+	values *[]string
+}
+
+func (l stringList) String() string {
+	if l.values == nil {
+		return ""
+	}
+	return strings.Join(*l.values, ",")
+}
+
+func (l stringList) Set(v string) error {
+	*l.values = splitList(v)
+	return nil
+}
+
+func splitList(v string) []string {
+	items := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,102 @@
+package options
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yml")
+	content := `
+listenAddress: ":9000"
+mountRoot: /srv/nas
+terminal:
+  timeout: 300
+tls:
+  enabled: false
+backup:
+  dir: /data/backups
+  daily: 14
+limits:
+  rateLimits:
+    login: {rate: 1, burst: 5}
+`
+	if err := os.WriteFile(config, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FLUTE_MOUNT_ROOT", "/data/nas")
+	t.Setenv("FLUTE_TERMINAL_TIMEOUT", "120")
+	t.Setenv("FLUTE_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+
+	o, err := Load([]string{"--config", config, "--terminal-timeout", "60"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 配置文件覆盖默认值
+	if o.ListenAddress != ":9000" || o.TLS.Enabled {
+		t.Errorf("config file not applied: %+v", o)
+	}
+	// 环境变量覆盖配置文件
+	if o.MountRoot != "/data/nas" {
+		t.Errorf("MountRoot = %s, want /data/nas", o.MountRoot)
+	}
+	// 命令行参数覆盖环境变量
+	if o.Terminal.Timeout != 60 {
+		t.Errorf("Terminal.Timeout = %d, want 60", o.Terminal.Timeout)
+	}
+	// 未配置的项保持默认值
+	if o.Terminal.RecordPath != NewOptions().Terminal.RecordPath {
+		t.Errorf("Terminal.RecordPath = %s, want default", o.Terminal.RecordPath)
+	}
+	if len(o.Security.AllowedOrigins) != 2 || o.Security.AllowedOrigins[1] != "https://b.example.com" {
+		t.Errorf("AllowedOrigins = %v, want 2 origins from env", o.Security.AllowedOrigins)
+	}
+	if o.Backup.Dir != "/data/backups" || o.Backup.Daily != 14 || o.Backup.Hourly != NewOptions().Backup.Hourly {
+		t.Errorf("Backup = %+v, want dir and daily from config file", o.Backup)
+	}
+	// 限流配置只覆盖配置文件中的分类
+	if l := o.Limits.RateLimits["login"]; l.Rate != 1 || l.Burst != 5 {
+		t.Errorf("login rate limit = %+v, want {1 5}", l)
+	}
+	if l := o.Limits.RateLimits["default"]; l != NewOptions().Limits.RateLimits["default"] {
+		t.Errorf("default rate limit = %+v, want default", l)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	if _, err := Load([]string{"--config", filepath.Join(t.TempDir(), "missing.yml")}); err == nil {
+		t.Error("missing config file given by flag should fail")
+	}
+	if _, err := Load([]string{"--mount-root", "relative/path"}); err == nil {
+		t.Error("relative mount root should fail")
+	}
+	if _, err := Load([]string{"--max-body-bytes", "0"}); err == nil {
+		t.Error("zero max body bytes should fail")
+	}
+	if _, err := Load([]string{"--allowed-origins", "nas.example.com"}); err == nil {
+		t.Error("allowed origin without scheme should fail")
+	}
+	if _, err := Load([]string{"--trusted-proxies", "10.0.0.1,proxy.local"}); err == nil {
+		t.Error("trusted proxy that is not an ip or cidr should fail")
+	}
+	if _, err := Load([]string{"--backup-schedule", "every hour"}); err == nil {
+		t.Error("invalid backup schedule should fail")
+	}
+	t.Setenv("FLUTE_TLS", "maybe")
+	if _, err := Load(nil); err == nil {
+		t.Error("invalid FLUTE_TLS should fail")
+	}
+}
+
+func TestLoadVersion(t *testing.T) {
+	// 输出版本信息时不加载配置文件，配置错误也不影响
+	o, err := Load([]string{"--version", "--config", filepath.Join(t.TempDir(), "missing.yml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !o.ShowVersion {
+		t.Error("ShowVersion should be set by --version")
+	}
+}
@@ -8,6 +8,21 @@ import type {
 } from './model';
 import { formatSpeed } from '$lib/index';
 
+// 会话失效的返回码，见 pkg/module/retcode/code/auth.yml
+const retcodeSessionInvalid = 3006;
+
+// 只有会话失效或未登录时跳转到登录页，登录失败、二次验证过期等返回码由登录页自己处理
+function shouldRedirectToLogin(err: any): boolean {
+	if (!err.response || err.response.status !== 401) {
+		return false;
+	}
+	if (window.location.pathname.startsWith('/login')) {
+		return false;
+	}
+	const code = err.response.data ? err.response.data.code : undefined;
+	return code === undefined || code === retcodeSessionInvalid;
+}
+
 export class FluteAPI {
 	constructor() {}
 
@@ -24,7 +39,7 @@ export class FluteAPI {
 					}
 				})
 				.catch((err) => {
-					if (err.response && err.response.status === 401) {
+					if (shouldRedirectToLogin(err)) {
 						console.log('Unauthorized, nav to login page');
 						goto('/login');
 					}
@@ -46,7 +61,7 @@ export class FluteAPI {
 					}
 				})
 				.catch((err) => {
-					if (err.response && err.response.status === 401) {
+					if (shouldRedirectToLogin(err)) {
 						console.log('Unauthorized, nav to login page');
 						goto('/login');
 					}
@@ -99,12 +114,16 @@ export class FluteAPI {
 					}
 				})
 				.catch((err) => {
-					if (err.response && err.response.status === 401) {
-						// 使用严格相等
+					if (shouldRedirectToLogin(err)) {
 						console.log('Unauthorized, nav to login page');
 						// that.nav("/login")
 						goto('/login');
 					}
+					// 业务错误的HTTP状态码不是200，响应体中仍然有返回码
+					if (err.response && err.response.data && err.response.data.code !== undefined) {
+						reject(new Error('Error code: ' + err.response.data.code));
+						return;
+					}
 					reject(err); // 拒绝Promise以处理错误
 				});
 		});
@@ -145,6 +164,14 @@ export class FluteAPI {
 			let lastTime = Date.now();
 
 			xhr.open('POST', `/v1/files/upload?FilePath=${path}`, true);
+			// axios 会自动携带CSRF token，XMLHttpRequest 需要手动设置
+			const xsrfToken = document.cookie
+				.split('; ')
+				.find((c) => c.startsWith('XSRF-TOKEN='))
+				?.split('=')[1];
+			if (xsrfToken) {
+				xhr.setRequestHeader('X-XSRF-TOKEN', xsrfToken);
+			}
 
 			xhr.upload.onprogress = function (event: any) {
 				if (!startTime) {
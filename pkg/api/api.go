@@ -2,12 +2,19 @@ package api
 
 import (
 	v1 "flutelake/fluteNAS/pkg/api/v1"
+	"flutelake/fluteNAS/pkg/controller"
 	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/backup"
 	"flutelake/fluteNAS/pkg/module/cache"
+	"flutelake/fluteNAS/pkg/module/certs"
+	"flutelake/fluteNAS/pkg/module/event"
+	"flutelake/fluteNAS/pkg/module/flog"
 	"flutelake/fluteNAS/pkg/module/metricsvm"
+	"flutelake/fluteNAS/pkg/module/retcode"
 	"flutelake/fluteNAS/pkg/server/apiserver"
 	"flutelake/fluteNAS/pkg/server/terminal"
 	"flutelake/fluteNAS/pkg/util"
+	"flutelake/fluteNAS/pkg/version"
 	"fmt"
 )
 
@@ -17,80 +24,186 @@ func RegisterHandlersV1(
 	publicKey *util.LinkedRune,
 	c cache.TinyCache,
 	terms *terminal.WebTerminal,
+	sessionKey []byte,
+	certManager *certs.Manager,
+	mountRoot string,
+	victoriaMetricsURL string,
+	dataPath string,
+	dbBackups *backup.Database,
+	cron *controller.CronJob,
 ) {
 	const prefix string = "/v1"
 
 	authApi := v1.NewAuthApi(privateKey, publicKey, c)
 	termApi := v1.NewTerminalAPI(terms)
 	wallpaperApi := v1.NewWallpapaerAPI(c)
+	tokenApi := v1.NewTokenAPI()
+
+	sessionApi := v1.NewSessionAPI(c, sessionKey)
+	systemApi := v1.NewSystemAPI(certManager, c, dataPath, dbBackups)
+	auditApi := v1.NewAuditAPI()
+	preferenceApi := v1.NewPreferenceAPI()
+
+	// Authorization: Bearer 认证需要在注册路由之前设置
+	as.SetTokenAuthenticator(tokenApi)
+	// 会话持久化同样需要在注册路由之前设置
+	as.SetSessionStore(sessionApi)
+	// 设置了 Audit 的路由调用后写入审计日志
+	as.SetAuditRecorder(auditApi)
+	// 接口返回的错误信息优先使用用户设置的语言
+	as.SetLocalePreference(preferenceApi)
+	if err := preferenceApi.Load(); err != nil {
+		flog.Errorf("load user preferences failed: %v", err)
+	}
+	if err := sessionApi.Restore(); err != nil {
+		flog.Errorf("restore sessions failed: %v", err)
+	}
 
 	// check login status api
-	as.Register(as.NewRoute().Prefix(prefix).Path("/hello").Handler(HelloFluteNAS))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/hello").Handler(HelloFluteNAS).In(model.HelloRequest{}).Out(model.HelloResponse{}))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/version").Handler(v1.GetVersion).Out(version.Info{}).AllowAnonymous(true))
 	as.HandleFunc("/metrics", metricsvm.Handler)
+	as.HandleFunc(prefix+"/openapi.json", as.ServeOpenAPI)
+
+	// 事件推送，websocket 和 SSE 两种方式，服务停止时关闭所有订阅
+	eventApi := v1.NewEventAPI(as)
+	as.HandleFunc("/ws/v1/events", eventApi.WebSocketHandler)
+	as.HandleFunc(prefix+"/events", eventApi.ServeSSE)
+	as.RegisterOnShutdown(event.Close)
+	// scopes在数据库中以JSON数组保存，接口返回数组
+	as.SetSchema(model.TokenScopeString(""), &apiserver.Schema{Type: "array", Items: &apiserver.Schema{Type: "string"}})
+	// 状态条件在数据库中以JSON保存，接口返回数组
+	as.SetSchema(model.ConditionsString(""), &apiserver.Schema{Type: "array", Items: &apiserver.Schema{
+		Type: "object",
+		Properties: map[string]*apiserver.Schema{
+			"Type":               {Type: "string"},
+			"Status":             {Type: "string", Enum: []any{model.ConditionTrue, model.ConditionFalse, model.ConditionUnknown}},
+			"Reason":             {Type: "string"},
+			"Message":            {Type: "string"},
+			"LastTransitionTime": {Type: "string", Format: "date-time"},
+			"ObservedGeneration": {Type: "integer", Format: "int64"},
+		},
+	}})
 	// =================================== public apis ===================================== //
-	as.Register(as.NewRoute().Prefix(prefix).Path("/login").Handler(authApi.Login).AllowAnonymous(true))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/key").Handler(authApi.GetKey).AllowAnonymous(true))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/wallpaper").Handler(wallpaperApi.GetWallpaper).AllowAnonymous(true))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/login").Handler(authApi.Login).In(model.LoginRequest{}).Out(model.LoginResponse{}).AllowAnonymous(true).Audit().RateLimit(apiserver.RateClassLogin))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/login/mfa").Handler(authApi.LoginMFA).In(model.MFALoginRequest{}).Out(model.LoginResponse{}).AllowAnonymous(true).Audit().RateLimit(apiserver.RateClassLogin))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/key").Handler(authApi.GetKey).Out(model.KeyResponse{}).AllowAnonymous(true).RateLimit(apiserver.RateClassLogin))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/wallpaper").Handler(wallpaperApi.GetWallpaper).Out(v1.WallpaperResponse{}).AllowAnonymous(true))
 
 	//==================================== private apis ==================================== //
-	as.Register(as.NewRoute().Prefix(prefix).Path("/logout").Handler(authApi.Logout))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/logout").Handler(authApi.Logout).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/user/info").Handler(authApi.UserInfo).Out(model.UserInfoResponse{}))
+
+	// preferences
+	as.Register(as.NewRoute().Prefix(prefix).Path("/preference/get").Handler(preferenceApi.GetPreference).Out(model.GetUserPreferenceResponse{}))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/preference/set").Handler(preferenceApi.SetPreference).In(model.SetUserPreferenceRequest{}).Out(model.SetUserPreferenceResponse{}).Audit())
+
+	// sessions
+	as.Register(as.NewRoute().Prefix(prefix).Path("/session/list").Handler(sessionApi.ListSessions).In(model.ListSessionsRequest{}).Out(model.ListSessionsResponse{}))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/session/revoke").Handler(sessionApi.RevokeSession).In(model.RevokeSessionRequest{}).Out(model.RevokeSessionResponse{}).Audit())
+
+	// two-factor authentication
+	as.Register(as.NewRoute().Prefix(prefix).Path("/mfa/status").Handler(authApi.MFAStatus).Out(model.MFAStatusResponse{}))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/mfa/enroll").Handler(authApi.MFAEnroll).Out(model.MFAEnrollResponse{}).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/mfa/activate").Handler(authApi.MFAActivate).In(model.MFACodeRequest{}).Out(model.MFARecoveryCodesResponse{}).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/mfa/disable").Handler(authApi.MFADisable).In(model.MFACodeRequest{}).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/mfa/recovery-codes").Handler(authApi.MFARegenerateRecoveryCodes).In(model.MFACodeRequest{}).Out(model.MFARecoveryCodesResponse{}).Audit())
+
+	// login lockouts
+	as.Register(as.NewRoute().Prefix(prefix).Path("/login-lockout/list").Handler(authApi.ListLoginLockouts).Out(model.ListLoginLockoutsResponse{}).Permission(model.PermissionUserManage))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/login-lockout/clear").Handler(authApi.ClearLoginLockout).In(model.ClearLoginLockoutRequest{}).Out(model.ClearLoginLockoutResponse{}).Permission(model.PermissionUserManage).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/login-attempt/list").Handler(authApi.ListLoginAttempts).In(model.ListLoginAttemptsRequest{}).Out(model.ListLoginAttemptsResponse{}).Permission(model.PermissionUserManage))
+
+	// api tokens
+	as.Register(as.NewRoute().Prefix(prefix).Path("/token/create").Handler(tokenApi.CreateToken).In(model.CreateAPITokenRequest{}).Out(model.CreateAPITokenResponse{}).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/token/list").Handler(tokenApi.ListTokens).In(model.ListAPITokensRequest{}).Out(model.ListAPITokensResponse{}))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/token/revoke").Handler(tokenApi.RevokeToken).In(model.RevokeAPITokenRequest{}).Out(model.RevokeAPITokenResponse{}).Audit())
+
+	// user roles
+	userRoleServer := v1.UserRoleServer{}
+	as.Register(as.NewRoute().Prefix(prefix).Path("/user-role/list").Handler(userRoleServer.ListUserRoles).Out(model.ListUserRolesResponse{}).Permission(model.PermissionUserManage))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/user-role/set").Handler(userRoleServer.SetUserRole).In(model.SetUserRoleRequest{}).Out(model.SetUserRoleResponse{}).Permission(model.PermissionUserManage).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/user-role/delete").Handler(userRoleServer.DeleteUserRole).In(model.DeleteUserRoleRequest{}).Out(model.DeleteUserRoleResponse{}).Permission(model.PermissionUserManage).Audit())
+
+	// system settings
+	as.Register(as.NewRoute().Prefix(prefix).Path("/system/tls/info").Handler(systemApi.TLSInfo).Out(model.TLSInfoResponse{}).Permission(model.PermissionSystemManage))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/system/tls/upload").Handler(systemApi.UploadTLSCertificate).In(model.UploadTLSCertificateRequest{}).Out(model.UploadTLSCertificateResponse{}).Permission(model.PermissionSystemManage).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/system/config/export").Handler(systemApi.ExportConfig).In(model.ExportConfigRequest{}).Out(model.ExportConfigResponse{}).Permission(model.PermissionSystemManage).Audit().RateLimit(apiserver.RateClassExpensive))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/system/config/import").Handler(systemApi.ImportConfig).Consumes("multipart/form-data").Query("DryRun", "为true时只返回差异，不修改配置").Query("Categories", "恢复的分类，逗号分隔，默认全部").Out(model.ImportConfigResponse{}).Permission(model.PermissionSystemManage).Audit().MaxBodyBytes(v1.MaxConfigArchiveBytes))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/system/backup/list").Handler(systemApi.ListDatabaseBackups).In(model.ListDatabaseBackupsRequest{}).Out(model.ListDatabaseBackupsResponse{}).Permission(model.PermissionSystemManage).RateLimit(apiserver.RateClassExpensive))
+	// 下载地址中的token只能使用一次
+	as.HandleFunc(prefix+"/system/config/download", systemApi.DownloadConfig)
+
+	// controller jobs
+	jobApi := v1.NewJobAPI(cron)
+	as.Register(as.NewRoute().Prefix(prefix).Path("/jobs/list").Handler(jobApi.ListJobs).In(model.ListJobsRequest{}).Out(model.ListJobsResponse{}).Permission(model.PermissionSystemManage))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/jobs/reconcilers").Handler(jobApi.ListReconcilers).In(model.ListReconcilersRequest{}).Out(model.ListReconcilersResponse{}).Permission(model.PermissionSystemManage))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/jobs/run").Handler(jobApi.RunJob).In(model.JobNameRequest{}).Out(model.JobResponse{}).Permission(model.PermissionSystemManage).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/jobs/pause").Handler(jobApi.PauseJob).In(model.JobNameRequest{}).Out(model.JobResponse{}).Permission(model.PermissionSystemManage).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/jobs/resume").Handler(jobApi.ResumeJob).In(model.JobNameRequest{}).Out(model.JobResponse{}).Permission(model.PermissionSystemManage).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/jobs/schedule").Handler(jobApi.SetJobSchedule).In(model.SetJobScheduleRequest{}).Out(model.JobResponse{}).Permission(model.PermissionSystemManage).Audit())
+
+	// audit logs
+	as.Register(as.NewRoute().Prefix(prefix).Path("/audit/list").Handler(auditApi.ListAuditLogs).In(model.ListAuditLogsRequest{}).Out(model.ListAuditLogsResponse{}).Permission(model.PermissionAuditRead))
 
 	// web terminal
-	as.Register(as.NewRoute().Prefix(prefix).Path("/terminal").Handler(termApi.CreateTerminal))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/terminal").Handler(termApi.CreateTerminal).In(model.CreateTerminalRequest{}).Out(model.CreateTerminalResponse{}).Permission(model.PermissionTerminal).Audit())
 
 	// file download server
-	fserver := v1.NewFileServer(c, "/mnt")
+	fserver := v1.NewFileServer(c, mountRoot)
 	as.HandleFunc("/files/download", fserver.ServerHttp)
-	as.Register(as.NewRoute().Prefix(prefix).Path("/files/listdir").Handler(v1.ListDir))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/files/readdir").Handler(v1.ReadDir))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/files/createdir").Handler(v1.CreateDir))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/files/remove").Handler(v1.RemoveFile))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/files/upload").Handler(v1.UploadFiles))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/files/download").Handler(fserver.DownloadFiles))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/files/listdir").Handler(fserver.ListDir).In(model.ListDirRequest{}).Out(model.ListDirResponse{}).Permission(model.PermissionFileRead))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/files/readdir").Handler(fserver.ReadDir).In(model.ReadDirRequest{}).Out(model.ReadDirResponse{}).Permission(model.PermissionFileRead))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/files/createdir").Handler(fserver.CreateDir).In(model.CreateDirRequest{}).Out(model.CreateDirResponse{}).Permission(model.PermissionFileWrite).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/files/remove").Handler(fserver.RemoveFile).In(model.RemoveFileRequest{}).Out(model.RemoveFileResponse{}).Permission(model.PermissionFileWrite).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/files/upload").Handler(fserver.UploadFiles).Consumes("multipart/form-data").Query("FilePath", "上传到的目录").Out(model.UploadFilesResponse{}).Permission(model.PermissionFileWrite).Audit().MaxBodyBytes(apiserver.NoBodyLimit))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/files/download").Handler(fserver.DownloadFiles).In(model.DownloadFilesRequest{}).Out(model.DownloadFilesResponse{}).Permission(model.PermissionFileRead))
 
 	// disk device
-	as.Register(as.NewRoute().Prefix(prefix).Path("/disk/list").Handler(v1.ListDiskDevices))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/disk/set-mountpoint").Handler(v1.SetMountPoint))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/disk/mkfs").Handler(v1.MkfsDisk))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/disk/mkfs-fstypes").Handler(v1.ListSupportedMkfsFilesystems))
+	diskServer := v1.NewDiskServer(mountRoot)
+	as.Register(as.NewRoute().Prefix(prefix).Path("/disk/list").Handler(diskServer.ListDiskDevices).In(model.ListDiskDevicesRequest{}).Out(model.ListDiskDevicesResponse{}).Permission(model.PermissionDiskRead).RateLimit(apiserver.RateClassExpensive))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/disk/set-mountpoint").Handler(diskServer.SetMountPoint).In(model.SetMountPointRequest{}).Out(model.SetMountPointResponse{}).Permission(model.PermissionDiskWrite).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/disk/mkfs").Handler(diskServer.MkfsDisk).In(model.MkfsDiskRequest{}).Out(model.MkfsDiskResponse{}).Permission(model.PermissionDiskWrite).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/disk/mkfs-fstypes").Handler(diskServer.ListSupportedMkfsFilesystems).In(model.ListSupportedMkfsFilesystemsRequest{}).Out(model.ListSupportedMkfsFilesystemsResponse{}).Permission(model.PermissionDiskRead).RateLimit(apiserver.RateClassExpensive))
 
 	// samba users
 	sambaUserServer := v1.SambaUserServer{}
-	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-user/create").Handler(sambaUserServer.CreateUser))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-user/list").Handler(sambaUserServer.ListUsers))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-user/update").Handler(sambaUserServer.UpdateUser))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-user/delete").Handler(sambaUserServer.DeleteUser))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-user/create").Handler(sambaUserServer.CreateUser).In(model.SambaUser{}).Out(model.CreateSambaUserResponse{}).Permission(model.PermissionShareWrite).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-user/list").Handler(sambaUserServer.ListUsers).Out(model.ListSambaUsersResponse{}).Permission(model.PermissionShareRead))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-user/update").Handler(sambaUserServer.UpdateUser).In(model.UpdateSambaUserRequest{}).Out(model.UpdateSambaUserResponse{}).Permission(model.PermissionShareWrite).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-user/delete").Handler(sambaUserServer.DeleteUser).In(model.DeleteSambaUserRequest{}).Out(model.DeleteSambaUserResponse{}).Permission(model.PermissionShareWrite).Audit())
 
 	// samba shares
 	sambaShareServer := v1.SambaShareServer{}
-	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-share/create").Handler(sambaShareServer.CreateShare))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-share/list").Handler(sambaShareServer.ListShares))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-share/update").Handler(sambaShareServer.UpdateShare))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-share/delete").Handler(sambaShareServer.DeleteShare))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-share/status").Handler(sambaShareServer.SambaStatus))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-share/create").Handler(sambaShareServer.CreateShare).In(v1.CreateSambaShareRequest{}).Out(v1.CreateSambaShareResponse{}).Permission(model.PermissionShareWrite).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-share/list").Handler(sambaShareServer.ListShares).Out(v1.ListSambaSharesResponse{}).Permission(model.PermissionShareRead))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-share/update").Handler(sambaShareServer.UpdateShare).In(v1.UpdateSambaShareRequest{}).Out(v1.UpdateSambaShareResponse{}).Permission(model.PermissionShareWrite).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-share/delete").Handler(sambaShareServer.DeleteShare).In(v1.DeleteSambaShareRequest{}).Out(v1.DeleteSambaShareResponse{}).Permission(model.PermissionShareWrite).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/samba-share/status").Handler(sambaShareServer.SambaStatus).In(v1.SambaStatusRequest{}).Out(v1.SambaStatusResponse{}).Permission(model.PermissionShareRead).RateLimit(apiserver.RateClassExpensive))
 
 	// nfs shares
 	nfsShareServer := v1.NFSShareServer{}
-	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-share/create").Handler(nfsShareServer.CreateNFSExport))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-share/list").Handler(nfsShareServer.ListNFSExports))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-share/update").Handler(nfsShareServer.UpdateNFSExport))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-share/delete").Handler(nfsShareServer.DeleteNFSExport))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-share/status").Handler(nfsShareServer.NFSStatus))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-share/create").Handler(nfsShareServer.CreateNFSExport).In(model.NFSExport{}).Out(v1.NFSExportResponse{}).Permission(model.PermissionShareWrite).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-share/list").Handler(nfsShareServer.ListNFSExports).In(v1.NFSExportRequest{}).Out(v1.NFSExportsResponse{}).Permission(model.PermissionShareRead))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-share/update").Handler(nfsShareServer.UpdateNFSExport).In(v1.UpdateNFSExportRequest{}).Out(v1.NFSExportResponse{}).Permission(model.PermissionShareWrite).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-share/delete").Handler(nfsShareServer.DeleteNFSExport).In(v1.DeleteNFSExportRequest{}).Out(map[string]string{}).Permission(model.PermissionShareWrite).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-share/status").Handler(nfsShareServer.NFSStatus).In(v1.NFSStatusRequest{}).Out(v1.NFSStatusResponse{}).Permission(model.PermissionShareRead).RateLimit(apiserver.RateClassExpensive))
 	// nfs server control
-	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-server/start").Handler(nfsShareServer.StartNFSServer))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-server/stop").Handler(nfsShareServer.StopNFSServer))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-server/status").Handler(nfsShareServer.GetNFSServerStatus))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-server/validate").Handler(nfsShareServer.ValidateNFSConfig))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-server/start").Handler(nfsShareServer.StartNFSServer).In(v1.StartNFSServerRequest{}).Out(v1.StartNFSServerResponse{}).Permission(model.PermissionShareWrite).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-server/stop").Handler(nfsShareServer.StopNFSServer).In(v1.StopNFSServerRequest{}).Out(v1.StopNFSServerResponse{}).Permission(model.PermissionShareWrite).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-server/status").Handler(nfsShareServer.GetNFSServerStatus).In(v1.GetNFSServerStatusRequest{}).Out(v1.GetNFSServerStatusResponse{}).Permission(model.PermissionShareRead).RateLimit(apiserver.RateClassExpensive))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-server/validate").Handler(nfsShareServer.ValidateNFSConfig).In(v1.ValidateNFSConfigRequest{}).Out(v1.ValidateNFSConfigResponse{}).Permission(model.PermissionShareRead).RateLimit(apiserver.RateClassExpensive))
 	// nfs export status control
-	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-export/update-status").Handler(nfsShareServer.UpdateExportStatus))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-export/test-config").Handler(nfsShareServer.TestExportConfig))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-export/update-status").Handler(nfsShareServer.UpdateExportStatus).In(v1.UpdateExportStatusRequest{}).Out(v1.UpdateExportStatusResponse{}).Permission(model.PermissionShareWrite).Audit())
+	as.Register(as.NewRoute().Prefix(prefix).Path("/nfs-export/test-config").Handler(nfsShareServer.TestExportConfig).In(v1.TestExportConfigRequest{}).Out(v1.TestExportConfigResponse{}).Permission(model.PermissionShareWrite).Audit().RateLimit(apiserver.RateClassExpensive))
 
 	// hosts
-	as.Register(as.NewRoute().Prefix(prefix).Path("/host/list").Handler(v1.ListHosts))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/host/system-info").Handler(v1.GetHostSystemInfo))
-	as.Register(as.NewRoute().Prefix(prefix).Path("/host/monitoring").Handler(v1.GetHostMonitoringMetrics))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/host/list").Handler(v1.ListHosts).Out(model.ListHostsResponse{}).Permission(model.PermissionHostRead))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/host/system-info").Handler(v1.GetHostSystemInfo).Query("HostIP", "节点IP，默认127.0.0.1").Out(v1.HostSystemInfoResponse{}).Permission(model.PermissionHostRead).RateLimit(apiserver.RateClassExpensive))
+	as.Register(as.NewRoute().Prefix(prefix).Path("/host/monitoring").Handler(v1.GetHostMonitoringMetrics).Query("HostIP", "节点IP，默认127.0.0.1").Out(v1.HostMonitoringResponse{}).Permission(model.PermissionHostRead).RateLimit(apiserver.RateClassExpensive))
 
-	as.Register(as.NewRoute().Prefix(prefix).Path("/metrics/query_range").Handler(v1.QueryVictoriaMetricsRange))
+	metricsServer := v1.NewMetricsServer(victoriaMetricsURL)
+	as.Register(as.NewRoute().Prefix(prefix).Path("/metrics/query_range").Handler(metricsServer.QueryVictoriaMetricsRange).In(v1.VictoriaQueryRangeRequest{}).Permission(model.PermissionHostRead))
 }
 
 func HelloFluteNAS(w *apiserver.Response, r *apiserver.Request) {
@@ -104,7 +217,13 @@ func HelloFluteNAS(w *apiserver.Response, r *apiserver.Request) {
 	param := &model.HelloRequest{}
 	err := r.Unmarshal(param)
 	if err != nil {
-		w.WriteError(err, nil)
+		w.WriteParamError(err)
+		return
 	}
-	w.Write([]byte(fmt.Sprintf("Welcome to fluteNAS, %s", param.F1)))
+	info := version.Get()
+	w.Write(retcode.StatusOK(model.HelloResponse{
+		Message:   fmt.Sprintf("Welcome to fluteNAS, %s", param.F1),
+		Version:   info.Version,
+		GitCommit: info.GitCommit,
+	}))
 }
@@ -0,0 +1,93 @@
+package v1
+
+import (
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"flutelake/fluteNAS/pkg/server/apiserver"
+	"strings"
+)
+
+type AuditAPI struct{}
+
+func NewAuditAPI() *AuditAPI {
+	return &AuditAPI{}
+}
+
+// Record 实现 apiserver.AuditRecorder
+func (a *AuditAPI) Record(entry *apiserver.AuditEntry) error {
+	log := model.AuditLog{
+		CreatedAt:  entry.Time,
+		ClientIP:   entry.ClientIP,
+		UserAgent:  entry.UserAgent,
+		Route:      entry.Route,
+		Query:      entry.Query,
+		Body:       entry.Body,
+		HTTPStatus: entry.HTTPStatus,
+		Code:       entry.Code,
+		DurationMs: entry.Duration.Milliseconds(),
+	}
+	if entry.Session != nil {
+		if userinfo, ok := entry.Session.UserInfo.(model.SessionUserInfo); ok {
+			log.Username = userinfo.Username
+			log.TokenID = userinfo.TokenID
+		}
+	}
+	return db.Instance().Create(&log).Error
+}
+
+// ListAuditLogs 分页查询审计日志，按时间倒序
+func (a *AuditAPI) ListAuditLogs(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.ListAuditLogsRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+	if in.Page == 0 {
+		in.Page = 1
+	}
+	if in.PageSize == 0 {
+		in.PageSize = 50
+	}
+
+	query := db.Instance().Model(&model.AuditLog{})
+	if in.Username != "" {
+		query = query.Where("username = ?", in.Username)
+	}
+	if in.ClientIP != "" {
+		query = query.Where("client_ip = ?", in.ClientIP)
+	}
+	if in.Route != "" {
+		query = query.Where("route LIKE ? ESCAPE '\\'", escapeLike(in.Route)+"%")
+	}
+	if in.FailedOnly {
+		query = query.Where("(code <> 0 OR http_status >= 400)")
+	}
+	if in.Since != nil {
+		query = query.Where("created_at >= ?", *in.Since)
+	}
+	if in.Until != nil {
+		query = query.Where("created_at < ?", *in.Until)
+	}
+
+	out := model.ListAuditLogsResponse{
+		Page:     in.Page,
+		PageSize: in.PageSize,
+		Logs:     []model.AuditLog{},
+	}
+	if err := query.Count(&out.Total).Error; err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+	err := query.Order("id desc").Offset((in.Page - 1) * in.PageSize).Limit(in.PageSize).Find(&out.Logs).Error
+	if err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+// escapeLike 转义 LIKE 中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -3,8 +3,12 @@ package v1
 import (
 	"bufio"
 	"encoding/base64"
+	"errors"
 	"flutelake/fluteNAS/pkg/model"
 	"flutelake/fluteNAS/pkg/module/cache"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/node"
 	"flutelake/fluteNAS/pkg/module/retcode"
 	"flutelake/fluteNAS/pkg/server/apiserver"
 	"flutelake/fluteNAS/pkg/util"
@@ -12,14 +16,17 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
 )
 
 type AuthApi struct {
 	publicKey  *util.LinkedRune
 	privateKey *util.LinkedRune
 	cache      cache.TinyCache
+	guard      *loginGuard
 }
 
 func NewAuthApi(privateKey *util.LinkedRune, publicKey *util.LinkedRune, c cache.TinyCache) *AuthApi {
@@ -27,18 +34,27 @@ func NewAuthApi(privateKey *util.LinkedRune, publicKey *util.LinkedRune, c cache
 		publicKey:  publicKey,
 		privateKey: privateKey,
 		cache:      c,
+		guard:      newLoginGuard(),
 	}
 }
 
 func (a *AuthApi) Login(w *apiserver.Response, r *apiserver.Request) {
 	in := model.LoginRequest{}
 	if err := r.Unmarshal(&in); err != nil {
-		w.Write(retcode.StatusError)
+		w.WriteParamError(err)
 		return
 	}
+	in.Username = strings.TrimSpace(in.Username)
+
+	// 锁定期间直接拒绝，不再尝试ssh登录
+	if a.checkLoginLocked(w, r, in.Username) {
+		return
+	}
+
 	pwdBs, err := base64.StdEncoding.DecodeString(in.Password)
 	if err != nil {
-		w.Write(retcode.StatusError)
+		a.loginFailed(r, in.Username, model.LoginFailedInvalid)
+		w.WriteError(err, retcode.StatusParamInvalid(nil).WithArgs("Password"))
 		return
 	}
 	// flog.Infof(string(pwdBs))
@@ -50,7 +66,8 @@ func (a *AuthApi) Login(w *apiserver.Response, r *apiserver.Request) {
 	// flog.Infof(string(testbs))
 	pwd, err := util.RSADecrypt(a.privateKey.String(), pwdBs)
 	if err != nil {
-		w.Write(retcode.StatusError)
+		a.loginFailed(r, in.Username, model.LoginFailedInvalid)
+		w.WriteError(err, retcode.StatusParamInvalid(nil).WithArgs("Password"))
 		return
 	}
 
@@ -60,28 +77,68 @@ func (a *AuthApi) Login(w *apiserver.Response, r *apiserver.Request) {
 			ssh.Password(pwd),
 		},
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         time.Second * 10,
 	}
 
 	port, err := getSshPort()
 	if err != nil {
-		w.WriteError(err, nil)
+		w.WriteError(err, retcode.StatusSSHConfigFailed(nil))
 		return
 	}
 
 	address := fmt.Sprintf("%s:%d", "127.0.0.1", port)
 	client, err := ssh.Dial("tcp", address, config)
 	if err != nil {
-		w.WriteError(err, nil)
+		// 只有认证失败才计入失败次数，sshd不可用等错误不应导致锁定
+		if isSSHAuthError(err) {
+			a.loginFailed(r, in.Username, model.LoginFailedPassword)
+			w.WriteError(err, retcode.StatusLoginFailed(nil))
+			return
+		}
+		w.WriteError(err, retcode.StatusError(nil))
 		return
 	}
 	defer client.Close()
 
-	// set cookie
-	w.SetCookie(model.SessionUserInfo{
+	role, err := resolveUserRole(in.Username)
+	if err != nil {
+		w.WriteError(err, nil)
+		return
+	}
+
+	userinfo := model.SessionUserInfo{
 		Username: in.Username,
 		Password: util.NewLinkedRune(pwd),
-		IsAdmin:  true,
-	})
+		IsAdmin:  role == model.RoleAdmin,
+		Role:     role,
+	}
+
+	// 开启了二次验证的用户，需要验证TOTP后才下发会话
+	totp, err := getEnabledTOTP(in.Username)
+	if err != nil {
+		w.WriteError(err, nil)
+		return
+	}
+	if totp != nil {
+		token, err := a.beginMFALogin(userinfo)
+		if err != nil {
+			w.WriteError(err, retcode.StatusError(nil))
+			return
+		}
+		out := model.LoginResponse{
+			MFARequired: true,
+			MFAToken:    token,
+		}
+		w.Write(retcode.StatusOK(out))
+		return
+	}
+
+	a.loginSucceeded(in.Username)
+	// set cookie
+	if err := w.SetCookie(userinfo); err != nil {
+		w.WriteError(err, retcode.StatusError(nil))
+		return
+	}
 	out := model.LoginResponse{}
 	w.Write(retcode.StatusOK(out))
 }
@@ -89,7 +146,9 @@ func (a *AuthApi) Login(w *apiserver.Response, r *apiserver.Request) {
 func (a *AuthApi) Logout(w *apiserver.Response, r *apiserver.Request) {
 	cookie, _ := r.GetCookie()
 	if cookie != nil {
-		a.cache.Delete(apiserver.GenSessionCacheID(cookie.Value))
+		if err := revokeSession(a.cache, apiserver.SessionHash(cookie.Value)); err != nil {
+			flog.Errorf("delete session failed: %v", err)
+		}
 	}
 	w.NullCookie()
 	w.Write(retcode.StatusOK(nil))
@@ -104,6 +163,43 @@ func (a *AuthApi) GetKey(w *apiserver.Response, r *apiserver.Request) {
 	w.Write(retcode.StatusOK(out))
 }
 
+// UserInfo 获取当前登录用户的角色和权限
+func (a *AuthApi) UserInfo(w *apiserver.Response, r *apiserver.Request) {
+	userinfo, ok := r.Session.UserInfo.(model.SessionUserInfo)
+	if !ok {
+		w.WriteError(errors.New("format session error"), retcode.StatusSessionInvalid(nil))
+		return
+	}
+	out := model.UserInfoResponse{
+		Username:    userinfo.Username,
+		Role:        userinfo.Role,
+		IsAdmin:     userinfo.IsAdmin,
+		Permissions: model.RolePermissions(userinfo.Role),
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+// resolveUserRole 获取用户角色，未分配角色时本机管理员默认为admin，其他用户默认为只读
+func resolveUserRole(username string) (string, error) {
+	role, err := model.GetUserRole(db.Instance(), username)
+	if err == nil {
+		return role, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		flog.Errorf("query role of user %s failed: %v", username, err)
+		return "", retcode.Wrap(err, retcode.StatusDatabaseError(nil))
+	}
+	if node.IsLocalAdminUser(username) {
+		return model.RoleAdmin, nil
+	}
+	return model.RoleReadOnly, nil
+}
+
+// isSSHAuthError 判断ssh连接失败是否由用户名或密码错误导致
+func isSSHAuthError(err error) bool {
+	return strings.Contains(err.Error(), "unable to authenticate")
+}
+
 func getSshPort() (int, error) {
 	file, err := os.Open("/etc/ssh/sshd_config")
 	if err != nil {
@@ -17,12 +17,20 @@ func GetHostInfo(w *apiserver.Response, hostIP string) (*model.Host, error) {
 	err := db.Instance().First(&host, "host_ip = ?", hostIP).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			w.WriteError(err, retcode.StatusParamInvalid("HostID"))
+			w.WriteError(err, retcode.StatusHostNotFound(nil).WithArgs(hostIP))
 		} else {
 			flog.Errorf("Error query localhost: %v", err)
-			w.WriteError(err, retcode.StatusError(nil))
+			w.WriteError(err, retcode.StatusDatabaseError(nil))
 		}
 		return nil, err
 	}
 	return &host, nil
 }
+
+// dbRetCode 数据库查询错误对应的返回码，记录不存在时返回 notFound
+func dbRetCode(err error, notFound *retcode.RetCode) *retcode.RetCode {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return notFound
+	}
+	return retcode.StatusDatabaseError(nil)
+}
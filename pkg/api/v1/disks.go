@@ -1,9 +1,12 @@
 package v1
 
 import (
+	"context"
 	"errors"
+	"flutelake/fluteNAS/pkg/controller"
 	"flutelake/fluteNAS/pkg/model"
 	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/event"
 	"flutelake/fluteNAS/pkg/module/flog"
 	"flutelake/fluteNAS/pkg/module/node"
 	"flutelake/fluteNAS/pkg/module/retcode"
@@ -12,35 +15,49 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+
+	"gorm.io/gorm"
 )
 
-func ListDiskDevices(w *apiserver.Response, r *apiserver.Request) {
+type DiskServer struct {
+	// 磁盘挂载点的根目录，接口中的路径都是相对该目录的路径
+	mountRoot string
+}
+
+func NewDiskServer(mountRoot string) *DiskServer {
+	return &DiskServer{
+		mountRoot: mountRoot,
+	}
+}
+
+func (s *DiskServer) ListDiskDevices(w *apiserver.Response, r *apiserver.Request) {
 	in := &model.ListDiskDevicesRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
-	disks, err := node.DescribeDisk(in.HostIP)
+	disks, err := node.DescribeDisk(r.Context(), in.HostIP)
 	if err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusDiskDescribeFailed(nil))
 		return
 	}
 
 	// 处理预期的挂载点和实际的挂载点不一致的问题
 	var mountPoints []model.MountPoint
 	db.Instance().Model(&model.MountPoint{}).Where("host_ip = ?", in.HostIP).Find(&mountPoints)
-	mpMap := make(map[string]string, 0)
+	mpMap := make(map[string]model.MountPoint, 0)
 	for _, mp := range mountPoints {
-		mpMap[mp.UUID] = mp.Path
+		mpMap[mp.UUID] = mp
 	}
 	for i, disk := range disks {
 		if mp, ok := mpMap[disk.UUID]; ok {
-			disks[i].SpecMountPoint = mp
+			disks[i].SpecMountPoint = mp.Path
+			disks[i].MountConditions = mp.Conditions
 		}
 		// 接口返回的挂载点 不暴露前缀路径
-		disks[i].MountPoint = strings.TrimPrefix(disks[i].MountPoint, "/mnt")
-		disks[i].SpecMountPoint = strings.TrimPrefix(disks[i].SpecMountPoint, "/mnt")
+		disks[i].MountPoint = strings.TrimPrefix(disks[i].MountPoint, s.mountRoot)
+		disks[i].SpecMountPoint = strings.TrimPrefix(disks[i].SpecMountPoint, s.mountRoot)
 	}
 
 	out := &model.ListDiskDevicesResponse{
@@ -49,22 +66,22 @@ func ListDiskDevices(w *apiserver.Response, r *apiserver.Request) {
 	w.Write(retcode.StatusOK(out))
 }
 
-func SetMountPoint(w *apiserver.Response, r *apiserver.Request) {
+func (s *DiskServer) SetMountPoint(w *apiserver.Response, r *apiserver.Request) {
 	in := &model.SetMountPointRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusParamInvalid(nil))
+		w.WriteParamError(err)
 		return
 	}
 
 	var mountPoints []model.MountPoint
 	result := db.Instance().Model(&model.MountPoint{}).Where("uuid = ? AND host_ip = ?", in.UUID, in.HostIP).Find(&mountPoints)
 	if result.Error != nil {
-		w.WriteError(result.Error, retcode.StatusError(nil))
+		w.WriteError(result.Error, retcode.StatusDatabaseError(nil))
 	}
 	if len(mountPoints) > 1 {
 		w.WriteError(
 			fmt.Errorf("there are many same uuid: %s mountpoint disk record on the host: %s", in.UUID, in.HostIP),
-			retcode.StatusParamInvalid(nil),
+			retcode.StatusMountPointConflict(nil).WithArgs(in.UUID),
 		)
 		return
 	}
@@ -79,22 +96,21 @@ func SetMountPoint(w *apiserver.Response, r *apiserver.Request) {
 		// } else {
 		// 	setMountPoint(w, r, in, &mountPoints[0])
 		// }
-		setMountPoint(w, r, in)
+		s.setMountPoint(w, r, in)
 
 	} else {
-		cancelMountPoint(w, r, in, &mountPoints[0])
+		s.cancelMountPoint(w, r, in, &mountPoints[0])
 	}
 }
 
-func setMountPoint(w *apiserver.Response, r *apiserver.Request, in *model.SetMountPointRequest) {
+func (s *DiskServer) setMountPoint(w *apiserver.Response, r *apiserver.Request, in *model.SetMountPointRequest) {
 	host, err := GetHostInfo(w, in.HostIP)
 	if err != nil {
 		return
 	}
 
 	// cmd := node.NewExec().SetHost(host.HostIP)
-	// todo 挂载前缀改成使用配置
-	p := filepath.Join("/mnt", util.Trim(in.Path))
+	p := filepath.Join(s.mountRoot, util.Trim(in.Path))
 
 	// 检查是否已经挂载
 	// mounted := false
@@ -137,30 +153,34 @@ func setMountPoint(w *apiserver.Response, r *apiserver.Request, in *model.SetMou
 			Device: in.Device,
 		})
 	if result.Error != nil {
-		w.WriteError(result.Error, retcode.StatusError(nil))
+		w.WriteError(result.Error, retcode.StatusDatabaseError(nil))
 		return
 	}
 	if result.RowsAffected == 1 {
 		flog.Debugf("new mount-point record create, UUID: %s", in.UUID)
 	} else {
 		flog.Debugf("mount-point record updated, UUID: %s", in.UUID)
+		db.Instance().Model(&model.MountPoint{}).Where("uuid = ? AND host_ip = ?", in.UUID, host.HostIP).
+			UpdateColumn("generation", gorm.Expr("generation + 1"))
 	}
+	controller.Enqueue(controller.ReconcilerMountPoint, host.ID)
 
 	w.Write(retcode.StatusOK(&model.SetMountPointResponse{}))
 }
 
-func cancelMountPoint(w *apiserver.Response, r *apiserver.Request, in *model.SetMountPointRequest, record *model.MountPoint) {
+func (s *DiskServer) cancelMountPoint(w *apiserver.Response, r *apiserver.Request, in *model.SetMountPointRequest, record *model.MountPoint) {
 	p := record.Path
 	host, err := GetHostInfo(w, in.HostIP)
 	if err != nil {
 		return
 	}
 	cmd := node.NewExec().SetHost(host.HostIP)
+	defer cmd.Close()
 	// 检查是否已经挂载
 	mounted := false
-	points, err := node.DescribeMountedPoint(host.HostIP)
+	points, err := node.DescribeMountedPoint(r.Context(), host.HostIP)
 	if err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusDiskDescribeFailed(nil))
 		return
 	}
 	for _, item := range points {
@@ -172,18 +192,19 @@ func cancelMountPoint(w *apiserver.Response, r *apiserver.Request, in *model.Set
 	}
 	if mounted {
 		// 已经挂载， 且与取消前的路径一致， 执行解挂操作
-		err := cmd.UmountDir(p)
+		err := node.UmountDir(r.Context(), cmd, p)
 		if err != nil {
 			// flog.Errorf("umount  %s failed: %v", mountedOther, err)
-			w.WriteError(err, retcode.StatusUmountDiskFailed(p))
+			w.WriteError(err, retcode.StatusUmountDiskFailed(nil).WithArgs(p))
 			return
 		}
 	}
 
 	record.Path = ""
+	record.Generation++
 	result := db.Instance().Save(record)
 	if result.Error != nil {
-		w.WriteError(result.Error, retcode.StatusError(nil))
+		w.WriteError(result.Error, retcode.StatusDatabaseError(nil))
 		return
 	}
 	if result.RowsAffected == 1 {
@@ -196,10 +217,10 @@ func cancelMountPoint(w *apiserver.Response, r *apiserver.Request, in *model.Set
 	w.Write(retcode.StatusOK(&model.SetMountPointResponse{}))
 }
 
-func MkfsDisk(w *apiserver.Response, r *apiserver.Request) {
+func (s *DiskServer) MkfsDisk(w *apiserver.Response, r *apiserver.Request) {
 	in := &model.MkfsDiskRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusParamInvalid(nil))
+		w.WriteParamError(err)
 		return
 	}
 
@@ -208,9 +229,9 @@ func MkfsDisk(w *apiserver.Response, r *apiserver.Request) {
 		return
 	}
 
-	disks, err := node.DescribeDisk(host.HostIP)
+	disks, err := node.DescribeDisk(r.Context(), host.HostIP)
 	if err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusDiskDescribeFailed(nil))
 		return
 	}
 
@@ -222,32 +243,38 @@ func MkfsDisk(w *apiserver.Response, r *apiserver.Request) {
 		}
 	}
 	if target == nil {
-		w.WriteError(errors.New("disk not found"), retcode.StatusParamInvalid(nil))
+		w.WriteError(errors.New("disk not found"), retcode.StatusDiskNotFound(nil).WithArgs(in.Device))
 		return
 	}
 	if target.IsSystemDisk {
-		w.WriteError(errors.New("system disk cannot be formatted"), retcode.StatusParamInvalid(nil))
+		w.WriteError(errors.New("system disk cannot be formatted"), retcode.StatusSystemDiskProtected(nil).WithArgs(in.Device))
 		return
 	}
 	if target.FsType != "" || target.MountPoint != "" {
-		w.WriteError(errors.New("disk is not empty"), retcode.StatusParamInvalid(nil))
+		w.WriteError(errors.New("disk is not empty"), retcode.StatusDiskNotEmpty(nil).WithArgs(in.Device))
 		return
 	}
 
-	if err := node.EnsureDiskEmptyForMkfs(host.HostIP, in.Device); err != nil {
-		w.WriteError(err, retcode.StatusParamInvalid(nil))
+	if err := node.EnsureDiskEmptyForMkfs(r.Context(), host.HostIP, in.Device); err != nil {
+		w.WriteError(err, retcode.StatusDiskNotEmpty(nil).WithArgs(in.Device))
 		return
 	}
 
-	if err := node.MkfsDisk(host.HostIP, in.Device, in.FsType); err != nil {
+	progress := model.MkfsEvent{HostIP: host.HostIP, Device: in.Device, FsType: in.FsType}
+	event.Publish(event.TopicMkfs, model.EventMkfsStarted, progress)
+	// 格式化开始后不随请求取消，避免磁盘停在格式化了一半的状态
+	if err := node.MkfsDisk(context.WithoutCancel(r.Context()), host.HostIP, in.Device, in.FsType); err != nil {
 		flog.Errorf("mkfs failed, device: %s, fs: %s, err: %v", in.Device, in.FsType, err)
-		w.WriteError(err, retcode.StatusError(nil))
+		progress.Error = err.Error()
+		event.Publish(event.TopicMkfs, model.EventMkfsFailed, progress)
+		w.WriteError(err, retcode.StatusMkfsFailed(nil).WithArgs(in.Device))
 		return
 	}
+	event.Publish(event.TopicMkfs, model.EventMkfsFinished, progress)
 
-	disks, err = node.DescribeDisk(host.HostIP)
+	disks, err = node.DescribeDisk(r.Context(), host.HostIP)
 	if err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusDiskDescribeFailed(nil))
 		return
 	}
 	for i := range disks {
@@ -258,17 +285,17 @@ func MkfsDisk(w *apiserver.Response, r *apiserver.Request) {
 		}
 	}
 
-	w.WriteError(errors.New("disk not found after mkfs"), retcode.StatusError(nil))
+	w.WriteError(errors.New("disk not found after mkfs"), retcode.StatusDiskNotFound(nil).WithArgs(in.Device))
 }
 
-func ListSupportedMkfsFilesystems(w *apiserver.Response, r *apiserver.Request) {
+func (s *DiskServer) ListSupportedMkfsFilesystems(w *apiserver.Response, r *apiserver.Request) {
 	in := &model.ListSupportedMkfsFilesystemsRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusParamInvalid(nil))
+		w.WriteParamError(err)
 		return
 	}
 
-	fsTypes, err := node.ListSupportedMkfsFilesystems(in.HostIP)
+	fsTypes, err := node.ListSupportedMkfsFilesystems(r.Context(), in.HostIP)
 	if err != nil {
 		w.WriteError(err, retcode.StatusError(nil))
 		return
@@ -0,0 +1,219 @@
+package v1
+
+import (
+	"encoding/json"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/event"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/server/apiserver"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// EventsScope 检查API token授权范围时，websocket和SSE都使用该路由
+	EventsScope = "/v1/events"
+	// 心跳间隔，同时重新校验会话，退出登录或token失效后断开连接
+	eventsHeartbeat = 30 * time.Second
+	eventsWriteWait = 10 * time.Second
+)
+
+// eventTopicPermissions 订阅各个主题需要的权限
+var eventTopicPermissions = map[event.Topic]string{
+	event.TopicSambaShare: model.PermissionShareRead,
+	event.TopicNFSShare:   model.PermissionShareRead,
+	event.TopicMount:      model.PermissionDiskRead,
+	event.TopicMkfs:       model.PermissionDiskRead,
+	event.TopicMetrics:    model.PermissionHostRead,
+}
+
+type EventAPI struct {
+	as       *apiserver.Apiserver
+	upgrader websocket.Upgrader
+}
+
+func NewEventAPI(as *apiserver.Apiserver) *EventAPI {
+	return &EventAPI{
+		as: as,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin:     as.CheckOrigin,
+		},
+	}
+}
+
+// WebSocketHandler 通过websocket推送事件，每条消息是一个json格式的 event.Event，
+// url参数 topics 为逗号分隔的主题，为空时订阅有权限的所有主题
+func (a *EventAPI) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := a.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	conn, err := a.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		flog.Errorf("upgrade events websocket failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// 客户端不需要发送消息，读取只用于处理 pong 和发现连接关闭
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			conn.SetWriteDeadline(time.Now().Add(eventsWriteWait))
+			if !ok {
+				// 服务停止
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+				return
+			}
+			if err := conn.WriteJSON(e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if !a.sessionValid(r) {
+				conn.SetWriteDeadline(time.Now().Add(eventsWriteWait))
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session expired"))
+				return
+			}
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventsWriteWait)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// ServeSSE 不支持websocket的客户端使用 Server-Sent Events 接收事件，参数与 WebSocketHandler 相同
+func (a *EventAPI) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	sub, ok := a.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// 禁止nginx等反向代理缓存响应
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			bs, err := json.Marshal(e)
+			if err != nil {
+				flog.Errorf("marshal event failed: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Topic, bs); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if !a.sessionValid(r) {
+				return
+			}
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// subscribe 校验来源和会话，按会话的权限订阅请求的主题，失败时写入响应状态码
+func (a *EventAPI) subscribe(w http.ResponseWriter, r *http.Request) (*event.Subscription, bool) {
+	if !a.as.CheckOrigin(r) {
+		w.WriteHeader(http.StatusForbidden)
+		return nil, false
+	}
+	sess, status := a.as.Authenticate(r, EventsScope)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return nil, false
+	}
+	topics, status := eventTopics(r.URL.Query().Get("topics"), sess)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return nil, false
+	}
+	return event.Subscribe(topics...), true
+}
+
+// eventTopics 解析请求的主题，为空时返回有权限的所有主题
+func eventTopics(query string, sess *apiserver.Session) ([]event.Topic, int) {
+	checker, _ := sess.UserInfo.(apiserver.PermissionChecker)
+	allowed := func(t event.Topic) bool {
+		return checker != nil && checker.HasPermission(eventTopicPermissions[t])
+	}
+
+	topics := []event.Topic{}
+	if strings.TrimSpace(query) == "" {
+		for _, t := range event.Topics {
+			if allowed(t) {
+				topics = append(topics, t)
+			}
+		}
+		if len(topics) == 0 {
+			return nil, http.StatusForbidden
+		}
+		return topics, http.StatusOK
+	}
+	for _, name := range strings.Split(query, ",") {
+		t := event.Topic(strings.TrimSpace(name))
+		if _, ok := eventTopicPermissions[t]; !ok {
+			return nil, http.StatusBadRequest
+		}
+		if !allowed(t) {
+			return nil, http.StatusForbidden
+		}
+		topics = append(topics, t)
+	}
+	return topics, http.StatusOK
+}
+
+// sessionValid 长连接期间会话可能过期或被注销
+func (a *EventAPI) sessionValid(r *http.Request) bool {
+	sess, status := a.as.Authenticate(r, EventsScope)
+	if status != http.StatusOK {
+		return false
+	}
+	return sess.ExpiresAt.IsZero() || time.Now().Before(sess.ExpiresAt)
+}
@@ -33,16 +33,34 @@ func NewFileServer(cache cache.TinyCache, rootPath string) *FileServer {
 	}
 }
 
-func ListDir(w *apiserver.Response, r *apiserver.Request) {
+// absPath 把接口中的相对路径转换为根目录下的绝对路径，不允许跳出根目录
+func (s *FileServer) absPath(p string) string {
+	return filepath.Join(s.rootPath, filepath.Clean(string(filepath.Separator)+p))
+}
+
+// fileRetCode 按文件操作错误的类型返回具体的返回码，p 为接口中的路径
+func fileRetCode(err error, p string) *retcode.RetCode {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return retcode.StatusNotFound(nil).WithArgs(p)
+	case errors.Is(err, fs.ErrExist):
+		return retcode.StatusFileAlreadyExists(nil).WithArgs(p)
+	case errors.Is(err, fs.ErrPermission):
+		return retcode.StatusFilePermissionDenied(nil).WithArgs(p)
+	}
+	return retcode.StatusFileOperationFailed(nil).WithArgs(p)
+}
+
+func (s *FileServer) ListDir(w *apiserver.Response, r *apiserver.Request) {
 	in := &model.ListDirRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
-	p := filepath.Join("/mnt", filepath.Clean(string(filepath.Separator)+in.Path))
+	p := s.absPath(in.Path)
 	entities, err := os.ReadDir(p)
 	if err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, fileRetCode(err, in.Path))
 		return
 	}
 	dirs := make([]string, 0)
@@ -58,20 +76,20 @@ func ListDir(w *apiserver.Response, r *apiserver.Request) {
 	w.Write(retcode.StatusOK(out))
 }
 
-func ReadDir(w *apiserver.Response, r *apiserver.Request) {
+func (s *FileServer) ReadDir(w *apiserver.Response, r *apiserver.Request) {
 	in := &model.ReadDirRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
-	p := filepath.Join("/mnt", filepath.Clean(string(filepath.Separator)+in.Path))
+	p := s.absPath(in.Path)
 	entities, err := os.ReadDir(p)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			w.WriteError(err, retcode.StatusDirNotExist(nil))
 			return
 		}
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, fileRetCode(err, in.Path))
 		return
 	}
 	enDirs := make([]model.FileEntry, 0)
@@ -103,16 +121,16 @@ func ReadDir(w *apiserver.Response, r *apiserver.Request) {
 	w.Write(retcode.StatusOK(out))
 }
 
-func CreateDir(w *apiserver.Response, r *apiserver.Request) {
+func (s *FileServer) CreateDir(w *apiserver.Response, r *apiserver.Request) {
 	in := &model.CreateDirRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
-	p := filepath.Join("/mnt", filepath.Clean(string(filepath.Separator)+in.Path))
+	p := s.absPath(in.Path)
 	err := os.Mkdir(p, 0o644)
 	if err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, fileRetCode(err, in.Path))
 		return
 	}
 
@@ -120,7 +138,7 @@ func CreateDir(w *apiserver.Response, r *apiserver.Request) {
 	err = os.Chown(p, uid, gid)
 	if err != nil {
 		defer os.Remove(p)
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, fileRetCode(err, in.Path))
 		return
 	}
 
@@ -128,20 +146,20 @@ func CreateDir(w *apiserver.Response, r *apiserver.Request) {
 	w.Write(retcode.StatusOK(out))
 }
 
-func RemoveFile(w *apiserver.Response, r *apiserver.Request) {
+func (s *FileServer) RemoveFile(w *apiserver.Response, r *apiserver.Request) {
 	in := &model.RemoveFileRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 	ps := []string{}
 	if in.Path != "" {
-		p := filepath.Join("/mnt", filepath.Clean(string(filepath.Separator)+in.Path))
+		p := s.absPath(in.Path)
 		ps = append(ps, p)
 	}
 	if in.Paths != nil {
 		for _, item := range in.Paths {
-			p := filepath.Join("/mnt", filepath.Clean(string(filepath.Separator)+item))
+			p := s.absPath(item)
 			ps = append(ps, p)
 		}
 	}
@@ -150,16 +168,16 @@ func RemoveFile(w *apiserver.Response, r *apiserver.Request) {
 		_, err := os.Stat(p)
 		if err != nil {
 			if errors.Is(err, fs.ErrNotExist) {
-				w.Write(retcode.StatusOK)
+				w.Write(retcode.StatusOK(nil))
 				return
 			}
-			w.WriteError(err, retcode.StatusError(nil))
+			w.WriteError(err, fileRetCode(err, p))
 			return
 		}
 
 		err = os.RemoveAll(p)
 		if err != nil {
-			w.WriteError(err, retcode.StatusError(nil))
+			w.WriteError(err, fileRetCode(err, p))
 			return
 		}
 	}
@@ -167,22 +185,22 @@ func RemoveFile(w *apiserver.Response, r *apiserver.Request) {
 	w.Write(retcode.StatusOK(out))
 }
 
-func UploadFiles(w *apiserver.Response, r *apiserver.Request) {
+func (s *FileServer) UploadFiles(w *apiserver.Response, r *apiserver.Request) {
 	dir := r.Request.URL.Query().Get("FilePath")
 	if strings.HasSuffix(dir, string(filepath.Separator)) {
 		dir = strings.TrimRight(dir, string(filepath.Separator))
 	}
-	path := filepath.Join("/mnt", filepath.Clean(string(filepath.Separator)+dir))
+	path := s.absPath(dir)
 	if _, err := os.Stat(path); err != nil {
 		// donot care dir existed or not exist
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, fileRetCode(err, dir))
 		return
 	}
 	// newName := q.Get("NewName")
 
 	reader, err := r.Request.MultipartReader()
 	if err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusUploadInvalid(nil))
 		return
 	}
 
@@ -194,7 +212,7 @@ func UploadFiles(w *apiserver.Response, r *apiserver.Request) {
 			if errors.Is(err, io.EOF) {
 				break
 			}
-			w.WriteError(err, retcode.StatusError(nil))
+			w.WriteError(err, retcode.StatusUploadInvalid(nil))
 			return
 		}
 
@@ -203,13 +221,13 @@ func UploadFiles(w *apiserver.Response, r *apiserver.Request) {
 		} else {
 			name := part.FileName()
 			if name == "" {
-				w.WriteError(fmt.Errorf("multipart name is empty"), retcode.StatusError(nil))
+				w.WriteError(fmt.Errorf("multipart name is empty"), retcode.StatusUploadInvalid(nil))
 				return
 			}
 			p := filepath.Join(path, name)
 			file, err = os.Create(p)
 			if err != nil {
-				w.WriteError(err, retcode.StatusError(nil))
+				w.WriteError(err, fileRetCode(err, name))
 				return
 			}
 			defer file.Close()
@@ -228,18 +246,18 @@ func UploadFiles(w *apiserver.Response, r *apiserver.Request) {
 func (s *FileServer) DownloadFiles(w *apiserver.Response, r *apiserver.Request) {
 	in := &model.DownloadFilesRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 	if in.Path == string(filepath.Separator) {
 		w.WriteError(fmt.Errorf("file path is empty"), retcode.StatusDirEmpty(nil))
 		return
 	}
-	path := filepath.Join("/mnt", filepath.Clean(string(filepath.Separator)+in.Path))
+	path := s.absPath(in.Path)
 	token := util.RandStringRunes(16)
 	_, err := os.Stat(path)
 	if err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, fileRetCode(err, in.Path))
 		return
 	}
 	s.cache.SetExpired(fmt.Sprintf("fsdownload:%s", token), path, time.Second*60)
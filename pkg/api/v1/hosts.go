@@ -13,7 +13,7 @@ func ListHosts(w *apiserver.Response, r *apiserver.Request) {
 	var hosts []model.Host
 	err := db.Instance().Find(&hosts).Error
 	if err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
 		return
 	}
 
@@ -56,13 +56,14 @@ func GetHostSystemInfo(w *apiserver.Response, r *apiserver.Request) {
 	}
 
 	// 获取基础系统信息
-	osRelease, osVersion := node.GetOS(hostIP)
-	hostname := node.GetHostname(hostIP)
-	kernel := node.GetKernelVersion(hostIP)
-	arch := node.GetArch(hostIP)
+	ctx := r.Context()
+	osRelease, osVersion := node.GetOS(ctx, hostIP)
+	hostname := node.GetHostname(ctx, hostIP)
+	kernel := node.GetKernelVersion(ctx, hostIP)
+	arch := node.GetArch(ctx, hostIP)
 
 	// 检测发行版信息
-	distroInfo, err := node.DetectDistro(hostIP)
+	distroInfo, err := node.DetectDistro(ctx, hostIP)
 	if err != nil {
 		flog.Errorf("Failed to detect distro for host %s: %v", hostIP, err)
 		// 使用基础OS信息作为fallback
@@ -72,7 +73,7 @@ func GetHostSystemInfo(w *apiserver.Response, r *apiserver.Request) {
 	}
 
 	// 检查NFS-Ganesha安装状态
-	installed, version, serviceStatus, err := node.CheckNFSGaneshaInstallation(hostIP)
+	installed, version, serviceStatus, err := node.CheckNFSGaneshaInstallation(ctx, hostIP)
 	if err != nil {
 		flog.Warnf("Failed to check NFS installation for host %s: %v", hostIP, err)
 		// 继续返回其他信息
@@ -120,9 +121,9 @@ func GetHostMonitoringMetrics(w *apiserver.Response, r *apiserver.Request) {
 		hostIP = "127.0.0.1"
 	}
 
-	metrics, err := node.GetMonitoringMetrics(hostIP)
+	metrics, err := node.GetMonitoringMetrics(r.Context(), hostIP)
 	if err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusMetricsUnavailable(nil))
 		return
 	}
 
@@ -0,0 +1,113 @@
+package v1
+
+import (
+	"errors"
+	"flutelake/fluteNAS/pkg/controller"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"flutelake/fluteNAS/pkg/server/apiserver"
+)
+
+// JobAPI 查看和控制定时执行的控制器任务
+type JobAPI struct {
+	cron *controller.CronJob
+}
+
+func NewJobAPI(cron *controller.CronJob) *JobAPI {
+	return &JobAPI{
+		cron: cron,
+	}
+}
+
+// ListJobs 列出所有任务的调度、执行状态和最近的执行记录
+func (a *JobAPI) ListJobs(w *apiserver.Response, r *apiserver.Request) {
+	w.Write(retcode.StatusOK(model.ListJobsResponse{Jobs: a.cron.Jobs()}))
+}
+
+// ListReconcilers 列出每个reconciler的队列长度和对象的同步状态，失败的对象包括错误信息和下一次重试的时间
+func (a *JobAPI) ListReconcilers(w *apiserver.Response, r *apiserver.Request) {
+	w.Write(retcode.StatusOK(model.ListReconcilersResponse{Reconcilers: controller.Reconcilers()}))
+}
+
+// RunJob 立即在后台执行一次任务
+func (a *JobAPI) RunJob(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.JobNameRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+	if err := a.cron.RunNow(in.Name); err != nil {
+		w.WriteError(err, jobRetCode(err, in.Name))
+		return
+	}
+	flog.Infof("job %s triggered by user %s", in.Name, getCurrentUser(r))
+	a.writeJob(w, in.Name)
+}
+
+// PauseJob 暂停任务的定时执行
+func (a *JobAPI) PauseJob(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.JobNameRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+	if err := a.cron.Pause(in.Name); err != nil {
+		w.WriteError(err, jobRetCode(err, in.Name))
+		return
+	}
+	flog.Infof("job %s paused by user %s", in.Name, getCurrentUser(r))
+	a.writeJob(w, in.Name)
+}
+
+// ResumeJob 恢复暂停的任务
+func (a *JobAPI) ResumeJob(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.JobNameRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+	if err := a.cron.Resume(in.Name); err != nil {
+		w.WriteError(err, jobRetCode(err, in.Name))
+		return
+	}
+	flog.Infof("job %s resumed by user %s", in.Name, getCurrentUser(r))
+	a.writeJob(w, in.Name)
+}
+
+// SetJobSchedule 修改任务的调度
+func (a *JobAPI) SetJobSchedule(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.SetJobScheduleRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+	if err := a.cron.SetSchedule(in.Name, in.Schedule); err != nil {
+		w.WriteError(err, jobRetCode(err, in.Name))
+		return
+	}
+	flog.Infof("schedule of job %s changed to %q by user %s", in.Name, in.Schedule, getCurrentUser(r))
+	a.writeJob(w, in.Name)
+}
+
+func (a *JobAPI) writeJob(w *apiserver.Response, name string) {
+	job, err := a.cron.Job(name)
+	if err != nil {
+		w.WriteError(err, jobRetCode(err, name))
+		return
+	}
+	w.Write(retcode.StatusOK(model.JobResponse{Job: job}))
+}
+
+// jobRetCode 任务操作错误对应的返回码
+func jobRetCode(err error, name string) *retcode.RetCode {
+	switch {
+	case errors.Is(err, controller.ErrJobNotFound):
+		return retcode.StatusNotFound(nil).WithArgs("job " + name)
+	case errors.Is(err, controller.ErrJobRunning):
+		return retcode.StatusJobRunning(nil).WithArgs(name)
+	case errors.Is(err, controller.ErrInvalidSchedule):
+		return retcode.StatusParamInvalid(nil).WithArgs("Schedule")
+	}
+	return retcode.StatusDatabaseError(nil)
+}
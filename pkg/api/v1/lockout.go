@@ -0,0 +1,193 @@
+package v1
+
+import (
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/lockout"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"flutelake/fluteNAS/pkg/server/apiserver"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	lockoutKindUser = "user"
+	lockoutKindIP   = "ip"
+)
+
+// 同一用户名连续失败5次后开始锁定
+var userLockoutPolicy = lockout.Policy{
+	MaxFailures: 5,
+	BaseDelay:   time.Second * 30,
+	MaxDelay:    time.Hour,
+	Window:      time.Minute * 15,
+}
+
+// 同一IP可能有多个用户在登录，阈值放宽一些
+var ipLockoutPolicy = lockout.Policy{
+	MaxFailures: 20,
+	BaseDelay:   time.Second * 30,
+	MaxDelay:    time.Hour,
+	Window:      time.Minute * 15,
+}
+
+// loginGuard 按用户名和客户端IP分别统计登录失败次数
+type loginGuard struct {
+	users *lockout.Guard
+	ips   *lockout.Guard
+}
+
+func newLoginGuard() *loginGuard {
+	return &loginGuard{
+		users: lockout.NewGuard(lockoutKindUser, userLockoutPolicy),
+		ips:   lockout.NewGuard(lockoutKindIP, ipLockoutPolicy),
+	}
+}
+
+// lockedFor 返回用户名或IP中较长的剩余锁定时间
+func (g *loginGuard) lockedFor(username string, clientIP string) time.Duration {
+	d := g.ips.Check(clientIP)
+	if username != "" {
+		if ud := g.users.Check(username); ud > d {
+			d = ud
+		}
+	}
+	return d
+}
+
+func (g *loginGuard) guard(kind string) *lockout.Guard {
+	if kind == lockoutKindIP {
+		return g.ips
+	}
+	return g.users
+}
+
+// loginClientIP 与限流使用相同的客户端IP，伪造 X-Forwarded-For 不能绕过按IP的锁定
+func loginClientIP(r *apiserver.Request) string {
+	ip := r.ClientIP()
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// checkLoginLocked 用户名或IP处于锁定状态时写入错误响应并返回true
+func (a *AuthApi) checkLoginLocked(w *apiserver.Response, r *apiserver.Request, username string) bool {
+	clientIP := loginClientIP(r)
+	d := a.guard.lockedFor(username, clientIP)
+	if d <= 0 {
+		return false
+	}
+	recordLoginAttempt(r, username, clientIP, model.LoginFailedLocked)
+	retryAfter := int(math.Ceil(d.Seconds()))
+	w.ResponseWriter.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.Write(retcode.StatusLoginLocked(model.LoginLockedResponse{RetryAfter: retryAfter}))
+	return true
+}
+
+// loginFailed 记录一次登录失败，并累加用户名和IP的失败计数
+func (a *AuthApi) loginFailed(r *apiserver.Request, username string, reason string) {
+	clientIP := loginClientIP(r)
+	recordLoginAttempt(r, username, clientIP, reason)
+	if clientIP != "" {
+		if d := a.guard.ips.Failure(clientIP); d > 0 {
+			flog.Warnf("too many failed logins from %s, locked for %v", clientIP, d)
+		}
+	}
+	if username != "" {
+		if d := a.guard.users.Failure(username); d > 0 {
+			flog.Warnf("too many failed logins of user %s, locked for %v", username, d)
+		}
+	}
+}
+
+// loginSucceeded 登录成功后清除用户名的失败计数，IP的计数按窗口期自然过期
+func (a *AuthApi) loginSucceeded(username string) {
+	a.guard.users.Success(username)
+}
+
+func recordLoginAttempt(r *apiserver.Request, username string, clientIP string, reason string) {
+	attempt := model.LoginAttempt{
+		Username:  username,
+		ClientIP:  clientIP,
+		UserAgent: r.Request.UserAgent(),
+		Reason:    reason,
+	}
+	if err := db.Instance().Create(&attempt).Error; err != nil {
+		flog.Errorf("save login attempt failed: %v", err)
+	}
+}
+
+// ListLoginLockouts 列出当前的失败计数和锁定状态
+func (a *AuthApi) ListLoginLockouts(w *apiserver.Response, r *apiserver.Request) {
+	now := time.Now()
+	out := model.ListLoginLockoutsResponse{
+		Lockouts: []model.LoginLockout{},
+	}
+	for _, g := range []*lockout.Guard{a.guard.users, a.guard.ips} {
+		for _, e := range g.List() {
+			out.Lockouts = append(out.Lockouts, model.LoginLockout{
+				Kind:        e.Kind,
+				Key:         e.Key,
+				Failures:    e.Failures,
+				LastFailure: e.LastFailure,
+				LockedUntil: e.LockedUntil,
+				Locked:      e.Locked(now),
+			})
+		}
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+// ClearLoginLockout 手动解除用户名或IP的锁定
+func (a *AuthApi) ClearLoginLockout(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.ClearLoginLockoutRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+
+	cleared := a.guard.guard(in.Kind).Clear(in.Key)
+	if cleared {
+		flog.Infof("login lockout of %s %s cleared by user %s", in.Kind, in.Key, getCurrentUser(r))
+	}
+
+	out := model.ClearLoginLockoutResponse{
+		Kind:    in.Kind,
+		Key:     in.Key,
+		Cleared: cleared,
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+// ListLoginAttempts 查询登录失败的审计记录
+func (a *AuthApi) ListLoginAttempts(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.ListLoginAttemptsRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+	if in.Limit == 0 {
+		in.Limit = 100
+	}
+
+	query := db.Instance().Order("id desc").Limit(in.Limit)
+	if in.Username != "" {
+		query = query.Where("username = ?", in.Username)
+	}
+	if in.ClientIP != "" {
+		query = query.Where("client_ip = ?", in.ClientIP)
+	}
+	attempts := []model.LoginAttempt{}
+	if err := query.Find(&attempts).Error; err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+
+	out := model.ListLoginAttemptsResponse{
+		Attempts: attempts,
+	}
+	w.Write(retcode.StatusOK(out))
+}
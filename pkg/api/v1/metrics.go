@@ -17,22 +17,26 @@ type VictoriaQueryRangeRequest struct {
 	Step  int64  `json:"Step"`
 }
 
-func QueryVictoriaMetricsRange(w *apiserver.Response, r *apiserver.Request) {
-	// baseURL := os.Getenv("VICTORIA_METRICS_QUERY_URL")
-	// if baseURL == "" {
-	// 	w.WriteError(fmt.Errorf("victoria metrics query url not configured"), retcode.StatusError(nil))
-	// 	return
-	// }
-	baseURL := "http://127.0.0.1:8086"
+type MetricsServer struct {
+	// VictoriaMetrics 查询地址
+	baseURL string
+}
+
+func NewMetricsServer(baseURL string) *MetricsServer {
+	return &MetricsServer{
+		baseURL: baseURL,
+	}
+}
 
+func (s *MetricsServer) QueryVictoriaMetricsRange(w *apiserver.Response, r *apiserver.Request) {
 	in := &VictoriaQueryRangeRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
 	if in.Query == "" {
-		w.WriteError(fmt.Errorf("query is required"), retcode.StatusError(nil))
+		w.WriteError(fmt.Errorf("query is required"), retcode.StatusParamInvalid(nil).WithArgs("Query"))
 		return
 	}
 
@@ -46,9 +50,9 @@ func QueryVictoriaMetricsRange(w *apiserver.Response, r *apiserver.Request) {
 		in.Step = 10
 	}
 
-	u, err := url.Parse(baseURL)
+	u, err := url.Parse(s.baseURL)
 	if err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusMetricsUnavailable(nil))
 		return
 	}
 	u.Path = "/api/v1/query_range"
@@ -61,25 +65,25 @@ func QueryVictoriaMetricsRange(w *apiserver.Response, r *apiserver.Request) {
 
 	req, err := http.NewRequestWithContext(r.Request.Context(), http.MethodGet, u.String(), nil)
 	if err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusMetricsUnavailable(nil))
 		return
 	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusMetricsUnavailable(nil))
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		w.WriteError(fmt.Errorf("victoria metrics returned status %d", resp.StatusCode), retcode.StatusError(nil))
+		w.WriteError(fmt.Errorf("victoria metrics returned status %d", resp.StatusCode), retcode.StatusMetricsUnavailable(nil))
 		return
 	}
 
 	var out any
 	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusMetricsUnavailable(nil))
 		return
 	}
 
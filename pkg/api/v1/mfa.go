@@ -0,0 +1,366 @@
+package v1
+
+import (
+	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"flutelake/fluteNAS/pkg/server/apiserver"
+	"flutelake/fluteNAS/pkg/util"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	mfaIssuer = "FluteNAS"
+	// 密码验证通过后，等待输入二次验证码的有效期
+	mfaPendingTTL = time.Minute * 5
+	// 每次密码验证后允许尝试验证码的次数
+	mfaMaxAttempts = 5
+	// 允许的时钟偏差，前后各一个时间步
+	mfaSkew           = 1
+	mfaRecoveryCodes  = 10
+	mfaRecoveryLength = 10
+)
+
+// mfaPending 密码验证通过、等待二次验证的登录
+type mfaPending struct {
+	UserInfo model.SessionUserInfo
+	Attempts int
+}
+
+func genMFAPendingCacheID(token string) string {
+	return "MFA:" + token
+}
+
+// getEnabledTOTP 获取用户已启用的二次验证配置，未启用时返回nil
+func getEnabledTOTP(username string) (*model.UserTOTP, error) {
+	var t model.UserTOTP
+	err := db.Instance().First(&t, "username = ?", username).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, retcode.Wrap(err, retcode.StatusDatabaseError(nil))
+	}
+	if !t.Enabled {
+		return nil, nil
+	}
+	return &t, nil
+}
+
+// beginMFALogin 缓存已通过密码验证的用户信息，返回二次验证使用的token
+func (a *AuthApi) beginMFALogin(userinfo model.SessionUserInfo) (string, error) {
+	token, err := util.RandSecureString(32)
+	if err != nil {
+		return "", err
+	}
+	a.cache.SetExpired(genMFAPendingCacheID(token), &mfaPending{UserInfo: userinfo}, mfaPendingTTL)
+	return token, nil
+}
+
+// LoginMFA 登录的第二步，校验TOTP验证码或恢复码后下发会话cookie
+func (a *AuthApi) LoginMFA(w *apiserver.Response, r *apiserver.Request) {
+	in := model.MFALoginRequest{}
+	if err := r.Unmarshal(&in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+
+	cacheID := genMFAPendingCacheID(in.MFAToken)
+	v, ok := a.cache.Get(cacheID)
+	if !ok {
+		w.WriteError(errors.New("mfa token is invalid or expired"), retcode.StatusMFATokenExpired(nil))
+		return
+	}
+	pending, ok := v.(*mfaPending)
+	if !ok {
+		w.WriteError(errors.New("format mfa pending login error"), retcode.StatusMFATokenExpired(nil))
+		return
+	}
+
+	if a.checkLoginLocked(w, r, pending.UserInfo.Username) {
+		return
+	}
+
+	t, err := getEnabledTOTP(pending.UserInfo.Username)
+	if err != nil {
+		w.WriteError(err, nil)
+		return
+	}
+	if t != nil {
+		ok, err := verifySecondFactor(t, in.Code)
+		if err != nil {
+			w.WriteError(err, nil)
+			return
+		}
+		if !ok {
+			pending.Attempts++
+			if pending.Attempts >= mfaMaxAttempts {
+				a.cache.Delete(cacheID)
+			}
+			a.loginFailed(r, pending.UserInfo.Username, model.LoginFailedMFA)
+			w.WriteError(errors.New("mfa code is invalid"), retcode.StatusMFACodeInvalid(nil))
+			return
+		}
+	}
+	a.cache.Delete(cacheID)
+	a.loginSucceeded(pending.UserInfo.Username)
+
+	if err := w.SetCookie(pending.UserInfo); err != nil {
+		w.WriteError(err, retcode.StatusError(nil))
+		return
+	}
+	out := model.LoginResponse{}
+	w.Write(retcode.StatusOK(out))
+}
+
+// MFAStatus 获取当前用户的二次验证状态
+func (a *AuthApi) MFAStatus(w *apiserver.Response, r *apiserver.Request) {
+	out := model.MFAStatusResponse{}
+	t, err := getEnabledTOTP(getCurrentUser(r))
+	if err != nil {
+		w.WriteError(err, nil)
+		return
+	}
+	if t != nil {
+		out.Enabled = true
+		out.RecoveryCodesLeft = len(t.GetRecoveryCodes())
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+// MFAEnroll 生成新的TOTP密钥，需要调用 MFAActivate 验证一次后才会启用
+func (a *AuthApi) MFAEnroll(w *apiserver.Response, r *apiserver.Request) {
+	username, ok := mfaSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	var t model.UserTOTP
+	err := db.Instance().First(&t, "username = ?", username).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+	if t.Enabled {
+		w.WriteError(errors.New("mfa is already enabled"), retcode.StatusMFAAlreadyEnabled(nil))
+		return
+	}
+
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		w.WriteError(err, retcode.StatusError(nil))
+		return
+	}
+	t.Username = username
+	t.Secret = secret
+	t.Enabled = false
+	t.RecoveryCodes = "[]"
+	t.LastUsedStep = 0
+	if err := db.Instance().Save(&t).Error; err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+
+	out := model.MFAEnrollResponse{
+		Secret: secret,
+		URI:    util.TOTPURI(mfaIssuer, username, secret),
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+// MFAActivate 验证身份验证器App生成的验证码并启用二次验证，返回恢复码
+func (a *AuthApi) MFAActivate(w *apiserver.Response, r *apiserver.Request) {
+	in := model.MFACodeRequest{}
+	if err := r.Unmarshal(&in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+	username, ok := mfaSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	var t model.UserTOTP
+	if err := db.Instance().First(&t, "username = ? AND enabled = ?", username, false).Error; err != nil {
+		w.WriteError(err, dbRetCode(err, retcode.StatusMFANotEnabled(nil)))
+		return
+	}
+	step, ok := util.ValidateTOTP(t.Secret, in.Code, time.Now(), mfaSkew)
+	if !ok {
+		w.WriteError(errors.New("mfa code is invalid"), retcode.StatusMFACodeInvalid(nil))
+		return
+	}
+
+	codes, err := resetRecoveryCodes(&t)
+	if err != nil {
+		w.WriteError(err, retcode.StatusError(nil))
+		return
+	}
+	t.Enabled = true
+	t.LastUsedStep = step
+	if err := db.Instance().Save(&t).Error; err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+	flog.Infof("user %s enabled mfa", username)
+
+	out := model.MFARecoveryCodesResponse{
+		RecoveryCodes: codes,
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+// MFADisable 校验验证码后关闭二次验证
+func (a *AuthApi) MFADisable(w *apiserver.Response, r *apiserver.Request) {
+	in := model.MFACodeRequest{}
+	if err := r.Unmarshal(&in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+	username, ok := mfaSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	t, err := getEnabledTOTP(username)
+	if err != nil {
+		w.WriteError(err, nil)
+		return
+	}
+	if t == nil {
+		w.WriteError(errors.New("mfa is not enabled"), retcode.StatusMFANotEnabled(nil))
+		return
+	}
+	ok, err = verifySecondFactor(t, in.Code)
+	if err != nil {
+		w.WriteError(err, nil)
+		return
+	}
+	if !ok {
+		w.WriteError(errors.New("mfa code is invalid"), retcode.StatusMFACodeInvalid(nil))
+		return
+	}
+
+	if err := db.Instance().Unscoped().Delete(t).Error; err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+	flog.Infof("user %s disabled mfa", username)
+	w.Write(retcode.StatusOK(nil))
+}
+
+// MFARegenerateRecoveryCodes 校验验证码后重新生成恢复码，旧的恢复码全部失效
+func (a *AuthApi) MFARegenerateRecoveryCodes(w *apiserver.Response, r *apiserver.Request) {
+	in := model.MFACodeRequest{}
+	if err := r.Unmarshal(&in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+	username, ok := mfaSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	t, err := getEnabledTOTP(username)
+	if err != nil {
+		w.WriteError(err, nil)
+		return
+	}
+	if t == nil {
+		w.WriteError(errors.New("mfa is not enabled"), retcode.StatusMFANotEnabled(nil))
+		return
+	}
+	// 只接受TOTP验证码，避免用恢复码无限续期
+	step, ok := util.ValidateTOTP(t.Secret, in.Code, time.Now(), mfaSkew)
+	if !ok || step <= t.LastUsedStep {
+		w.WriteError(errors.New("mfa code is invalid"), retcode.StatusMFACodeInvalid(nil))
+		return
+	}
+
+	codes, err := resetRecoveryCodes(t)
+	if err != nil {
+		w.WriteError(err, retcode.StatusError(nil))
+		return
+	}
+	t.LastUsedStep = step
+	if err := db.Instance().Save(t).Error; err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+
+	out := model.MFARecoveryCodesResponse{
+		RecoveryCodes: codes,
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+// mfaSessionUser 二次验证只能由cookie会话的用户本人管理
+func mfaSessionUser(w *apiserver.Response, r *apiserver.Request) (string, bool) {
+	userinfo, ok := r.Session.UserInfo.(model.SessionUserInfo)
+	if !ok {
+		w.WriteError(errors.New("format session error"), retcode.StatusSessionInvalid(nil))
+		return "", false
+	}
+	if userinfo.TokenID != 0 {
+		w.WriteError(errors.New("mfa cannot be managed by api token"), retcode.StatusTokenNotAllowed(nil))
+		return "", false
+	}
+	return userinfo.Username, true
+}
+
+// verifySecondFactor 校验TOTP验证码或恢复码，通过后更新最后使用的时间步或作废恢复码
+func verifySecondFactor(t *model.UserTOTP, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if step, ok := util.ValidateTOTP(t.Secret, code, time.Now(), mfaSkew); ok {
+		if step <= t.LastUsedStep {
+			// 验证码已经使用过
+			return false, nil
+		}
+		t.LastUsedStep = step
+		err := db.Instance().Model(t).UpdateColumn("last_used_step", step).Error
+		return true, retcode.Wrap(err, retcode.StatusDatabaseError(nil))
+	}
+
+	hash := util.SHA256Hex(normalizeRecoveryCode(code))
+	hashes := t.GetRecoveryCodes()
+	for i, h := range hashes {
+		if h != hash {
+			continue
+		}
+		remain := append(hashes[:i:i], hashes[i+1:]...)
+		if err := t.SetRecoveryCodes(remain); err != nil {
+			return false, err
+		}
+		flog.Warnf("user %s used a mfa recovery code, %d left", t.Username, len(remain))
+		err := db.Instance().Model(t).UpdateColumn("recovery_codes", t.RecoveryCodes).Error
+		return true, retcode.Wrap(err, retcode.StatusDatabaseError(nil))
+	}
+	return false, nil
+}
+
+// resetRecoveryCodes 生成新的恢复码，返回明文，t中只保存摘要
+func resetRecoveryCodes(t *model.UserTOTP) ([]string, error) {
+	codes := make([]string, 0, mfaRecoveryCodes)
+	hashes := make([]string, 0, mfaRecoveryCodes)
+	for i := 0; i < mfaRecoveryCodes; i++ {
+		raw, err := util.RandSecureString(mfaRecoveryLength)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, raw[:mfaRecoveryLength/2]+"-"+raw[mfaRecoveryLength/2:])
+		hashes = append(hashes, util.SHA256Hex(raw))
+	}
+	if err := t.SetRecoveryCodes(hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
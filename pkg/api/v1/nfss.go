@@ -1,17 +1,20 @@
 package v1
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 
 	"gorm.io/gorm"
 
+	"flutelake/fluteNAS/pkg/controller"
 	"flutelake/fluteNAS/pkg/model"
 	"flutelake/fluteNAS/pkg/module/db"
 	"flutelake/fluteNAS/pkg/module/flog"
 	"flutelake/fluteNAS/pkg/module/node"
 	"flutelake/fluteNAS/pkg/module/retcode"
+	"flutelake/fluteNAS/pkg/module/trans"
 	"flutelake/fluteNAS/pkg/server/apiserver"
 	"flutelake/fluteNAS/pkg/util"
 )
@@ -58,7 +61,7 @@ func (s *NFSShareServer) CreateNFSExport(w *apiserver.Response, r *apiserver.Req
 	// 解析请求
 	export := &model.NFSExport{}
 	if err := r.Unmarshal(export); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
@@ -66,16 +69,17 @@ func (s *NFSShareServer) CreateNFSExport(w *apiserver.Response, r *apiserver.Req
 	if export.Acls != "" {
 		var acls []model.NFSAcl
 		if err := json.Unmarshal([]byte(export.Acls), &acls); err != nil {
-			w.WriteError(errors.New("ACLs格式无效，应为有效的JSON数组"), retcode.StatusError(nil))
+			w.WriteError(fmt.Errorf("acls is not a valid json array: %v", err), retcode.StatusParamInvalid(nil).WithArgs("Acls"))
 			return
 		}
 	}
 
 	// 创建记录
 	if result := db.Instance().Create(export); result.Error != nil {
-		w.WriteError(result.Error, retcode.StatusError(nil))
+		w.WriteError(result.Error, retcode.StatusDatabaseError(nil))
 		return
 	}
+	enqueueNFSHost(export.HostIP)
 
 	// 返回响应
 	response := &NFSExportResponse{
@@ -89,7 +93,7 @@ func (s *NFSShareServer) DeleteNFSExport(w *apiserver.Response, r *apiserver.Req
 	// 获取ID参数
 	in := &DeleteNFSExportRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
@@ -97,21 +101,22 @@ func (s *NFSShareServer) DeleteNFSExport(w *apiserver.Response, r *apiserver.Req
 	var export model.NFSExport
 	if result := db.Instance().First(&export, in.ID); result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			w.WriteError(errors.New("未找到NFS共享"), retcode.StatusError(nil))
+			w.WriteError(fmt.Errorf("nfs export %d not found", in.ID), retcode.StatusNFSExportNotFound(nil))
 		} else {
-			w.WriteError(result.Error, retcode.StatusError(nil))
+			w.WriteError(result.Error, retcode.StatusDatabaseError(nil))
 		}
 		return
 	}
 
 	// 删除记录
 	if result := db.Instance().Delete(&export); result.Error != nil {
-		w.WriteError(result.Error, retcode.StatusError(nil))
+		w.WriteError(result.Error, retcode.StatusDatabaseError(nil))
 		return
 	}
+	enqueueNFSHost(export.HostIP)
 
 	// 返回成功响应
-	w.Write(retcode.StatusOK(map[string]string{"message": "NFS共享已成功删除"}))
+	w.Write(retcode.StatusOK(map[string]string{"message": trans.NFS0000().Sprintf(r.Locale())}))
 }
 
 // 添加UpdateNFSExportRequest结构体
@@ -131,7 +136,7 @@ func (s *NFSShareServer) UpdateNFSExport(w *apiserver.Response, r *apiserver.Req
 	// 解析更新请求
 	in := &UpdateNFSExportRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
@@ -139,9 +144,9 @@ func (s *NFSShareServer) UpdateNFSExport(w *apiserver.Response, r *apiserver.Req
 	var existingExport model.NFSExport
 	if result := db.Instance().First(&existingExport, in.ID); result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			w.WriteError(errors.New("未找到NFS共享"), retcode.StatusError(nil))
+			w.WriteError(fmt.Errorf("nfs export %d not found", in.ID), retcode.StatusNFSExportNotFound(nil))
 		} else {
-			w.WriteError(result.Error, retcode.StatusError(nil))
+			w.WriteError(result.Error, retcode.StatusDatabaseError(nil))
 		}
 		return
 	}
@@ -150,7 +155,7 @@ func (s *NFSShareServer) UpdateNFSExport(w *apiserver.Response, r *apiserver.Req
 	if in.Acls != "" {
 		var acls []model.NFSAcl
 		if err := json.Unmarshal([]byte(in.Acls), &acls); err != nil {
-			w.WriteError(errors.New("ACLs格式无效，应为有效的JSON数组"), retcode.StatusError(nil))
+			w.WriteError(fmt.Errorf("acls is not a valid json array: %v", err), retcode.StatusParamInvalid(nil).WithArgs("Acls"))
 			return
 		}
 	}
@@ -165,6 +170,8 @@ func (s *NFSShareServer) UpdateNFSExport(w *apiserver.Response, r *apiserver.Req
 		DefaultACL: in.DefaultACL,
 		Acls:       in.Acls,
 		Protocols:  in.Protocols,
+		Generation: existingExport.Generation + 1,
+		Conditions: existingExport.Conditions,
 	}
 
 	// 保留创建时间
@@ -172,9 +179,12 @@ func (s *NFSShareServer) UpdateNFSExport(w *apiserver.Response, r *apiserver.Req
 
 	// 保存更新
 	if result := db.Instance().Save(&updatedExport); result.Error != nil {
-		w.WriteError(result.Error, retcode.StatusError(nil))
+		w.WriteError(result.Error, retcode.StatusDatabaseError(nil))
 		return
 	}
+	// 修改了主机时原来的主机上同样需要删除导出规则
+	enqueueNFSHost(existingExport.HostIP)
+	enqueueNFSHost(updatedExport.HostIP)
 
 	// 返回响应
 	response := &NFSExportResponse{
@@ -193,7 +203,7 @@ func (s *NFSShareServer) ListNFSExports(w *apiserver.Response, r *apiserver.Requ
 	// 从请求体中获取参数
 	var in NFSExportRequest
 	if err := r.Unmarshal(&in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
@@ -205,7 +215,7 @@ func (s *NFSShareServer) ListNFSExports(w *apiserver.Response, r *apiserver.Requ
 	}
 
 	if result := query.Find(&exports); result.Error != nil {
-		w.WriteError(result.Error, retcode.StatusError(nil))
+		w.WriteError(result.Error, retcode.StatusDatabaseError(nil))
 		return
 	}
 
@@ -228,11 +238,12 @@ type NFSStatusResponse struct {
 func (s *NFSShareServer) NFSStatus(w *apiserver.Response, r *apiserver.Request) {
 	in := &NFSStatusRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
 	cmd := node.NewExec().SetHost(in.HostIP)
+	defer cmd.Close()
 
 	checkInstalled := `
         if command -v ganesha.nfsd >/dev/null 2>&1; then
@@ -241,10 +252,10 @@ func (s *NFSShareServer) NFSStatus(w *apiserver.Response, r *apiserver.Request)
             echo "not_installed"
         fi`
 
-	resBs, err := cmd.Command(checkInstalled)
+	resBs, err := cmd.CommandContext(r.Context(), checkInstalled)
 	if err != nil {
 		flog.Errorf("check NFS-Ganesha is installed on host: %s, error: %v, stdout: %s", in.HostIP, err, string(resBs))
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusNFSServiceCheckFailed(nil).WithArgs(in.HostIP))
 		return
 	}
 
@@ -272,19 +283,20 @@ func (s *NFSShareServer) NFSStatus(w *apiserver.Response, r *apiserver.Request)
                 exit 1
             fi`
 
-		resBs, err = cmd.Command(installScript)
+		// 安装开始后不随请求取消，避免包管理器被中断
+		resBs, err = cmd.CommandContext(context.WithoutCancel(r.Context()), installScript)
 		if err != nil {
 			flog.Errorf("try to install NFS-Ganesha service on host: %s, error: %v, stdout: %s", in.HostIP, err, string(resBs))
-			w.WriteError(err, retcode.StatusError(nil))
+			w.WriteError(err, retcode.StatusNFSInstallFailed(nil).WithArgs(in.HostIP))
 			return
 		}
 	}
 	// 检查 NFS-Ganesha 服务状态
 	checkActive := `systemctl is-active nfs-ganesha`
-	activeResult, err := cmd.Command(checkActive)
+	activeResult, err := cmd.CommandContext(r.Context(), checkActive)
 	if err != nil {
 		flog.Errorf("get NFS-Ganesha service status on host: %s, error: %v, stdout: %s", in.HostIP, err, string(resBs))
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusNFSServiceCheckFailed(nil).WithArgs(in.HostIP))
 		return
 	}
 
@@ -334,7 +346,7 @@ type GetNFSServerStatusResponse struct {
 func (s *NFSShareServer) StartNFSServer(w *apiserver.Response, r *apiserver.Request) {
 	in := &StartNFSServerRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
@@ -343,15 +355,15 @@ func (s *NFSShareServer) StartNFSServer(w *apiserver.Response, r *apiserver.Requ
 		getCurrentUser(r), in.HostIP)
 
 	// 启动服务
-	if err := node.StartNFSServerControl(in.HostIP); err != nil {
+	if err := node.StartNFSServerControl(r.Context(), in.HostIP); err != nil {
 		flog.Errorf("start NFS server on host: %s, error: %v", in.HostIP, err)
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusNFSServiceControlFailed(nil).WithArgs(in.HostIP))
 		return
 	}
 
 	out := &StartNFSServerResponse{
 		Status:  "running",
-		Message: "NFS服务已启动",
+		Message: trans.NFS0001().Sprintf(r.Locale()),
 	}
 	w.Write(retcode.StatusOK(out))
 }
@@ -360,7 +372,7 @@ func (s *NFSShareServer) StartNFSServer(w *apiserver.Response, r *apiserver.Requ
 func (s *NFSShareServer) StopNFSServer(w *apiserver.Response, r *apiserver.Request) {
 	in := &StopNFSServerRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
@@ -369,15 +381,15 @@ func (s *NFSShareServer) StopNFSServer(w *apiserver.Response, r *apiserver.Reque
 		getCurrentUser(r), in.HostIP)
 
 	// 停止服务
-	if err := node.StopNFSServerControl(in.HostIP); err != nil {
+	if err := node.StopNFSServerControl(r.Context(), in.HostIP); err != nil {
 		flog.Errorf("stop NFS server on host: %s, error: %v", in.HostIP, err)
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusNFSServiceControlFailed(nil).WithArgs(in.HostIP))
 		return
 	}
 
 	out := &StopNFSServerResponse{
 		Status:  "stopped",
-		Message: "NFS服务已停止",
+		Message: trans.NFS0002().Sprintf(r.Locale()),
 	}
 	w.Write(retcode.StatusOK(out))
 }
@@ -386,22 +398,22 @@ func (s *NFSShareServer) StopNFSServer(w *apiserver.Response, r *apiserver.Reque
 func (s *NFSShareServer) GetNFSServerStatus(w *apiserver.Response, r *apiserver.Request) {
 	in := &GetNFSServerStatusRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
 	// 获取服务状态
-	status, uptime, err := node.GetNFSServerStatusControl(in.HostIP)
+	status, uptime, err := node.GetNFSServerStatusControl(r.Context(), in.HostIP)
 	if err != nil {
 		flog.Errorf("get NFS server status on host: %s, error: %v", in.HostIP, err)
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusNFSServiceCheckFailed(nil).WithArgs(in.HostIP))
 		return
 	}
 
 	out := &GetNFSServerStatusResponse{
 		Status:  status,
 		Uptime:  uptime,
-		Message: fmt.Sprintf("NFS服务状态: %s", status),
+		Message: trans.NFS0003().Sprintf(r.Locale(), status),
 	}
 	w.Write(retcode.StatusOK(out))
 }
@@ -422,7 +434,7 @@ type ValidateNFSConfigResponse struct {
 func (s *NFSShareServer) ValidateNFSConfig(w *apiserver.Response, r *apiserver.Request) {
 	in := &ValidateNFSConfigRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
@@ -437,7 +449,7 @@ func (s *NFSShareServer) ValidateNFSConfig(w *apiserver.Response, r *apiserver.R
 		out := &ValidateNFSConfigResponse{
 			Valid:   false,
 			Errors:  []string{err.Error()},
-			Message: "配置验证失败",
+			Message: trans.NFS0004().Sprintf(r.Locale()),
 		}
 		w.Write(retcode.StatusOK(out))
 		return
@@ -446,7 +458,7 @@ func (s *NFSShareServer) ValidateNFSConfig(w *apiserver.Response, r *apiserver.R
 	out := &ValidateNFSConfigResponse{
 		Valid:   true,
 		Errors:  []string{},
-		Message: "配置验证通过",
+		Message: trans.NFS0005().Sprintf(r.Locale()),
 	}
 	w.Write(retcode.StatusOK(out))
 }
@@ -467,13 +479,13 @@ type UpdateExportStatusResponse struct {
 func (s *NFSShareServer) UpdateExportStatus(w *apiserver.Response, r *apiserver.Request) {
 	in := &UpdateExportStatusRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
 	// 验证状态值
 	if in.Status != "enabled" && in.Status != "disabled" {
-		w.WriteError(errors.New("状态必须是enabled或disabled"), retcode.StatusError(nil))
+		w.WriteError(fmt.Errorf("invalid status %s", in.Status), retcode.StatusParamInvalid(nil).WithArgs("Status"))
 		return
 	}
 
@@ -485,7 +497,7 @@ func (s *NFSShareServer) UpdateExportStatus(w *apiserver.Response, r *apiserver.
 	dbInstance := db.Instance()
 	if err := model.UpdateStatus(dbInstance, in.ID, in.Status); err != nil {
 		flog.Errorf("update NFS export status failed, ID: %d, error: %v", in.ID, err)
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
 		return
 	}
 
@@ -493,21 +505,16 @@ func (s *NFSShareServer) UpdateExportStatus(w *apiserver.Response, r *apiserver.
 	var updatedExport model.NFSExport
 	if result := dbInstance.First(&updatedExport, in.ID); result.Error != nil {
 		flog.Errorf("get NFS export after status update failed, ID: %d, error: %v", in.ID, result.Error)
-		w.WriteError(result.Error, retcode.StatusError(nil))
+		w.WriteError(result.Error, retcode.StatusDatabaseError(nil))
 		return
 	}
 
-	// 尝试触发配置同步（异步进行，不阻塞响应）
-	go func() {
-		if err := triggerNFSConfigSync(updatedExport.HostIP); err != nil {
-			flog.Errorf("trigger NFS config sync after status update failed, HostIP: %s, error: %v",
-				updatedExport.HostIP, err)
-		}
-	}()
+	// 触发配置同步（异步进行，不阻塞响应）
+	enqueueNFSHost(updatedExport.HostIP)
 
 	out := &UpdateExportStatusResponse{
 		Status:  in.Status,
-		Message: fmt.Sprintf("导出规则状态已更新为%s", in.Status),
+		Message: trans.NFS0006().Sprintf(r.Locale(), in.Status),
 	}
 	w.Write(retcode.StatusOK(out))
 }
@@ -528,7 +535,7 @@ type TestExportConfigResponse struct {
 func (s *NFSShareServer) TestExportConfig(w *apiserver.Response, r *apiserver.Request) {
 	in := &TestExportConfigRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
@@ -550,7 +557,7 @@ func (s *NFSShareServer) TestExportConfig(w *apiserver.Response, r *apiserver.Re
 		out := &TestExportConfigResponse{
 			Valid:   false,
 			Errors:  []string{err.Error()},
-			Message: "导出规则配置测试失败",
+			Message: trans.NFS0007().Sprintf(r.Locale()),
 		}
 		w.Write(retcode.StatusOK(out))
 		return
@@ -564,25 +571,22 @@ func (s *NFSShareServer) TestExportConfig(w *apiserver.Response, r *apiserver.Re
 	w.Write(retcode.StatusOK(out))
 }
 
-// triggerNFSConfigSync 触发NFS配置同步
-func triggerNFSConfigSync(hostIP string) error {
-	// 获取所有启用的导出规则
-	exports, err := model.GetEnabledByHostIP(db.Instance(), hostIP)
-	if err != nil {
-		return fmt.Errorf("get enabled exports for host %s failed: %w", hostIP, err)
-	}
-
-	// 使用exec来生成并应用配置
-	cmd := node.NewExec().SetHost(hostIP)
-	if err := cmd.RefreshNFSGaneshaConfig(exports); err != nil {
-		return fmt.Errorf("refresh NFS config for host %s failed: %w", hostIP, err)
+// enqueueNFSHost 把主机加入NFS配置同步的队列，未指定主机的导出规则在本机生效
+func enqueueNFSHost(hostIP string) {
+	if hostIP == "" {
+		hostIP = model.LocalHost
 	}
-
-	return nil
+	controller.Enqueue(controller.ReconcilerNFSShare, hostIP)
 }
 
-// getCurrentUser 获取当前用户（简化实现）
+// getCurrentUser 获取当前会话的用户名
 func getCurrentUser(r *apiserver.Request) string {
-	// TODO: 从session或token中获取实际用户名
-	return "admin"
+	if r.Session == nil {
+		return ""
+	}
+	userinfo, ok := r.Session.UserInfo.(model.SessionUserInfo)
+	if !ok {
+		return ""
+	}
+	return userinfo.Username
 }
@@ -0,0 +1,92 @@
+package v1
+
+import (
+	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"flutelake/fluteNAS/pkg/module/trans"
+	"flutelake/fluteNAS/pkg/server/apiserver"
+	"sync"
+
+	"gorm.io/gorm/clause"
+)
+
+// PreferenceAPI 用户的个人设置，语言设置缓存在内存中，每个请求都会读取
+type PreferenceAPI struct {
+	mu      sync.RWMutex
+	locales map[string]trans.Locale
+}
+
+func NewPreferenceAPI() *PreferenceAPI {
+	return &PreferenceAPI{
+		locales: map[string]trans.Locale{},
+	}
+}
+
+// Load 从数据库加载所有用户的语言设置
+func (a *PreferenceAPI) Load() error {
+	var prefs []model.UserPreference
+	if err := db.Instance().Where("locale <> ''").Find(&prefs).Error; err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, p := range prefs {
+		a.locales[p.Username] = trans.Locale(p.Locale)
+	}
+	return nil
+}
+
+// PreferredLocale 实现 apiserver.LocalePreference
+func (a *PreferenceAPI) PreferredLocale(sess *apiserver.Session) (trans.Locale, bool) {
+	userinfo, ok := sess.UserInfo.(model.SessionUserInfo)
+	if !ok {
+		return "", false
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	locale, ok := a.locales[userinfo.Username]
+	return locale, ok
+}
+
+func (a *PreferenceAPI) GetPreference(w *apiserver.Response, r *apiserver.Request) {
+	locale, _ := a.PreferredLocale(r.Session)
+	w.Write(retcode.StatusOK(model.GetUserPreferenceResponse{Locale: string(locale)}))
+}
+
+func (a *PreferenceAPI) SetPreference(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.SetUserPreferenceRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+	userinfo, ok := r.Session.UserInfo.(model.SessionUserInfo)
+	if !ok {
+		w.WriteError(errors.New("format session error"), retcode.StatusSessionInvalid(nil))
+		return
+	}
+
+	pref := model.UserPreference{
+		Username: userinfo.Username,
+		Locale:   in.Locale,
+	}
+	err := db.Instance().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "username"}},
+		DoUpdates: clause.AssignmentColumns([]string{"locale", "updated_at", "deleted_at"}),
+	}).Create(&pref).Error
+	if err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+
+	a.mu.Lock()
+	if in.Locale == "" {
+		delete(a.locales, userinfo.Username)
+	} else {
+		a.locales[userinfo.Username] = trans.Locale(in.Locale)
+	}
+	a.mu.Unlock()
+
+	w.Write(retcode.StatusOK(model.SetUserPreferenceResponse{Locale: in.Locale}))
+}
@@ -1,7 +1,9 @@
 package v1
 
 import (
+	"context"
 	"encoding/json"
+	"flutelake/fluteNAS/pkg/controller"
 	"flutelake/fluteNAS/pkg/model"
 	"flutelake/fluteNAS/pkg/module/db"
 	"flutelake/fluteNAS/pkg/module/flog"
@@ -44,6 +46,8 @@ type SambaShare struct {
 	Pseudo          string                 `json:"Pseudo"`
 	UserPermissions []model.UserPermission `json:"Users" gorm:"foreignKey:SambaShareID"`
 	Status          string                 `json:"Status" gorm:"default:init"`
+	Generation      int64                  `json:"Generation"`
+	Conditions      model.ConditionsString `json:"Conditions"`
 	CreatedAt       time.Time              `json:"CreatedAt"`
 	UpdatedAt       time.Time              `json:"UpdatedAt"`
 }
@@ -83,7 +87,7 @@ type SambaStatusResponse struct {
 func (s *SambaShareServer) CreateShare(w *apiserver.Response, r *apiserver.Request) {
 	in := &CreateSambaShareRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
@@ -104,9 +108,10 @@ func (s *SambaShareServer) CreateShare(w *apiserver.Response, r *apiserver.Reque
 
 	// Use actual DB instance
 	if err := db.Instance().Create(&share).Error; err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
 		return
 	}
+	controller.Enqueue(controller.ReconcilerSambaShare, share.HostIP)
 
 	out := CreateSambaShareResponse{
 		ID:   share.ID,
@@ -121,7 +126,7 @@ func (s *SambaShareServer) ListShares(w *apiserver.Response, r *apiserver.Reques
 
 	// Use actual DB instance
 	if err := db.Instance().Find(&shares).Error; err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
 		return
 	}
 
@@ -134,6 +139,8 @@ func (s *SambaShareServer) ListShares(w *apiserver.Response, r *apiserver.Reques
 			Pseudo:          share.Pseudo,
 			UserPermissions: share.UserPermissions.Get(),
 			Status:          share.Status,
+			Generation:      share.Generation,
+			Conditions:      share.Conditions,
 			HostIP:          share.HostIP,
 			CreatedAt:       share.CreatedAt,
 			UpdatedAt:       share.UpdatedAt,
@@ -149,14 +156,14 @@ func (s *SambaShareServer) ListShares(w *apiserver.Response, r *apiserver.Reques
 func (s *SambaShareServer) UpdateShare(w *apiserver.Response, r *apiserver.Request) {
 	in := &UpdateSambaShareRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
 	var share model.SambaShare
 	// Use actual DB instance
 	if err := db.Instance().First(&share, in.ID).Error; err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, dbRetCode(err, retcode.StatusSambaShareNotFound(nil)))
 		return
 	}
 
@@ -166,12 +173,16 @@ func (s *SambaShareServer) UpdateShare(w *apiserver.Response, r *apiserver.Reque
 	if in.Path != "" {
 		share.Path = in.Path
 	}
+	// 控制器重新生成smb.conf后改为active
+	share.Status = model.SambaShareStatus_Updating
+	share.Generation++
 
 	// Use actual DB instance
 	if err := db.Instance().Save(&share).Error; err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
 		return
 	}
+	controller.Enqueue(controller.ReconcilerSambaShare, share.HostIP)
 
 	out := UpdateSambaShareResponse{
 		ID: in.ID,
@@ -182,23 +193,26 @@ func (s *SambaShareServer) UpdateShare(w *apiserver.Response, r *apiserver.Reque
 func (s *SambaShareServer) DeleteShare(w *apiserver.Response, r *apiserver.Request) {
 	in := &DeleteSambaShareRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
 	var share model.SambaShare
 	// Use actual DB instance
 	if err := db.Instance().First(&share, in.ID).Error; err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, dbRetCode(err, retcode.StatusSambaShareNotFound(nil)))
 		return
 	}
 
-	// todo 删除需要通过状态来删除
+	// 控制器从smb.conf中移除共享后删除记录
+	share.Status = model.SambaShareStatus_Deleting
+	share.Generation++
 	// Use actual DB instance
-	if err := db.Instance().Delete(&share).Error; err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+	if err := db.Instance().Save(&share).Error; err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
 		return
 	}
+	controller.Enqueue(controller.ReconcilerSambaShare, share.HostIP)
 
 	out := DeleteSambaShareResponse{
 		ID: in.ID,
@@ -209,11 +223,12 @@ func (s *SambaShareServer) DeleteShare(w *apiserver.Response, r *apiserver.Reque
 func (s *SambaShareServer) SambaStatus(w *apiserver.Response, r *apiserver.Request) {
 	in := &SambaStatusRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
 	cmd := node.NewExec().SetHost(in.HostIP)
+	defer cmd.Close()
 
 	checkInstalled := `
         if command -v smbd >/dev/null 2>&1; then
@@ -222,10 +237,10 @@ func (s *SambaShareServer) SambaStatus(w *apiserver.Response, r *apiserver.Reque
             echo "not_installed"
         fi`
 
-	resBs, err := cmd.Command(checkInstalled)
+	resBs, err := cmd.CommandContext(r.Context(), checkInstalled)
 	if err != nil {
 		flog.Errorf("check samba is installed on host: %s, error: %v, stdout: %s", in.HostIP, err, string(resBs))
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusSambaServiceCheckFailed(nil).WithArgs(in.HostIP))
 		return
 	}
 
@@ -251,19 +266,20 @@ func (s *SambaShareServer) SambaStatus(w *apiserver.Response, r *apiserver.Reque
                 exit 1
             fi`
 
-		resBs, err = cmd.Command(installScript)
+		// 安装开始后不随请求取消，避免包管理器被中断
+		resBs, err = cmd.CommandContext(context.WithoutCancel(r.Context()), installScript)
 		if err != nil {
 			flog.Errorf("try to install samba service on host: %s, error: %v, stdout: %s", in.HostIP, err, string(resBs))
-			w.WriteError(err, retcode.StatusError(nil))
+			w.WriteError(err, retcode.StatusSambaInstallFailed(nil).WithArgs(in.HostIP))
 			return
 		}
 	}
 	// 检查 samba 服务状态
 	checkActive := `systemctl is-active smbd`
-	activeResult, err := cmd.Command(checkActive)
+	activeResult, err := cmd.CommandContext(r.Context(), checkActive)
 	if err != nil {
 		flog.Errorf("get samba service status on host: %s, error: %v, stdout: %s", in.HostIP, err, string(resBs))
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusSambaServiceCheckFailed(nil).WithArgs(in.HostIP))
 		return
 	}
 
@@ -1,10 +1,12 @@
 package v1
 
 import (
+	"flutelake/fluteNAS/pkg/controller"
 	"flutelake/fluteNAS/pkg/model"
 	"flutelake/fluteNAS/pkg/module/db"
 	"flutelake/fluteNAS/pkg/module/retcode"
 	"flutelake/fluteNAS/pkg/server/apiserver"
+	"strconv"
 )
 
 type SambaUserServer struct{}
@@ -12,7 +14,7 @@ type SambaUserServer struct{}
 func (s *SambaUserServer) CreateUser(w *apiserver.Response, r *apiserver.Request) {
 	in := &model.SambaUser{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
@@ -21,9 +23,10 @@ func (s *SambaUserServer) CreateUser(w *apiserver.Response, r *apiserver.Request
 	in.Status = model.SambaUserStatus_Init
 	// Use actual DB instance
 	if err := db.Instance().Create(&in).Error; err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
 		return
 	}
+	controller.Enqueue(controller.ReconcilerSambaUser, strconv.FormatUint(uint64(in.ID), 10))
 
 	out := model.CreateSambaUserResponse{
 		ID:       in.ID,
@@ -37,7 +40,7 @@ func (s *SambaUserServer) ListUsers(w *apiserver.Response, r *apiserver.Request)
 
 	// Use actual DB instance
 	if err := db.Instance().Find(&users).Error; err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
 		return
 	}
 
@@ -50,25 +53,27 @@ func (s *SambaUserServer) ListUsers(w *apiserver.Response, r *apiserver.Request)
 func (s *SambaUserServer) UpdateUser(w *apiserver.Response, r *apiserver.Request) {
 	in := &model.UpdateSambaUserRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
 	var user model.SambaUser
 	// Use actual DB instance
 	if err := db.Instance().First(&user, in.ID).Error; err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, dbRetCode(err, retcode.StatusSambaUserNotFound(nil)))
 		return
 	}
 
 	user.Password = in.Password
 	user.Status = model.SambaUserStatus_ChangingPWD
+	user.Generation++
 
 	// Use actual DB instance
 	if err := db.Instance().Save(&user).Error; err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
 		return
 	}
+	controller.Enqueue(controller.ReconcilerSambaUser, strconv.FormatUint(uint64(user.ID), 10))
 
 	out := model.UpdateSambaUserResponse{
 		ID: in.ID,
@@ -79,27 +84,29 @@ func (s *SambaUserServer) UpdateUser(w *apiserver.Response, r *apiserver.Request
 func (s *SambaUserServer) DeleteUser(w *apiserver.Response, r *apiserver.Request) {
 	in := &model.DeleteSambaUserRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteParamError(err)
 		return
 	}
 
 	var user model.SambaUser
 	// Use actual DB instance
 	if err := db.Instance().First(&user, in.ID).Error; err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, dbRetCode(err, retcode.StatusSambaUserNotFound(nil)))
 		return
 	}
 
 	// Use actual DB instance
 	user.Status = model.SambaUserStatus_Deleting
+	user.Generation++
 	if err := db.Instance().Save(&user).Error; err != nil {
-		w.WriteError(err, retcode.StatusError(nil))
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
 		return
 	}
 	// if err := db.Instance().Delete(&user).Error; err != nil {
 	// 	w.WriteError(err, retcode.StatusError(nil))
 	// 	return
 	// }
+	controller.Enqueue(controller.ReconcilerSambaUser, strconv.FormatUint(uint64(user.ID), 10))
 
 	out := model.DeleteSambaUserResponse{
 		ID: in.ID,
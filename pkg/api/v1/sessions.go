@@ -0,0 +1,193 @@
+package v1
+
+import (
+	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/cache"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"flutelake/fluteNAS/pkg/server/apiserver"
+	"flutelake/fluteNAS/pkg/util"
+	"time"
+)
+
+type SessionAPI struct {
+	cache cache.TinyCache
+	// 加密会话中ssh密码的AES密钥
+	key []byte
+}
+
+func NewSessionAPI(c cache.TinyCache, key []byte) *SessionAPI {
+	return &SessionAPI{
+		cache: c,
+		key:   key,
+	}
+}
+
+// Save 实现 apiserver.SessionStore，密码加密后保存
+func (a *SessionAPI) Save(sess *apiserver.Session) error {
+	userinfo, ok := sess.UserInfo.(model.SessionUserInfo)
+	if !ok {
+		return errors.New("format session error")
+	}
+
+	s := model.Session{
+		SessionHash: apiserver.SessionHash(sess.SessionID),
+		Username:    userinfo.Username,
+		ClientIP:    sess.ClientIP,
+		UserAgent:   sess.UserAgent,
+		ExpiresAt:   sess.ExpiresAt,
+	}
+	if userinfo.Password != nil {
+		cipher, err := util.AESGCMEncrypt(a.key, []byte(userinfo.Password.String()))
+		if err != nil {
+			return err
+		}
+		s.PasswordCipher = cipher
+	}
+	return db.Instance().Create(&s).Error
+}
+
+// Restore 清理过期的会话，并把未过期的会话重新加载到缓存
+func (a *SessionAPI) Restore() error {
+	now := time.Now()
+	if err := db.Instance().Unscoped().Where("expires_at <= ?", now).Delete(&model.Session{}).Error; err != nil {
+		return err
+	}
+
+	sessions := []model.Session{}
+	if err := db.Instance().Find(&sessions).Error; err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		// 重新获取角色，重启期间角色可能发生了变化
+		role, err := resolveUserRole(s.Username)
+		if err != nil {
+			flog.Warnf("restore session %d of user %s failed: %v", s.ID, s.Username, err)
+			continue
+		}
+		userinfo := model.SessionUserInfo{
+			Username: s.Username,
+			IsAdmin:  role == model.RoleAdmin,
+			Role:     role,
+		}
+		if s.PasswordCipher != "" {
+			pwd, err := util.AESGCMDecrypt(a.key, s.PasswordCipher)
+			if err != nil {
+				// 会话密钥发生了变化，会话仍然有效，只是无法打开web终端
+				flog.Warnf("decrypt password of session %d failed: %v", s.ID, err)
+			} else {
+				userinfo.Password = util.NewLinkedRune(string(pwd))
+			}
+		}
+		a.cache.SetExpired(apiserver.GenSessionCacheIDByHash(s.SessionHash), &apiserver.Session{
+			UserInfo:  userinfo,
+			ExpiresAt: s.ExpiresAt,
+			ClientIP:  s.ClientIP,
+			UserAgent: s.UserAgent,
+		}, s.ExpiresAt.Sub(now))
+	}
+	flog.Infof("restored %d sessions", len(sessions))
+	return nil
+}
+
+// ListSessions 列出当前用户未过期的会话
+func (a *SessionAPI) ListSessions(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.ListSessionsRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+
+	userinfo, ok := r.Session.UserInfo.(model.SessionUserInfo)
+	if !ok {
+		w.WriteError(errors.New("format session error"), retcode.StatusSessionInvalid(nil))
+		return
+	}
+
+	query := db.Instance().Where("expires_at > ?", time.Now()).Order("id desc")
+	if !in.All || !userinfo.HasPermission(model.PermissionUserManage) {
+		query = query.Where("username = ?", userinfo.Username)
+	}
+	sessions := []model.Session{}
+	if err := query.Find(&sessions).Error; err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+
+	current := currentSessionHash(r, userinfo)
+	out := model.ListSessionsResponse{
+		Sessions: make([]model.SessionInfo, 0, len(sessions)),
+	}
+	for _, s := range sessions {
+		out.Sessions = append(out.Sessions, model.SessionInfo{
+			ID:        s.ID,
+			Username:  s.Username,
+			ClientIP:  s.ClientIP,
+			UserAgent: s.UserAgent,
+			CreatedAt: s.CreatedAt,
+			ExpiresAt: s.ExpiresAt,
+			Current:   s.SessionHash == current,
+		})
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+// RevokeSession 吊销会话，吊销当前会话等同于退出登录
+func (a *SessionAPI) RevokeSession(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.RevokeSessionRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+
+	userinfo, ok := r.Session.UserInfo.(model.SessionUserInfo)
+	if !ok {
+		w.WriteError(errors.New("format session error"), retcode.StatusSessionInvalid(nil))
+		return
+	}
+
+	var s model.Session
+	if err := db.Instance().First(&s, in.ID).Error; err != nil {
+		w.WriteError(err, dbRetCode(err, retcode.StatusNotFound(nil).WithArgs("session")))
+		return
+	}
+	// 只能吊销自己的会话，拥有用户管理权限时可以吊销所有会话
+	if s.Username != userinfo.Username && !userinfo.HasPermission(model.PermissionUserManage) {
+		w.WriteError(errors.New("cannot revoke session of other users"), retcode.StatusForbidden(nil))
+		return
+	}
+
+	if err := revokeSession(a.cache, s.SessionHash); err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+	flog.Infof("session %d of user %s revoked by user %s", s.ID, s.Username, userinfo.Username)
+
+	if s.SessionHash == currentSessionHash(r, userinfo) {
+		w.NullCookie()
+	}
+	out := model.RevokeSessionResponse{
+		ID: in.ID,
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+// revokeSession 从缓存和数据库中删除会话
+func revokeSession(c cache.TinyCache, hash string) error {
+	c.Delete(apiserver.GenSessionCacheIDByHash(hash))
+	return db.Instance().Unscoped().Where("session_hash = ?", hash).Delete(&model.Session{}).Error
+}
+
+// currentSessionHash 返回发起请求的cookie会话的摘要，token认证时返回空
+func currentSessionHash(r *apiserver.Request, userinfo model.SessionUserInfo) string {
+	if userinfo.TokenID != 0 {
+		return ""
+	}
+	cookie, err := r.GetCookie()
+	if err != nil {
+		return ""
+	}
+	return apiserver.SessionHash(cookie.Value)
+}
@@ -0,0 +1,286 @@
+package v1
+
+import (
+	"errors"
+	"flutelake/fluteNAS/pkg/controller"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/backup"
+	"flutelake/fluteNAS/pkg/module/cache"
+	"flutelake/fluteNAS/pkg/module/certs"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"flutelake/fluteNAS/pkg/server/apiserver"
+	"flutelake/fluteNAS/pkg/util"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 导出的配置归档保留的时间，超时后需要重新导出
+const configExportTTL = time.Minute * 10
+
+// MaxConfigArchiveBytes 导入的配置归档大小上限，归档中包含数据库快照
+const MaxConfigArchiveBytes int64 = 256 << 20
+
+type SystemAPI struct {
+	// 未启用https时为nil
+	certs *certs.Manager
+	cache cache.TinyCache
+	// 数据目录，导出的归档和恢复前的备份保存在这里
+	dataPath  string
+	dbBackups *backup.Database
+}
+
+func NewSystemAPI(certManager *certs.Manager, c cache.TinyCache, dataPath string, dbBackups *backup.Database) *SystemAPI {
+	return &SystemAPI{
+		certs:     certManager,
+		cache:     c,
+		dataPath:  dataPath,
+		dbBackups: dbBackups,
+	}
+}
+
+type configExport struct {
+	Path     string
+	Filename string
+}
+
+// TLSInfo 获取当前https证书信息
+func (a *SystemAPI) TLSInfo(w *apiserver.Response, r *apiserver.Request) {
+	out := model.TLSInfoResponse{}
+	if a.certs != nil {
+		info, err := a.certs.Info()
+		if err != nil {
+			w.WriteError(err, retcode.StatusError(nil))
+			return
+		}
+		out.Enabled = true
+		out.Certificate = info
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+// UploadTLSCertificate 上传证书和私钥，校验通过后立即替换正在使用的证书
+func (a *SystemAPI) UploadTLSCertificate(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.UploadTLSCertificateRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+	if a.certs == nil {
+		w.WriteError(errors.New("https is not enabled"), retcode.StatusHTTPSDisabled(nil))
+		return
+	}
+
+	info, err := a.certs.Update([]byte(in.Certificate), []byte(in.PrivateKey))
+	if err != nil {
+		w.WriteError(err, retcode.StatusCertificateInvalid(nil))
+		return
+	}
+	flog.Infof("tls certificate %s (%s) uploaded by user %s", info.Subject, info.Fingerprint, getCurrentUser(r))
+
+	out := model.UploadTLSCertificateResponse{
+		Certificate: info,
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+// ExportConfig 导出配置归档，返回一次性的下载地址
+func (a *SystemAPI) ExportConfig(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.ExportConfigRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+
+	dir := filepath.Join(a.dataPath, "config-exports")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		w.WriteError(err, retcode.StatusError(nil))
+		return
+	}
+	purgeConfigExports(dir)
+	f, err := os.CreateTemp(dir, "config-*.tar.gz")
+	if err != nil {
+		w.WriteError(err, retcode.StatusError(nil))
+		return
+	}
+	defer f.Close()
+	err = backup.Export(db.Instance(), f, backup.ExportOptions{Format: in.Format, Passphrase: in.Passphrase})
+	if err != nil {
+		os.Remove(f.Name())
+		if errors.Is(err, backup.ErrPassphraseRequired) {
+			w.WriteError(err, retcode.StatusParamInvalid(nil).WithArgs("Passphrase"))
+			return
+		}
+		w.WriteError(err, retcode.StatusError(nil))
+		return
+	}
+	info, err := f.Stat()
+	if err != nil {
+		w.WriteError(err, retcode.StatusError(nil))
+		return
+	}
+
+	token, err := util.RandSecureString(32)
+	if err != nil {
+		w.WriteError(err, retcode.StatusError(nil))
+		return
+	}
+	filename := fmt.Sprintf("flutenas-config-%s.tar.gz", time.Now().Format("20060102-150405"))
+	if in.Passphrase != "" {
+		filename += ".enc"
+	}
+	a.cache.SetExpired(configExportCacheKey(token), &configExport{Path: f.Name(), Filename: filename}, configExportTTL)
+	flog.Infof("configuration exported by user %s, encrypted: %v", getCurrentUser(r), in.Passphrase != "")
+
+	w.Write(retcode.StatusOK(model.ExportConfigResponse{
+		Token:     token,
+		Location:  "/v1/system/config/download?Token=" + token,
+		Filename:  filename,
+		Size:      info.Size(),
+		Encrypted: in.Passphrase != "",
+	}))
+}
+
+// DownloadConfig 下载导出的配置归档，下载后删除服务器上的文件
+func (a *SystemAPI) DownloadConfig(w http.ResponseWriter, r *http.Request) {
+	v, ok := a.cache.BurnAfterGet(configExportCacheKey(r.URL.Query().Get("Token")))
+	export, _ := v.(*configExport)
+	if !ok || export == nil {
+		http.Error(w, "Token is invalid or expired", http.StatusGone)
+		return
+	}
+	defer os.Remove(export.Path)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", export.Filename))
+	http.ServeFile(w, r, export.Path)
+}
+
+// ImportConfig 从上传的归档恢复配置，DryRun 时只返回与当前配置的差异。
+// 归档通过 multipart 的 Archive 字段上传，密码通过 Passphrase 字段提交
+func (a *SystemAPI) ImportConfig(w *apiserver.Response, r *apiserver.Request) {
+	q := r.Request.URL.Query()
+	dryRun := q.Get("DryRun") == "true"
+	var names []string
+	if c := strings.TrimSpace(q.Get("Categories")); c != "" {
+		names = strings.Split(c, ",")
+	}
+	categories, err := backup.ParseCategories(names)
+	if err != nil {
+		w.WriteError(err, retcode.StatusParamInvalid(nil).WithArgs("Categories"))
+		return
+	}
+
+	if err := r.Request.ParseMultipartForm(32 << 20); err != nil {
+		w.WriteError(err, retcode.StatusUploadInvalid(nil))
+		return
+	}
+	defer r.Request.MultipartForm.RemoveAll()
+	file, _, err := r.Request.FormFile("Archive")
+	if err != nil {
+		w.WriteError(err, retcode.StatusUploadInvalid(nil))
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		w.WriteError(err, retcode.StatusUploadInvalid(nil))
+		return
+	}
+
+	cfg, err := backup.ReadArchive(data, r.Request.FormValue("Passphrase"))
+	if err != nil {
+		switch {
+		case errors.Is(err, backup.ErrPassphrase):
+			w.WriteError(err, retcode.StatusConfigPassphraseInvalid(nil))
+		case errors.Is(err, backup.ErrArchiveTooNew):
+			w.WriteError(err, retcode.StatusConfigArchiveTooNew(nil))
+		default:
+			w.WriteError(err, retcode.StatusConfigArchiveInvalid(nil))
+		}
+		return
+	}
+	current, err := backup.LoadConfig(db.Instance())
+	if err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+
+	out := model.ImportConfigResponse{
+		DryRun:        dryRun,
+		FormatVersion: cfg.FormatVersion,
+		SchemaVersion: cfg.SchemaVersion,
+		AppVersion:    cfg.AppVersion,
+		CreatedAt:     cfg.CreatedAt,
+		Categories:    categories,
+		Diffs:         backup.Diff(current, cfg, categories),
+	}
+	if !dryRun {
+		// 恢复前备份当前数据库，恢复错误时可以手动还原
+		dir := filepath.Join(a.dataPath, "restore-backups")
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			w.WriteError(err, retcode.StatusError(nil))
+			return
+		}
+		out.BackupFile = filepath.Join(dir, fmt.Sprintf("nas.db.%s.bak", time.Now().Format("20060102150405")))
+		if err := db.BackupTo(db.Instance(), out.BackupFile); err != nil {
+			w.WriteError(err, retcode.StatusDatabaseError(nil))
+			return
+		}
+		if err := backup.Restore(db.Instance(), cfg, categories); err != nil {
+			w.WriteError(err, retcode.StatusDatabaseError(nil))
+			return
+		}
+		flog.Infof("configuration %v restored from archive created at %s by user %s, backup: %s",
+			categories, cfg.CreatedAt.Format(time.RFC3339), getCurrentUser(r), out.BackupFile)
+		// 恢复的对象立即下发到主机，不等待定时同步
+		if err := controller.ResyncAll(); err != nil {
+			flog.Errorf("resync after restore failed: %v", err)
+		}
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+// ListDatabaseBackups 列出定时备份的数据库文件，Verify 时校验每个文件的sha256
+func (a *SystemAPI) ListDatabaseBackups(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.ListDatabaseBackupsRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+	backups, err := a.dbBackups.List(in.Verify)
+	if err != nil {
+		w.WriteError(err, retcode.StatusError(nil))
+		return
+	}
+	w.Write(retcode.StatusOK(model.ListDatabaseBackupsResponse{
+		Dir:     a.dbBackups.Dir(),
+		Backups: backups,
+	}))
+}
+
+func configExportCacheKey(token string) string {
+	return "configexport:" + token
+}
+
+// purgeConfigExports 删除过期没有下载的归档
+func purgeConfigExports(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) < configExportTTL {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			flog.Warnf("remove expired config export %s failed: %v", e.Name(), err)
+		}
+	}
+}
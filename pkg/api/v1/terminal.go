@@ -22,13 +22,18 @@ func NewTerminalAPI(terms *terminal.WebTerminal) *TerminalAPI {
 func (a *TerminalAPI) CreateTerminal(w *apiserver.Response, r *apiserver.Request) {
 	in := &model.CreateTerminalRequest{}
 	if err := r.Unmarshal(in); err != nil {
-		w.WriteError(err, retcode.StatusError)
+		w.WriteParamError(err)
 		return
 	}
 	// get username and password from session
 	userinfo, ok := r.Session.UserInfo.(model.SessionUserInfo)
 	if !ok {
-		w.WriteError(fmt.Errorf("format session error"), retcode.StatusError)
+		w.WriteError(fmt.Errorf("format session error"), retcode.StatusSessionInvalid(nil))
+		return
+	}
+	// token认证的会话没有ssh密码，无法打开终端
+	if userinfo.TokenID != 0 || userinfo.Password == nil {
+		w.WriteError(fmt.Errorf("terminal is not available for api token"), retcode.StatusTokenNotAllowed(nil))
 		return
 	}
 	// if host_ip not eq localhost, get host ip from db
@@ -58,7 +63,8 @@ func (a *TerminalAPI) CreateTerminal(w *apiserver.Response, r *apiserver.Request
 		},
 	})
 	if err != nil {
-		w.WriteError(err, nil)
+		w.WriteError(err, retcode.StatusError(nil))
+		return
 	}
 	out := model.CreateTerminalResponse{
 		Token: token,
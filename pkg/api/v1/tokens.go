@@ -0,0 +1,197 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"flutelake/fluteNAS/pkg/server/apiserver"
+	"flutelake/fluteNAS/pkg/util"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// token明文前缀，方便在日志和密钥扫描中识别
+	apiTokenPrefix = "fnt_"
+	apiTokenLength = 40
+	// 最后使用时间的更新间隔，避免每个请求都写库
+	apiTokenTouchInterval = time.Minute
+)
+
+type TokenAPI struct{}
+
+func NewTokenAPI() *TokenAPI {
+	return &TokenAPI{}
+}
+
+// Authenticate 实现 apiserver.TokenAuthenticator
+func (a *TokenAPI) Authenticate(token string, path string) (*apiserver.Session, error) {
+	var t model.APIToken
+	err := db.Instance().First(&t, "token_hash = ?", util.SHA256Hex(token)).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			flog.Errorf("query api token failed: %v", err)
+		}
+		return nil, apiserver.ErrTokenInvalid
+	}
+	now := time.Now()
+	if t.Expired(now) {
+		return nil, apiserver.ErrTokenInvalid
+	}
+	if !t.Scopes.Allow(path) {
+		return nil, apiserver.ErrTokenOutOfScope
+	}
+
+	// token的权限跟随所属用户当前的角色
+	role, err := resolveUserRole(t.Username)
+	if err != nil {
+		return nil, apiserver.ErrTokenInvalid
+	}
+
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) > apiTokenTouchInterval {
+		if err := db.Instance().Model(&t).UpdateColumn("last_used_at", now).Error; err != nil {
+			flog.Warnf("update api token %d last used time failed: %v", t.ID, err)
+		}
+	}
+
+	return &apiserver.Session{
+		SessionID: fmt.Sprintf("token:%d", t.ID),
+		UserInfo: model.SessionUserInfo{
+			Username: t.Username,
+			IsAdmin:  role == model.RoleAdmin,
+			Role:     role,
+			TokenID:  t.ID,
+		},
+	}, nil
+}
+
+func (a *TokenAPI) CreateToken(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.CreateAPITokenRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+
+	userinfo, ok := r.Session.UserInfo.(model.SessionUserInfo)
+	if !ok {
+		w.WriteError(errors.New("format session error"), retcode.StatusSessionInvalid(nil))
+		return
+	}
+	// 不允许使用token创建新的token
+	if userinfo.TokenID != 0 {
+		w.WriteError(errors.New("api token cannot be created by token authentication"), retcode.StatusTokenNotAllowed(nil))
+		return
+	}
+
+	random, err := util.RandSecureString(apiTokenLength)
+	if err != nil {
+		w.WriteError(err, retcode.StatusError(nil))
+		return
+	}
+	plain := apiTokenPrefix + random
+
+	t := model.APIToken{
+		Name:      in.Name,
+		Username:  userinfo.Username,
+		TokenHash: util.SHA256Hex(plain),
+		Prefix:    plain[:len(apiTokenPrefix)+4],
+		Scopes:    "[]",
+	}
+	if len(in.Scopes) > 0 {
+		bs, err := json.Marshal(in.Scopes)
+		if err != nil {
+			w.WriteError(err, retcode.StatusParamInvalid(nil).WithArgs("Scopes"))
+			return
+		}
+		t.Scopes = model.TokenScopeString(bs)
+	}
+	if in.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, in.ExpiresInDays)
+		t.ExpiresAt = &expiresAt
+	}
+
+	if err := db.Instance().Create(&t).Error; err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+	flog.Infof("api token %d(%s) created by user %s", t.ID, t.Name, t.Username)
+
+	out := model.CreateAPITokenResponse{
+		ID:        t.ID,
+		Name:      t.Name,
+		Token:     plain,
+		ExpiresAt: t.ExpiresAt,
+		Scopes:    t.Scopes.Get(),
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+func (a *TokenAPI) ListTokens(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.ListAPITokensRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+
+	userinfo, ok := r.Session.UserInfo.(model.SessionUserInfo)
+	if !ok {
+		w.WriteError(errors.New("format session error"), retcode.StatusSessionInvalid(nil))
+		return
+	}
+
+	query := db.Instance().Order("id")
+	if !in.All || !userinfo.HasPermission(model.PermissionUserManage) {
+		query = query.Where("username = ?", userinfo.Username)
+	}
+	tokens := []model.APIToken{}
+	if err := query.Find(&tokens).Error; err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+
+	out := model.ListAPITokensResponse{
+		Tokens: tokens,
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+func (a *TokenAPI) RevokeToken(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.RevokeAPITokenRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+
+	userinfo, ok := r.Session.UserInfo.(model.SessionUserInfo)
+	if !ok {
+		w.WriteError(errors.New("format session error"), retcode.StatusSessionInvalid(nil))
+		return
+	}
+
+	var t model.APIToken
+	if err := db.Instance().First(&t, in.ID).Error; err != nil {
+		w.WriteError(err, dbRetCode(err, retcode.StatusNotFound(nil).WithArgs("token")))
+		return
+	}
+	// 只能吊销自己的token，拥有用户管理权限时可以吊销所有token
+	if t.Username != userinfo.Username && !userinfo.HasPermission(model.PermissionUserManage) {
+		w.WriteError(errors.New("cannot revoke token of other users"), retcode.StatusForbidden(nil))
+		return
+	}
+
+	if err := db.Instance().Delete(&t).Error; err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+	flog.Infof("api token %d(%s) revoked by user %s", t.ID, t.Name, userinfo.Username)
+
+	out := model.RevokeAPITokenResponse{
+		ID: in.ID,
+	}
+	w.Write(retcode.StatusOK(out))
+}
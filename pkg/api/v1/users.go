@@ -0,0 +1,83 @@
+package v1
+
+import (
+	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"flutelake/fluteNAS/pkg/server/apiserver"
+
+	"gorm.io/gorm/clause"
+)
+
+type UserRoleServer struct{}
+
+func (s *UserRoleServer) ListUserRoles(w *apiserver.Response, r *apiserver.Request) {
+	var users []model.UserRole
+	if err := db.Instance().Order("username").Find(&users).Error; err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+
+	out := model.ListUserRolesResponse{
+		Users: users,
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+func (s *UserRoleServer) SetUserRole(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.SetUserRoleRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+
+	// 防止管理员把自己降级后无法再管理角色
+	if in.Username == getCurrentUser(r) && in.Role != model.RoleAdmin {
+		w.WriteError(errors.New("cannot downgrade the role of current user"), retcode.StatusParamInvalid(nil).WithArgs("Username"))
+		return
+	}
+
+	ur := model.UserRole{
+		Username: in.Username,
+		Role:     in.Role,
+	}
+	err := db.Instance().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "username"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at", "deleted_at"}),
+	}).Create(&ur).Error
+	if err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+
+	out := model.SetUserRoleResponse{
+		Username: in.Username,
+		Role:     in.Role,
+	}
+	w.Write(retcode.StatusOK(out))
+}
+
+func (s *UserRoleServer) DeleteUserRole(w *apiserver.Response, r *apiserver.Request) {
+	in := &model.DeleteUserRoleRequest{}
+	if err := r.Unmarshal(in); err != nil {
+		w.WriteParamError(err)
+		return
+	}
+
+	if in.Username == getCurrentUser(r) {
+		w.WriteError(errors.New("cannot delete the role of current user"), retcode.StatusParamInvalid(nil).WithArgs("Username"))
+		return
+	}
+
+	// 硬删除，否则唯一索引会阻止重新分配角色
+	if err := db.Instance().Unscoped().Where("username = ?", in.Username).Delete(&model.UserRole{}).Error; err != nil {
+		w.WriteError(err, retcode.StatusDatabaseError(nil))
+		return
+	}
+
+	out := model.DeleteUserRoleResponse{
+		Username: in.Username,
+	}
+	w.Write(retcode.StatusOK(out))
+}
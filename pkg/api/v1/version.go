@@ -0,0 +1,12 @@
+package v1
+
+import (
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"flutelake/fluteNAS/pkg/server/apiserver"
+	"flutelake/fluteNAS/pkg/version"
+)
+
+// GetVersion 返回当前运行的版本信息，不需要登录
+func GetVersion(w *apiserver.Response, r *apiserver.Request) {
+	w.Write(retcode.StatusOK(version.Get()))
+}
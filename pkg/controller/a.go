@@ -1,8 +1,11 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"flutelake/fluteNAS/pkg/model"
 	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/event"
 	"flutelake/fluteNAS/pkg/module/flog"
 	"flutelake/fluteNAS/pkg/module/node"
 	"flutelake/fluteNAS/pkg/util"
@@ -10,95 +13,139 @@ import (
 )
 
 type StorageDeviceController struct {
+	mountRoot   string
+	newExecutor node.ExecutorFactory
 }
 
-func NewStorageDeviceController() *StorageDeviceController {
-	return &StorageDeviceController{}
+func NewStorageDeviceController(mountRoot string, executor node.ExecutorFactory) *StorageDeviceController {
+	return &StorageDeviceController{
+		mountRoot:   mountRoot,
+		newExecutor: executor,
+	}
 }
 
-func (s *StorageDeviceController) MountPoint() {
-	// ticker := time.NewTicker(10 * time.Second)
-	// for range ticker.C {
-	// }
+// Keys 返回所有设置了挂载点的主机ID
+func (s *StorageDeviceController) Keys() ([]string, error) {
+	var ids []string
+	if err := db.Instance().Model(&model.MountPoint{}).Distinct("host_id").Pluck("host_id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("query db mount points failed: %v", err)
+	}
+	return ids, nil
+}
+
+// Reconcile 按数据库中的记录挂载主机上的磁盘，key 为主机ID
+func (s *StorageDeviceController) Reconcile(ctx context.Context, key string) error {
 	// 检查挂载点
-	var mountPoints []model.MountPoint
-	result := db.Instance().Find(&mountPoints)
+	var mps []model.MountPoint
+	result := db.Instance().Find(&mps, "host_id = ?", key)
 	if result.Error != nil {
-		flog.Errorf("Error query db mount points: %v", result.Error)
-		return
+		return fmt.Errorf("query db mount points failed: %v", result.Error)
 	}
 	if result.RowsAffected == 0 {
-		return
+		return nil
 	}
-	mpMap := make(map[string][]model.MountPoint)
-	for _, mountPoint := range mountPoints {
-		mpMap[mountPoint.HostID] = append(mpMap[mountPoint.HostID], mountPoint)
+	var host model.Host
+	if err := db.Instance().First(&host, "ID = ?", key).Error; err != nil {
+		return fmt.Errorf("get host info, id: %s, err: %v", key, err)
 	}
 
-	for n, mps := range mpMap {
-		var host model.Host
-		if err := db.Instance().First(&host, "ID = ?", n).Error; err != nil {
-			flog.Errorf("Error get host info, id: %s, err: %v", n, err)
-			continue
-		}
+	exec := s.newExecutor(host.HostIP)
+	defer exec.Close()
+	disks, err := node.DescribeDiskWith(ctx, exec)
+	if err != nil {
+		err = fmt.Errorf("describe disk on host %s: %v", host.HostIP, err)
+		setMountPointsReady(mps, err)
+		return err
+	}
+	diskMap := make(map[string]model.DiskDevice)
+	for _, d := range disks {
+		diskMap[d.UUID] = d
+	}
+	points, err := node.DescribeMountedPointWith(ctx, exec)
+	if err != nil {
+		err = fmt.Errorf("describe mount point on host %s: %v", host.HostIP, err)
+		setMountPointsReady(mps, err)
+		return err
+	}
 
-		exec := node.NewExec().SetHost(host.HostIP)
-		disks, err := node.DescribeDisk(host.HostIP)
-		if err != nil {
-			flog.Errorf("Error describe disk: %v", err)
+	devicePointMap := make(map[string]model.MountedPoint)
+	for _, p := range points {
+		devicePointMap[p.Device] = p
+	}
+
+	// 单个挂载点失败不影响其他挂载点，所有错误在最后一起返回
+	var errs []error
+	for i := range mps {
+		mp := &mps[i]
+		if mp.Path == "" || util.Trim(mp.Path) == s.mountRoot {
 			continue
 		}
-		diskMap := make(map[string]model.DiskDevice)
-		for _, d := range disks {
-			diskMap[d.UUID] = d
-		}
-		points, err := node.DescribeMountedPoint(host.HostIP)
-		if err != nil {
-			flog.Errorf("Error describe mount point: %v", err)
+		disk, ok := diskMap[mp.UUID]
+		if !ok {
+			flog.Infof("Mount point disk not exist, uuid: %s,  try to delete", mp.UUID)
+			db.Instance().Delete(&model.MountPoint{}, "ID = ?", mp.ID)
 			continue
 		}
-
-		devicePointMap := make(map[string]model.MountedPoint)
-		for _, p := range points {
-			devicePointMap[p.Device] = p
-		}
-
-		for _, mp := range mps {
-			if mp.Path == "" || util.Trim(mp.Path) == "/mnt" {
-				continue
-			}
-			disk, ok := diskMap[mp.UUID]
-			if !ok {
-				flog.Infof("Mount point disk not exist, uuid: %s,  try to delete", mp.UUID)
-				db.Instance().Delete(&model.MountPoint{}, "ID = ?", mp.ID)
-				continue
-			}
-			// 使用UUID对应的实际设备名称，系统重启可能会导致设备名发生变化
-			mounted, ok := devicePointMap[disk.Name]
-			if ok {
-				if mounted.Point != mp.Path {
-					// 解绑
-					err := exec.UmountDir(mounted.Point)
-					if err != nil {
-						flog.Errorf("Error umount(device: %s, point: %s): %v", mounted.Device, mounted.Point, err)
-						continue
-					}
-				} else {
-					// 已正确挂载
+		// 使用UUID对应的实际设备名称，系统重启可能会导致设备名发生变化
+		mounted, ok := devicePointMap[disk.Name]
+		if ok {
+			if mounted.Point != mp.Path {
+				// 解绑
+				err := node.UmountDir(ctx, exec, mounted.Point)
+				if err != nil {
+					err = withReason(model.ReasonUmountFailed, fmt.Errorf("umount(device: %s, point: %s): %v", mounted.Device, mounted.Point, err))
+					errs = append(errs, err)
+					setMountPointReady(mp, err)
+					publishMountEvent(model.EventMountFailed, host.HostIP, *mp, mounted.Point, err)
 					continue
 				}
-			}
-			// 检查mp.Path路径是否存在，不存在则创建
-			if _, err := exec.Command(fmt.Sprintf("mkdir -p %s", mp.Path)); err != nil {
-				flog.Errorf("Error creating mount point directory: %s, err: %v", mp.Path, err)
+				publishMountEvent(model.EventUmounted, host.HostIP, *mp, mounted.Point, nil)
+			} else {
+				// 已正确挂载
+				setMountPointReady(mp, nil)
 				continue
 			}
+		}
+		// 检查mp.Path路径是否存在，不存在则创建
+		if _, err := exec.CommandContext(ctx, fmt.Sprintf("mkdir -p %s", mp.Path)); err != nil {
+			err = fmt.Errorf("create mount point directory: %s, err: %v", mp.Path, err)
+			errs = append(errs, err)
+			setMountPointReady(mp, err)
+			publishMountEvent(model.EventMountFailed, host.HostIP, *mp, mp.Path, err)
+			continue
+		}
 
-			cmdstr := fmt.Sprintf("mount %s %s", mp.Device, mp.Path)
-			if _, err := exec.Command(cmdstr); err != nil {
-				flog.Errorf("Error mount point: %v, mount cmd: %s", err, cmdstr)
-				continue
-			}
+		cmdstr := fmt.Sprintf("mount %s %s", mp.Device, mp.Path)
+		if _, err := exec.CommandContext(ctx, cmdstr); err != nil {
+			err = fmt.Errorf("mount point: %v, mount cmd: %s", err, cmdstr)
+			errs = append(errs, err)
+			setMountPointReady(mp, err)
+			publishMountEvent(model.EventMountFailed, host.HostIP, *mp, mp.Path, err)
+			continue
 		}
+		setMountPointReady(mp, nil)
+		publishMountEvent(model.EventMounted, host.HostIP, *mp, mp.Path, nil)
+	}
+	return errors.Join(errs...)
+}
+
+// setMountPointsReady 主机上的挂载点都无法同步时，设置所有挂载点的Ready条件
+func setMountPointsReady(mps []model.MountPoint, err error) {
+	for i := range mps {
+		if mps[i].Path != "" {
+			setMountPointReady(&mps[i], withReason(model.ReasonDiskDescribeFailed, err))
+		}
+	}
+}
+
+func setMountPointReady(mp *model.MountPoint, err error) {
+	setReady(mp, &mp.Conditions, mp.Generation, model.ReasonMounted, model.ReasonMountFailed, err)
+}
+
+func publishMountEvent(typ string, hostIP string, mp model.MountPoint, path string, err error) {
+	e := model.MountEvent{HostIP: hostIP, UUID: mp.UUID, Device: mp.Device, Path: path}
+	if err != nil {
+		e.Error = err.Error()
 	}
+	event.Publish(event.TopicMount, typ, e)
 }
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/node"
+	"strings"
+	"testing"
+)
+
+func TestStorageDeviceReconcile(t *testing.T) {
+	const (
+		hostIP = "10.0.0.2"
+		lsblk  = `NAME="/dev/sda" SIZE="500107862016" SERIAL="S0" TYPE="disk" MOUNTPOINT="" UUID=""
+NAME="/dev/sda1" SIZE="500106813440" SERIAL="" TYPE="part" MOUNTPOINT="/" PKNAME="/dev/sda" UUID="root"
+NAME="/dev/sdb" SIZE="4000787030016" SERIAL="S1" TYPE="disk" MOUNTPOINT="" FSTYPE="ext4" UUID="u1"
+`
+	)
+	tests := []struct {
+		name    string
+		mounted string
+		script  func(f *node.FakeExecutor)
+		reason  string
+		// 期望执行的命令，按顺序匹配前缀
+		commands []string
+		// 挂载点记录是否被删除
+		deleted bool
+	}{
+		{
+			name:     "mount disk",
+			mounted:  "/dev/sda1 on / type ext4 (rw,relatime)",
+			commands: []string{"lsblk", "mount -l", "mkdir -p /mnt/data", "mount /dev/sdb /mnt/data"},
+		},
+		{
+			name:     "already mounted",
+			mounted:  "/dev/sdb on /mnt/data type ext4 (rw,relatime)",
+			commands: []string{"lsblk", "mount -l"},
+		},
+		{
+			name:     "move mount point",
+			mounted:  "/dev/sdb on /mnt/old type ext4 (rw,relatime)",
+			script:   func(f *node.FakeExecutor) { f.On("ls -A /mnt/old", "0\n", nil) },
+			commands: []string{"lsblk", "mount -l", "umount -f /mnt/old", "ls -A /mnt/old", "rmdir /mnt/old", "mkdir -p /mnt/data", "mount /dev/sdb /mnt/data"},
+		},
+		{
+			name:     "umount failed",
+			mounted:  "/dev/sdb on /mnt/old type ext4 (rw,relatime)",
+			script:   func(f *node.FakeExecutor) { f.On("umount", "", errors.New("target is busy")) },
+			reason:   model.ReasonUmountFailed,
+			commands: []string{"lsblk", "mount -l", "umount -f /mnt/old"},
+		},
+		{
+			name:     "mount failed",
+			script:   func(f *node.FakeExecutor) { f.On("mount /dev/sdb", "", errors.New("wrong fs type")) },
+			reason:   model.ReasonMountFailed,
+			commands: []string{"lsblk", "mount -l", "mkdir -p /mnt/data", "mount /dev/sdb /mnt/data"},
+		},
+		{
+			name:     "describe disk failed",
+			script:   func(f *node.FakeExecutor) { f.On("lsblk", "", errors.New("no route to host")) },
+			reason:   model.ReasonDiskDescribeFailed,
+			commands: []string{"lsblk"},
+		},
+		{
+			name:     "disk removed",
+			script:   func(f *node.FakeExecutor) { f.On("lsblk", strings.SplitAfter(lsblk, "\n")[0], nil) },
+			commands: []string{"lsblk", "mount -l"},
+			deleted:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTestDB(t, &model.Host{}, &model.MountPoint{})
+			if err := db.Instance().Create(&model.Host{ID: "h1", HostIP: hostIP}).Error; err != nil {
+				t.Fatal(err)
+			}
+			mp := model.MountPoint{UUID: "u1", HostID: "h1", HostIP: hostIP, Device: "/dev/sdb", Path: "/mnt/data"}
+			if err := db.Instance().Create(&mp).Error; err != nil {
+				t.Fatal(err)
+			}
+			fake := node.NewFakeExecutor().On("lsblk", lsblk, nil).On("mount -l", tt.mounted, nil)
+			if tt.script != nil {
+				tt.script(fake)
+			}
+
+			c := NewStorageDeviceController("/mnt", fake.Factory())
+			if err := c.Reconcile(context.Background(), "h1"); (err != nil) != (tt.reason != "") {
+				t.Fatalf("expected failure %q, got error %v", tt.reason, err)
+			}
+
+			cmds := fake.Commands(hostIP)
+			if len(cmds) != len(tt.commands) {
+				t.Fatalf("expected commands %q, got %q", tt.commands, cmds)
+			}
+			for i := range cmds {
+				if !strings.HasPrefix(cmds[i], tt.commands[i]) {
+					t.Fatalf("expected commands %q, got %q", tt.commands, cmds)
+				}
+			}
+
+			var got []model.MountPoint
+			if err := db.Instance().Find(&got, mp.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if tt.deleted != (len(got) == 0) {
+				t.Fatalf("expected mount point deleted %v, got %d records", tt.deleted, len(got))
+			}
+			if tt.deleted {
+				return
+			}
+			ready, _ := got[0].Conditions.Find(model.ConditionReady)
+			wantReason := tt.reason
+			if wantReason == "" {
+				wantReason = model.ReasonMounted
+			}
+			if ready.Reason != wantReason {
+				t.Fatalf("expected ready reason %s, got %+v", wantReason, ready)
+			}
+		})
+	}
+}
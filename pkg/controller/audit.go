@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"fmt"
+	"time"
+)
+
+// AuditLogController 按保留天数清理过期的审计日志
+type AuditLogController struct {
+	retention time.Duration
+}
+
+func NewAuditLogController(retentionDays int) *AuditLogController {
+	return &AuditLogController{
+		retention: time.Hour * 24 * time.Duration(retentionDays),
+	}
+}
+
+func (c *AuditLogController) Do() error {
+	before := time.Now().Add(-c.retention)
+	res := db.Instance().Where("created_at < ?", before).Delete(&model.AuditLog{})
+	if res.Error != nil {
+		return fmt.Errorf("failed to clean audit logs before %s: %v", before.Format(time.RFC3339), res.Error)
+	}
+	if res.RowsAffected > 0 {
+		flog.Infof("cleaned %d audit logs before %s", res.RowsAffected, before.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"flutelake/fluteNAS/pkg/module/backup"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"fmt"
+	"sync"
+)
+
+// DatabaseBackupController 定时备份数据库，数据库使用 synchronous=OFF，断电时可能损坏
+type DatabaseBackupController struct {
+	backups *backup.Database
+	lock    sync.Mutex
+}
+
+func NewDatabaseBackupController(backups *backup.Database) *DatabaseBackupController {
+	return &DatabaseBackupController{
+		backups: backups,
+	}
+}
+
+func (c *DatabaseBackupController) Do() error {
+	if !c.lock.TryLock() {
+		return nil
+	}
+	defer c.lock.Unlock()
+	b, err := c.backups.Backup()
+	if err != nil {
+		return fmt.Errorf("failed to back up database to %s: %v", c.backups.Dir(), err)
+	}
+	flog.Infof("database backed up to %s, size %d, sha256 %s", b.Path, b.Size, b.SHA256)
+	return nil
+}
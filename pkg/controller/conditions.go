@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/flog"
+)
+
+// reasonError 带有条件原因的错误，设置Ready条件时作为 Reason
+type reasonError struct {
+	reason string
+	err    error
+}
+
+func (e *reasonError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reasonError) Unwrap() error {
+	return e.err
+}
+
+func withReason(reason string, err error) error {
+	return &reasonError{reason: reason, err: err}
+}
+
+// reasonOf 返回错误中的原因，没有时返回 fallback
+func reasonOf(err error, fallback string) string {
+	var re *reasonError
+	if errors.As(err, &re) {
+		return re.reason
+	}
+	return fallback
+}
+
+// setReady 保存对象的Ready条件，err 为nil时状态为True，原因为 okReason，
+// 否则状态为False，原因优先使用错误中的原因。保存失败只记录日志，不影响同步的结果
+func setReady(obj any, conditions *model.ConditionsString, generation int64, okReason, failReason string, err error) {
+	c := model.Condition{
+		Type:               model.ConditionReady,
+		Status:             model.ConditionTrue,
+		Reason:             okReason,
+		ObservedGeneration: generation,
+	}
+	if err != nil {
+		c.Status = model.ConditionFalse
+		c.Reason = reasonOf(err, failReason)
+		c.Message = err.Error()
+	}
+	if err := model.SaveCondition(db.Instance(), obj, conditions, c); err != nil {
+		flog.Warnf("save ready condition failed: %v", err)
+	}
+}
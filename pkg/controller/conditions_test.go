@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// initTestDB 在临时目录中创建数据库并迁移 models
+func initTestDB(t *testing.T, models ...any) {
+	t.Helper()
+	flog.NewLogger(0)
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Instance().AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetReady(t *testing.T) {
+	initTestDB(t, &model.SambaShare{})
+	share := model.SambaShare{HostIP: "127.0.0.1", Name: "media", Path: "/mnt/media"}
+	if err := db.Instance().Create(&share).Error; err != nil {
+		t.Fatal(err)
+	}
+	load := func() model.SambaShare {
+		t.Helper()
+		var s model.SambaShare
+		if err := db.Instance().First(&s, share.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	if s := load(); s.Generation != 1 || len(s.Conditions.Get()) != 0 {
+		t.Fatalf("unexpected new share generation %d conditions %s", s.Generation, s.Conditions)
+	}
+
+	err := withReason(model.ReasonReloadFailed, fmt.Errorf("reload smb.conf failed: %w", errors.New("exit status 1")))
+	setSharesReady([]model.SambaShare{share}, err)
+	s := load()
+	c, ok := s.Conditions.Find(model.ConditionReady)
+	if !ok || c.Status != model.ConditionFalse || c.Reason != model.ReasonReloadFailed ||
+		c.Message != "reload smb.conf failed: exit status 1" || c.ObservedGeneration != 1 || c.LastTransitionTime.IsZero() {
+		t.Fatalf("unexpected condition %+v", c)
+	}
+	if !s.UpdatedAt.Equal(share.UpdatedAt) {
+		t.Fatal("saving conditions should not change UpdatedAt")
+	}
+
+	// 状态不变时保留 LastTransitionTime
+	time.Sleep(10 * time.Millisecond)
+	s.Generation = 2
+	setSharesReady([]model.SambaShare{s}, withReason(model.ReasonConfigWriteFailed, errors.New("permission denied")))
+	s = load()
+	failed, _ := s.Conditions.Find(model.ConditionReady)
+	if !failed.LastTransitionTime.Equal(c.LastTransitionTime) || failed.Reason != model.ReasonConfigWriteFailed || failed.ObservedGeneration != 2 {
+		t.Fatalf("unexpected condition %+v", failed)
+	}
+
+	setSharesReady([]model.SambaShare{s}, nil)
+	ready, _ := load().Conditions.Find(model.ConditionReady)
+	if ready.Status != model.ConditionTrue || ready.Reason != model.ReasonApplied || ready.Message != "" || !ready.LastTransitionTime.After(c.LastTransitionTime) {
+		t.Fatalf("unexpected condition %+v", ready)
+	}
+
+	// 接口返回数组，请求中传入的条件被忽略
+	bs, _ := json.Marshal(load())
+	var out struct {
+		Conditions []model.Condition
+	}
+	if err := json.Unmarshal(bs, &out); err != nil || len(out.Conditions) != 1 {
+		t.Fatalf("unexpected conditions in response %s: %v", bs, err)
+	}
+	in := model.SambaShare{}
+	if err := json.Unmarshal(bs, &in); err != nil || in.Conditions != "" {
+		t.Fatalf("conditions from request should be ignored, got %q: %v", in.Conditions, err)
+	}
+}
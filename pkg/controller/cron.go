@@ -3,27 +3,47 @@ package controller
 import (
 	"context"
 	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
 )
 
+// 每个任务保留的执行记录数量
+const jobHistorySize = 20
+
 type CronJob struct {
 	cron *cron.Cron
-	jobs map[string]cron.EntryID
+	jobs map[string]*job
 	mu   sync.Mutex
+	// 手动触发的执行，停止时同样需要等待
+	manual sync.WaitGroup
+	// 保存调度修改和暂停状态，为nil时不保存
+	store *gorm.DB
 }
 
-// type Job struct {
-// 	UniqueName   string
-// 	ScheduleRule string
-// 	JobFunc      func()
-// }
+type job struct {
+	name            string
+	schedule        string
+	defaultSchedule string
+	fn              func() error
+	// 暂停时为0
+	entryID cron.EntryID
+	paused  bool
+	running bool
+	// 按时间倒序
+	history []model.JobRun
+}
 
 func NewCronJob() *CronJob {
 	return &CronJob{
 		cron: cron.New(),
-		jobs: make(map[string]cron.EntryID),
+		jobs: make(map[string]*job),
 	}
 }
 
@@ -35,7 +55,24 @@ func (c *CronJob) Stop() context.Context {
 	return c.cron.Stop()
 }
 
-func (c *CronJob) AddJob(name, schedule string, job func()) error {
+// Shutdown 停止调度新的任务，并等待正在运行的任务结束或ctx超时
+func (c *CronJob) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		<-c.Stop().Done()
+		c.manual.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// AddJob 添加定时任务，job 返回的错误记录在执行记录中
+func (c *CronJob) AddJob(name, schedule string, fn func() error) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -43,12 +80,11 @@ func (c *CronJob) AddJob(name, schedule string, job func()) error {
 		return ErrJobExists
 	}
 
-	id, err := c.cron.AddFunc(schedule, job)
-	if err != nil {
+	j := &job{name: name, schedule: schedule, defaultSchedule: schedule, fn: fn}
+	if err := c.schedule(j); err != nil {
 		return err
 	}
-
-	c.jobs[name] = id
+	c.jobs[name] = j
 	return nil
 }
 
@@ -56,12 +92,12 @@ func (c *CronJob) RemoveJob(name string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	id, exists := c.jobs[name]
+	j, exists := c.jobs[name]
 	if !exists {
 		return ErrJobNotFound
 	}
 
-	c.cron.Remove(id)
+	c.unschedule(j)
 	delete(c.jobs, name)
 	return nil
 }
@@ -77,7 +113,247 @@ func (c *CronJob) ListJobs() []string {
 	return names
 }
 
+// Jobs 返回所有任务的状态，按名称排序
+func (c *CronJob) Jobs() []model.JobInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	infos := make([]model.JobInfo, 0, len(c.jobs))
+	for _, j := range c.jobs {
+		infos = append(infos, c.info(j))
+	}
+	sort.Slice(infos, func(i, k int) bool { return infos[i].Name < infos[k].Name })
+	return infos
+}
+
+// Job 返回一个任务的状态
+func (c *CronJob) Job(name string) (model.JobInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	j, exists := c.jobs[name]
+	if !exists {
+		return model.JobInfo{}, ErrJobNotFound
+	}
+	return c.info(j), nil
+}
+
+// RunNow 立即在后台执行一次任务，暂停的任务同样可以执行
+func (c *CronJob) RunNow(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	j, exists := c.jobs[name]
+	if !exists {
+		return ErrJobNotFound
+	}
+	if j.running {
+		return ErrJobRunning
+	}
+	c.manual.Add(1)
+	go func() {
+		defer c.manual.Done()
+		c.run(j, model.JobTriggerManual)
+	}()
+	return nil
+}
+
+// Pause 暂停任务的定时执行，正在执行的不受影响
+func (c *CronJob) Pause(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	j, exists := c.jobs[name]
+	if !exists {
+		return ErrJobNotFound
+	}
+	if j.paused {
+		return nil
+	}
+	c.unschedule(j)
+	j.paused = true
+	return c.save(j)
+}
+
+// Resume 恢复暂停的任务
+func (c *CronJob) Resume(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	j, exists := c.jobs[name]
+	if !exists {
+		return ErrJobNotFound
+	}
+	if !j.paused {
+		return nil
+	}
+	if err := c.schedule(j); err != nil {
+		return err
+	}
+	j.paused = false
+	return c.save(j)
+}
+
+// SetSchedule 修改任务的调度，暂停的任务在恢复后使用新的调度
+func (c *CronJob) SetSchedule(name, schedule string) error {
+	if _, err := cron.ParseStandard(schedule); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	j, exists := c.jobs[name]
+	if !exists {
+		return ErrJobNotFound
+	}
+	old := j.schedule
+	j.schedule = schedule
+	if !j.paused {
+		c.unschedule(j)
+		if err := c.schedule(j); err != nil {
+			j.schedule = old
+			c.schedule(j)
+			return err
+		}
+	}
+	return c.save(j)
+}
+
+// LoadSettings 应用保存的调度修改和暂停状态，之后的修改同样保存到数据库
+func (c *CronJob) LoadSettings(store *gorm.DB) error {
+	var settings []model.JobSetting
+	if err := store.Find(&settings).Error; err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store = store
+	for _, s := range settings {
+		j, exists := c.jobs[s.Name]
+		if !exists {
+			continue
+		}
+		if s.Schedule != "" && s.Schedule != j.schedule {
+			if _, err := cron.ParseStandard(s.Schedule); err != nil {
+				flog.Warnf("ignore invalid saved schedule %q of job %s: %v", s.Schedule, s.Name, err)
+			} else {
+				j.schedule = s.Schedule
+				c.unschedule(j)
+				if err := c.schedule(j); err != nil {
+					return err
+				}
+			}
+		}
+		if s.Paused {
+			c.unschedule(j)
+			j.paused = true
+		}
+	}
+	return nil
+}
+
+// schedule 把任务添加到调度器，调用时需要持有锁
+func (c *CronJob) schedule(j *job) error {
+	id, err := c.cron.AddFunc(j.schedule, func() {
+		c.run(j, model.JobTriggerSchedule)
+	})
+	if err != nil {
+		return err
+	}
+	j.entryID = id
+	return nil
+}
+
+func (c *CronJob) unschedule(j *job) {
+	if j.entryID != 0 {
+		c.cron.Remove(j.entryID)
+		j.entryID = 0
+	}
+}
+
+// save 保存与默认值不同的设置，调用时需要持有锁
+func (c *CronJob) save(j *job) error {
+	if c.store == nil {
+		return nil
+	}
+	if j.schedule == j.defaultSchedule && !j.paused {
+		return c.store.Delete(&model.JobSetting{}, "name = ?", j.name).Error
+	}
+	s := &model.JobSetting{Name: j.name, Paused: j.paused}
+	if j.schedule != j.defaultSchedule {
+		s.Schedule = j.schedule
+	}
+	return c.store.Save(s).Error
+}
+
+// run 执行任务并记录结果，上一次执行还没有结束时跳过
+func (c *CronJob) run(j *job, trigger string) {
+	c.mu.Lock()
+	if j.running {
+		c.mu.Unlock()
+		return
+	}
+	j.running = true
+	c.mu.Unlock()
+
+	start := time.Now()
+	err := safeRun(j.fn)
+	r := model.JobRun{
+		StartedAt:  start,
+		DurationMs: time.Since(start).Milliseconds(),
+		Trigger:    trigger,
+	}
+	if err != nil {
+		r.Error = err.Error()
+		flog.Errorf("job %s failed: %v", j.name, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	j.running = false
+	j.history = append([]model.JobRun{r}, j.history...)
+	if len(j.history) > jobHistorySize {
+		j.history = j.history[:jobHistorySize]
+	}
+}
+
+// safeRun 任务panic时转换为错误，避免影响整个服务
+func safeRun(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// info 调用时需要持有锁
+func (c *CronJob) info(j *job) model.JobInfo {
+	info := model.JobInfo{
+		Name:            j.name,
+		Schedule:        j.schedule,
+		DefaultSchedule: j.defaultSchedule,
+		Paused:          j.paused,
+		Running:         j.running,
+		History:         append([]model.JobRun{}, j.history...),
+	}
+	if len(j.history) > 0 {
+		last := j.history[0]
+		info.LastRun = &last
+	}
+	if j.entryID != 0 {
+		if next := c.cron.Entry(j.entryID).Next; !next.IsZero() {
+			info.NextRun = &next
+		}
+	}
+	return info
+}
+
 var (
-	ErrJobExists   = errors.New("job already exists")
-	ErrJobNotFound = errors.New("job not found")
+	ErrJobExists       = errors.New("job already exists")
+	ErrJobNotFound     = errors.New("job not found")
+	ErrJobRunning      = errors.New("job is running")
+	ErrInvalidSchedule = errors.New("invalid schedule")
 )
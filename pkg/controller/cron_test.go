@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCronJobHistory(t *testing.T) {
+	flog.NewLogger(0)
+	c := NewCronJob()
+	calls := 0
+	err := c.AddJob("test", "@every 1h", func() error {
+		calls++
+		switch calls {
+		case 1:
+			return errors.New("boom")
+		case 2:
+			panic("oops")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddJob("test", "@every 1h", func() error { return nil }); !errors.Is(err, ErrJobExists) {
+		t.Fatalf("expected ErrJobExists, got %v", err)
+	}
+
+	for i := 0; i < jobHistorySize+5; i++ {
+		if err := c.RunNow("test"); err != nil {
+			t.Fatal(err)
+		}
+		c.manual.Wait()
+	}
+	job, err := c.Job("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(job.History) != jobHistorySize {
+		t.Fatalf("expected %d runs in history, got %d", jobHistorySize, len(job.History))
+	}
+	if job.LastRun == nil || job.LastRun.Error != "" || job.LastRun.Trigger != model.JobTriggerManual {
+		t.Fatalf("unexpected last run %+v", job.LastRun)
+	}
+
+	// 最早的执行记录已经被丢弃，重新检查错误和panic的记录
+	c.jobs["test"].history = nil
+	calls = 0
+	for i := 0; i < 2; i++ {
+		c.RunNow("test")
+		c.manual.Wait()
+	}
+	job, _ = c.Job("test")
+	if job.History[1].Error != "boom" || job.History[0].Error != "panic: oops" {
+		t.Fatalf("unexpected history %+v", job.History)
+	}
+	if _, err := c.Job("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestCronJobRunNowWhileRunning(t *testing.T) {
+	flog.NewLogger(0)
+	c := NewCronJob()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	c.AddJob("slow", "@every 1h", func() error {
+		close(started)
+		<-release
+		return nil
+	})
+
+	if err := c.RunNow("slow"); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if job, _ := c.Job("slow"); !job.Running {
+		t.Fatal("expected job to be running")
+	}
+	if err := c.RunNow("slow"); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("expected ErrJobRunning, got %v", err)
+	}
+	close(release)
+	c.manual.Wait()
+	if job, _ := c.Job("slow"); job.Running || len(job.History) != 1 {
+		t.Fatalf("unexpected job state %+v", job)
+	}
+}
+
+func TestCronJobPauseAndSchedule(t *testing.T) {
+	flog.NewLogger(0)
+	c := NewCronJob()
+	c.AddJob("test", "@every 1h", func() error { return nil })
+	c.Start()
+	defer c.Stop()
+
+	job, _ := c.Job("test")
+	if job.NextRun == nil {
+		t.Fatal("expected next run of scheduled job")
+	}
+	if err := c.Pause("test"); err != nil {
+		t.Fatal(err)
+	}
+	job, _ = c.Job("test")
+	if !job.Paused || job.NextRun != nil {
+		t.Fatalf("unexpected paused job %+v", job)
+	}
+
+	if err := c.SetSchedule("test", "not a schedule"); !errors.Is(err, ErrInvalidSchedule) {
+		t.Fatalf("expected ErrInvalidSchedule, got %v", err)
+	}
+	if err := c.SetSchedule("test", "@every 2h"); err != nil {
+		t.Fatal(err)
+	}
+	// 暂停的任务修改调度后仍然保持暂停
+	job, _ = c.Job("test")
+	if !job.Paused || job.Schedule != "@every 2h" || job.DefaultSchedule != "@every 1h" {
+		t.Fatalf("unexpected job %+v", job)
+	}
+
+	if err := c.Resume("test"); err != nil {
+		t.Fatal(err)
+	}
+	job, _ = c.Job("test")
+	if job.Paused || job.NextRun == nil || job.NextRun.Sub(time.Now()) < time.Hour {
+		t.Fatalf("expected resumed job to use new schedule, got %+v", job)
+	}
+	if err := c.Pause("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestCronJobLoadSettings(t *testing.T) {
+	flog.NewLogger(0)
+	store, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "nas.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AutoMigrate(&model.JobSetting{}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCronJob()
+	c.AddJob("a", "@every 1h", func() error { return nil })
+	c.AddJob("b", "@every 1h", func() error { return nil })
+	if err := c.LoadSettings(store); err != nil {
+		t.Fatal(err)
+	}
+	c.Pause("a")
+	c.SetSchedule("b", "@every 3h")
+
+	// 重启后恢复保存的设置
+	restarted := NewCronJob()
+	restarted.AddJob("a", "@every 1h", func() error { return nil })
+	restarted.AddJob("b", "@every 1h", func() error { return nil })
+	if err := restarted.LoadSettings(store); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := restarted.Job("a"); !a.Paused || a.Schedule != "@every 1h" {
+		t.Fatalf("unexpected job a %+v", a)
+	}
+	if b, _ := restarted.Job("b"); b.Paused || b.Schedule != "@every 3h" {
+		t.Fatalf("unexpected job b %+v", b)
+	}
+
+	// 恢复为默认设置后删除保存的记录
+	restarted.Resume("a")
+	restarted.SetSchedule("b", "@every 1h")
+	var count int64
+	store.Model(&model.JobSetting{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected default settings not to be stored, got %d rows", count)
+	}
+}
@@ -1,81 +1,94 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
-	"sync"
 	"time"
 
 	"flutelake/fluteNAS/pkg/model"
 	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/event"
 	"flutelake/fluteNAS/pkg/module/flog"
 	"flutelake/fluteNAS/pkg/module/node"
 )
 
-var nfsExporterLock sync.Mutex
-
 // NFSShareController NFS分享控制器
 type NFSShareController struct {
+	newExecutor node.ExecutorFactory
 }
 
-// NewNFSShareController 创建NFS分享控制器
-func NewNFSShareController() *NFSShareController {
-	return &NFSShareController{}
+// NewNFSShareController 创建NFS分享控制器，通过 executor 在主机上执行命令
+func NewNFSShareController(executor node.ExecutorFactory) *NFSShareController {
+	return &NFSShareController{
+		newExecutor: executor,
+	}
 }
 
-// syncNFSConfig 同步NFS配置
-func (c *NFSShareController) Do() {
-	if !nfsExporterLock.TryLock() {
-		return
-	}
+// Keys 返回所有主机的IP
+func (c *NFSShareController) Keys() ([]string, error) {
+	return hostIPs()
+}
 
-	defer nfsExporterLock.Unlock()
+// Reconcile 同步主机的NFS配置，key 为主机IP
+func (c *NFSShareController) Reconcile(ctx context.Context, hostIP string) error {
 	startTime := time.Now()
-	flog.Debugf("Starting NFS config sync...")
+	flog.Debugf("Starting NFS config sync for host %s...", hostIP)
 
-	// 获取所有启用的NFS导出规则
+	// 未指定主机的导出规则在本机生效
+	hostIPs := []string{hostIP}
+	if hostIP == model.LocalHost {
+		hostIPs = append(hostIPs, "")
+	}
+	// 获取主机上所有启用的NFS导出规则
 	var exports []model.NFSExport
-	err := db.Instance().Where("status = ?", "enabled").Find(&exports).Error
+	err := db.Instance().Where("host_ip IN ? AND status = ?", hostIPs, "enabled").Find(&exports).Error
 	if err != nil {
-		flog.Errorf("Failed to fetch enabled NFS exports: %v", err)
-		return
-	}
-
-	if len(exports) == 0 {
-		flog.Debugf("No enabled NFS exports found, skipping sync")
-		return
-	}
-
-	// 检查nfs-ganesha服务是否运行，未运行则启动
-	// 检查nfs-ganesha服务是否设置开机自启，未设置则设置
-	if err := node.CheckAndMaintainNFSService(); err != nil {
-		flog.Warnf("nfs-ganesha service checking, error: %v", err)
-	}
-
-	// 按HostIP分组处理
-	hostExports := make(map[string][]model.NFSExport)
-	for _, export := range exports {
-		hostIP := export.HostIP
-		if hostIP == "" {
-			hostIP = "127.0.0.1" // 默认本地
+		return fmt.Errorf("failed to fetch enabled NFS exports: %v", err)
+	}
+
+	// 最后一个导出规则被删除或停用时同样需要同步，写入没有导出规则的配置
+	if len(exports) > 0 {
+		// 检查nfs-ganesha服务是否运行，未运行则启动
+		// 检查nfs-ganesha服务是否设置开机自启，未设置则设置
+		local := c.newExecutor(model.LocalHost)
+		err = node.CheckAndMaintainNFSService(ctx, local)
+		local.Close()
+		if err != nil {
+			flog.Warnf("nfs-ganesha service checking, error: %v", err)
 		}
-		hostExports[hostIP] = append(hostExports[hostIP], export)
 	}
 
-	// 为每个主机生成配置并热重载
-	for hostIP, hostExports := range hostExports {
-		if err := c.syncHostNFSConfig(hostIP, hostExports); err != nil {
-			flog.Errorf("Failed to sync NFS config for host %s: %v", hostIP, err)
-		}
+	err = c.syncHostNFSConfig(ctx, hostIP, exports)
+	for i := range exports {
+		setReady(&exports[i], &exports[i].Conditions, exports[i].Generation, model.ReasonApplied, model.ReasonConfigWriteFailed, err)
+	}
+	if err != nil {
+		publishNFSShareEvents(model.EventShareFailed, hostIP, exports, err)
+		return fmt.Errorf("failed to sync NFS config for host %s: %w", hostIP, err)
 	}
 
-	flog.Debugf("NFS config sync completed in %v", time.Since(startTime))
+	flog.Debugf("NFS config sync for host %s completed in %v", hostIP, time.Since(startTime))
+	return nil
 }
 
 // syncHostNFSConfig 同步指定主机的NFS配置
-func (c *NFSShareController) syncHostNFSConfig(hostIP string, exports []model.NFSExport) error {
+func (c *NFSShareController) syncHostNFSConfig(ctx context.Context, hostIP string, exports []model.NFSExport) error {
+	cmd := c.newExecutor(hostIP)
+	defer cmd.Close()
+
+	configPath := "/etc/ganesha/ganesha.conf"
 	if len(exports) == 0 {
-		return nil
+		// 主机上没有配置文件时没有导出过目录，不需要写入空的配置
+		exists, err := node.FileExists(ctx, cmd, configPath)
+		if err != nil {
+			return withReason(model.ReasonConfigWriteFailed, fmt.Errorf("failed to check NFS config: %w", err))
+		}
+		if !exists {
+			flog.Debugf("No NFS exports and config on host %s, skipping sync", hostIP)
+			return nil
+		}
 	}
 
 	flog.Infof("Syncing NFS config for host %s, %d exports", hostIP, len(exports))
@@ -83,40 +96,42 @@ func (c *NFSShareController) syncHostNFSConfig(hostIP string, exports []model.NF
 	// 步骤1: 生成NFS配置（使用标准化函数）
 	config, err := node.GenerateNFSConfig(exports)
 	if err != nil {
-		return fmt.Errorf("failed to generate NFS config: %w", err)
+		return withReason(model.ReasonConfigInvalid, fmt.Errorf("failed to generate NFS config: %w", err))
 	}
 
 	// 步骤2: 检查配置文件是否发生变化
-	if err := node.CompareAndReplaceNFSConfig(hostIP, config); err != nil {
+	if err := node.CompareAndReplaceNFSConfig(ctx, cmd, config); err != nil {
 		// If configs are identical, skip the update process
 		if strings.Contains(err.Error(), "config unchanged") {
 			flog.Infof("NFS config for host %s is already up to date, skipping update", hostIP)
 			return nil
 		}
-		return fmt.Errorf("NFS config comparison failed: %w", err)
+		return withReason(model.ReasonConfigWriteFailed, fmt.Errorf("NFS config comparison failed: %w", err))
 	}
 
 	// 步骤3: 备份当前配置
-	if err := c.BackupNFSConfig(hostIP); err != nil {
+	if err := c.BackupNFSConfig(ctx, hostIP); err != nil {
 		flog.Warnf("Failed to backup current NFS config before update: %v", err)
 		// Continue even if backup fails
 	}
 
 	// 步骤4: 写入配置文件
-	configPath := "/etc/ganesha/ganesha.conf"
-	if err := node.WriteFile(hostIP, configPath, []byte(config), 0644); err != nil {
-		return fmt.Errorf("failed to write NFS config: %w", err)
+	if err := cmd.WriteFileContext(ctx, configPath, []byte(config), 0644); err != nil {
+		return withReason(model.ReasonConfigWriteFailed, fmt.Errorf("failed to write NFS config: %w", err))
 	}
 
 	// 步骤5: 热重载NFS服务（使用 standardized function）
-	if err := node.ReloadNFSConfig(hostIP); err != nil {
+	if err := node.ReloadNFSConfig(ctx, cmd); err != nil && len(exports) == 0 && errors.Is(err, node.ErrNFSNotRunning) {
+		// 服务没有运行时不会导出任何目录，空的配置在服务启动后生效
+		flog.Infof("NFS-Ganesha is not running on host %s, removed exports take effect on next start", hostIP)
+	} else if err != nil {
 		// 热重载失败，尝试回滚
 		flog.Errorf("NFS hot reload failed, attempting rollback: %v", err)
-		if rollbackErr := c.RollbackNFSConfig(hostIP); rollbackErr != nil {
+		if rollbackErr := c.RollbackNFSConfig(ctx, hostIP); rollbackErr != nil {
 			flog.Errorf("Failed to rollback NFS config: %v", rollbackErr)
-			return fmt.Errorf("NFS reload failed: %w, rollback also failed: %v", err, rollbackErr)
+			return withReason(model.ReasonReloadFailed, fmt.Errorf("NFS reload failed: %w, rollback also failed: %v", err, rollbackErr))
 		}
-		return fmt.Errorf("NFS reload failed: %w, config has been rolled back", err)
+		return withReason(model.ReasonReloadFailed, fmt.Errorf("NFS reload failed: %w, config has been rolled back", err))
 	}
 
 	// 步骤6: 更新最后同步时间
@@ -128,15 +143,28 @@ func (c *NFSShareController) syncHostNFSConfig(hostIP string, exports []model.NF
 	}
 
 	flog.Infof("Successfully synced NFS config for host %s", hostIP)
+	publishNFSShareEvents(model.EventShareApplied, hostIP, exports, nil)
 	return nil
 }
 
+func publishNFSShareEvents(typ string, hostIP string, exports []model.NFSExport, err error) {
+	for _, export := range exports {
+		e := model.NFSShareEvent{ID: export.ID, HostIP: hostIP, Name: export.Name, Pseudo: export.Pseudo}
+		if err != nil {
+			e.Error = err.Error()
+		}
+		event.Publish(event.TopicNFSShare, typ, e)
+	}
+}
+
 // BackupNFSConfig 备份当前NFS配置
-func (c *NFSShareController) BackupNFSConfig(hostIP string) error {
+func (c *NFSShareController) BackupNFSConfig(ctx context.Context, hostIP string) error {
 	configPath := "/etc/ganesha/ganesha.conf"
 	backupPath := fmt.Sprintf("/etc/ganesha/ganesha.conf.backup.%d", time.Now().Unix())
 
-	if err := node.BackupFile(hostIP, configPath, backupPath); err != nil {
+	cmd := c.newExecutor(hostIP)
+	defer cmd.Close()
+	if err := node.BackupFile(ctx, cmd, configPath, backupPath); err != nil {
 		return fmt.Errorf("failed to backup NFS config: %w", err)
 	}
 
@@ -145,15 +173,15 @@ func (c *NFSShareController) BackupNFSConfig(hostIP string) error {
 }
 
 // RollbackNFSConfig 回滚NFS配置
-func (c *NFSShareController) RollbackNFSConfig(hostIP string) error {
+func (c *NFSShareController) RollbackNFSConfig(ctx context.Context, hostIP string) error {
 	configPath := "/etc/ganesha/ganesha.conf"
 
 	// Find the most recent backup file
-	cmd := node.NewExec().SetHost(hostIP)
+	cmd := c.newExecutor(hostIP)
 	defer cmd.Close()
 
 	findCmd := "ls -t /etc/ganesha/ganesha.conf.backup.* 2>/dev/null | head -n1"
-	backupPathOutput, err := cmd.Command(findCmd)
+	backupPathOutput, err := cmd.CommandContext(ctx, findCmd)
 	if err != nil || len(backupPathOutput) == 0 {
 		return fmt.Errorf("no backup file found for rollback: %w", err)
 	}
@@ -165,12 +193,12 @@ func (c *NFSShareController) RollbackNFSConfig(hostIP string) error {
 	}
 
 	// Move backup to current config
-	if err := node.MoveFile(hostIP, backupPath, configPath); err != nil {
+	if err := node.MoveFile(ctx, cmd, backupPath, configPath); err != nil {
 		return fmt.Errorf("failed to rollback NFS config: %w", err)
 	}
 
 	// Reload the rolled-back config
-	if reloadErr := node.ReloadNFSConfig(hostIP); reloadErr != nil {
+	if reloadErr := node.ReloadNFSConfig(ctx, cmd); reloadErr != nil {
 		return fmt.Errorf("rollback successful but reload failed: %w", reloadErr)
 	}
 
@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/node"
+	"strings"
+	"testing"
+)
+
+func TestSyncHostNFSConfig(t *testing.T) {
+	const (
+		hostIP     = "10.0.0.2"
+		configPath = "/etc/ganesha/ganesha.conf"
+		reloadCmd  = "pid=$(pgrep ganesha.nfsd)"
+	)
+	tests := []struct {
+		name string
+		// current 为主机上当前的配置，返回 "" 时表示配置文件不存在
+		current func(config string) string
+		script  func(f *node.FakeExecutor)
+		reason  string
+		// 期望执行的命令，按顺序匹配前缀
+		commands []string
+		// 是否期望写入新的配置
+		written bool
+	}{
+		{
+			name:     "create config",
+			commands: []string{"test -f", "cp ", "write " + configPath, reloadCmd},
+			written:  true,
+		},
+		{
+			name:     "update config",
+			current:  func(string) string { return "EXPORT {}" },
+			commands: []string{"test -f", "cat ", "cp ", "write " + configPath, reloadCmd},
+			written:  true,
+		},
+		{
+			name:     "config unchanged",
+			current:  func(config string) string { return config },
+			commands: []string{"test -f", "cat "},
+		},
+		{
+			name: "host unreachable",
+			script: func(f *node.FakeExecutor) {
+				f.On("test -f", "", errors.New("dial tcp 10.0.0.2:22: connect: no route to host"))
+			},
+			reason:   model.ReasonConfigWriteFailed,
+			commands: []string{"test -f"},
+		},
+		{
+			name: "write config failed",
+			script: func(f *node.FakeExecutor) {
+				f.On("write "+configPath, "", errors.New("read-only file system"))
+			},
+			reason:   model.ReasonConfigWriteFailed,
+			commands: []string{"test -f", "cp ", "write " + configPath},
+		},
+		{
+			name: "reload failed and rolled back",
+			script: func(f *node.FakeExecutor) {
+				f.On("ls -t /etc/ganesha/ganesha.conf.backup.*", "/etc/ganesha/ganesha.conf.backup.1\n", nil)
+				f.On(reloadCmd, "process-not-found", nil)
+			},
+			reason:   model.ReasonReloadFailed,
+			commands: []string{"test -f", "cp ", "write " + configPath, reloadCmd, "ls -t", "mv '/etc/ganesha/ganesha.conf.backup.1' '/etc/ganesha/ganesha.conf'", reloadCmd},
+			written:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTestDB(t, &model.NFSExport{})
+			exports := []model.NFSExport{
+				{HostIP: hostIP, Name: "media", Path: "media", Pseudo: "/media", DefaultACL: "RO", Acls: `[{"IPRange":"10.0.0.0/24","Permission":"RW"}]`, Status: "enabled"},
+				{HostIP: hostIP, Name: "backup", Path: "backup", Pseudo: "/backup", DefaultACL: "None", Acls: "[]", Status: "enabled"},
+			}
+			if err := db.Instance().Create(&exports).Error; err != nil {
+				t.Fatal(err)
+			}
+			config, err := node.GenerateNFSConfig(exports)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fake := node.NewFakeExecutor().On("test -f", "not_found", nil).On(reloadCmd, "reload-success", nil)
+			if tt.current != nil {
+				fake.On("test -f", "exists", nil).On("cat ", tt.current(config), nil)
+			}
+			if tt.script != nil {
+				tt.script(fake)
+			}
+
+			c := NewNFSShareController(fake.Factory())
+			err = c.syncHostNFSConfig(context.Background(), hostIP, exports)
+			if got := reasonOf(err, ""); (err != nil) != (tt.reason != "") || got != tt.reason {
+				t.Fatalf("expected reason %q, got error %v", tt.reason, err)
+			}
+
+			cmds := fake.Commands(hostIP)
+			if len(cmds) != len(tt.commands) {
+				t.Fatalf("expected commands %q, got %q", tt.commands, cmds)
+			}
+			for i := range cmds {
+				if !strings.HasPrefix(cmds[i], tt.commands[i]) {
+					t.Fatalf("expected commands %q, got %q", tt.commands, cmds)
+				}
+			}
+
+			written, ok := fake.File(hostIP, configPath)
+			if ok != tt.written || (ok && string(written) != config) {
+				t.Fatalf("expected config written %v, got %v:\n%s", tt.written, ok, written)
+			}
+
+			var applied int64
+			db.Instance().Model(&model.NFSExport{}).Where("last_applied IS NOT NULL").Count(&applied)
+			if wantApplied := tt.written && tt.reason == ""; wantApplied != (applied == int64(len(exports))) {
+				t.Fatalf("unexpected last applied exports %d", applied)
+			}
+		})
+	}
+}
+
+func TestNFSReconcileWithoutExports(t *testing.T) {
+	const (
+		hostIP     = "10.0.0.2"
+		configPath = "/etc/ganesha/ganesha.conf"
+		reloadCmd  = "pid=$(pgrep ganesha.nfsd)"
+	)
+	tests := []struct {
+		name   string
+		script func(f *node.FakeExecutor)
+		// 期望执行的命令，按顺序匹配前缀
+		commands []string
+		written  bool
+	}{
+		{
+			name: "last export removed",
+			script: func(f *node.FakeExecutor) {
+				f.On("test -f", "exists", nil).On("cat ", "EXPORT { Export_Id = 1; }", nil).On(reloadCmd, "reload-success", nil)
+			},
+			commands: []string{"test -f", "test -f", "cat ", "cp ", "write " + configPath, reloadCmd},
+			written:  true,
+		},
+		{
+			name: "service not running",
+			script: func(f *node.FakeExecutor) {
+				f.On("test -f", "exists", nil).On("cat ", "EXPORT { Export_Id = 1; }", nil).On(reloadCmd, "process-not-found", nil)
+			},
+			commands: []string{"test -f", "test -f", "cat ", "cp ", "write " + configPath, reloadCmd},
+			written:  true,
+		},
+		{
+			name: "never exported",
+			script: func(f *node.FakeExecutor) {
+				f.On("test -f", "not_found", nil)
+			},
+			commands: []string{"test -f"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTestDB(t, &model.NFSExport{})
+			disabled := model.NFSExport{HostIP: hostIP, Name: "media", Path: "media", Pseudo: "/media", DefaultACL: "RO", Acls: "[]", Status: "disabled"}
+			if err := db.Instance().Create(&disabled).Error; err != nil {
+				t.Fatal(err)
+			}
+			fake := node.NewFakeExecutor()
+			tt.script(fake)
+
+			if err := NewNFSShareController(fake.Factory()).Reconcile(context.Background(), hostIP); err != nil {
+				t.Fatal(err)
+			}
+			cmds := fake.Commands(hostIP)
+			if len(cmds) != len(tt.commands) {
+				t.Fatalf("expected commands %q, got %q", tt.commands, cmds)
+			}
+			for i := range cmds {
+				if !strings.HasPrefix(cmds[i], tt.commands[i]) {
+					t.Fatalf("expected commands %q, got %q", tt.commands, cmds)
+				}
+			}
+			// 没有导出规则时不需要启动服务
+			if local := fake.Commands(model.LocalHost); len(local) != 0 {
+				t.Fatalf("expected nfs-ganesha service to be untouched, got %q", local)
+			}
+
+			written, ok := fake.File(hostIP, configPath)
+			if ok != tt.written {
+				t.Fatalf("expected config written %v, got %v", tt.written, ok)
+			}
+			if ok && strings.Contains(string(written), "Export_Id") {
+				t.Fatalf("expected config without exports:\n%s", written)
+			}
+		})
+	}
+}
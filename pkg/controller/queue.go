@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+// 失败重试的间隔，从 retryBaseDelay 开始每次失败翻倍，最长 retryMaxDelay
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
+
+// workQueue 待处理对象key的队列。
+// 同一个key在队列中只保留一个，正在处理的key再次加入时，等处理完成后重新入队，同一个key不会被并发处理
+type workQueue struct {
+	cond       *sync.Cond
+	queue      []string
+	dirty      map[string]bool
+	processing map[string]bool
+	// 每个key连续失败的次数
+	failures     map[string]int
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+	shuttingDown bool
+}
+
+func newWorkQueue() *workQueue {
+	return &workQueue{
+		cond:       sync.NewCond(&sync.Mutex{}),
+		dirty:      make(map[string]bool),
+		processing: make(map[string]bool),
+		failures:   make(map[string]int),
+		baseDelay:  retryBaseDelay,
+		maxDelay:   retryMaxDelay,
+	}
+}
+
+func (q *workQueue) add(key string) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.shuttingDown || q.dirty[key] {
+		return
+	}
+	q.dirty[key] = true
+	if q.processing[key] {
+		return
+	}
+	q.queue = append(q.queue, key)
+	q.cond.Signal()
+}
+
+// addAfter 延迟一段时间后加入队列
+func (q *workQueue) addAfter(key string, d time.Duration) {
+	if d <= 0 {
+		q.add(key)
+		return
+	}
+	time.AfterFunc(d, func() { q.add(key) })
+}
+
+// addRateLimited 按失败次数退避后重新加入队列，返回等待的时间
+func (q *workQueue) addRateLimited(key string) time.Duration {
+	q.cond.L.Lock()
+	n := q.failures[key]
+	q.failures[key] = n + 1
+	q.cond.L.Unlock()
+
+	d := q.baseDelay
+	for i := 0; i < n && d < q.maxDelay; i++ {
+		d *= 2
+	}
+	if d > q.maxDelay {
+		d = q.maxDelay
+	}
+	q.addAfter(key, d)
+	return d
+}
+
+// forget 处理成功后清除失败次数
+func (q *workQueue) forget(key string) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	delete(q.failures, key)
+}
+
+// get 阻塞直到取出一个key，队列关闭后返回 shutdown 为true，处理完成后需要调用 done
+func (q *workQueue) get() (key string, shutdown bool) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	for len(q.queue) == 0 && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	if len(q.queue) == 0 {
+		return "", true
+	}
+	key, q.queue = q.queue[0], q.queue[1:]
+	q.processing[key] = true
+	delete(q.dirty, key)
+	return key, false
+}
+
+func (q *workQueue) done(key string) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	delete(q.processing, key)
+	if q.dirty[key] {
+		q.queue = append(q.queue, key)
+		q.cond.Signal()
+	}
+}
+
+func (q *workQueue) len() int {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return len(q.queue)
+}
+
+// shutDown 不再接收新的key，已经在队列中的key处理完后 get 返回 shutdown
+func (q *workQueue) shutDown() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.shuttingDown = true
+	q.cond.Broadcast()
+}
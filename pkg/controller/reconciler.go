@@ -0,0 +1,274 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 注册的reconciler名称，接口修改对象后按名称把对象key加入对应的队列
+const (
+	// key 为主机ID
+	ReconcilerMountPoint = "mountPoint"
+	// key 为samba用户ID
+	ReconcilerSambaUser = "sambaUser"
+	// key 为主机IP
+	ReconcilerSambaShare = "sambaShare"
+	// key 为主机IP
+	ReconcilerNFSShare = "nfsShare"
+)
+
+// 处理单个对象的超时时间，超时后结束正在执行的主机命令并按失败重试
+const defaultReconcileTimeout = 5 * time.Minute
+
+// Reconciler 从队列中取出对象key交给 reconcile 处理，失败时按退避间隔重试。
+// Resync 把 list 返回的所有key加入队列，定时执行作为兜底
+type Reconciler struct {
+	name      string
+	reconcile func(ctx context.Context, key string) error
+	list      func() ([]string, error)
+	queue     *workQueue
+	mu        sync.Mutex
+	status    map[string]*model.ReconcileStatus
+	workers   sync.WaitGroup
+	timeout   time.Duration
+	// 停止时取消正在处理的对象
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewReconciler(name string, reconcile func(ctx context.Context, key string) error, list func() ([]string, error)) *Reconciler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Reconciler{
+		name:      name,
+		reconcile: reconcile,
+		list:      list,
+		queue:     newWorkQueue(),
+		status:    make(map[string]*model.ReconcileStatus),
+		timeout:   defaultReconcileTimeout,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+func (r *Reconciler) Name() string {
+	return r.name
+}
+
+// Enqueue 把对象key加入队列，已经在队列中时忽略
+func (r *Reconciler) Enqueue(key string) {
+	r.queue.add(key)
+}
+
+// Resync 把所有对象加入队列，并清除已经不存在的对象的状态
+func (r *Reconciler) Resync() error {
+	keys, err := r.list()
+	if err != nil {
+		return err
+	}
+	exists := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		exists[key] = true
+		r.queue.add(key)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.status {
+		if !exists[key] {
+			delete(r.status, key)
+		}
+	}
+	return nil
+}
+
+// Start 启动 workers 个协程处理队列
+func (r *Reconciler) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		r.workers.Add(1)
+		go func() {
+			defer r.workers.Done()
+			for {
+				key, shutdown := r.queue.get()
+				if shutdown {
+					return
+				}
+				r.process(key)
+			}
+		}()
+	}
+}
+
+// Shutdown 不再接收新的对象，等待正在处理的对象完成，ctx超时后取消正在执行的命令
+func (r *Reconciler) Shutdown(ctx context.Context) error {
+	defer r.cancel()
+	r.queue.shutDown()
+	done := make(chan struct{})
+	go func() {
+		r.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Reconciler) process(key string) {
+	defer r.queue.done(key)
+
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	err := safeRun(func() error { return r.reconcile(ctx, key) })
+	cancel()
+	if errors.Is(err, errObjectChanged) {
+		// 同步期间对象被接口修改，处理完成后立即重新处理，不计入失败次数
+		flog.Infof("%s %s changed during reconcile, requeue: %v", r.name, key, err)
+		r.queue.add(key)
+		return
+	}
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.status[key]
+	if !ok {
+		s = &model.ReconcileStatus{Key: key}
+		r.status[key] = s
+	}
+	if err == nil {
+		r.queue.forget(key)
+		s.Failures = 0
+		s.LastError = ""
+		s.LastErrorAt = nil
+		s.LastSyncedAt = &now
+		s.NextRetryAt = nil
+		return
+	}
+
+	delay := r.queue.addRateLimited(key)
+	next := now.Add(delay)
+	s.Failures++
+	s.LastError = err.Error()
+	s.LastErrorAt = &now
+	s.NextRetryAt = &next
+	flog.Errorf("reconcile %s %s failed %d times, retry in %v: %v", r.name, key, s.Failures, delay, err)
+}
+
+// Info 返回队列长度和对象状态
+func (r *Reconciler) Info() model.ReconcilerInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info := model.ReconcilerInfo{
+		Name:        r.name,
+		QueueLength: r.queue.len(),
+		Objects:     make([]model.ReconcileStatus, 0, len(r.status)),
+	}
+	for _, s := range r.status {
+		info.Objects = append(info.Objects, *s)
+	}
+	sort.Slice(info.Objects, func(i, j int) bool { return info.Objects[i].Key < info.Objects[j].Key })
+	return info
+}
+
+// 进程内注册的reconciler，接口通过名称找到对应的队列
+var (
+	reconcilersMu sync.RWMutex
+	reconcilers   = make(map[string]*Reconciler)
+)
+
+// Register 注册reconciler，之后 Enqueue 可以按名称加入对象
+func Register(r *Reconciler) error {
+	reconcilersMu.Lock()
+	defer reconcilersMu.Unlock()
+	if _, exists := reconcilers[r.name]; exists {
+		return ErrReconcilerExists
+	}
+	reconcilers[r.name] = r
+	return nil
+}
+
+// Enqueue 把对象加入指定reconciler的队列立即处理，reconciler未注册时忽略
+func Enqueue(name, key string) {
+	reconcilersMu.RLock()
+	r, ok := reconcilers[name]
+	reconcilersMu.RUnlock()
+	if !ok {
+		flog.Debugf("reconciler %s not registered, ignore key %s", name, key)
+		return
+	}
+	r.Enqueue(key)
+}
+
+// StartReconcilers 为每个注册的reconciler启动 workers 个协程
+func StartReconcilers(workers int) {
+	for _, r := range registered() {
+		r.Start(workers)
+	}
+}
+
+// ResyncAll 把所有reconciler的全部对象加入队列，批量修改配置后调用
+func ResyncAll() error {
+	var errs []error
+	for _, r := range registered() {
+		if err := r.Resync(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Reconcilers 返回所有reconciler的状态，按名称排序
+func Reconcilers() []model.ReconcilerInfo {
+	rs := registered()
+	infos := make([]model.ReconcilerInfo, 0, len(rs))
+	for _, r := range rs {
+		infos = append(infos, r.Info())
+	}
+	return infos
+}
+
+// ShutdownReconcilers 停止所有reconciler并等待正在处理的对象完成
+func ShutdownReconcilers(ctx context.Context) error {
+	var errs []error
+	for _, r := range registered() {
+		if err := r.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func registered() []*Reconciler {
+	reconcilersMu.RLock()
+	defer reconcilersMu.RUnlock()
+	rs := make([]*Reconciler, 0, len(reconcilers))
+	for _, r := range reconcilers {
+		rs = append(rs, r)
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].name < rs[j].name })
+	return rs
+}
+
+// hostIPs 返回所有主机的IP
+func hostIPs() ([]string, error) {
+	var ips []string
+	if err := db.Instance().Model(&model.Host{}).Pluck("host_ip", &ips).Error; err != nil {
+		return nil, fmt.Errorf("cannot query hosts from db, error: %v", err)
+	}
+	return ips, nil
+}
+
+var ErrReconcilerExists = errors.New("reconciler already exists")
+
+// errObjectChanged 写回状态时对象的状态或版本与读取时不一致，说明同步期间被接口修改，
+// 不能覆盖新的修改，需要重新处理
+var errObjectChanged = errors.New("object changed during reconcile")
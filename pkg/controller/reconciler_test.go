@@ -0,0 +1,231 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/node"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkQueue(t *testing.T) {
+	q := newWorkQueue()
+	q.add("a")
+	q.add("b")
+	q.add("a")
+	if q.len() != 2 {
+		t.Fatalf("expected duplicated key to be merged, got %d keys", q.len())
+	}
+
+	key, _ := q.get()
+	if key != "a" {
+		t.Fatalf("expected a, got %s", key)
+	}
+	// 正在处理的key再次加入时，处理完成后才重新入队
+	q.add("a")
+	if q.len() != 1 {
+		t.Fatalf("expected key in processing not to be queued, got %d keys", q.len())
+	}
+	q.done("a")
+	if q.len() != 2 {
+		t.Fatalf("expected key to be queued again after done, got %d keys", q.len())
+	}
+
+	q.shutDown()
+	q.add("c")
+	for _, want := range []string{"b", "a"} {
+		if key, shutdown := q.get(); key != want || shutdown {
+			t.Fatalf("expected %s before shutdown, got %s %v", want, key, shutdown)
+		}
+	}
+	if _, shutdown := q.get(); !shutdown {
+		t.Fatal("expected shutdown after queue drained")
+	}
+}
+
+func TestWorkQueueBackoff(t *testing.T) {
+	q := newWorkQueue()
+	q.baseDelay = time.Hour
+	q.maxDelay = 5 * time.Hour
+	var delays []time.Duration
+	for i := 0; i < 5; i++ {
+		delays = append(delays, q.addRateLimited("a"))
+	}
+	want := []time.Duration{time.Hour, 2 * time.Hour, 4 * time.Hour, 5 * time.Hour, 5 * time.Hour}
+	for i := range want {
+		if delays[i] != want[i] {
+			t.Fatalf("unexpected delays %v", delays)
+		}
+	}
+	q.forget("a")
+	if d := q.addRateLimited("a"); d != time.Hour {
+		t.Fatalf("expected delay to reset after forget, got %v", d)
+	}
+}
+
+func TestReconciler(t *testing.T) {
+	flog.NewLogger(0)
+	var mu sync.Mutex
+	calls := map[string]int{}
+	synced := make(chan string, 10)
+	r := NewReconciler("test", func(ctx context.Context, key string) error {
+		mu.Lock()
+		calls[key]++
+		n := calls[key]
+		mu.Unlock()
+		// 前两次失败，之后成功
+		if key == "flaky" && n <= 2 {
+			return errors.New("host unreachable")
+		}
+		synced <- key
+		return nil
+	}, func() ([]string, error) {
+		return []string{"ok", "flaky"}, nil
+	})
+	r.queue.baseDelay = 10 * time.Millisecond
+	r.Start(2)
+	defer r.Shutdown(context.Background())
+
+	if err := r.Resync(); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for len(got) < 2 {
+		select {
+		case key := <-synced:
+			got[key] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for reconcile, synced %v", got)
+		}
+	}
+
+	info := r.Info()
+	if len(info.Objects) != 2 || info.Objects[0].Key != "flaky" || info.Objects[1].Key != "ok" {
+		t.Fatalf("unexpected objects %+v", info.Objects)
+	}
+	for _, s := range info.Objects {
+		if s.Failures != 0 || s.LastError != "" || s.LastSyncedAt == nil || s.NextRetryAt != nil {
+			t.Fatalf("unexpected status %+v", s)
+		}
+	}
+	mu.Lock()
+	if calls["flaky"] != 3 {
+		t.Fatalf("expected flaky to be retried twice, got %d calls", calls["flaky"])
+	}
+	mu.Unlock()
+}
+
+func TestReconcilerFailureStatus(t *testing.T) {
+	flog.NewLogger(0)
+	keys := []string{"a", "b"}
+	r := NewReconciler("test", func(ctx context.Context, key string) error {
+		if key == "b" {
+			return errors.New("mount failed")
+		}
+		return nil
+	}, func() ([]string, error) {
+		return keys, nil
+	})
+	r.queue.baseDelay = time.Hour
+	r.queue.maxDelay = 2 * time.Hour
+
+	// 不启动协程，直接处理队列中的对象
+	r.Resync()
+	for r.queue.len() > 0 {
+		key, _ := r.queue.get()
+		r.process(key)
+	}
+	info := r.Info()
+	b := info.Objects[1]
+	if b.Key != "b" || b.Failures != 1 || b.LastError != "mount failed" || b.LastErrorAt == nil || b.NextRetryAt == nil {
+		t.Fatalf("unexpected status %+v", b)
+	}
+	if b.NextRetryAt.Sub(*b.LastErrorAt) != time.Hour {
+		t.Fatalf("expected retry after base delay, got %v", b.NextRetryAt.Sub(*b.LastErrorAt))
+	}
+
+	// 对象删除后，全量同步时清除状态
+	keys = []string{"a"}
+	r.Resync()
+	if info := r.Info(); len(info.Objects) != 1 || info.Objects[0].Key != "a" {
+		t.Fatalf("expected status of removed object to be cleared, got %+v", info.Objects)
+	}
+}
+
+func TestReconcilerTimeout(t *testing.T) {
+	flog.NewLogger(0)
+	r := NewReconciler("test", func(ctx context.Context, key string) error {
+		// 模拟卡住的主机命令，只有 ctx 取消时才返回
+		_, err := node.NewFakeExecutor().Block("umount").Factory()("10.0.0.2").CommandContext(ctx, "umount -f /mnt/old")
+		return err
+	}, func() ([]string, error) {
+		return nil, nil
+	})
+	r.timeout = 50 * time.Millisecond
+	r.queue.baseDelay = time.Hour
+
+	r.process("a")
+	if s := r.Info().Objects[0]; s.Failures != 1 || !strings.Contains(s.LastError, context.DeadlineExceeded.Error()) {
+		t.Fatalf("expected reconcile to time out, got %+v", s)
+	}
+
+	// 停止时取消正在处理的对象
+	r.timeout = time.Hour
+	r.queue.forget("a")
+	r.Start(1)
+	r.Enqueue("b")
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := r.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected shutdown to wait for running reconcile, got %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		r.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected running reconcile to be canceled after shutdown")
+	}
+}
+
+func TestReconcilerObjectChanged(t *testing.T) {
+	flog.NewLogger(0)
+	calls := 0
+	r := NewReconciler("test", func(ctx context.Context, key string) error {
+		calls++
+		if calls == 1 {
+			return fmt.Errorf("%w: share media", errObjectChanged)
+		}
+		return nil
+	}, func() ([]string, error) {
+		return nil, nil
+	})
+	r.queue.baseDelay = time.Hour
+
+	r.Enqueue("a")
+	key, _ := r.queue.get()
+	r.process(key)
+	// 对象被修改时立即重新入队，不记为失败
+	if r.queue.len() != 1 {
+		t.Fatalf("expected changed object to be queued again, got %d keys", r.queue.len())
+	}
+	for _, s := range r.Info().Objects {
+		if s.Failures != 0 || s.NextRetryAt != nil {
+			t.Fatalf("changed object should not be counted as failure, got %+v", s)
+		}
+	}
+
+	key, _ = r.queue.get()
+	r.process(key)
+	if s := r.Info().Objects; calls != 2 || len(s) != 1 || s[0].LastSyncedAt == nil || s[0].Failures != 0 {
+		t.Fatalf("expected object to be synced after requeue, got %d calls %+v", calls, s)
+	}
+}
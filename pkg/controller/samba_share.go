@@ -2,76 +2,85 @@ package controller
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"flutelake/fluteNAS/pkg/model"
 	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/event"
 	"flutelake/fluteNAS/pkg/module/flog"
 	"flutelake/fluteNAS/pkg/module/node"
 	"fmt"
 	"html/template"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/scylladb/go-set"
+	"gorm.io/gorm"
 )
 
-var sambaShareLock sync.Mutex
-
 type SambaShareController struct {
+	mountRoot   string
+	newExecutor node.ExecutorFactory
 }
 
-func NewSambaShareController() *SambaShareController {
-	return &SambaShareController{}
+func NewSambaShareController(mountRoot string, executor node.ExecutorFactory) *SambaShareController {
+	return &SambaShareController{
+		mountRoot:   mountRoot,
+		newExecutor: executor,
+	}
 }
 
-func (s *SambaShareController) Do() {
-	if !sambaShareLock.TryLock() {
-		return
-	}
-	defer sambaShareLock.Unlock()
-	hosts := []model.Host{}
-	queryRes := db.Instance().Find(&hosts)
-	if queryRes.Error != nil {
-		flog.Errorf("cannot query hosts from db, error: %v", queryRes.Error)
-		return
-	}
-	for _, h := range hosts {
-		s.DoOnHost(h)
-	}
+// Keys 返回所有主机的IP
+func (s *SambaShareController) Keys() ([]string, error) {
+	return hostIPs()
+}
 
+// Reconcile 生成并下发主机的smb.conf，key 为主机IP
+func (s *SambaShareController) Reconcile(ctx context.Context, key string) error {
+	host := model.Host{}
+	if err := db.Instance().First(&host, "host_ip = ?", key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("cannot query host %s from db, error: %v", key, err)
+	}
+	return s.DoOnHost(ctx, host)
 }
 
-func (s *SambaShareController) DoOnHost(host model.Host) {
+func (s *SambaShareController) DoOnHost(ctx context.Context, host model.Host) error {
 	smbShares := []model.SambaShare{}
 	// 找出所有的samba 用户
 	queryRes := db.Instance().Where("host_ip = ?", host.HostIP).Find(&smbShares)
 	if queryRes.Error != nil {
-		flog.Errorf("cannot query samba users from db, error: %v", queryRes.Error)
-		return
+		return fmt.Errorf("cannot query samba shares from db, error: %v", queryRes.Error)
 	}
 
 	if len(smbShares) == 0 {
 		flog.Debugf("No enabled samba exports found, skipping sync")
-		return
+		return nil
 	}
 
-	if err := CheckAndMaintainSambaService(); err != nil {
+	local := s.newExecutor(model.LocalHost)
+	err := CheckAndMaintainSambaService(ctx, local)
+	local.Close()
+	if err != nil {
 		flog.Warnf("check and maintain samba service failed, error: %v", err)
 	}
 
-	updateIDs := []uint{}
-	deleteIDs := []uint{}
+	updated := []model.SambaShare{}
+	deleted := []model.SambaShare{}
 	change := false
 	exports := []SambaExport{}
+	mountRoot := s.mountRoot
 	for _, s := range smbShares {
 		switch s.Status {
 		case model.SambaShareStatus_Init, model.SambaShareStatus_Updating:
 			change = true
-			updateIDs = append(updateIDs, s.ID)
+			updated = append(updated, s)
 		case model.SambaShareStatus_Deleting:
 			change = true
-			deleteIDs = append(deleteIDs, s.ID)
+			deleted = append(deleted, s)
 			continue
 		}
 		perms := s.UserPermissions.Get()
@@ -93,7 +102,7 @@ func (s *SambaShareController) DoOnHost(host model.Host) {
 		}
 		ex := SambaExport{
 			ShareID:           s.Pseudo, //fmt.Sprintf("%d", s.ID),
-			Path:              filepath.Join("/mnt", s.Path),
+			Path:              filepath.Join(mountRoot, s.Path),
 			ValidUsers:        strings.Join(vaildUsers.List(), " "),
 			WriteUsers:        strings.Join(writeUsers.List(), " "),
 			Everyone:          everyone,
@@ -103,47 +112,98 @@ func (s *SambaShareController) DoOnHost(host model.Host) {
 	}
 
 	if !change {
-		return
+		// 升级前已经生效的共享没有条件，补充Ready条件
+		for i := range smbShares {
+			if _, ok := smbShares[i].Conditions.Find(model.ConditionReady); !ok {
+				setSharesReady(smbShares[i:i+1], nil)
+			}
+		}
+		return nil
 	}
 
 	buf, err := BuildSambaExports(exports)
 	if err != nil {
-		flog.Errorf("build smb.conf failed, error: %v", err)
-		return
+		err = withReason(model.ReasonConfigInvalid, fmt.Errorf("build smb.conf failed, error: %v", err))
+		setSharesReady(append(updated, deleted...), err)
+		return err
 	}
 	content := buf.String()
 
-	cmd := node.NewExec().SetHost(host.HostIP)
-	err = cmd.WriteFile("/etc/samba/smb.conf", []byte(content), 0644)
+	cmd := s.newExecutor(host.HostIP)
+	defer cmd.Close()
+	err = cmd.WriteFileContext(ctx, "/etc/samba/smb.conf", []byte(content), 0644)
 	if err != nil {
-		flog.Errorf("write smb.conf into host: %s, failed, error: %v", host.HostIP, err)
-		return
+		publishSambaShareEvents(model.EventShareFailed, append(updated, deleted...), err)
+		err = withReason(model.ReasonConfigWriteFailed, fmt.Errorf("write smb.conf into host: %s, failed, error: %v", host.HostIP, err))
+		setSharesReady(append(updated, deleted...), err)
+		return err
 	}
 
-	_, err = cmd.Command("smbcontrol smbd reload-config")
+	_, err = cmd.CommandContext(ctx, "smbcontrol smbd reload-config")
 	if err != nil {
-		flog.Errorf("reload smb.conf on host: %s, failed, error: %v", host.HostIP, err)
-		return
+		publishSambaShareEvents(model.EventShareFailed, append(updated, deleted...), err)
+		err = withReason(model.ReasonReloadFailed, fmt.Errorf("reload smb.conf on host: %s, failed, error: %v", host.HostIP, err))
+		setSharesReady(append(updated, deleted...), err)
+		return err
 	}
 
-	if len(updateIDs) > 0 {
-		result := db.Instance().Model(&model.SambaShare{}).Where("ID IN ?", updateIDs).Updates(map[string]interface{}{
-			"status":     model.SambaShareStatus_Active,
-			"updated_at": time.Now(),
-		})
+	// 只更新状态和版本与读取时一致的共享，同步期间被接口修改的共享重新处理
+	changed := false
+	applied := make([]model.SambaShare, 0, len(updated))
+	for _, share := range updated {
+		result := db.Instance().Model(&model.SambaShare{}).
+			Where("id = ? AND generation = ? AND status = ?", share.ID, share.Generation, share.Status).
+			Updates(map[string]interface{}{
+				"status":     model.SambaShareStatus_Active,
+				"updated_at": time.Now(),
+			})
 		if result.Error != nil {
-			flog.Errorf("update samba shares status failed, error: %v", err)
-			return
+			return fmt.Errorf("update samba shares status failed, error: %v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			changed = true
+			continue
 		}
+		share.Status = model.SambaShareStatus_Active
+		applied = append(applied, share)
 	}
-	if len(deleteIDs) > 0 {
-		result := db.Instance().Where("ID IN ?", updateIDs).Delete(&model.SambaShare{})
+	setSharesReady(applied, nil)
+	publishSambaShareEvents(model.EventShareActive, applied, nil)
+
+	removed := make([]model.SambaShare, 0, len(deleted))
+	for _, share := range deleted {
+		result := db.Instance().Where("id = ? AND generation = ? AND status = ?", share.ID, share.Generation, share.Status).Delete(&model.SambaShare{})
 		if result.Error != nil {
-			flog.Errorf("delete samba shares failed, error: %v", err)
-			return
+			return fmt.Errorf("delete samba shares failed, error: %v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			changed = true
+			continue
 		}
+		removed = append(removed, share)
+	}
+	publishSambaShareEvents(model.EventShareDeleted, removed, nil)
+	if changed {
+		return fmt.Errorf("%w: samba shares on host %s", errObjectChanged, host.HostIP)
+	}
+	return nil
+}
+
+// setSharesReady 保存共享的Ready条件，err 为nil时表示配置已经生效
+func setSharesReady(shares []model.SambaShare, err error) {
+	for i := range shares {
+		setReady(&shares[i], &shares[i].Conditions, shares[i].Generation, model.ReasonApplied, model.ReasonConfigWriteFailed, err)
 	}
+}
 
+func publishSambaShareEvents(typ string, shares []model.SambaShare, err error) {
+	for _, s := range shares {
+		e := model.SambaShareEvent{ID: s.ID, HostIP: s.HostIP, Pseudo: s.Pseudo, Status: s.Status}
+		if err != nil {
+			e.Error = err.Error()
+		}
+		event.Publish(event.TopicSambaShare, typ, e)
+	}
 }
 
 func BuildSambaExports(exports []SambaExport) (*bytes.Buffer, error) {
@@ -237,19 +297,17 @@ const _sambaShareTemplate = `
 // force user = root
 // force group = root
 
-func CheckAndMaintainSambaService() error {
-
-	cmd := node.NewExec().SetHost("127.0.0.1")
-	defer cmd.Close()
-	output, err := cmd.CommandWithoutExitCode("systemctl is-active smbd")
+// CheckAndMaintainSambaService 检查 cmd 所在主机的smbd服务，未运行或未开机自启时启动并设置自启
+func CheckAndMaintainSambaService(ctx context.Context, cmd node.Executor) error {
+	output, err := cmd.CommandWithoutExitCodeContext(ctx, "systemctl is-active smbd")
 	if err != nil {
 		return fmt.Errorf("failed to check Samba enable status: %w", err)
 	}
 	if strings.TrimSpace(string(output)) != "active" {
-		cmd.CommandWithoutExitCode("systemctl start smbd")
+		cmd.CommandWithoutExitCodeContext(ctx, "systemctl start smbd")
 	}
 
-	output, err = cmd.CommandWithoutExitCode("systemctl is-enabled smbd")
+	output, err = cmd.CommandWithoutExitCodeContext(ctx, "systemctl is-enabled smbd")
 	if err != nil {
 		return fmt.Errorf("failed to check Samba enable status: %w", err)
 	}
@@ -257,7 +315,7 @@ func CheckAndMaintainSambaService() error {
 	enabledState := strings.TrimSpace(string(output))
 	if enabledState != "enabled" {
 		flog.Warnf("Samba service is not enabled at boot: %s", enabledState)
-		cmd.CommandWithoutExitCode("systemctl enable smbd")
+		cmd.CommandWithoutExitCodeContext(ctx, "systemctl enable smbd")
 	}
 
 	return nil
@@ -0,0 +1,218 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/node"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSambaShareDoOnHost(t *testing.T) {
+	const hostIP = "10.0.0.2"
+	tests := []struct {
+		name   string
+		status string
+		script func(f *node.FakeExecutor)
+		// 期望的错误原因，为空时期望同步成功
+		reason string
+		// 期望执行的命令，按顺序匹配前缀
+		commands []string
+		// 同步后共享的状态，为空时期望记录已经删除
+		wantStatus string
+	}{
+		{
+			name:       "apply new share",
+			status:     model.SambaShareStatus_Init,
+			commands:   []string{"write /etc/samba/smb.conf", "smbcontrol smbd reload-config"},
+			wantStatus: model.SambaShareStatus_Active,
+		},
+		{
+			name:       "already active",
+			status:     model.SambaShareStatus_Active,
+			wantStatus: model.SambaShareStatus_Active,
+		},
+		{
+			name:     "delete share",
+			status:   model.SambaShareStatus_Deleting,
+			commands: []string{"write /etc/samba/smb.conf", "smbcontrol smbd reload-config"},
+		},
+		{
+			name:   "write config failed",
+			status: model.SambaShareStatus_Updating,
+			script: func(f *node.FakeExecutor) {
+				f.On("write /etc/samba/smb.conf", "", errors.New("permission denied"))
+			},
+			reason:     model.ReasonConfigWriteFailed,
+			commands:   []string{"write /etc/samba/smb.conf"},
+			wantStatus: model.SambaShareStatus_Updating,
+		},
+		{
+			name:   "reload failed",
+			status: model.SambaShareStatus_Init,
+			script: func(f *node.FakeExecutor) {
+				f.On("smbcontrol", "", errors.New("exit status 1"))
+			},
+			reason:     model.ReasonReloadFailed,
+			commands:   []string{"write /etc/samba/smb.conf", "smbcontrol smbd reload-config"},
+			wantStatus: model.SambaShareStatus_Init,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTestDB(t, &model.SambaShare{})
+			share := model.SambaShare{
+				HostIP:          hostIP,
+				Name:            "media",
+				Path:            "media",
+				Pseudo:          "media",
+				UserPermissions: `[{"Username":"alice","Permission":"rw"},{"Username":"bob","Permission":"r"}]`,
+				Status:          tt.status,
+			}
+			if err := db.Instance().Create(&share).Error; err != nil {
+				t.Fatal(err)
+			}
+			fake := node.NewFakeExecutor().On("systemctl is-active", "active", nil).On("systemctl is-enabled", "enabled", nil)
+			if tt.script != nil {
+				tt.script(fake)
+			}
+
+			c := NewSambaShareController("/mnt", fake.Factory())
+			err := c.DoOnHost(context.Background(), model.Host{HostIP: hostIP})
+			if got := reasonOf(err, ""); (err != nil) != (tt.reason != "") || got != tt.reason {
+				t.Fatalf("expected reason %q, got error %v", tt.reason, err)
+			}
+
+			cmds := fake.Commands(hostIP)
+			if len(cmds) != len(tt.commands) {
+				t.Fatalf("expected commands %q, got %q", tt.commands, cmds)
+			}
+			for i := range cmds {
+				if !strings.HasPrefix(cmds[i], tt.commands[i]) {
+					t.Fatalf("expected commands %q, got %q", tt.commands, cmds)
+				}
+			}
+			// 服务检查总是在本机执行
+			if local := fake.Commands(model.LocalHost); len(local) != 2 {
+				t.Fatalf("expected samba service to be checked on local host, got %q", local)
+			}
+
+			var got []model.SambaShare
+			if err := db.Instance().Find(&got, share.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantStatus == "" {
+				if len(got) != 0 {
+					t.Fatal("expected share to be deleted")
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Status != tt.wantStatus {
+				t.Fatalf("expected status %s, got %+v", tt.wantStatus, got)
+			}
+			ready, _ := got[0].Conditions.Find(model.ConditionReady)
+			wantReason := tt.reason
+			if wantReason == "" {
+				wantReason = model.ReasonApplied
+			}
+			if ready.Reason != wantReason {
+				t.Fatalf("expected ready reason %s, got %+v", wantReason, ready)
+			}
+		})
+	}
+}
+
+func TestSambaShareDoOnHostConfig(t *testing.T) {
+	initTestDB(t, &model.SambaShare{})
+	shares := []model.SambaShare{
+		{HostIP: "10.0.0.2", Name: "media", Path: "media", Pseudo: "media", UserPermissions: `[{"Username":"alice","Permission":"rw"}]`},
+		{HostIP: "10.0.0.2", Name: "public", Path: "public", Pseudo: "public", UserPermissions: `[{"Username":"everyone","Permission":"r"}]`},
+		{HostIP: "10.0.0.3", Name: "other", Path: "other", Pseudo: "other"},
+	}
+	if err := db.Instance().Create(&shares).Error; err != nil {
+		t.Fatal(err)
+	}
+	fake := node.NewFakeExecutor()
+	if err := NewSambaShareController("/srv/nas", fake.Factory()).DoOnHost(context.Background(), model.Host{HostIP: "10.0.0.2"}); err != nil {
+		t.Fatal(err)
+	}
+	conf, ok := fake.File("10.0.0.2", "/etc/samba/smb.conf")
+	if !ok {
+		t.Fatal("expected smb.conf to be written")
+	}
+	for _, want := range []string{"[media]", "path = /srv/nas/media", "valid users = alice", "[public]", "guest ok = yes"} {
+		if !strings.Contains(string(conf), want) {
+			t.Fatalf("expected %q in smb.conf:\n%s", want, conf)
+		}
+	}
+	if strings.Contains(string(conf), "[other]") {
+		t.Fatalf("share of other host should not be exported:\n%s", conf)
+	}
+	if _, ok := fake.File("10.0.0.3", "/etc/samba/smb.conf"); ok {
+		t.Fatal("expected other host to be untouched")
+	}
+}
+
+func TestSambaShareDoOnHostConcurrentUpdate(t *testing.T) {
+	const hostIP = "10.0.0.2"
+	tests := []struct {
+		name   string
+		status string
+		// 重新加载配置时接口把共享修改为的状态
+		update string
+	}{
+		{name: "updated during reconcile", status: model.SambaShareStatus_Init, update: model.SambaShareStatus_Updating},
+		{name: "deleted during reconcile", status: model.SambaShareStatus_Updating, update: model.SambaShareStatus_Deleting},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTestDB(t, &model.SambaShare{})
+			share := model.SambaShare{HostIP: hostIP, Name: "media", Path: "media", Pseudo: "media", Status: tt.status}
+			if err := db.Instance().Create(&share).Error; err != nil {
+				t.Fatal(err)
+			}
+			var once sync.Once
+			fake := node.NewFakeExecutor().Do("smbcontrol", func() {
+				once.Do(func() {
+					db.Instance().Model(&model.SambaShare{}).Where("id = ?", share.ID).Updates(map[string]any{
+						"status":     tt.update,
+						"generation": share.Generation + 1,
+					})
+				})
+			})
+			c := NewSambaShareController("/mnt", fake.Factory())
+			if err := c.DoOnHost(context.Background(), model.Host{HostIP: hostIP}); !errors.Is(err, errObjectChanged) {
+				t.Fatalf("expected errObjectChanged, got %v", err)
+			}
+			var got model.SambaShare
+			if err := db.Instance().First(&got, share.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.update || got.Generation != share.Generation+1 {
+				t.Fatalf("change made during reconcile should be kept, got %+v", got)
+			}
+
+			// 重新处理时应用新的修改
+			if err := c.DoOnHost(context.Background(), model.Host{HostIP: hostIP}); err != nil {
+				t.Fatal(err)
+			}
+			var shares []model.SambaShare
+			if err := db.Instance().Find(&shares, share.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			conf, _ := fake.File(hostIP, "/etc/samba/smb.conf")
+			if tt.update == model.SambaShareStatus_Deleting {
+				if len(shares) != 0 || strings.Contains(string(conf), "[media]") {
+					t.Fatalf("expected share to be removed, got %+v:\n%s", shares, conf)
+				}
+				return
+			}
+			if len(shares) != 1 || shares[0].Status != model.SambaShareStatus_Active {
+				t.Fatalf("expected share to be active, got %+v", shares)
+			}
+		})
+	}
+}
@@ -1,162 +1,199 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"flutelake/fluteNAS/pkg/model"
 	"flutelake/fluteNAS/pkg/module/db"
 	"flutelake/fluteNAS/pkg/module/flog"
 	"flutelake/fluteNAS/pkg/module/node"
 	"flutelake/fluteNAS/pkg/util"
 	"fmt"
+	"strconv"
 	"strings"
-	"sync"
-)
 
-var sambaUserLock sync.Mutex
+	"gorm.io/gorm"
+)
 
 type SambaUserController struct {
+	newExecutor node.ExecutorFactory
 }
 
-func NewSambaUsereController() *SambaUserController {
-	return &SambaUserController{}
+func NewSambaUsereController(executor node.ExecutorFactory) *SambaUserController {
+	return &SambaUserController{
+		newExecutor: executor,
+	}
+}
+
+// Keys 返回所有samba用户的ID
+func (s *SambaUserController) Keys() ([]string, error) {
+	var ids []uint
+	if err := db.Instance().Model(&model.SambaUser{}).Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("cannot query samba users from db, error: %v", err)
+	}
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, strconv.FormatUint(uint64(id), 10))
+	}
+	return keys, nil
 }
 
-func (s *SambaUserController) Do() {
-	if !sambaUserLock.TryLock() {
-		return
-	}
-	defer sambaUserLock.Unlock()
-	// flog.Debugf("start to check samba users...")
-	smbUsers := []model.SambaUser{}
-	// 找出所有的samba 用户
-	queryRes := db.Instance().Find(&smbUsers)
-	if queryRes.Error != nil {
-		flog.Errorf("cannot query samba users from db, error: %v", queryRes.Error)
-		return
-	}
-
-	for _, u := range smbUsers {
-		switch u.Status {
-		case model.SambaUserStatus_Active:
-			// 检查用户是否存在
-			if err := s.checkSambaUser(&u); err != nil {
-				flog.Errorf("failed to check samba user %s: %v", u.Username, err)
-				continue
-			}
-		case model.SambaUserStatus_Init:
-			if err := s.createSambaUser(&u); err != nil {
-				flog.Errorf("failed to create samba user %s: %v", u.Username, err)
-				continue
-			}
-		case model.SambaUserStatus_ChangingPWD:
-			if err := s.updateSambaUserPassword(&u); err != nil {
-				flog.Errorf("failed to update samba user password %s: %v", u.Username, err)
-				continue
-			}
-		case model.SambaUserStatus_Deleting:
-			if err := s.deleteSambaUser(&u); err != nil {
-				flog.Errorf("failed to delete samba user %s: %v", u.Username, err)
-				continue
-			}
+// Reconcile 按用户状态在主机上创建、修改密码、检查或删除samba用户，key 为用户ID
+func (s *SambaUserController) Reconcile(ctx context.Context, key string) error {
+	u := model.SambaUser{}
+	if err := db.Instance().First(&u, "id = ?", key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("cannot query samba user %s from db, error: %v", key, err)
+	}
+
+	var err error
+	switch u.Status {
+	case model.SambaUserStatus_Active:
+		// 检查用户是否存在
+		if err = s.checkSambaUser(ctx, &u); err != nil {
+			err = withReason(model.ReasonUserCheckFailed, fmt.Errorf("failed to check samba user %s: %w", u.Username, err))
+		}
+	case model.SambaUserStatus_Init:
+		if err = s.createSambaUser(ctx, &u); err != nil {
+			err = withReason(model.ReasonUserCreateFailed, fmt.Errorf("failed to create samba user %s: %w", u.Username, err))
+		}
+	case model.SambaUserStatus_ChangingPWD:
+		if err = s.updateSambaUserPassword(ctx, &u); err != nil {
+			err = withReason(model.ReasonPasswordFailed, fmt.Errorf("failed to update samba user password %s: %w", u.Username, err))
+		}
+	case model.SambaUserStatus_Deleting:
+		if err = s.deleteSambaUser(ctx, &u); err == nil {
+			// 记录已经删除
+			return nil
 		}
+		err = withReason(model.ReasonUserDeleteFailed, fmt.Errorf("failed to delete samba user %s: %w", u.Username, err))
 	}
+	if errors.Is(err, errObjectChanged) {
+		// 用户已经被接口修改，条件由重新处理时设置
+		return err
+	}
+	setReady(&u, &u.Conditions, u.Generation, model.ReasonApplied, model.ReasonUserCheckFailed, err)
+	return err
 }
 
 // createSambaUser 创建新的Samba用户
-func (s *SambaUserController) createSambaUser(user *model.SambaUser) error {
-	cmd := node.NewExec().SetHost(user.HostIP)
+func (s *SambaUserController) createSambaUser(ctx context.Context, user *model.SambaUser) error {
+	cmd := s.newExecutor(user.HostIP)
+	defer cmd.Close()
 	// 1. 创建系统用户
 	// useradd -M not create home directory
 	// useradd -s 指定登录shell，如果不指定会默认使用/bin/bash
-	if bs, err := cmd.Command(fmt.Sprintf("id %s || useradd -M -s /sbin/nologin %s", user.Username, user.Username)); err != nil {
+	if bs, err := cmd.CommandContext(ctx, fmt.Sprintf("id %s || useradd -M -s /sbin/nologin %s", user.Username, user.Username)); err != nil {
 		return fmt.Errorf("failed to create system user: %v, stdout: %s", err, string(bs))
 	}
 
 	// 2. 创建Samba用户并设置密码
-	bs, err := cmd.Command(fmt.Sprintf("(echo %s; echo %s) | smbpasswd -a %s", user.Password, user.Password, user.Username))
+	bs, err := cmd.CommandContext(ctx, fmt.Sprintf("(echo %s; echo %s) | smbpasswd -a %s", user.Password, user.Password, user.Username))
 	if err != nil {
 		return fmt.Errorf("failed to create samba user: %v, stdout: %s", err, string(bs))
 	}
 
 	// 3. 更新用户状态为激活
-	if err := db.Instance().Model(user).Update("status", model.SambaUserStatus_Active).Error; err != nil {
-		return fmt.Errorf("failed to update user status: %v", err)
+	if err := activateSambaUser(user); err != nil {
+		return err
 	}
 	flog.Infof("create samba user: %s successed", user.Username)
 	return nil
 }
 
 // updateSambaUserPassword 更新Samba用户密码
-func (s *SambaUserController) updateSambaUserPassword(user *model.SambaUser) error {
-	cmd := node.NewExec().SetHost(user.HostIP)
+func (s *SambaUserController) updateSambaUserPassword(ctx context.Context, user *model.SambaUser) error {
+	cmd := s.newExecutor(user.HostIP)
+	defer cmd.Close()
 	// 1. 新Samba用户密码
-	bs, err := cmd.Command(fmt.Sprintf("(echo %s; echo %s) | smbpasswd -a %s", user.Password, user.Password, user.Username))
+	bs, err := cmd.CommandContext(ctx, fmt.Sprintf("(echo %s; echo %s) | smbpasswd -a %s", user.Password, user.Password, user.Username))
 	if err != nil {
 		return fmt.Errorf("failed to update samba password: %v, stdout: %s", err, string(bs))
 	}
 
 	// 3. 更新用户状态为激活
-	if err := db.Instance().Model(user).Update("status", model.SambaUserStatus_Active).Error; err != nil {
-		return fmt.Errorf("failed to update user status: %v", err)
-	}
-
-	return nil
+	return activateSambaUser(user)
 }
 
 // deleteSambaUser 删除Samba用户
-func (s *SambaUserController) deleteSambaUser(user *model.SambaUser) error {
-	cmd := node.NewExec().SetHost(user.HostIP)
+func (s *SambaUserController) deleteSambaUser(ctx context.Context, user *model.SambaUser) error {
+	cmd := s.newExecutor(user.HostIP)
+	defer cmd.Close()
 	// 1. 检查samba用户是否存在
-	bs, err := cmd.Command(fmt.Sprintf("pdbedit --list | grep %s: | wc -l", user.Username))
+	bs, err := cmd.CommandContext(ctx, fmt.Sprintf("pdbedit --list | grep %s: | wc -l", user.Username))
 	if err != nil {
 		return fmt.Errorf("pdbedit failed to list samba user: %v, stdout: %s", err, string(bs))
 	}
 	if util.Trim(string(bs)) != "0" {
 		// 2. 删除samba用户
-		bs, err = cmd.Command(fmt.Sprintf("pdbedit --delete --user=%s", user.Username))
+		bs, err = cmd.CommandContext(ctx, fmt.Sprintf("pdbedit --delete --user=%s", user.Username))
 		if err != nil {
 			return fmt.Errorf("pdbedit failed to delete samba user: %v, stdout: %s", err, string(bs))
 		}
 	}
 
 	// 3. 检查系统用户是否存在
-	bs, err = cmd.Command(fmt.Sprintf("cat /etc/passwd | grep %s: | wc -l", user.Username))
+	bs, err = cmd.CommandContext(ctx, fmt.Sprintf("cat /etc/passwd | grep %s: | wc -l", user.Username))
 	if err != nil {
 		return fmt.Errorf("cat os user failed: %v, stdout: %s", err, string(bs))
 	}
 	// 4. 删除系统用户
 	if util.Trim(string(bs)) != "0" {
-		bs, err := cmd.Command(fmt.Sprintf("userdel -r %s", user.Username))
+		bs, err := cmd.CommandContext(ctx, fmt.Sprintf("userdel -r %s", user.Username))
 		if err != nil {
 			return fmt.Errorf("delete os user failed: %v, stdout: %s", err, string(bs))
 		}
 	}
 
-	// 3. 从数据库中删除用户记录
-	if err := db.Instance().Delete(user).Error; err != nil {
-		return fmt.Errorf("failed to delete user from database: %v", err)
+	// 3. 从数据库中删除用户记录，同步期间用户被接口修改时保留记录重新处理
+	result := db.Instance().Where("id = ? AND generation = ? AND status = ?", user.ID, user.Generation, user.Status).Delete(&model.SambaUser{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete user from database: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: samba user %s", errObjectChanged, user.Username)
+	}
+	return nil
+}
+
+// activateSambaUser 把用户状态改为激活，只有状态和版本与读取时一致才更新，
+// 不一致说明同步期间用户被接口修改，不能覆盖新的密码或删除操作
+func activateSambaUser(user *model.SambaUser) error {
+	result := db.Instance().Model(&model.SambaUser{}).
+		Where("id = ? AND generation = ? AND status = ?", user.ID, user.Generation, user.Status).
+		Update("status", model.SambaUserStatus_Active)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update user status: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: samba user %s", errObjectChanged, user.Username)
 	}
+	user.Status = model.SambaUserStatus_Active
 	return nil
 }
 
-func (s *SambaUserController) checkSambaUser(user *model.SambaUser) error {
-	cmd := node.NewExec().SetHost(user.HostIP)
+func (s *SambaUserController) checkSambaUser(ctx context.Context, user *model.SambaUser) error {
+	cmd := s.newExecutor(user.HostIP)
+	defer cmd.Close()
 
 	// 检查os samba user 是否存在
-	bs, err := cmd.Command(fmt.Sprintf("id %s", user.Username))
+	bs, err := cmd.CommandContext(ctx, fmt.Sprintf("id %s", user.Username))
 	if err != nil {
 		if strings.Contains(err.Error(), "no such user") {
 			// 不存在 则去创建
-			return s.createSambaUser(user)
+			return s.createSambaUser(ctx, user)
 		}
 		flog.Errorf("check samba user on host: %s, exec output: %s, error: %v", user.HostIP, string(bs), err)
 		return err
 	}
 
-	bs, err = cmd.Command(fmt.Sprintf("pdbedit -L %s", user.Username))
+	bs, err = cmd.CommandContext(ctx, fmt.Sprintf("pdbedit -L %s", user.Username))
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			// 不存在 则去创建
-			return s.createSambaUser(user)
+			return s.createSambaUser(ctx, user)
 		}
 		flog.Errorf("pdbedit check samba user on host: %s, exec output: %s, error: %v", user.HostIP, string(bs), err)
 		return err
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/node"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSambaUserReconcileConcurrentUpdate(t *testing.T) {
+	const hostIP = "10.0.0.2"
+	tests := []struct {
+		name   string
+		status string
+		// 设置密码时接口把用户修改为的状态
+		update string
+		// 重新处理时期望执行的命令，按顺序匹配前缀
+		commands []string
+	}{
+		{
+			name:     "password changed during create",
+			status:   model.SambaUserStatus_Init,
+			update:   model.SambaUserStatus_ChangingPWD,
+			commands: []string{"(echo newsecret; echo newsecret) | smbpasswd -a alice"},
+		},
+		{
+			name:     "deleted during password change",
+			status:   model.SambaUserStatus_ChangingPWD,
+			update:   model.SambaUserStatus_Deleting,
+			commands: []string{"pdbedit --list", "pdbedit --delete --user=alice", "cat /etc/passwd", "userdel -r alice"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTestDB(t, &model.SambaUser{})
+			user := model.SambaUser{HostIP: hostIP, Username: "alice", Password: "secret", Status: tt.status}
+			if err := db.Instance().Create(&user).Error; err != nil {
+				t.Fatal(err)
+			}
+			key := strconv.FormatUint(uint64(user.ID), 10)
+			var once sync.Once
+			fake := node.NewFakeExecutor().Do("(echo", func() {
+				once.Do(func() {
+					db.Instance().Model(&model.SambaUser{}).Where("id = ?", user.ID).Updates(map[string]any{
+						"status":     tt.update,
+						"password":   "newsecret",
+						"generation": user.Generation + 1,
+					})
+				})
+			})
+			c := NewSambaUsereController(fake.Factory())
+			if err := c.Reconcile(context.Background(), key); !errors.Is(err, errObjectChanged) {
+				t.Fatalf("expected errObjectChanged, got %v", err)
+			}
+			var got model.SambaUser
+			if err := db.Instance().First(&got, user.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.update || got.Generation != user.Generation+1 {
+				t.Fatalf("change made during reconcile should be kept, got %+v", got)
+			}
+
+			// 重新处理时应用新的修改
+			before := len(fake.Commands(hostIP))
+			if err := c.Reconcile(context.Background(), key); err != nil {
+				t.Fatal(err)
+			}
+			cmds := fake.Commands(hostIP)[before:]
+			if len(cmds) != len(tt.commands) {
+				t.Fatalf("expected commands %q, got %q", tt.commands, cmds)
+			}
+			for i := range cmds {
+				if !strings.HasPrefix(cmds[i], tt.commands[i]) {
+					t.Fatalf("expected commands %q, got %q", tt.commands, cmds)
+				}
+			}
+			var users []model.SambaUser
+			if err := db.Instance().Find(&users, user.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if tt.update == model.SambaUserStatus_Deleting {
+				if len(users) != 0 {
+					t.Fatalf("expected user to be deleted, got %+v", users)
+				}
+				return
+			}
+			if len(users) != 1 || users[0].Status != model.SambaUserStatus_Active {
+				t.Fatalf("expected user to be active, got %+v", users)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"time"
+)
+
+// AuditLog 修改数据的接口调用记录
+type AuditLog struct {
+	ID        uint      `json:"ID" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"CreatedAt" gorm:"index"`
+	Username  string    `json:"Username" gorm:"index"`
+	// 通过API token调用时为token的ID
+	TokenID   uint   `json:"TokenID"`
+	ClientIP  string `json:"ClientIP" gorm:"index"`
+	UserAgent string `json:"UserAgent"`
+	Route     string `json:"Route" gorm:"index"`
+	Query     string `json:"Query"`
+	// 隐藏了密码等敏感参数的请求体
+	Body       string `json:"Body"`
+	HTTPStatus int    `json:"HTTPStatus"`
+	// 响应的 retcode，0表示成功，没有响应体时为-1
+	Code int `json:"Code"`
+	// 处理耗时，单位毫秒
+	DurationMs int64 `json:"DurationMs"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+type ListAuditLogsRequest struct {
+	Username string `json:"Username"`
+	ClientIP string `json:"ClientIP"`
+	// 接口路径前缀，例如 /v1/disk
+	Route string `json:"Route"`
+	// 只返回失败的调用
+	FailedOnly bool       `json:"FailedOnly"`
+	Since      *time.Time `json:"Since"`
+	Until      *time.Time `json:"Until"`
+	// 页码从1开始
+	Page     int `json:"Page" validate:"omitempty,min=1"`
+	PageSize int `json:"PageSize" validate:"omitempty,min=1,max=500"`
+}
+
+type ListAuditLogsResponse struct {
+	Total    int64      `json:"Total"`
+	Page     int        `json:"Page"`
+	PageSize int        `json:"PageSize"`
+	Logs     []AuditLog `json:"Logs"`
+}
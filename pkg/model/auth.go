@@ -2,22 +2,40 @@ package model
 
 import (
 	"flutelake/fluteNAS/pkg/util"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+// Session 持久化的cookie会话，服务重启后重新加载到缓存
 type Session struct {
 	gorm.Model
-	ID        uint   `json:"ID" gorm:"uniqueIndex"`
-	SessionID string `json:"session_id"`
-	Username  string `json:"username"`
-	ExpiresAt int64  `json:"expires_at"`
+	// 会话ID的sha256摘要
+	SessionHash string `json:"-" gorm:"uniqueIndex;not null"`
+	Username    string `json:"Username" gorm:"not null;index"`
+	// 打开web终端需要的ssh密码，使用数据目录下的会话密钥加密保存
+	PasswordCipher string    `json:"-"`
+	ClientIP       string    `json:"ClientIP"`
+	UserAgent      string    `json:"UserAgent"`
+	ExpiresAt      time.Time `json:"ExpiresAt" gorm:"index"`
+}
+
+func (Session) TableName() string {
+	return "sessions"
 }
 
 type SessionUserInfo struct {
 	Username string           `json:"username"`
 	Password *util.LinkedRune `json:"password"`
 	IsAdmin  bool             `json:"is_admin"`
+	Role     string           `json:"role"`
+	// 通过API token认证时为token的ID，cookie会话时为0
+	TokenID uint `json:"token_id,omitempty"`
+}
+
+// HasPermission 判断会话用户的角色是否拥有指定权限
+func (u SessionUserInfo) HasPermission(permission string) bool {
+	return RoleHasPermission(u.Role, permission)
 }
 
 type LoginRequest struct {
@@ -25,7 +43,11 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
-type LoginResponse struct{}
+type LoginResponse struct {
+	// 用户开启了二次验证时为true，需要使用 mfa_token 调用 /v1/login/mfa 完成登录
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+}
 
 type KeyRequest struct {
 }
@@ -33,3 +55,38 @@ type KeyRequest struct {
 type KeyResponse struct {
 	Key string `json:"key"`
 }
+
+type UserInfoResponse struct {
+	Username    string   `json:"username"`
+	Role        string   `json:"role"`
+	IsAdmin     bool     `json:"is_admin"`
+	Permissions []string `json:"permissions"`
+}
+
+type ListSessionsRequest struct {
+	// 拥有用户管理权限时可以查看所有用户的会话
+	All bool `json:"All"`
+}
+
+type SessionInfo struct {
+	ID        uint      `json:"ID"`
+	Username  string    `json:"Username"`
+	ClientIP  string    `json:"ClientIP"`
+	UserAgent string    `json:"UserAgent"`
+	CreatedAt time.Time `json:"CreatedAt"`
+	ExpiresAt time.Time `json:"ExpiresAt"`
+	// 是否为发起请求的会话
+	Current bool `json:"Current"`
+}
+
+type ListSessionsResponse struct {
+	Sessions []SessionInfo `json:"Sessions"`
+}
+
+type RevokeSessionRequest struct {
+	ID uint `json:"ID" validate:"required"`
+}
+
+type RevokeSessionResponse struct {
+	ID uint `json:"ID"`
+}
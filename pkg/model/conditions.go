@@ -0,0 +1,121 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 条件的类型
+const (
+	// 对象的配置已经应用到主机上
+	ConditionReady = "Ready"
+)
+
+// 条件的状态
+const (
+	ConditionTrue    = "True"
+	ConditionFalse   = "False"
+	ConditionUnknown = "Unknown"
+)
+
+// 条件的原因，界面按原因显示说明，详细的错误在 Message 中
+const (
+	ReasonApplied = "Applied"
+	// 生成配置文件失败
+	ReasonConfigInvalid = "ConfigInvalid"
+	// 写入主机上的配置文件失败
+	ReasonConfigWriteFailed = "ConfigWriteFailed"
+	// 服务重新加载配置失败
+	ReasonReloadFailed       = "ReloadFailed"
+	ReasonUserCreateFailed   = "UserCreateFailed"
+	ReasonPasswordFailed     = "PasswordUpdateFailed"
+	ReasonUserCheckFailed    = "UserCheckFailed"
+	ReasonUserDeleteFailed   = "UserDeleteFailed"
+	ReasonMounted            = "Mounted"
+	ReasonMountFailed        = "MountFailed"
+	ReasonUmountFailed       = "UmountFailed"
+	ReasonDiskDescribeFailed = "DiskDescribeFailed"
+)
+
+// Condition 对象某一方面的状态，字段含义与 Kubernetes 的 condition 相同
+type Condition struct {
+	Type   string `json:"Type"`
+	Status string `json:"Status"`
+	Reason string `json:"Reason"`
+	// 可读的说明，失败时为错误信息
+	Message string `json:"Message"`
+	// Status 最近一次变化的时间
+	LastTransitionTime time.Time `json:"LastTransitionTime"`
+	// 设置条件时对象的 Generation，小于对象当前的 Generation 时说明最新的修改还没有被处理
+	ObservedGeneration int64 `json:"ObservedGeneration"`
+}
+
+// ConditionsString 对象的状态条件，JSON数组格式保存，每个类型最多一个
+type ConditionsString string
+
+func (s ConditionsString) Get() []Condition {
+	var arr []Condition
+	if err := json.Unmarshal([]byte(s), &arr); err != nil {
+		return []Condition{}
+	}
+	return arr
+}
+
+// Find 返回指定类型的条件
+func (s ConditionsString) Find(typ string) (Condition, bool) {
+	for _, c := range s.Get() {
+		if c.Type == typ {
+			return c, true
+		}
+	}
+	return Condition{}, false
+}
+
+// Set 添加或替换同类型的条件，Status 没有变化时保留原来的 LastTransitionTime
+func (s ConditionsString) Set(c Condition) ConditionsString {
+	arr := s.Get()
+	i := 0
+	for i < len(arr) && arr[i].Type != c.Type {
+		i++
+	}
+	if i < len(arr) && arr[i].Status == c.Status {
+		c.LastTransitionTime = arr[i].LastTransitionTime
+	}
+	if c.LastTransitionTime.IsZero() {
+		c.LastTransitionTime = time.Now()
+	}
+	if i < len(arr) {
+		arr[i] = c
+	} else {
+		arr = append(arr, c)
+	}
+	bs, _ := json.Marshal(arr)
+	return ConditionsString(bs)
+}
+
+// MarshalJSON 接口返回时将条件展开为数组
+func (s ConditionsString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Get())
+}
+
+// UnmarshalJSON 条件由控制器维护，忽略请求中传入的值
+func (s *ConditionsString) UnmarshalJSON([]byte) error {
+	return nil
+}
+
+// SaveCondition 设置对象的条件，条件没有变化时不写数据库。
+// 只更新 conditions 字段，不修改 UpdatedAt，也不会覆盖同时通过接口修改的字段
+func SaveCondition(db *gorm.DB, obj any, conditions *ConditionsString, c Condition) error {
+	if old, ok := conditions.Find(c.Type); ok && old.Status == c.Status && old.Reason == c.Reason &&
+		old.Message == c.Message && old.ObservedGeneration == c.ObservedGeneration {
+		return nil
+	}
+	updated := conditions.Set(c)
+	if err := db.Model(obj).UpdateColumn("conditions", updated).Error; err != nil {
+		return err
+	}
+	*conditions = updated
+	return nil
+}
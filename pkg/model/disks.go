@@ -26,15 +26,19 @@ type DiskDevice struct {
 	HotPlug        bool
 	Rota           bool
 	IsSystemDisk   bool
+	// 设置了挂载点时，挂载点的状态条件
+	MountConditions ConditionsString
 }
 
 type MountPoint struct {
 	gorm.Model
-	UUID   string `json:"UUID" gorm:"uniqueIndex"`
-	HostID string `json:"HostID"`
-	HostIP string `json:"HostIP"`
-	Device string `json:"Device"`
-	Path   string `json:"PATH"`
+	UUID       string           `json:"UUID" gorm:"uniqueIndex"`
+	HostID     string           `json:"HostID"`
+	HostIP     string           `json:"HostIP"`
+	Device     string           `json:"Device"`
+	Path       string           `json:"PATH"`
+	Generation int64            `json:"Generation" gorm:"not null;default:1"`
+	Conditions ConditionsString `json:"Conditions" gorm:"not null;default:'[]'"`
 }
 
 // result of mount -l on node
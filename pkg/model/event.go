@@ -0,0 +1,56 @@
+package model
+
+// 事件类型，与 event.Topic 组合确定事件数据的结构
+const (
+	// samba-share: SambaShareEvent
+	EventShareActive  = "active"
+	EventShareDeleted = "deleted"
+	EventShareFailed  = "failed"
+	// nfs-share: NFSShareEvent，同步失败时为 EventShareFailed
+	EventShareApplied = "applied"
+	// mount: MountEvent
+	EventMounted     = "mounted"
+	EventUmounted    = "umounted"
+	EventMountFailed = "failed"
+	// mkfs: MkfsEvent
+	EventMkfsStarted  = "started"
+	EventMkfsFinished = "finished"
+	EventMkfsFailed   = "failed"
+	// metrics: node.MonitoringMetrics
+	EventMetricsSample = "sample"
+)
+
+// SambaShareEvent samba共享的状态变化
+type SambaShareEvent struct {
+	ID     uint   `json:"ID"`
+	HostIP string `json:"HostIP"`
+	Pseudo string `json:"Pseudo"`
+	Status string `json:"Status"`
+	Error  string `json:"Error,omitempty"`
+}
+
+// NFSShareEvent nfs导出规则同步到主机的结果
+type NFSShareEvent struct {
+	ID     uint   `json:"ID"`
+	HostIP string `json:"HostIP"`
+	Name   string `json:"Name"`
+	Pseudo string `json:"Pseudo"`
+	Error  string `json:"Error,omitempty"`
+}
+
+// MountEvent 挂载点的变化
+type MountEvent struct {
+	HostIP string `json:"HostIP"`
+	UUID   string `json:"UUID"`
+	Device string `json:"Device"`
+	Path   string `json:"Path"`
+	Error  string `json:"Error,omitempty"`
+}
+
+// MkfsEvent 格式化磁盘的进度
+type MkfsEvent struct {
+	HostIP string `json:"HostIP"`
+	Device string `json:"Device"`
+	FsType string `json:"FsType"`
+	Error  string `json:"Error,omitempty"`
+}
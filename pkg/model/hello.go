@@ -5,4 +5,9 @@ type HelloRequest struct {
 	F2 string `json:"f2" validate:"required"`
 }
 
-type HelloResponse struct{}
+type HelloResponse struct {
+	Message string `json:"Message"`
+	// 当前运行的版本和commit，用于确认部署的版本
+	Version   string `json:"Version"`
+	GitCommit string `json:"GitCommit"`
+}
@@ -0,0 +1,96 @@
+package model
+
+import "time"
+
+// 任务执行的触发方式
+const (
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+)
+
+// JobSetting 通过接口修改的定时任务调度和暂停状态，重启后仍然生效
+type JobSetting struct {
+	Name string `gorm:"primaryKey"`
+	// 为空表示使用默认的调度
+	Schedule  string
+	Paused    bool
+	UpdatedAt time.Time
+}
+
+func (JobSetting) TableName() string {
+	return "job_settings"
+}
+
+// JobInfo 定时任务的状态
+type JobInfo struct {
+	Name            string `json:"Name"`
+	Schedule        string `json:"Schedule"`
+	DefaultSchedule string `json:"DefaultSchedule"`
+	Paused          bool   `json:"Paused"`
+	Running         bool   `json:"Running"`
+	// 暂停或调度器未启动时为空
+	NextRun *time.Time `json:"NextRun"`
+	// 最近一次执行，没有执行过时为空
+	LastRun *JobRun `json:"LastRun"`
+	// 最近的执行记录，按时间倒序，数量有上限
+	History []JobRun `json:"History"`
+}
+
+// JobRun 一次任务执行的记录
+type JobRun struct {
+	StartedAt  time.Time `json:"StartedAt"`
+	DurationMs int64     `json:"DurationMs"`
+	// 执行失败时的错误信息
+	Error   string `json:"Error"`
+	Trigger string `json:"Trigger"`
+}
+
+type ListJobsRequest struct {
+}
+
+type ListJobsResponse struct {
+	Jobs []JobInfo `json:"Jobs"`
+}
+
+type JobNameRequest struct {
+	Name string `json:"Name" validate:"required"`
+}
+
+type SetJobScheduleRequest struct {
+	Name string `json:"Name" validate:"required"`
+	// cron表达式，例如 "*/5 * * * *" 或 "@every 30s"
+	Schedule string `json:"Schedule" validate:"required"`
+}
+
+type JobResponse struct {
+	Job JobInfo `json:"Job"`
+}
+
+// ReconcilerInfo 一个reconciler的队列和对象状态
+type ReconcilerInfo struct {
+	Name string `json:"Name"`
+	// 等待处理的对象数，不包括等待重试的对象
+	QueueLength int `json:"QueueLength"`
+	// 处理过的对象，按key排序
+	Objects []ReconcileStatus `json:"Objects"`
+}
+
+// ReconcileStatus 一个对象最近的同步结果
+type ReconcileStatus struct {
+	Key string `json:"Key"`
+	// 连续失败的次数，成功后清零
+	Failures    int        `json:"Failures"`
+	LastError   string     `json:"LastError"`
+	LastErrorAt *time.Time `json:"LastErrorAt"`
+	// 最近一次同步成功的时间
+	LastSyncedAt *time.Time `json:"LastSyncedAt"`
+	// 失败后下一次重试的时间
+	NextRetryAt *time.Time `json:"NextRetryAt"`
+}
+
+type ListReconcilersRequest struct {
+}
+
+type ListReconcilersResponse struct {
+	Reconcilers []ReconcilerInfo `json:"Reconcilers"`
+}
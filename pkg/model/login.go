@@ -0,0 +1,72 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 登录失败的原因
+const (
+	LoginFailedPassword = "password"
+	LoginFailedMFA      = "mfa"
+	LoginFailedLocked   = "locked"
+	LoginFailedInvalid  = "invalid-request"
+)
+
+// LoginAttempt 登录失败的审计记录
+type LoginAttempt struct {
+	gorm.Model
+	Username  string `json:"Username" gorm:"index"`
+	ClientIP  string `json:"ClientIP" gorm:"index"`
+	UserAgent string `json:"UserAgent"`
+	Reason    string `json:"Reason"`
+}
+
+func (LoginAttempt) TableName() string {
+	return "login_attempts"
+}
+
+type LoginLockout struct {
+	// user 或 ip
+	Kind        string    `json:"Kind"`
+	Key         string    `json:"Key"`
+	Failures    int       `json:"Failures"`
+	LastFailure time.Time `json:"LastFailure"`
+	LockedUntil time.Time `json:"LockedUntil"`
+	Locked      bool      `json:"Locked"`
+}
+
+type ListLoginLockoutsRequest struct {
+}
+
+type ListLoginLockoutsResponse struct {
+	Lockouts []LoginLockout `json:"Lockouts"`
+}
+
+type ClearLoginLockoutRequest struct {
+	Kind string `json:"Kind" validate:"required,oneof=user ip"`
+	Key  string `json:"Key" validate:"required"`
+}
+
+type ClearLoginLockoutResponse struct {
+	Kind    string `json:"Kind"`
+	Key     string `json:"Key"`
+	Cleared bool   `json:"Cleared"`
+}
+
+type ListLoginAttemptsRequest struct {
+	Username string `json:"Username"`
+	ClientIP string `json:"ClientIP"`
+	// 默认返回最近100条
+	Limit int `json:"Limit" validate:"omitempty,min=1,max=1000"`
+}
+
+type ListLoginAttemptsResponse struct {
+	Attempts []LoginAttempt `json:"Attempts"`
+}
+
+type LoginLockedResponse struct {
+	// 剩余锁定时间，单位秒
+	RetryAfter int `json:"retry_after"`
+}
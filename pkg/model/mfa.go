@@ -0,0 +1,66 @@
+package model
+
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+)
+
+// UserTOTP 用户的TOTP二次验证配置
+type UserTOTP struct {
+	gorm.Model
+	Username string `json:"Username" gorm:"uniqueIndex;not null"`
+	Secret   string `json:"-" gorm:"not null"`
+	// 扫码后需要验证一次验证码才会启用
+	Enabled bool `json:"Enabled" gorm:"not null;default:false"`
+	// 恢复码的sha256摘要，JSON数组格式保存
+	RecoveryCodes string `json:"-" gorm:"not null;default:'[]'"`
+	// 最后一次使用的时间步，防止验证码被重放
+	LastUsedStep int64 `json:"-"`
+}
+
+func (UserTOTP) TableName() string {
+	return "user_totps"
+}
+
+func (t *UserTOTP) GetRecoveryCodes() []string {
+	var arr []string
+	if err := json.Unmarshal([]byte(t.RecoveryCodes), &arr); err != nil {
+		return []string{}
+	}
+	return arr
+}
+
+func (t *UserTOTP) SetRecoveryCodes(hashes []string) error {
+	bs, err := json.Marshal(hashes)
+	if err != nil {
+		return err
+	}
+	t.RecoveryCodes = string(bs)
+	return nil
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	// TOTP验证码或恢复码
+	Code string `json:"code" validate:"required"`
+}
+
+type MFAStatusResponse struct {
+	Enabled           bool `json:"Enabled"`
+	RecoveryCodesLeft int  `json:"RecoveryCodesLeft"`
+}
+
+type MFAEnrollResponse struct {
+	Secret string `json:"Secret"`
+	URI    string `json:"URI"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"Code" validate:"required"`
+}
+
+type MFARecoveryCodesResponse struct {
+	// 恢复码明文只返回一次
+	RecoveryCodes []string `json:"RecoveryCodes"`
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"flutelake/fluteNAS/pkg/module/db"
+
+	"gorm.io/gorm"
+)
+
+// Migrations 数据库迁移，按版本顺序追加，已发布的迁移不能修改
+// 新增表和字段仍然由 AutoMigrate 完成，迁移在 AutoMigrate 之前执行
+var Migrations = []db.Migration{
+	{
+		Version:     1,
+		Description: "make nfs export pseudo path unique per host",
+		Up: func(tx *gorm.DB) error {
+			return recreateIndex(tx, "nfs_exports", "idx_host_pseudo", "host_ip, pseudo")
+		},
+		Down: func(tx *gorm.DB) error {
+			return recreateIndex(tx, "nfs_exports", "idx_host_pseudo", "pseudo")
+		},
+	},
+	{
+		Version:     2,
+		Description: "normalize empty or invalid json of nfs acls and samba user permissions",
+		Up: func(tx *gorm.DB) error {
+			if err := normalizeJSONArray(tx, "nfs_exports", "acls"); err != nil {
+				return err
+			}
+			return normalizeJSONArray(tx, "samba_shares", "user_permissions")
+		},
+		// 规范化后的数据旧版本同样可以读取，回滚不需要处理
+		Down: func(tx *gorm.DB) error { return nil },
+	},
+}
+
+// recreateIndex 使用新的字段重建唯一索引，表不存在时跳过
+func recreateIndex(tx *gorm.DB, table, index, columns string) error {
+	if !tx.Migrator().HasTable(table) {
+		return nil
+	}
+	if err := tx.Exec("DROP INDEX IF EXISTS " + index).Error; err != nil {
+		return err
+	}
+	return tx.Exec("CREATE UNIQUE INDEX " + index + " ON " + table + " (" + columns + ")").Error
+}
+
+// normalizeJSONArray 把空值、非法json和非数组的值替换为 []
+func normalizeJSONArray(tx *gorm.DB, table, column string) error {
+	if !tx.Migrator().HasColumn(table, column) {
+		return nil
+	}
+	// CASE 保证 json_type 只对合法的json求值
+	return tx.Exec("UPDATE " + table + " SET " + column + " = '[]' WHERE CASE" +
+		" WHEN " + column + " IS NULL OR json_valid(" + column + ") = 0 THEN 1" +
+		" WHEN json_type(" + column + ") <> 'array' THEN 1 ELSE 0 END = 1").Error
+}
@@ -17,19 +17,21 @@ type OpenNFSServerRequest struct {
 
 type NFSExport struct {
 	gorm.Model
-	ID          uint       `json:"ID" gorm:"primaryKey,autoIncrement"`
-	HostIP      string     `json:"HostIP" gorm:"not null;index"`
-	Name        string     `json:"Name" gorm:"not null"`
-	Path        string     `json:"Path" gorm:"not null"`
-	Pseudo      string     `json:"Pseudo" gorm:"not null;uniqueIndex:idx_host_pseudo"`
-	DefaultACL  string     `json:"DefaultACL" gorm:"not null;default:'None'"`
-	Acls        string     `json:"Acls" gorm:"not null;default:'[]'"`
-	Protocols   string     `json:"Protocols" gorm:"not null;default:'3,4'"`
-	Status      string     `json:"Status" gorm:"not null;default:'enabled';index"`
-	LastApplied *time.Time `json:"LastApplied" gorm:"nullable"`
-	TestResult  string     `json:"TestResult" gorm:"nullable"`
-	CreatedAt   time.Time  `json:"CreatedAt" gorm:"autoCreateTime"`
-	UpdatedAt   time.Time  `json:"UpdatedAt" gorm:"autoUpdateTime"`
+	ID          uint             `json:"ID" gorm:"primaryKey,autoIncrement"`
+	HostIP      string           `json:"HostIP" gorm:"not null;index;uniqueIndex:idx_host_pseudo,priority:1"`
+	Name        string           `json:"Name" gorm:"not null"`
+	Path        string           `json:"Path" gorm:"not null"`
+	Pseudo      string           `json:"Pseudo" gorm:"not null;uniqueIndex:idx_host_pseudo,priority:2"`
+	DefaultACL  string           `json:"DefaultACL" gorm:"not null;default:'None'"`
+	Acls        string           `json:"Acls" gorm:"not null;default:'[]'"`
+	Protocols   string           `json:"Protocols" gorm:"not null;default:'3,4'"`
+	Status      string           `json:"Status" gorm:"not null;default:'enabled';index"`
+	LastApplied *time.Time       `json:"LastApplied" gorm:"nullable"`
+	TestResult  string           `json:"TestResult" gorm:"nullable"`
+	CreatedAt   time.Time        `json:"CreatedAt" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time        `json:"UpdatedAt" gorm:"autoUpdateTime"`
+	Generation  int64            `json:"Generation" gorm:"not null;default:1"`
+	Conditions  ConditionsString `json:"Conditions" gorm:"not null;default:'[]'"`
 	// AclsMapped  []NFSAcl   `json:"AclsMapped" gorm:"-"`
 }
 
@@ -119,14 +121,14 @@ type NFSAcl struct {
 // Validate 验证ACL规则
 func (a *NFSAcl) Validate() error {
 	if a.IPRange == "" {
-		return errors.New("IPRange不能为空")
+		return errors.New("IPRange is required")
 	}
 	if a.Permission != "RO" && a.Permission != "RW" {
-		return errors.New("Permission必须是RO或RW")
+		return errors.New("Permission must be RO or RW")
 	}
 	// 验证IPRange格式（简化验证）
 	if !strings.Contains(a.IPRange, "/") && net.ParseIP(a.IPRange) == nil {
-		return errors.New("IPRange格式无效")
+		return errors.New("IPRange is not a valid ip or cidr")
 	}
 	return nil
 }
@@ -134,15 +136,18 @@ func (a *NFSAcl) Validate() error {
 // UpdateStatus 更新导出规则状态
 func UpdateStatus(db *gorm.DB, id uint, status string) error {
 	if status != "enabled" && status != "disabled" {
-		return fmt.Errorf("无效的状态: %s, 必须是enabled或disabled", status)
+		return fmt.Errorf("invalid status %s, must be enabled or disabled", status)
 	}
 
-	result := db.Model(&NFSExport{}).Where("id = ?", id).Update("status", status)
+	result := db.Model(&NFSExport{}).Where("id = ?", id).Updates(map[string]any{
+		"status":     status,
+		"generation": gorm.Expr("generation + 1"),
+	})
 	if result.Error != nil {
 		return result.Error
 	}
 	if result.RowsAffected == 0 {
-		return errors.New("导出规则不存在")
+		return errors.New("nfs export not found")
 	}
 	return nil
 }
@@ -154,7 +159,7 @@ func UpdateLastApplied(db *gorm.DB, id uint, t time.Time) error {
 		return result.Error
 	}
 	if result.RowsAffected == 0 {
-		return errors.New("导出规则不存在")
+		return errors.New("nfs export not found")
 	}
 	return nil
 }
@@ -166,7 +171,7 @@ func UpdateTestResult(db *gorm.DB, id uint, result string) error {
 		return resultDB.Error
 	}
 	if resultDB.RowsAffected == 0 {
-		return errors.New("导出规则不存在")
+		return errors.New("nfs export not found")
 	}
 	return nil
 }
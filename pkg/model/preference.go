@@ -0,0 +1,30 @@
+package model
+
+import (
+	"gorm.io/gorm"
+)
+
+// UserPreference 用户的个人设置
+type UserPreference struct {
+	gorm.Model
+	Username string `json:"Username" gorm:"uniqueIndex;not null"`
+	// 界面和接口错误信息使用的语言，为空时使用浏览器的 Accept-Language
+	Locale string `json:"Locale"`
+}
+
+func (UserPreference) TableName() string {
+	return "user_preferences"
+}
+
+type GetUserPreferenceResponse struct {
+	Locale string `json:"Locale"`
+}
+
+type SetUserPreferenceRequest struct {
+	// 为空表示跟随浏览器语言
+	Locale string `json:"Locale" validate:"omitempty,oneof=zh-CN en-US ru-RU es-ES fr-FR ar-SA pt-BR"`
+}
+
+type SetUserPreferenceResponse struct {
+	Locale string `json:"Locale"`
+}
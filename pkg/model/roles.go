@@ -0,0 +1,131 @@
+package model
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// 用户角色
+const (
+	// 管理员，拥有全部权限
+	RoleAdmin = "admin"
+	// 运维人员，除用户角色管理和系统设置外的全部权限
+	RoleOperator = "operator"
+	// 只读用户，只能查看文件、磁盘、共享和主机信息
+	RoleReadOnly = "read-only"
+	// 文件用户，只能浏览和管理文件
+	RoleFileUser = "file-user"
+)
+
+// 接口权限，路由通过 Route.Permission 声明所需的权限
+const (
+	PermissionFileRead   = "file:read"
+	PermissionFileWrite  = "file:write"
+	PermissionDiskRead   = "disk:read"
+	PermissionDiskWrite  = "disk:write"
+	PermissionShareRead  = "share:read"
+	PermissionShareWrite = "share:write"
+	PermissionHostRead   = "host:read"
+	PermissionTerminal   = "terminal"
+	PermissionUserManage = "user:manage"
+	// https证书等系统设置
+	PermissionSystemManage = "system:manage"
+	// 查看审计日志
+	PermissionAuditRead = "audit:read"
+)
+
+var rolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermissionFileRead, PermissionFileWrite,
+		PermissionDiskRead, PermissionDiskWrite,
+		PermissionShareRead, PermissionShareWrite,
+		PermissionHostRead, PermissionTerminal,
+		PermissionUserManage, PermissionSystemManage,
+		PermissionAuditRead,
+	},
+	RoleOperator: {
+		PermissionFileRead, PermissionFileWrite,
+		PermissionDiskRead, PermissionDiskWrite,
+		PermissionShareRead, PermissionShareWrite,
+		PermissionHostRead, PermissionTerminal,
+	},
+	RoleReadOnly: {
+		PermissionFileRead,
+		PermissionDiskRead,
+		PermissionShareRead,
+		PermissionHostRead,
+	},
+	RoleFileUser: {
+		PermissionFileRead, PermissionFileWrite,
+	},
+}
+
+// IsValidRole 判断角色是否存在
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RolePermissions 获取角色拥有的权限列表
+func RolePermissions(role string) []string {
+	perms := rolePermissions[role]
+	out := make([]string, len(perms))
+	copy(out, perms)
+	return out
+}
+
+// RoleHasPermission 判断角色是否拥有指定权限
+func RoleHasPermission(role string, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// UserRole 系统用户在 fluteNAS 中被分配的角色
+type UserRole struct {
+	gorm.Model
+	Username string `json:"Username" gorm:"uniqueIndex;not null"`
+	Role     string `json:"Role" gorm:"not null"`
+}
+
+func (UserRole) TableName() string {
+	return "user_roles"
+}
+
+// GetUserRole 查询用户被分配的角色，未分配时返回 gorm.ErrRecordNotFound
+func GetUserRole(db *gorm.DB, username string) (string, error) {
+	var ur UserRole
+	if err := db.First(&ur, "username = ?", username).Error; err != nil {
+		return "", err
+	}
+	if !IsValidRole(ur.Role) {
+		return "", errors.New("invalid role: " + ur.Role)
+	}
+	return ur.Role, nil
+}
+
+type ListUserRolesResponse struct {
+	Users []UserRole `json:"Users"`
+}
+
+type SetUserRoleRequest struct {
+	Username string `json:"Username" validate:"required"`
+	Role     string `json:"Role" validate:"required,oneof=admin operator read-only file-user"`
+}
+
+type SetUserRoleResponse struct {
+	Username string `json:"Username"`
+	Role     string `json:"Role"`
+}
+
+type DeleteUserRoleRequest struct {
+	Username string `json:"Username" validate:"required"`
+}
+
+type DeleteUserRoleResponse struct {
+	Username string `json:"Username"`
+}
@@ -15,6 +15,10 @@ type SambaShare struct {
 	Pseudo          string               `json:"Pseudo"`
 	UserPermissions UserPermissionString `json:"UserPermissions" gorm:"foreignKey:SambaShareID"`
 	Status          string               `json:"Status" gorm:"default:init"`
+	// 每次修改配置后加1，与条件的 ObservedGeneration 比较可以判断修改是否已经处理
+	Generation int64 `json:"Generation" gorm:"not null;default:1"`
+	// 控制器设置的状态条件
+	Conditions ConditionsString `json:"Conditions" gorm:"not null;default:'[]'"`
 }
 
 type UserPermissionString string
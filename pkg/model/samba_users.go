@@ -6,11 +6,13 @@ import (
 
 type SambaUser struct {
 	gorm.Model
-	ID       uint   `json:"ID" gorm:"uniqueIndex"`
-	HostIP   string `json:"HostIP" gorm:"not null"`
-	Username string `json:"Username" gorm:"unique;not null" validate:"required"`
-	Password string `json:"Password" gorm:"not null" validate:"required"`
-	Status   string `json:"Status" gorm:"default:active"`
+	ID         uint             `json:"ID" gorm:"uniqueIndex"`
+	HostIP     string           `json:"HostIP" gorm:"not null"`
+	Username   string           `json:"Username" gorm:"unique;not null" validate:"required"`
+	Password   string           `json:"Password" gorm:"not null" validate:"required"`
+	Status     string           `json:"Status" gorm:"default:active"`
+	Generation int64            `json:"Generation" gorm:"not null;default:1"`
+	Conditions ConditionsString `json:"Conditions" gorm:"not null;default:'[]'"`
 }
 
 func (s *SambaUser) TableName() string {
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"flutelake/fluteNAS/pkg/module/certs"
+	"time"
+)
+
+type TLSInfoRequest struct {
+}
+
+type TLSInfoResponse struct {
+	// 未启用https时为false
+	Enabled     bool        `json:"Enabled"`
+	Certificate *certs.Info `json:"Certificate"`
+}
+
+type UploadTLSCertificateRequest struct {
+	// PEM编码的证书，可以包含中间证书
+	Certificate string `json:"Certificate" validate:"required"`
+	// PEM编码的私钥
+	PrivateKey string `json:"PrivateKey" validate:"required"`
+}
+
+type UploadTLSCertificateResponse struct {
+	Certificate *certs.Info `json:"Certificate"`
+}
+
+type ExportConfigRequest struct {
+	// 设置后使用密码加密归档文件，导入时需要提供同样的密码。存在samba用户时必须设置
+	Passphrase string `json:"Passphrase"`
+	// 归档中配置定义的格式，默认yaml
+	Format string `json:"Format" validate:"omitempty,oneof=yaml json"`
+}
+
+type ExportConfigResponse struct {
+	Token string `json:"Token"`
+	// 下载地址，只能下载一次，过期后需要重新导出
+	Location  string `json:"Location"`
+	Filename  string `json:"Filename"`
+	Size      int64  `json:"Size"`
+	Encrypted bool   `json:"Encrypted"`
+}
+
+type ImportConfigResponse struct {
+	// 只比较差异，没有修改数据库
+	DryRun        bool      `json:"DryRun"`
+	FormatVersion int       `json:"FormatVersion"`
+	SchemaVersion int       `json:"SchemaVersion"`
+	AppVersion    string    `json:"AppVersion"`
+	CreatedAt     time.Time `json:"CreatedAt"`
+	// 恢复的分类
+	Categories []string     `json:"Categories"`
+	Diffs      []ConfigDiff `json:"Diffs"`
+	// 恢复前数据库的备份文件，DryRun时为空
+	BackupFile string `json:"BackupFile"`
+}
+
+// ConfigDiff 一个分类中归档与当前配置的差异，以名称、路径等唯一标识列出
+type ConfigDiff struct {
+	Category string `json:"Category"`
+	// 只在归档中存在，恢复时新增
+	Added []string `json:"Added"`
+	// 只在当前配置中存在，恢复时删除
+	Removed []string `json:"Removed"`
+	// 两边都存在但内容不同，恢复时使用归档中的内容
+	Changed []string `json:"Changed"`
+}
+
+type ListDatabaseBackupsRequest struct {
+	// 重新计算每个备份的sha256并与备份时记录的校验和比较
+	Verify bool `json:"Verify"`
+}
+
+type ListDatabaseBackupsResponse struct {
+	// 备份文件所在的目录
+	Dir     string           `json:"Dir"`
+	Backups []DatabaseBackup `json:"Backups"`
+}
+
+// DatabaseBackup 一个数据库备份文件，按时间倒序返回
+type DatabaseBackup struct {
+	Name      string    `json:"Name"`
+	Path      string    `json:"Path"`
+	Size      int64     `json:"Size"`
+	CreatedAt time.Time `json:"CreatedAt"`
+	SHA256    string    `json:"SHA256"`
+	// unverified、ok、corrupted、no-checksum，请求校验时才会是ok或corrupted
+	Status string `json:"Status"`
+}
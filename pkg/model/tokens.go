@@ -0,0 +1,100 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIToken 自动化客户端使用的访问token，数据库中只保存token的sha256摘要
+type APIToken struct {
+	gorm.Model
+	Name       string           `json:"Name" gorm:"not null"`
+	Username   string           `json:"Username" gorm:"not null;index"`
+	TokenHash  string           `json:"-" gorm:"uniqueIndex;not null"`
+	Prefix     string           `json:"Prefix"`
+	Scopes     TokenScopeString `json:"Scopes" gorm:"not null;default:'[]'"`
+	ExpiresAt  *time.Time       `json:"ExpiresAt" gorm:"nullable"`
+	LastUsedAt *time.Time       `json:"LastUsedAt" gorm:"nullable"`
+}
+
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
+
+// Expired 判断token是否已过期
+func (t *APIToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// TokenScopeString token可访问的路由范围，JSON数组格式保存
+// 元素为完整路由(/v1/samba-share/list)或以 * 结尾的路由前缀(/v1/samba-share/*)，为空表示不限制
+type TokenScopeString string
+
+func (s TokenScopeString) Get() []string {
+	var arr []string
+	if err := json.Unmarshal([]byte(s), &arr); err != nil {
+		return []string{}
+	}
+	return arr
+}
+
+// Allow 判断路由是否在token的授权范围内
+func (s TokenScopeString) Allow(path string) bool {
+	scopes := s.Get()
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, scope := range scopes {
+		if strings.HasSuffix(scope, "*") {
+			if strings.HasPrefix(path, strings.TrimSuffix(scope, "*")) {
+				return true
+			}
+			continue
+		}
+		if scope == path {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON 接口返回时将scopes展开为数组
+func (s TokenScopeString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Get())
+}
+
+type CreateAPITokenRequest struct {
+	Name string `json:"Name" validate:"required"`
+	// 有效天数，0表示永不过期
+	ExpiresInDays int      `json:"ExpiresInDays" validate:"gte=0"`
+	Scopes        []string `json:"Scopes" validate:"dive,startswith=/v1/"`
+}
+
+type CreateAPITokenResponse struct {
+	ID    uint   `json:"ID"`
+	Name  string `json:"Name"`
+	Token string `json:"Token"`
+	// token明文只在创建时返回一次
+	ExpiresAt *time.Time `json:"ExpiresAt"`
+	Scopes    []string   `json:"Scopes"`
+}
+
+type ListAPITokensRequest struct {
+	// 拥有用户管理权限时可以查看所有用户的token
+	All bool `json:"All"`
+}
+
+type ListAPITokensResponse struct {
+	Tokens []APIToken `json:"Tokens"`
+}
+
+type RevokeAPITokenRequest struct {
+	ID uint `json:"ID" validate:"required"`
+}
+
+type RevokeAPITokenResponse struct {
+	ID uint `json:"ID"`
+}
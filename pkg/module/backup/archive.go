@@ -0,0 +1,311 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/version"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"golang.org/x/crypto/scrypt"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// FormatVersion 配置归档的格式版本，归档的结构不兼容时递增
+const FormatVersion = 1
+
+// 归档中的文件
+const (
+	configYAMLName = "config.yaml"
+	configJSONName = "config.json"
+	snapshotName   = "nas.db"
+)
+
+// 加密归档的文件头，之后依次是 salt、nonce 和 AES-GCM 密文
+var encryptedMagic = []byte("FLUTENAS-ENC1\n")
+
+const (
+	saltSize = 16
+	keySize  = 32
+)
+
+// maxExtractedBytes 解压后所有文件的大小上限，上传的归档大小有限制，但仍然可能是压缩炸弹
+var maxExtractedBytes int64 = 256 << 20
+
+var (
+	ErrInvalidArchive = errors.New("invalid configuration archive")
+	// ErrPassphrase 归档已加密但没有提供密码，或者密码错误
+	ErrPassphrase = errors.New("wrong passphrase of the configuration archive")
+	// ErrArchiveTooNew 归档由更新的版本导出，当前程序不能识别
+	ErrArchiveTooNew = errors.New("configuration archive is created by a newer version")
+	// ErrPassphraseRequired 归档中包含samba用户的密码，导出时必须设置密码
+	ErrPassphraseRequired = errors.New("passphrase is required to export samba user passwords")
+)
+
+type ExportOptions struct {
+	// 配置定义的格式，yaml或json，默认yaml
+	Format string
+	// 为空时不加密
+	Passphrase string
+}
+
+// Export 导出数据库快照和从快照中读取的配置定义，两者是同一时刻的数据。
+// 归档是包含配置定义和 nas.db 的 tar.gz，设置密码时整体加密。
+// 快照中不包含会话、API token、二次验证密钥、登录记录和审计日志。
+// samba用户的密码以明文保存，存在samba用户时必须设置密码
+func Export(conn *gorm.DB, w io.Writer, opts ExportOptions) error {
+	dir, err := os.MkdirTemp("", "flutenas-export-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	snapshotPath := filepath.Join(dir, snapshotName)
+	if err := db.BackupTo(conn, snapshotPath); err != nil {
+		return fmt.Errorf("snapshot database failed: %v", err)
+	}
+	cfg, err := prepareSnapshot(snapshotPath)
+	if err != nil {
+		return fmt.Errorf("read database snapshot failed: %v", err)
+	}
+	if len(cfg.SambaUsers) > 0 && opts.Passphrase == "" {
+		return ErrPassphraseRequired
+	}
+	cfg.FormatVersion = FormatVersion
+	cfg.SchemaVersion = len(model.Migrations)
+	cfg.AppVersion = version.Get().Version
+	cfg.CreatedAt = time.Now()
+
+	name, data, err := encodeConfig(cfg, opts.Format)
+	if err != nil {
+		return err
+	}
+	snapshot, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeTarGz(buf, map[string][]byte{name: data, snapshotName: snapshot}, cfg.CreatedAt); err != nil {
+		return err
+	}
+	out := buf.Bytes()
+	if opts.Passphrase != "" {
+		if out, err = encrypt(out, opts.Passphrase); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// prepareSnapshot 删除快照中的认证相关表后读取配置定义，归档的密码是可选的，
+// 不能在归档中明文保存二次验证密钥等数据
+func prepareSnapshot(p string) (*Config, error) {
+	conn, err := gorm.Open(sqlite.Open(p), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	if sqlDB, err := conn.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	err = conn.Migrator().DropTable(&model.Session{}, &model.APIToken{}, &model.UserTOTP{}, &model.LoginAttempt{}, &model.AuditLog{})
+	if err != nil {
+		return nil, fmt.Errorf("drop auth tables failed: %v", err)
+	}
+	// 删除的数据仍然留在空闲页中，需要重建数据库文件
+	if err := conn.Exec("VACUUM").Error; err != nil {
+		return nil, fmt.Errorf("vacuum database snapshot failed: %v", err)
+	}
+	return LoadConfig(conn)
+}
+
+// encodeConfig yaml由json转换而来，字段名和接口返回的json保持一致
+func encodeConfig(cfg *Config, format string) (string, []byte, error) {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return "", nil, err
+	}
+	if format == "json" {
+		return configJSONName, data, nil
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "", nil, err
+	}
+	data, err = yaml.Marshal(v)
+	return configYAMLName, data, err
+}
+
+func writeTarGz(w io.Writer, files map[string][]byte, modTime time.Time) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	// 配置定义在前，查看归档时不需要先解压数据库
+	for _, name := range []string{configYAMLName, configJSONName, snapshotName} {
+		data, ok := files[name]
+		if !ok {
+			continue
+		}
+		hdr := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: modTime}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// IsEncrypted 归档是否使用密码加密
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
+
+// ReadArchive 解密并解析归档中的配置定义，检查归档格式和数据库版本
+func ReadArchive(data []byte, passphrase string) (*Config, error) {
+	if IsEncrypted(data) {
+		if passphrase == "" {
+			return nil, ErrPassphrase
+		}
+		var err error
+		if data, err = decrypt(data, passphrase); err != nil {
+			return nil, err
+		}
+	}
+
+	files, err := readTarGz(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if _, ok := files[snapshotName]; !ok {
+		return nil, fmt.Errorf("%w: database snapshot not found", ErrInvalidArchive)
+	}
+	raw, ok := files[configJSONName]
+	if yml, isYAML := files[configYAMLName]; isYAML {
+		var v any
+		if err := yaml.Unmarshal(yml, &v); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if raw, err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		ok = true
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: configuration not found", ErrInvalidArchive)
+	}
+
+	cfg := &Config{}
+	if err := json.Unmarshal(raw, cfg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if cfg.FormatVersion < 1 {
+		return nil, fmt.Errorf("%w: missing format version", ErrInvalidArchive)
+	}
+	if cfg.FormatVersion > FormatVersion || cfg.SchemaVersion > len(model.Migrations) {
+		return nil, fmt.Errorf("%w: format version %d, schema version %d", ErrArchiveTooNew, cfg.FormatVersion, cfg.SchemaVersion)
+	}
+	return cfg, nil
+}
+
+func readTarGz(data []byte) (map[string][]byte, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+	files := make(map[string][]byte)
+	remaining := maxExtractedBytes
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, remaining+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > remaining {
+			return nil, fmt.Errorf("extracted size exceeds %d bytes", maxExtractedBytes)
+		}
+		remaining -= int64(len(data))
+		files[hdr.Name] = data
+	}
+}
+
+func encrypt(plaintext []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := passphraseGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte{}, encryptedMagic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plaintext, encryptedMagic), nil
+}
+
+func decrypt(data []byte, passphrase string) ([]byte, error) {
+	data = data[len(encryptedMagic):]
+	if len(data) < saltSize {
+		return nil, fmt.Errorf("%w: encrypted data too short", ErrInvalidArchive)
+	}
+	gcm, err := passphraseGCM(passphrase, data[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	data = data[saltSize:]
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: encrypted data too short", ErrInvalidArchive)
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], encryptedMagic)
+	if err != nil {
+		// 密码错误和数据损坏无法区分
+		return nil, ErrPassphrase
+	}
+	return plaintext, nil
+}
+
+// passphraseGCM 使用scrypt从密码派生AES-256密钥
+func passphraseGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,293 @@
+package backup
+
+import (
+	"flutelake/fluteNAS/pkg/model"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 可以单独恢复的配置分类
+const (
+	CategoryMountPoints = "mount-points"
+	CategoryHosts       = "hosts"
+	CategorySambaUsers  = "samba-users"
+	CategorySambaShares = "samba-shares"
+	CategoryNFSExports  = "nfs-exports"
+)
+
+// Categories 所有分类，恢复时按这个顺序处理
+var Categories = []string{
+	CategoryHosts,
+	CategoryMountPoints,
+	CategorySambaUsers,
+	CategorySambaShares,
+	CategoryNFSExports,
+}
+
+// Config NAS的完整定义，导出时从数据库快照中读取
+type Config struct {
+	FormatVersion int       `json:"FormatVersion"`
+	SchemaVersion int       `json:"SchemaVersion"`
+	AppVersion    string    `json:"AppVersion"`
+	CreatedAt     time.Time `json:"CreatedAt"`
+
+	Hosts       []model.Host       `json:"Hosts"`
+	MountPoints []model.MountPoint `json:"MountPoints"`
+	SambaUsers  []model.SambaUser  `json:"SambaUsers"`
+	SambaShares []model.SambaShare `json:"SambaShares"`
+	NFSExports  []model.NFSExport  `json:"NFSExports"`
+}
+
+// LoadConfig 读取数据库中所有分类的配置
+func LoadConfig(tx *gorm.DB) (*Config, error) {
+	c := &Config{}
+	for _, dest := range []any{&c.Hosts, &c.MountPoints, &c.SambaUsers, &c.SambaShares, &c.NFSExports} {
+		if err := tx.Order("id").Find(dest).Error; err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// ParseCategories 检查分类名称，为空时返回全部分类
+func ParseCategories(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return Categories, nil
+	}
+	selected := make(map[string]bool, len(names))
+	for _, n := range names {
+		if !isCategory(n) {
+			return nil, fmt.Errorf("unknown configuration category %q", n)
+		}
+		selected[n] = true
+	}
+	// 按固定顺序返回，主机需要先于挂载点和共享恢复
+	out := make([]string, 0, len(selected))
+	for _, c := range Categories {
+		if selected[c] {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func isCategory(name string) bool {
+	for _, c := range Categories {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff 比较当前配置和归档中选择的分类
+func Diff(current, archived *Config, categories []string) []model.ConfigDiff {
+	diffs := make([]model.ConfigDiff, 0, len(categories))
+	for _, c := range categories {
+		var d model.ConfigDiff
+		switch c {
+		case CategoryHosts:
+			d = diffItems(current.Hosts, archived.Hosts, hostKey, hostSpec)
+		case CategoryMountPoints:
+			d = diffItems(current.MountPoints, archived.MountPoints, mountPointKey, mountPointSpec)
+		case CategorySambaUsers:
+			d = diffItems(activeSambaUsers(current.SambaUsers), archived.SambaUsers, sambaUserKey, sambaUserSpec)
+		case CategorySambaShares:
+			d = diffItems(activeSambaShares(current.SambaShares), archived.SambaShares, sambaShareKey, sambaShareSpec)
+		case CategoryNFSExports:
+			d = diffItems(current.NFSExports, archived.NFSExports, nfsExportKey, nfsExportSpec)
+		}
+		d.Category = c
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+// diffItems 按唯一标识比较两组记录，spec 返回需要比较的字段，忽略ID和时间等字段
+func diffItems[T any](current, archived []T, key func(T) string, spec func(T) any) model.ConfigDiff {
+	d := model.ConfigDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	cur := make(map[string]T, len(current))
+	for _, item := range current {
+		cur[key(item)] = item
+	}
+	seen := make(map[string]bool, len(archived))
+	for _, item := range archived {
+		k := key(item)
+		seen[k] = true
+		old, ok := cur[k]
+		if !ok {
+			d.Added = append(d.Added, k)
+		} else if !reflect.DeepEqual(spec(old), spec(item)) {
+			d.Changed = append(d.Changed, k)
+		}
+	}
+	for k := range cur {
+		if !seen[k] {
+			d.Removed = append(d.Removed, k)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Changed)
+	return d
+}
+
+func hostKey(h model.Host) string { return h.HostIP }
+func hostSpec(h model.Host) any {
+	return [4]string{h.ID, h.Hostname, h.AliasName, h.SSHPort}
+}
+
+func mountPointKey(m model.MountPoint) string { return m.UUID }
+func mountPointSpec(m model.MountPoint) any {
+	return [4]string{m.HostID, m.HostIP, m.Device, m.Path}
+}
+
+func sambaUserKey(u model.SambaUser) string { return u.Username }
+func sambaUserSpec(u model.SambaUser) any {
+	return [2]string{u.HostIP, u.Password}
+}
+
+func sambaShareKey(s model.SambaShare) string { return s.Name }
+func sambaShareSpec(s model.SambaShare) any {
+	return [4]any{s.HostIP, s.Path, s.Pseudo, s.UserPermissions.Get()}
+}
+
+func nfsExportKey(e model.NFSExport) string { return e.HostIP + ":" + e.Pseudo }
+func nfsExportSpec(e model.NFSExport) any {
+	acls, _ := e.GetAcls()
+	return [5]any{e.Name, e.Path, e.DefaultACL, acls, e.Protocols}
+}
+
+// Restore 在一个事务中使用归档替换选择的分类，控制器下次同步时把配置应用到各个节点
+func Restore(tx *gorm.DB, archived *Config, categories []string) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		for _, c := range categories {
+			var err error
+			switch c {
+			case CategoryHosts:
+				err = replace(tx, archived.Hosts)
+			case CategoryMountPoints:
+				err = replace(tx, archived.MountPoints)
+			case CategorySambaUsers:
+				err = restoreSambaUsers(tx, archived.SambaUsers)
+			case CategorySambaShares:
+				err = restoreSambaShares(tx, archived.SambaShares)
+			case CategoryNFSExports:
+				err = replace(tx, archived.NFSExports)
+			}
+			if err != nil {
+				return fmt.Errorf("restore %s failed: %v", c, err)
+			}
+		}
+		return nil
+	})
+}
+
+// restoreSambaUsers 重建的节点上没有系统用户，恢复的用户都重新创建并设置密码，
+// 当前存在但归档中没有的用户标记为删除中，由控制器删除主机上的用户后删除记录
+func restoreSambaUsers(tx *gorm.DB, archived []model.SambaUser) error {
+	var current []model.SambaUser
+	if err := tx.Find(&current).Error; err != nil {
+		return err
+	}
+	users := append([]model.SambaUser{}, archived...)
+	restored := make(map[string]bool, len(users))
+	for i := range users {
+		restored[sambaUserKey(users[i])] = true
+		if users[i].Status != model.SambaUserStatus_Deleting {
+			users[i].Status = model.SambaUserStatus_Init
+		}
+	}
+	if err := replace(tx, users); err != nil {
+		return err
+	}
+	for _, u := range current {
+		if restored[sambaUserKey(u)] {
+			continue
+		}
+		removed := model.SambaUser{
+			HostIP:   u.HostIP,
+			Username: u.Username,
+			Password: u.Password,
+			Status:   model.SambaUserStatus_Deleting,
+		}
+		if err := tx.Create(&removed).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreSambaShares 只有状态不是已生效的共享才会写入 smb.conf，恢复的共享都标记为更新中，
+// 当前存在但归档中没有的共享标记为删除中，由控制器从 smb.conf 中移除后删除记录
+func restoreSambaShares(tx *gorm.DB, archived []model.SambaShare) error {
+	var current []model.SambaShare
+	if err := tx.Find(&current).Error; err != nil {
+		return err
+	}
+	shares := append([]model.SambaShare{}, archived...)
+	restored := make(map[string]bool, len(shares))
+	for i := range shares {
+		restored[sambaShareKey(shares[i])] = true
+		if shares[i].Status != model.SambaShareStatus_Deleting {
+			shares[i].Status = model.SambaShareStatus_Updating
+		}
+	}
+	if err := replace(tx, shares); err != nil {
+		return err
+	}
+	for _, s := range current {
+		if restored[sambaShareKey(s)] {
+			continue
+		}
+		removed := model.SambaShare{
+			HostIP:          s.HostIP,
+			Name:            s.Name,
+			Path:            s.Path,
+			Pseudo:          s.Pseudo,
+			UserPermissions: s.UserPermissions,
+			Status:          model.SambaShareStatus_Deleting,
+		}
+		if err := tx.Create(&removed).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// activeSambaUsers 去掉等待控制器删除的用户
+func activeSambaUsers(users []model.SambaUser) []model.SambaUser {
+	out := make([]model.SambaUser, 0, len(users))
+	for _, u := range users {
+		if u.Status != model.SambaUserStatus_Deleting {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// activeSambaShares 去掉等待控制器删除的共享
+func activeSambaShares(shares []model.SambaShare) []model.SambaShare {
+	out := make([]model.SambaShare, 0, len(shares))
+	for _, s := range shares {
+		if s.Status != model.SambaShareStatus_Deleting {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// replace 删除表中所有记录（包括软删除的记录）后插入归档中的记录，保留原来的ID
+func replace[T any](tx *gorm.DB, items []T) error {
+	if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(new(T)).Error; err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return tx.Create(&items).Error
+}
@@ -0,0 +1,362 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "nas.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	err = conn.AutoMigrate(&model.Host{}, &model.MountPoint{}, &model.SambaUser{}, &model.SambaShare{}, &model.NFSExport{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func seed(t *testing.T, conn *gorm.DB) {
+	t.Helper()
+	records := []any{
+		&model.Host{ID: "127.0.0.1", HostIP: "127.0.0.1", Hostname: "nas"},
+		&model.MountPoint{UUID: "uuid-1", HostID: "127.0.0.1", HostIP: "127.0.0.1", Device: "/dev/sdb", Path: "/mnt/data"},
+		&model.SambaUser{HostIP: "127.0.0.1", Username: "alice", Password: "secret", Status: model.SambaUserStatus_Active},
+		&model.SambaShare{HostIP: "127.0.0.1", Name: "media", Path: "/mnt/data/media", UserPermissions: `[{"Username":"alice","Permission":"rw"}]`},
+		&model.NFSExport{HostIP: "127.0.0.1", Name: "data", Path: "/mnt/data", Pseudo: "/data", Acls: `[{"IPRange":"10.0.0.0/8","Permission":"RW"}]`},
+	}
+	for _, r := range records {
+		if err := conn.Create(r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts ExportOptions
+	}{
+		{name: "yaml", opts: ExportOptions{Passphrase: "correct horse"}},
+		{name: "json", opts: ExportOptions{Format: "json", Passphrase: "correct horse"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := openTestDB(t)
+			seed(t, conn)
+
+			buf := &bytes.Buffer{}
+			if err := Export(conn, buf, tc.opts); err != nil {
+				t.Fatal(err)
+			}
+			if !IsEncrypted(buf.Bytes()) {
+				t.Fatalf("expected archive to be encrypted")
+			}
+			if _, err := ReadArchive(buf.Bytes(), ""); !errors.Is(err, ErrPassphrase) {
+				t.Fatalf("expected ErrPassphrase without passphrase, got %v", err)
+			}
+			if _, err := ReadArchive(buf.Bytes(), "wrong"); !errors.Is(err, ErrPassphrase) {
+				t.Fatalf("expected ErrPassphrase for wrong passphrase, got %v", err)
+			}
+			cfg, err := ReadArchive(buf.Bytes(), tc.opts.Passphrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.FormatVersion != FormatVersion || cfg.SchemaVersion != len(model.Migrations) || cfg.CreatedAt.IsZero() {
+				t.Fatalf("unexpected archive header %+v", cfg)
+			}
+			if len(cfg.NFSExports) != 1 || cfg.NFSExports[0].Acls != `[{"IPRange":"10.0.0.0/8","Permission":"RW"}]` {
+				t.Fatalf("nfs export not preserved: %+v", cfg.NFSExports)
+			}
+			if len(cfg.SambaUsers) != 1 || cfg.SambaUsers[0].Password != "secret" {
+				t.Fatalf("samba user not preserved: %+v", cfg.SambaUsers)
+			}
+
+			current, err := LoadConfig(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range Diff(current, cfg, Categories) {
+				if len(d.Added)+len(d.Removed)+len(d.Changed) != 0 {
+					t.Fatalf("expected no difference after round trip, got %+v", d)
+				}
+			}
+		})
+	}
+}
+
+func TestExportRequiresPassphrase(t *testing.T) {
+	conn := openTestDB(t)
+	seed(t, conn)
+	buf := &bytes.Buffer{}
+	if err := Export(conn, buf, ExportOptions{}); !errors.Is(err, ErrPassphraseRequired) {
+		t.Fatalf("expected ErrPassphraseRequired with samba users, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatal("archive should not be written without passphrase")
+	}
+
+	// 没有samba用户时可以不加密
+	conn.Unscoped().Where("username = ?", "alice").Delete(&model.SambaUser{})
+	if err := Export(conn, buf, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if IsEncrypted(buf.Bytes()) {
+		t.Fatal("expected plain archive without passphrase")
+	}
+	cfg, err := ReadArchive(buf.Bytes(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.SambaShares) != 1 || len(cfg.SambaUsers) != 0 {
+		t.Fatalf("unexpected configuration %+v", cfg)
+	}
+}
+
+func TestExportExcludesAuthTables(t *testing.T) {
+	conn := openTestDB(t)
+	seed(t, conn)
+	if err := conn.AutoMigrate(&model.Session{}, &model.APIToken{}, &model.UserTOTP{}, &model.LoginAttempt{}, &model.AuditLog{}); err != nil {
+		t.Fatal(err)
+	}
+	const secret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+	if err := conn.Create(&model.UserTOTP{Username: "admin", Secret: secret, Enabled: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Create(&model.Session{SessionHash: "hash", Username: "admin", ExpiresAt: time.Now().Add(time.Hour)}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := Export(conn, buf, ExportOptions{Passphrase: "correct horse"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := decrypt(buf.Bytes(), "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := readTarGz(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(files[snapshotName], []byte(secret)) {
+		t.Fatal("totp secret should not be in the database snapshot")
+	}
+	p := filepath.Join(t.TempDir(), snapshotName)
+	if err := os.WriteFile(p, files[snapshotName], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := gorm.Open(sqlite.Open(p), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sqlDB, err := snapshot.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	for _, table := range []any{&model.Session{}, &model.APIToken{}, &model.UserTOTP{}, &model.LoginAttempt{}, &model.AuditLog{}} {
+		if snapshot.Migrator().HasTable(table) {
+			t.Fatalf("table of %T should be dropped from the snapshot", table)
+		}
+	}
+	if !snapshot.Migrator().HasTable(&model.SambaShare{}) {
+		t.Fatal("configuration tables should be kept in the snapshot")
+	}
+	// 源数据库不受影响
+	if !conn.Migrator().HasTable(&model.UserTOTP{}) {
+		t.Fatal("tables of the source database should be kept")
+	}
+}
+
+func TestDiffAndRestore(t *testing.T) {
+	conn := openTestDB(t)
+	seed(t, conn)
+	buf := &bytes.Buffer{}
+	if err := Export(conn, buf, ExportOptions{Passphrase: "correct horse"}); err != nil {
+		t.Fatal(err)
+	}
+	archived, err := ReadArchive(buf.Bytes(), "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 导出之后修改配置
+	conn.Model(&model.SambaShare{}).Where("name = ?", "media").Update("path", "/mnt/other")
+	conn.Where("pseudo = ?", "/data").Delete(&model.NFSExport{})
+	conn.Create(&model.NFSExport{HostIP: "127.0.0.1", Name: "tmp", Path: "/mnt/tmp", Pseudo: "/tmp"})
+	conn.Model(&model.SambaUser{}).Where("username = ?", "alice").Update("status", model.SambaUserStatus_Active)
+
+	current, err := LoadConfig(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	categories, err := ParseCategories([]string{CategoryNFSExports, CategorySambaShares})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs := Diff(current, archived, categories)
+	if len(diffs) != 2 || diffs[0].Category != CategorySambaShares || diffs[1].Category != CategoryNFSExports {
+		t.Fatalf("unexpected categories %+v", diffs)
+	}
+	if len(diffs[0].Changed) != 1 || diffs[0].Changed[0] != "media" {
+		t.Fatalf("expected media changed, got %+v", diffs[0])
+	}
+	if len(diffs[1].Added) != 1 || diffs[1].Added[0] != "127.0.0.1:/data" || len(diffs[1].Removed) != 1 || diffs[1].Removed[0] != "127.0.0.1:/tmp" {
+		t.Fatalf("unexpected nfs diff %+v", diffs[1])
+	}
+
+	if err := Restore(conn, archived, append(categories, CategorySambaUsers)); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := LoadConfig(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range Diff(restored, archived, categories) {
+		if len(d.Added)+len(d.Removed)+len(d.Changed) != 0 {
+			t.Fatalf("expected no difference after restore, got %+v", d)
+		}
+	}
+	// 导出规则的状态不算作配置修改
+	restored.NFSExports[0].Status = "disabled"
+	if d := Diff(restored, archived, []string{CategoryNFSExports})[0]; len(d.Changed) != 0 {
+		t.Fatalf("expected status of nfs export to be ignored, got %+v", d)
+	}
+	if restored.SambaUsers[0].Status != model.SambaUserStatus_Init {
+		t.Fatalf("restored samba user should be recreated, got status %s", restored.SambaUsers[0].Status)
+	}
+	if restored.SambaShares[0].Status != model.SambaShareStatus_Updating {
+		t.Fatalf("restored samba share should be written to smb.conf again, got status %s", restored.SambaShares[0].Status)
+	}
+	if _, err := ParseCategories([]string{"disks"}); err == nil {
+		t.Fatal("expected error for unknown category")
+	}
+}
+
+func TestRestoreSambaShares(t *testing.T) {
+	conn := openTestDB(t)
+	seed(t, conn)
+	conn.Model(&model.SambaShare{}).Where("name = ?", "media").Update("status", model.SambaShareStatus_Active)
+	buf := &bytes.Buffer{}
+	if err := Export(conn, buf, ExportOptions{Passphrase: "correct horse"}); err != nil {
+		t.Fatal(err)
+	}
+	archived, err := ReadArchive(buf.Bytes(), "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archived.SambaShares[0].Status != model.SambaShareStatus_Active {
+		t.Fatalf("expected active share in archive, got %s", archived.SambaShares[0].Status)
+	}
+
+	// 导出之后新增的共享已经写入了 smb.conf
+	conn.Create(&model.SambaShare{HostIP: "127.0.0.2", Name: "tmp", Path: "/mnt/tmp", Pseudo: "tmp", Status: model.SambaShareStatus_Active})
+	if err := Restore(conn, archived, []string{CategorySambaShares}); err != nil {
+		t.Fatal(err)
+	}
+
+	var shares []model.SambaShare
+	if err := conn.Order("name").Find(&shares).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 2 || shares[0].Name != "media" || shares[1].Name != "tmp" {
+		t.Fatalf("unexpected shares after restore %+v", shares)
+	}
+	// 恢复的共享重新写入 smb.conf，归档中没有的共享由控制器从 smb.conf 中移除
+	if shares[0].Status != model.SambaShareStatus_Updating || shares[0].ID != archived.SambaShares[0].ID {
+		t.Fatalf("expected restored share to be updating, got %+v", shares[0])
+	}
+	if shares[1].Status != model.SambaShareStatus_Deleting || shares[1].HostIP != "127.0.0.2" {
+		t.Fatalf("expected share missing from archive to be deleting, got %+v", shares[1])
+	}
+
+	current, err := LoadConfig(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := Diff(current, archived, []string{CategorySambaShares})[0]; len(d.Added)+len(d.Removed)+len(d.Changed) != 0 {
+		t.Fatalf("expected share pending deletion to be ignored by diff, got %+v", d)
+	}
+}
+
+func TestRestoreSambaUsers(t *testing.T) {
+	conn := openTestDB(t)
+	seed(t, conn)
+	archived, err := LoadConfig(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 导出之后新增的用户已经在主机上创建
+	conn.Create(&model.SambaUser{HostIP: "127.0.0.2", Username: "bob", Password: "secret", Status: model.SambaUserStatus_Active})
+	if err := Restore(conn, archived, []string{CategorySambaUsers}); err != nil {
+		t.Fatal(err)
+	}
+
+	var users []model.SambaUser
+	if err := conn.Order("username").Find(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Username != "alice" || users[1].Username != "bob" {
+		t.Fatalf("unexpected users after restore %+v", users)
+	}
+	if users[0].Status != model.SambaUserStatus_Init || users[0].ID != archived.SambaUsers[0].ID {
+		t.Fatalf("expected restored user to be recreated, got %+v", users[0])
+	}
+	// 归档中没有的用户由控制器从主机上删除
+	if users[1].Status != model.SambaUserStatus_Deleting || users[1].HostIP != "127.0.0.2" {
+		t.Fatalf("expected user missing from archive to be deleting, got %+v", users[1])
+	}
+
+	current, err := LoadConfig(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := Diff(current, archived, []string{CategorySambaUsers})[0]; len(d.Added)+len(d.Removed)+len(d.Changed) != 0 {
+		t.Fatalf("expected user pending deletion to be ignored by diff, got %+v", d)
+	}
+}
+
+func TestReadArchiveInvalid(t *testing.T) {
+	if _, err := ReadArchive([]byte("not an archive"), ""); !errors.Is(err, ErrInvalidArchive) {
+		t.Fatalf("expected ErrInvalidArchive, got %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	cfg := []byte("FormatVersion: 99\nSchemaVersion: 1\n")
+	if err := writeTarGz(buf, map[string][]byte{configYAMLName: cfg, snapshotName: {}}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadArchive(buf.Bytes(), ""); !errors.Is(err, ErrArchiveTooNew) {
+		t.Fatalf("expected ErrArchiveTooNew, got %v", err)
+	}
+
+	// 解压后超过大小上限的归档
+	defer func(n int64) { maxExtractedBytes = n }(maxExtractedBytes)
+	maxExtractedBytes = 1 << 10
+	buf.Reset()
+	cfg = []byte("FormatVersion: 1\nSchemaVersion: 1\n")
+	if err := writeTarGz(buf, map[string][]byte{configYAMLName: cfg, snapshotName: make([]byte, 1<<20)}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > 1<<12 {
+		t.Fatalf("expected archive to be highly compressed, got %d bytes", buf.Len())
+	}
+	if _, err := ReadArchive(buf.Bytes(), ""); !errors.Is(err, ErrInvalidArchive) || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("expected oversized archive to be rejected, got %v", err)
+	}
+}
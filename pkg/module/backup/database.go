@@ -0,0 +1,295 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/db"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// 备份文件名中的时间格式，按文件名排序即按时间排序
+const backupTimeLayout = "20060102-150405"
+
+const (
+	backupPrefix   = "nas-"
+	backupSuffix   = ".db"
+	checksumSuffix = ".sha256"
+	partialSuffix  = ".partial"
+)
+
+// 备份的校验状态
+const (
+	BackupStatusUnverified = "unverified"
+	BackupStatusOK         = "ok"
+	BackupStatusCorrupted  = "corrupted"
+	// 缺少校验和文件，无法校验
+	BackupStatusNoChecksum = "no-checksum"
+)
+
+// Retention 按小时、天、周保留的备份数量，每个周期保留最新的一个备份
+type Retention struct {
+	Hourly int
+	Daily  int
+	Weekly int
+}
+
+// Database 定时在线备份数据库，备份完成后校验并轮换旧的备份
+type Database struct {
+	conn      *gorm.DB
+	dir       string
+	retention Retention
+	mu        sync.Mutex
+}
+
+func NewDatabase(conn *gorm.DB, dir string, retention Retention) *Database {
+	return &Database{
+		conn:      conn,
+		dir:       dir,
+		retention: retention,
+	}
+}
+
+// Dir 备份文件所在的目录
+func (d *Database) Dir() string {
+	return d.dir
+}
+
+// Backup 使用 VACUUM INTO 备份数据库，检查备份的完整性并记录sha256，最后轮换旧的备份
+func (d *Database) Backup() (*model.DatabaseBackup, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := os.MkdirAll(d.dir, 0o700); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	name := backupPrefix + now.Format(backupTimeLayout) + backupSuffix
+	p := filepath.Join(d.dir, name)
+	// 先写入临时文件，校验通过后再改名，列表中不会出现不完整的备份
+	partial := p + partialSuffix
+	os.Remove(partial)
+	if err := db.BackupTo(d.conn, partial); err != nil {
+		return nil, fmt.Errorf("backup database failed: %v", err)
+	}
+	if err := checkIntegrity(partial); err != nil {
+		os.Remove(partial)
+		return nil, err
+	}
+	sum, size, err := fileSHA256(partial)
+	if err != nil {
+		os.Remove(partial)
+		return nil, err
+	}
+	// 与 sha256sum 的输出格式相同，可以使用 sha256sum -c 校验
+	line := fmt.Sprintf("%s  %s\n", sum, name)
+	if err := os.WriteFile(p+checksumSuffix, []byte(line), 0o600); err != nil {
+		os.Remove(partial)
+		return nil, err
+	}
+	if err := os.Rename(partial, p); err != nil {
+		return nil, err
+	}
+
+	removed, err := d.rotate()
+	if err != nil {
+		return nil, fmt.Errorf("rotate database backups failed: %v", err)
+	}
+	if len(removed) > 0 {
+		flog.Infof("removed expired database backups %v", removed)
+	}
+	return &model.DatabaseBackup{
+		Name:      name,
+		Path:      p,
+		Size:      size,
+		CreatedAt: now.Truncate(time.Second),
+		SHA256:    sum,
+		Status:    BackupStatusOK,
+	}, nil
+}
+
+// List 列出所有备份，按时间倒序，verify 为true时重新计算校验和
+func (d *Database) List(verify bool) ([]model.DatabaseBackup, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	backups, err := d.list()
+	if err != nil {
+		return nil, err
+	}
+	if verify {
+		for i := range backups {
+			backups[i].Status = verifyBackup(&backups[i])
+		}
+	}
+	return backups, nil
+}
+
+func (d *Database) list() ([]model.DatabaseBackup, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []model.DatabaseBackup{}, nil
+		}
+		return nil, err
+	}
+	backups := make([]model.DatabaseBackup, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupSuffix) {
+			continue
+		}
+		createdAt, err := time.ParseInLocation(backupTimeLayout, strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), backupSuffix), time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		b := model.DatabaseBackup{
+			Name:      name,
+			Path:      filepath.Join(d.dir, name),
+			Size:      info.Size(),
+			CreatedAt: createdAt,
+			Status:    BackupStatusUnverified,
+		}
+		if sum, err := readChecksum(b.Path + checksumSuffix); err == nil {
+			b.SHA256 = sum
+		} else {
+			b.Status = BackupStatusNoChecksum
+		}
+		backups = append(backups, b)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+// rotate 删除不在保留策略内的备份，返回删除的文件名
+func (d *Database) rotate() ([]string, error) {
+	backups, err := d.list()
+	if err != nil {
+		return nil, err
+	}
+	removed := []string{}
+	for _, b := range expired(backups, d.retention) {
+		if err := os.Remove(b.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+		os.Remove(b.Path + checksumSuffix)
+		removed = append(removed, b.Name)
+	}
+	return removed, nil
+}
+
+// expired 返回需要删除的备份，backups 按时间倒序。
+// 每个小时、天、周保留最新的一个备份，分别保留最近的 Hourly、Daily、Weekly 个周期，最新的备份总是保留
+func expired(backups []model.DatabaseBackup, r Retention) []model.DatabaseBackup {
+	keep := make([]bool, len(backups))
+	periods := []struct {
+		limit int
+		key   func(time.Time) string
+	}{
+		{r.Hourly, func(t time.Time) string { return t.Format("2006010215") }},
+		{r.Daily, func(t time.Time) string { return t.Format("20060102") }},
+		{r.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", year, week)
+		}},
+	}
+	for _, p := range periods {
+		seen := make(map[string]bool)
+		for i, b := range backups {
+			if len(seen) >= p.limit {
+				break
+			}
+			k := p.key(b.CreatedAt)
+			if !seen[k] {
+				seen[k] = true
+				keep[i] = true
+			}
+		}
+	}
+	if len(keep) > 0 {
+		keep[0] = true
+	}
+
+	out := []model.DatabaseBackup{}
+	for i, b := range backups {
+		if !keep[i] {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func verifyBackup(b *model.DatabaseBackup) string {
+	if b.SHA256 == "" {
+		return BackupStatusNoChecksum
+	}
+	sum, _, err := fileSHA256(b.Path)
+	if err != nil || sum != b.SHA256 {
+		return BackupStatusCorrupted
+	}
+	return BackupStatusOK
+}
+
+// checkIntegrity 打开备份文件执行 integrity_check
+func checkIntegrity(p string) error {
+	conn, err := gorm.Open(sqlite.Open(p), &gorm.Config{})
+	if err != nil {
+		return err
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+	var result string
+	if err := conn.Raw("PRAGMA integrity_check").Scan(&result).Error; err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check of database backup failed: %s", result)
+	}
+	return nil
+}
+
+func fileSHA256(p string) (string, int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// readChecksum 读取 sha256sum 格式的校验和文件
+func readChecksum(p string) (string, error) {
+	bs, err := os.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(bs))
+	if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid checksum file %s", p)
+	}
+	return fields[0], nil
+}
@@ -0,0 +1,98 @@
+package backup
+
+import (
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDatabaseBackup(t *testing.T) {
+	flog.NewLogger(0)
+	conn := openTestDB(t)
+	seed(t, conn)
+	dir := filepath.Join(t.TempDir(), "backups")
+	d := NewDatabase(conn, dir, Retention{Hourly: 1})
+
+	b, err := d.Backup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.SHA256 == "" || b.Size == 0 {
+		t.Fatalf("unexpected backup %+v", b)
+	}
+	if _, err := os.Stat(b.Path + partialSuffix); !os.IsNotExist(err) {
+		t.Fatalf("partial file should be renamed, got %v", err)
+	}
+
+	backups, err := d.List(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 || backups[0].Status != BackupStatusOK || backups[0].SHA256 != b.SHA256 {
+		t.Fatalf("unexpected backups %+v", backups)
+	}
+
+	// 备份文件被修改后校验失败
+	if err := os.WriteFile(b.Path, []byte("broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	backups, _ = d.List(true)
+	if backups[0].Status != BackupStatusCorrupted {
+		t.Fatalf("expected corrupted backup, got %s", backups[0].Status)
+	}
+	backups, _ = d.List(false)
+	if backups[0].Status != BackupStatusUnverified {
+		t.Fatalf("expected unverified backup, got %s", backups[0].Status)
+	}
+
+	// 轮换删除同一小时内较早的备份
+	old := filepath.Join(dir, backupPrefix+b.CreatedAt.Add(-time.Second).Format(backupTimeLayout)+backupSuffix)
+	if err := os.WriteFile(old, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Backup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatalf("old backup should be rotated, got %v", err)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	// 2024-01-01 是周一，每6小时一个备份，共15天
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	var backups []model.DatabaseBackup
+	for i := 15*4 - 1; i >= 0; i-- {
+		created := start.Add(time.Duration(i) * 6 * time.Hour)
+		backups = append(backups, model.DatabaseBackup{Name: created.Format(backupTimeLayout), CreatedAt: created})
+	}
+
+	for _, tc := range []struct {
+		name      string
+		retention Retention
+		keep      int
+	}{
+		{"keep newest only", Retention{}, 1},
+		{"hourly", Retention{Hourly: 3}, 3},
+		// 最近3天每天最新的一个，最新的一个同时是小时备份
+		{"hourly and daily", Retention{Hourly: 2, Daily: 3}, 4},
+		// 跨3个ISO周：1月1-7日、8-14日、15日
+		{"weekly", Retention{Weekly: 5}, 3},
+		{"all", Retention{Hourly: 100}, len(backups)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			removed := expired(backups, tc.retention)
+			if got := len(backups) - len(removed); got != tc.keep {
+				t.Fatalf("kept %d backups, want %d", got, tc.keep)
+			}
+			for _, r := range removed {
+				if r.Name == backups[0].Name {
+					t.Fatal("newest backup must be kept")
+				}
+			}
+		})
+	}
+}
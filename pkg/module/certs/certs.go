@@ -0,0 +1,349 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	CertFileName = "server.crt"
+	KeyFileName  = "server.key"
+
+	// 每次写入的证书和私钥保存在 pairs 下的独立目录中，current 链接指向正在使用的目录
+	pairsDirName    = "pairs"
+	currentLinkName = "current"
+
+	// 自签名证书的有效期
+	selfSignedValidity = time.Hour * 24 * 365 * 10
+)
+
+// Info 证书的基本信息
+type Info struct {
+	Subject     string    `json:"Subject"`
+	Issuer      string    `json:"Issuer"`
+	DNSNames    []string  `json:"DNSNames"`
+	IPAddresses []string  `json:"IPAddresses"`
+	NotBefore   time.Time `json:"NotBefore"`
+	NotAfter    time.Time `json:"NotAfter"`
+	// 证书DER编码的sha256指纹
+	Fingerprint string `json:"Fingerprint"`
+	SelfSigned  bool   `json:"SelfSigned"`
+}
+
+// Manager 管理https使用的证书，替换证书后新的连接立即生效，不需要重启服务
+type Manager struct {
+	dir  string
+	cert *tls.Certificate
+	mu   sync.RWMutex
+}
+
+func NewManager(dir string) *Manager {
+	return &Manager{dir: dir}
+}
+
+func (m *Manager) CertFile() string { return filepath.Join(m.dir, CertFileName) }
+
+func (m *Manager) KeyFile() string { return filepath.Join(m.dir, KeyFileName) }
+
+// EnsureSelfSigned 证书不存在时生成自签名证书
+func (m *Manager) EnsureSelfSigned(hosts []string) (bool, error) {
+	if _, err := os.Stat(m.CertFile()); err == nil {
+		return false, nil
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	certPEM, keyPEM, err := GenerateSelfSigned(hosts, time.Now())
+	if err != nil {
+		return false, err
+	}
+	if err := m.write(certPEM, keyPEM); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Reload 从磁盘重新加载证书
+func (m *Manager) Reload() error {
+	cert, err := tls.LoadX509KeyPair(m.CertFile(), m.KeyFile())
+	if err != nil {
+		return fmt.Errorf("load tls certificate failed: %v", err)
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	m.cert = &cert
+	m.mu.Unlock()
+	return nil
+}
+
+// Update 校验并替换证书，校验失败时保持原证书不变
+func (m *Manager) Update(certPEM []byte, keyPEM []byte) (*Info, error) {
+	cert, err := Validate(certPEM, keyPEM, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := m.write(certPEM, keyPEM); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.cert = cert
+	m.mu.Unlock()
+	info := newInfo(cert.Leaf)
+	return &info, nil
+}
+
+// GetCertificate 用于 tls.Config.GetCertificate
+func (m *Manager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil {
+		return nil, errors.New("tls certificate not loaded")
+	}
+	return m.cert, nil
+}
+
+// Info 返回当前使用的证书信息
+func (m *Manager) Info() (*Info, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil {
+		return nil, errors.New("tls certificate not loaded")
+	}
+	info := newInfo(m.cert.Leaf)
+	return &info, nil
+}
+
+// write 把证书和私钥写入新的版本目录，再通过重命名 current 链接同时切换两者，
+// 写入失败或进程退出时不会出现新私钥和旧证书不匹配的情况
+func (m *Manager) write(certPEM []byte, keyPEM []byte) error {
+	if err := os.MkdirAll(filepath.Join(m.dir, pairsDirName), 0o700); err != nil {
+		return err
+	}
+	// 旧版本直接保存的证书文件先原样移入版本目录
+	legacyCert, legacyKey, err := m.readLegacyPair()
+	if err != nil {
+		return err
+	}
+	if legacyCert != nil {
+		if err := m.switchPair(legacyCert, legacyKey); err != nil {
+			return fmt.Errorf("migrate tls certificate files failed: %v", err)
+		}
+	}
+	return m.switchPair(certPEM, keyPEM)
+}
+
+// switchPair 写入新的版本目录并把 current 指向它，server.crt 和 server.key 是指向 current 下同名文件的链接
+func (m *Manager) switchPair(certPEM []byte, keyPEM []byte) error {
+	pair, err := os.MkdirTemp(filepath.Join(m.dir, pairsDirName), "pair-")
+	if err != nil {
+		return err
+	}
+	if err := writeFileSync(filepath.Join(pair, KeyFileName), keyPEM, 0o600); err != nil {
+		os.RemoveAll(pair)
+		return err
+	}
+	if err := writeFileSync(filepath.Join(pair, CertFileName), certPEM, 0o644); err != nil {
+		os.RemoveAll(pair)
+		return err
+	}
+
+	current := filepath.Join(m.dir, currentLinkName)
+	if err := replaceSymlink(filepath.Join(pairsDirName, filepath.Base(pair)), current); err != nil {
+		os.RemoveAll(pair)
+		return err
+	}
+	for _, name := range []string{KeyFileName, CertFileName} {
+		target := filepath.Join(currentLinkName, name)
+		if link, err := os.Readlink(filepath.Join(m.dir, name)); err == nil && link == target {
+			continue
+		}
+		if err := replaceSymlink(target, filepath.Join(m.dir, name)); err != nil {
+			return err
+		}
+	}
+	// 清理之前使用的以及写入中断留下的版本目录
+	entries, err := os.ReadDir(filepath.Join(m.dir, pairsDirName))
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		if e.Name() != filepath.Base(pair) {
+			os.RemoveAll(filepath.Join(m.dir, pairsDirName, e.Name()))
+		}
+	}
+	return nil
+}
+
+// readLegacyPair 读取旧版本直接保存在目录下的证书和私钥，已经是链接或文件不全时返回nil
+func (m *Manager) readLegacyPair() ([]byte, []byte, error) {
+	for _, p := range []string{m.CertFile(), m.KeyFile()} {
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil, nil, nil
+		}
+	}
+	certPEM, err := os.ReadFile(m.CertFile())
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(m.KeyFile())
+	if err != nil {
+		return nil, nil, err
+	}
+	return certPEM, keyPEM, nil
+}
+
+func writeFileSync(p string, data []byte, mode os.FileMode) error {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replaceSymlink 先创建临时链接再重命名，替换链接是原子操作
+func replaceSymlink(target string, p string) error {
+	tmp := p + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// Validate 校验证书和私钥是否匹配，以及证书是否在有效期内
+func Validate(certPEM []byte, keyPEM []byte, now time.Time) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate or private key: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate failed: %v", err)
+	}
+	if now.Before(leaf.NotBefore) {
+		return nil, fmt.Errorf("certificate is not valid before %s", leaf.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate expired at %s", leaf.NotAfter.Format(time.RFC3339))
+	}
+	cert.Leaf = leaf
+	return &cert, nil
+}
+
+// GenerateSelfSigned 生成ECDSA P-256自签名证书，hosts可以是域名或IP
+func GenerateSelfSigned(hosts []string, now time.Time) (certPEM []byte, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   "fluteNAS",
+			Organization: []string{"fluteNAS self-signed"},
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else if h != "" {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// LocalHosts 返回自签名证书默认包含的主机名和本机IP
+func LocalHosts() []string {
+	hosts := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		hosts = append(hosts, hostname)
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return hosts
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLinkLocalUnicast() {
+			hosts = append(hosts, ipnet.IP.String())
+		}
+	}
+	return hosts
+}
+
+func newInfo(leaf *x509.Certificate) Info {
+	sum := sha256.Sum256(leaf.Raw)
+	info := Info{
+		Subject:     leaf.Subject.String(),
+		Issuer:      leaf.Issuer.String(),
+		DNSNames:    leaf.DNSNames,
+		IPAddresses: []string{},
+		NotBefore:   leaf.NotBefore,
+		NotAfter:    leaf.NotAfter,
+		Fingerprint: hex.EncodeToString(sum[:]),
+		SelfSigned:  leaf.CheckSignatureFrom(leaf) == nil,
+	}
+	for _, ip := range leaf.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	return info
+}
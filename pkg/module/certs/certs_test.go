@@ -0,0 +1,144 @@
+package certs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManager(t *testing.T) {
+	m := NewManager(t.TempDir())
+
+	created, err := m.EnsureSelfSigned([]string{"localhost", "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Fatal("self-signed certificate should be created on first start")
+	}
+	if created, _ := m.EnsureSelfSigned(nil); created {
+		t.Fatal("existing certificate should not be replaced")
+	}
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := m.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.SelfSigned || len(info.DNSNames) != 1 || len(info.IPAddresses) != 1 {
+		t.Fatalf("unexpected certificate info: %+v", info)
+	}
+
+	// 上传新证书后立即生效
+	certPEM, keyPEM, err := GenerateSelfSigned([]string{"nas.example.com"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Update(certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := m.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf.DNSNames[0] != "nas.example.com" {
+		t.Fatalf("certificate not updated, got %v", cert.Leaf.DNSNames)
+	}
+}
+
+func TestManagerWrite(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(dir)
+
+	// 旧版本直接保存的证书文件
+	oldCert, oldKey, err := GenerateSelfSigned([]string{"old.example.com"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(m.KeyFile(), oldKey, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(m.CertFile(), oldCert, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if created, err := m.EnsureSelfSigned(nil); err != nil || created {
+		t.Fatalf("existing legacy certificate should be kept, created %v, err %v", created, err)
+	}
+
+	newCert, newKey, err := GenerateSelfSigned([]string{"nas.example.com"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Update(newCert, newKey); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{m.CertFile(), m.KeyFile()} {
+		if fi, err := os.Lstat(p); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			t.Fatalf("%s should be a symlink into the current pair, got %v %v", p, fi, err)
+		}
+	}
+	if fi, err := os.Stat(m.KeyFile()); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("private key should only be readable by owner, got %v %v", fi, err)
+	}
+	// 切换后删除旧的版本目录
+	if pairs, err := os.ReadDir(filepath.Join(dir, pairsDirName)); err != nil || len(pairs) != 1 {
+		t.Fatalf("expected only the current pair to be kept, got %v %v", pairs, err)
+	}
+
+	// 写入一半时退出，留下的临时目录和链接不影响正在使用的证书
+	if err := os.Mkdir(filepath.Join(dir, pairsDirName, "pair-interrupted"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, pairsDirName, "pair-interrupted", KeyFileName), oldKey, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(pairsDirName, "pair-interrupted"), filepath.Join(dir, currentLinkName+".tmp")); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := NewManager(dir)
+	if err := reloaded.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := reloaded.Info(); info.DNSNames[0] != "nas.example.com" {
+		t.Fatalf("expected current certificate after restart, got %v", info.DNSNames)
+	}
+	if _, err := reloaded.Update(oldCert, oldKey); err != nil {
+		t.Fatalf("update after interrupted write failed: %v", err)
+	}
+	if err := reloaded.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := reloaded.Info(); info.DNSNames[0] != "old.example.com" {
+		t.Fatalf("certificate not updated, got %v", info.DNSNames)
+	}
+	if pairs, err := os.ReadDir(filepath.Join(dir, pairsDirName)); err != nil || len(pairs) != 1 {
+		t.Fatalf("expected interrupted pair to be cleaned up, got %v %v", pairs, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Now()
+	certPEM, keyPEM, err := GenerateSelfSigned([]string{"localhost"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKeyPEM, err := GenerateSelfSigned([]string{"localhost"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Validate(certPEM, keyPEM, now); err != nil {
+		t.Fatalf("valid pair rejected: %v", err)
+	}
+	if _, err := Validate(certPEM, otherKeyPEM, now); err == nil {
+		t.Fatal("mismatched private key should be rejected")
+	}
+	if _, err := Validate([]byte("not a pem"), keyPEM, now); err == nil {
+		t.Fatal("malformed certificate should be rejected")
+	}
+	if _, err := Validate(certPEM, keyPEM, now.Add(selfSignedValidity+time.Hour)); err == nil {
+		t.Fatal("expired certificate should be rejected")
+	}
+}
@@ -37,3 +37,18 @@ func InitDB(pStr string) (err error) {
 
 	return nil
 }
+
+// Close 把WAL中的数据合并回数据库文件后关闭连接
+func Close() error {
+	if db == nil {
+		return nil
+	}
+	if err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE);").Error; err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
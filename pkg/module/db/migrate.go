@@ -0,0 +1,185 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 数据库结构的一个版本，Version 从1开始递增，发布后不能修改
+// AutoMigrate 只能新增表和字段，重命名字段、修改索引和转换数据需要通过迁移完成
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(tx *gorm.DB) error
+	// 回滚时执行，为nil表示该迁移不能回滚
+	Down func(tx *gorm.DB) error
+}
+
+// SchemaMigration 已执行的迁移记录
+type SchemaMigration struct {
+	Version     int       `gorm:"primaryKey;autoIncrement:false"`
+	Description string    `gorm:"not null"`
+	AppliedAt   time.Time `gorm:"not null"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// ErrSchemaTooNew 数据库由更新的版本迁移过，当前程序不能安全地使用
+var ErrSchemaTooNew = errors.New("database schema is newer than this build")
+
+// Migrator 按版本顺序执行迁移，执行前备份数据库文件
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+	// 备份文件的目录，为空时不备份
+	backupDir string
+}
+
+// NewMigrator 检查迁移的版本号从1开始连续递增
+func NewMigrator(db *gorm.DB, migrations []Migration, backupDir string) (*Migrator, error) {
+	ms := append([]Migration{}, migrations...)
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	for i, m := range ms {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must start from 1 without gaps, got %d at position %d", m.Version, i+1)
+		}
+		if m.Up == nil {
+			return nil, fmt.Errorf("migration %d has no up step", m.Version)
+		}
+	}
+	return &Migrator{db: db, migrations: ms, backupDir: backupDir}, nil
+}
+
+// Latest 当前程序支持的最新版本
+func (m *Migrator) Latest() int {
+	return len(m.migrations)
+}
+
+// Current 数据库当前的版本，没有执行过迁移时为0
+func (m *Migrator) Current() (int, error) {
+	if err := m.db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return 0, err
+	}
+	var version int
+	err := m.db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// Up 执行所有未执行的迁移，fresh 表示新建的空数据库，只记录版本不执行迁移
+// 数据库版本高于当前程序支持的版本时返回 ErrSchemaTooNew，拒绝降级运行
+func (m *Migrator) Up(fresh bool) error {
+	current, err := m.Current()
+	if err != nil {
+		return err
+	}
+	if current > m.Latest() {
+		return fmt.Errorf("%w: database version %d, supported version %d, restore a backup or upgrade flute-nas", ErrSchemaTooNew, current, m.Latest())
+	}
+	if current == m.Latest() {
+		return nil
+	}
+
+	if fresh {
+		// 新数据库的表结构由 AutoMigrate 按最新的模型创建
+		return m.db.Transaction(func(tx *gorm.DB) error {
+			for _, mg := range m.migrations[current:] {
+				if err := record(tx, mg); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	if _, err := m.backup(current); err != nil {
+		return fmt.Errorf("backup database before migration failed: %v", err)
+	}
+	for _, mg := range m.migrations[current:] {
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := mg.Up(tx); err != nil {
+				return err
+			}
+			return record(tx, mg)
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %v", mg.Version, mg.Description, err)
+		}
+	}
+	return nil
+}
+
+// DownTo 按倒序回滚版本大于 target 的迁移
+func (m *Migrator) DownTo(target int) error {
+	current, err := m.Current()
+	if err != nil {
+		return err
+	}
+	if current > m.Latest() {
+		return fmt.Errorf("%w: database version %d, supported version %d", ErrSchemaTooNew, current, m.Latest())
+	}
+	if target < 0 || target >= current {
+		return fmt.Errorf("cannot roll back from version %d to %d", current, target)
+	}
+	for v := current; v > target; v-- {
+		if m.migrations[v-1].Down == nil {
+			return fmt.Errorf("migration %d (%s) cannot be rolled back", v, m.migrations[v-1].Description)
+		}
+	}
+
+	if _, err := m.backup(current); err != nil {
+		return fmt.Errorf("backup database before rollback failed: %v", err)
+	}
+	for v := current; v > target; v-- {
+		mg := m.migrations[v-1]
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := mg.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, mg.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("rollback migration %d (%s) failed: %v", mg.Version, mg.Description, err)
+		}
+	}
+	return nil
+}
+
+// backup 把数据库备份到 backupDir，文件名包含迁移前的版本号
+func (m *Migrator) backup(version int) (string, error) {
+	if m.backupDir == "" {
+		return "", nil
+	}
+	if err := os.MkdirAll(m.backupDir, 0o700); err != nil {
+		return "", err
+	}
+	p := filepath.Join(m.backupDir, fmt.Sprintf("nas.db.v%d.%s.bak", version, time.Now().Format("20060102150405")))
+	return p, BackupTo(m.db, p)
+}
+
+func record(tx *gorm.DB, mg Migration) error {
+	return tx.Create(&SchemaMigration{
+		Version:     mg.Version,
+		Description: mg.Description,
+		AppliedAt:   time.Now(),
+	}).Error
+}
+
+// BackupTo 在线备份数据库到目标文件，备份期间不阻塞读写，目标文件不能已存在
+func BackupTo(db *gorm.DB, dst string) error {
+	return db.Exec("VACUUM INTO ?", dst).Error
+}
+
+// IsEmpty 数据库中还没有任何表，用于判断是否为新安装
+func IsEmpty(db *gorm.DB) (bool, error) {
+	var n int64
+	err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'").Scan(&n).Error
+	return n == 0, err
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	d, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "nas.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := d.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return d
+}
+
+func testMigrations() []Migration {
+	return []Migration{
+		{
+			Version:     1,
+			Description: "create items",
+			Up: func(tx *gorm.DB) error {
+				return tx.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)").Error
+			},
+			Down: func(tx *gorm.DB) error { return tx.Exec("DROP TABLE items").Error },
+		},
+		{
+			Version:     2,
+			Description: "add items.size",
+			Up:          func(tx *gorm.DB) error { return tx.Exec("ALTER TABLE items ADD COLUMN size INTEGER").Error },
+			Down:        func(tx *gorm.DB) error { return tx.Exec("ALTER TABLE items DROP COLUMN size").Error },
+		},
+	}
+}
+
+func TestMigratorUp(t *testing.T) {
+	d := openTestDB(t)
+	backupDir := filepath.Join(t.TempDir(), "backups")
+	m, err := NewMigrator(d, testMigrations(), backupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(false); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := m.Current(); v != 2 {
+		t.Fatalf("expected version 2, got %d", v)
+	}
+	if err := d.Exec("INSERT INTO items (name, size) VALUES ('a', 1)").Error; err != nil {
+		t.Fatalf("migrated table not usable: %v", err)
+	}
+	entries, err := os.ReadDir(backupDir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one backup file, got %v %v", entries, err)
+	}
+
+	// 已是最新版本，重复执行不做任何事
+	if err := m.Up(false); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(backupDir); len(entries) != 1 {
+		t.Fatalf("unexpected backup when nothing to migrate: %v", entries)
+	}
+}
+
+func TestMigratorFresh(t *testing.T) {
+	d := openTestDB(t)
+	empty, err := IsEmpty(d)
+	if err != nil || !empty {
+		t.Fatalf("expected empty database, got %v %v", empty, err)
+	}
+	m, _ := NewMigrator(d, testMigrations(), "")
+	if err := m.Up(true); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := m.Current(); v != 2 {
+		t.Fatalf("expected version 2, got %d", v)
+	}
+	// 新数据库只记录版本，不执行迁移
+	if d.Migrator().HasTable("items") {
+		t.Fatal("fresh database should not run migrations")
+	}
+}
+
+func TestMigratorTooNew(t *testing.T) {
+	d := openTestDB(t)
+	m, _ := NewMigrator(d, testMigrations(), "")
+	if err := m.Up(false); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := NewMigrator(d, testMigrations()[:1], "")
+	if err := old.Up(false); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("expected ErrSchemaTooNew, got %v", err)
+	}
+}
+
+func TestMigratorDownTo(t *testing.T) {
+	d := openTestDB(t)
+	m, _ := NewMigrator(d, testMigrations(), t.TempDir())
+	if err := m.Up(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DownTo(2); err == nil {
+		t.Fatal("expected error rolling back to current version")
+	}
+	if err := m.DownTo(0); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := m.Current(); v != 0 {
+		t.Fatalf("expected version 0, got %d", v)
+	}
+	if d.Migrator().HasTable("items") {
+		t.Fatal("items should be dropped")
+	}
+
+	ms := testMigrations()
+	ms[0].Down = nil
+	m, _ = NewMigrator(d, ms, "")
+	if err := m.Up(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DownTo(0); err == nil {
+		t.Fatal("expected error for migration without down step")
+	}
+	if v, _ := m.Current(); v != 2 {
+		t.Fatalf("failed rollback should not change version, got %d", v)
+	}
+}
+
+func TestNewMigratorInvalid(t *testing.T) {
+	d := openTestDB(t)
+	ms := testMigrations()
+	ms[1].Version = 3
+	if _, err := NewMigrator(d, ms, ""); err == nil {
+		t.Fatal("expected error for version gap")
+	}
+	ms = testMigrations()
+	ms[0].Up = nil
+	if _, err := NewMigrator(d, ms, ""); err == nil {
+		t.Fatal("expected error for missing up step")
+	}
+}
@@ -0,0 +1,164 @@
+package event
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Topic 事件主题，订阅时按主题过滤
+type Topic string
+
+const (
+	// samba共享的状态变化
+	TopicSambaShare Topic = "samba-share"
+	// nfs导出规则的同步结果
+	TopicNFSShare Topic = "nfs-share"
+	// 挂载点的挂载和卸载
+	TopicMount Topic = "mount"
+	// 格式化磁盘的进度
+	TopicMkfs Topic = "mkfs"
+	// 新采集的主机监控指标
+	TopicMetrics Topic = "metrics"
+)
+
+var Topics = []Topic{TopicSambaShare, TopicNFSShare, TopicMount, TopicMkfs, TopicMetrics}
+
+// Event 发布给订阅者的事件，Data 的类型由 Topic 和 Type 决定
+type Event struct {
+	// 递增的事件序号，订阅者可以据此判断是否丢失了事件
+	ID    uint64    `json:"ID"`
+	Topic Topic     `json:"Topic"`
+	Type  string    `json:"Type"`
+	Time  time.Time `json:"Time"`
+	Data  any       `json:"Data"`
+}
+
+// subscriptionBuffer 每个订阅者缓存的事件数，缓存满时丢弃新事件，不阻塞发布者
+const subscriptionBuffer = 64
+
+// Bus 进程内的事件总线
+type Bus struct {
+	mu     sync.Mutex
+	seq    uint64
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish 发布事件，没有订阅者时直接丢弃
+func (b *Bus) Publish(topic Topic, typ string, data any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.seq++
+	e := Event{ID: b.seq, Topic: topic, Type: typ, Time: time.Now(), Data: data}
+	for s := range b.subs {
+		if !s.match(topic) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe 订阅指定主题的事件，不指定主题时订阅所有事件，使用完需要调用 Close
+func (b *Bus) Subscribe(topics ...Topic) *Subscription {
+	s := &Subscription{
+		bus: b,
+		ch:  make(chan Event, subscriptionBuffer),
+	}
+	if len(topics) > 0 {
+		s.topics = make(map[Topic]bool, len(topics))
+		for _, t := range topics {
+			s.topics[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(s.ch)
+		return s
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Close 关闭所有订阅，之后发布的事件都会被丢弃，服务停止时调用
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for s := range b.subs {
+		delete(b.subs, s)
+		close(s.ch)
+	}
+}
+
+// Len 当前的订阅数
+func (b *Bus) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+type Subscription struct {
+	bus     *Bus
+	topics  map[Topic]bool
+	ch      chan Event
+	dropped atomic.Uint64
+}
+
+// Events 接收事件的channel，订阅关闭后channel被关闭
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Dropped 因为缓存满而丢弃的事件数
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if _, ok := s.bus.subs[s]; ok {
+		delete(s.bus.subs, s)
+		close(s.ch)
+	}
+}
+
+func (s *Subscription) match(topic Topic) bool {
+	return s.topics == nil || s.topics[topic]
+}
+
+var defaultBus = NewBus()
+
+// Publish 在默认的事件总线上发布事件
+func Publish(topic Topic, typ string, data any) {
+	defaultBus.Publish(topic, typ, data)
+}
+
+// Subscribe 订阅默认事件总线上的事件
+func Subscribe(topics ...Topic) *Subscription {
+	return defaultBus.Subscribe(topics...)
+}
+
+// Close 关闭默认的事件总线
+func Close() {
+	defaultBus.Close()
+}
@@ -0,0 +1,45 @@
+package event
+
+import (
+	"testing"
+)
+
+func TestBus(t *testing.T) {
+	b := NewBus()
+	all := b.Subscribe()
+	mount := b.Subscribe(TopicMount)
+
+	b.Publish(TopicMount, "mounted", "/mnt/a")
+	b.Publish(TopicMkfs, "started", "/dev/sdb")
+
+	if e := <-mount.Events(); e.Topic != TopicMount || e.Data != "/mnt/a" || e.ID != 1 {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	if len(mount.Events()) != 0 {
+		t.Fatal("mkfs event should not be delivered to mount subscriber")
+	}
+	if len(all.Events()) != 2 {
+		t.Fatalf("expect 2 events, got %d", len(all.Events()))
+	}
+
+	// 缓存满时丢弃事件而不是阻塞
+	for i := 0; i < subscriptionBuffer+3; i++ {
+		b.Publish(TopicMount, "mounted", i)
+	}
+	if mount.Dropped() != 3 {
+		t.Fatalf("expect 3 dropped events, got %d", mount.Dropped())
+	}
+
+	mount.Close()
+	mount.Close()
+	if b.Len() != 1 {
+		t.Fatalf("expect 1 subscription, got %d", b.Len())
+	}
+	b.Close()
+	for range all.Events() {
+	}
+	if _, ok := <-b.Subscribe().Events(); ok {
+		t.Fatal("subscription of closed bus should be closed")
+	}
+	b.Publish(TopicMount, "mounted", nil)
+}
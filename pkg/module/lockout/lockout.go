@@ -0,0 +1,155 @@
+package lockout
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Policy 登录失败的锁定策略
+type Policy struct {
+	// 连续失败多少次后开始锁定
+	MaxFailures int
+	// 第一次锁定的时长，之后每多失败一次时长翻倍
+	BaseDelay time.Duration
+	// 锁定时长的上限
+	MaxDelay time.Duration
+	// 超过该时间没有新的失败记录时清零计数
+	Window time.Duration
+}
+
+// Entry 某个key当前的失败计数和锁定状态
+type Entry struct {
+	Kind        string    `json:"Kind"`
+	Key         string    `json:"Key"`
+	Failures    int       `json:"Failures"`
+	LastFailure time.Time `json:"LastFailure"`
+	LockedUntil time.Time `json:"LockedUntil"`
+}
+
+// Locked 判断在t时刻是否处于锁定状态
+func (e Entry) Locked(t time.Time) bool {
+	return t.Before(e.LockedUntil)
+}
+
+// Guard 按key记录连续失败次数，超过阈值后按指数退避锁定
+type Guard struct {
+	kind    string
+	policy  Policy
+	entries map[string]*Entry
+	mu      sync.Mutex
+	// 方便测试替换时钟
+	now func() time.Time
+}
+
+func NewGuard(kind string, policy Policy) *Guard {
+	return &Guard{
+		kind:    kind,
+		policy:  policy,
+		entries: make(map[string]*Entry),
+		now:     time.Now,
+	}
+}
+
+func (g *Guard) Kind() string { return g.kind }
+
+// Check 返回key剩余的锁定时长，未锁定时返回0
+func (g *Guard) Check(key string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	e, ok := g.entries[key]
+	if !ok {
+		return 0
+	}
+	now := g.now()
+	if g.stale(e, now) {
+		delete(g.entries, key)
+		return 0
+	}
+	if !e.Locked(now) {
+		return 0
+	}
+	return e.LockedUntil.Sub(now)
+}
+
+// Failure 记录一次失败，返回因本次失败产生的锁定时长
+func (g *Guard) Failure(key string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	e, ok := g.entries[key]
+	if !ok || g.stale(e, now) {
+		e = &Entry{Kind: g.kind, Key: key}
+		g.entries[key] = e
+	}
+	e.Failures++
+	e.LastFailure = now
+
+	delay := g.delay(e.Failures)
+	if delay > 0 {
+		e.LockedUntil = now.Add(delay)
+	}
+	return delay
+}
+
+// Success 登录成功后清除key的失败记录
+func (g *Guard) Success(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.entries, key)
+}
+
+// Clear 手动解除锁定，key不存在时返回false
+func (g *Guard) Clear(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.entries[key]
+	delete(g.entries, key)
+	return ok
+}
+
+// List 返回所有未过期的记录，顺便清理过期的记录
+func (g *Guard) List() []Entry {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	out := make([]Entry, 0, len(g.entries))
+	for key, e := range g.entries {
+		if g.stale(e, now) {
+			delete(g.entries, key)
+			continue
+		}
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].LastFailure.After(out[j].LastFailure)
+	})
+	return out
+}
+
+// delay 计算第n次失败后的锁定时长
+func (g *Guard) delay(failures int) time.Duration {
+	over := failures - g.policy.MaxFailures
+	if over < 0 {
+		return 0
+	}
+	d := g.policy.BaseDelay
+	for i := 0; i < over; i++ {
+		d *= 2
+		if d >= g.policy.MaxDelay {
+			return g.policy.MaxDelay
+		}
+	}
+	if d > g.policy.MaxDelay {
+		return g.policy.MaxDelay
+	}
+	return d
+}
+
+// stale 锁定已经结束并且在窗口期内没有新的失败
+func (g *Guard) stale(e *Entry, now time.Time) bool {
+	return !e.Locked(now) && now.Sub(e.LastFailure) > g.policy.Window
+}
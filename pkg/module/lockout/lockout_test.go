@@ -0,0 +1,65 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGuard(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	g := NewGuard("user", Policy{
+		MaxFailures: 3,
+		BaseDelay:   time.Second * 30,
+		MaxDelay:    time.Minute * 2,
+		Window:      time.Minute * 15,
+	})
+	g.now = func() time.Time { return now }
+
+	// 未达到阈值时不锁定
+	for i := 0; i < 2; i++ {
+		if d := g.Failure("alice"); d != 0 {
+			t.Fatalf("failure %d locked for %v, want 0", i+1, d)
+		}
+	}
+	if d := g.Check("alice"); d != 0 {
+		t.Fatalf("Check() = %v before threshold, want 0", d)
+	}
+
+	// 达到阈值后按指数退避，并受上限约束
+	for _, want := range []time.Duration{time.Second * 30, time.Minute, time.Minute * 2, time.Minute * 2} {
+		if d := g.Failure("alice"); d != want {
+			t.Fatalf("Failure() = %v, want %v", d, want)
+		}
+		if d := g.Check("alice"); d != want {
+			t.Fatalf("Check() = %v, want %v", d, want)
+		}
+	}
+
+	// 锁定结束后还在窗口期内，继续失败仍然锁定
+	now = now.Add(time.Minute * 3)
+	if d := g.Check("alice"); d != 0 {
+		t.Fatalf("Check() = %v after lock expired, want 0", d)
+	}
+	if len(g.List()) != 1 {
+		t.Fatalf("entry should be kept within window")
+	}
+
+	// 超过窗口期后计数清零
+	now = now.Add(time.Minute * 16)
+	if len(g.List()) != 0 {
+		t.Fatalf("stale entry should be removed")
+	}
+	if d := g.Failure("alice"); d != 0 {
+		t.Fatalf("failure after window locked for %v, want 0", d)
+	}
+
+	// 登录成功和手动解除都会清除记录
+	g.Success("alice")
+	if g.Clear("alice") {
+		t.Fatalf("Clear() should return false after Success()")
+	}
+	g.Failure("bob")
+	if !g.Clear("bob") {
+		t.Fatalf("Clear() should return true for existing entry")
+	}
+}
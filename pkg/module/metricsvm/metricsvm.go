@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/version"
 
 	"github.com/VictoriaMetrics/metrics"
 )
@@ -127,6 +128,10 @@ func UpdateServiceMetrics(hostIP string, service string, installed bool, status
 }
 
 func writeMetrics(w io.Writer) {
+	info := version.Get()
+	fmt.Fprintf(w, "flutenas_build_info{version=%q,branch=%q,commit=%q,build_date=%q,go_version=%q} 1\n",
+		info.Version, info.GitBranch, info.GitCommit, info.BuildDate, info.GoVersion)
+
 	nodeMu.RLock()
 	for host, v := range nodeByHost {
 		n, err := fmt.Fprintf(w, "flutenas_node_cpu_usage_percent{host=%q} %g\n", host, v.CPUUsagePercent)
@@ -3,6 +3,7 @@ package node
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/rand"
 	"errors"
 	"flutelake/fluteNAS/pkg/model"
@@ -13,13 +14,29 @@ import (
 	"strings"
 )
 
-func DescribeDisk(hostIP string) ([]model.DiskDevice, error) {
+// 磁盘挂载点和共享目录所在的根目录
+var mountRoot = "/mnt"
+
+// SetMountRoot 设置挂载根目录，需要在启动控制器之前调用
+func SetMountRoot(root string) {
+	mountRoot = root
+}
+
+func MountRoot() string {
+	return mountRoot
+}
+
+func DescribeDisk(ctx context.Context, hostIP string) ([]model.DiskDevice, error) {
 	exec := NewExec().SetHost(hostIP)
 	defer exec.Close()
+	return DescribeDiskWith(ctx, exec)
+}
 
-	output, err := exec.Command("lsblk -npbP -oNAME,SIZE,SERIAL,TYPE,WWN,VENDOR,MOUNTPOINT,HOTPLUG,ROTA,FSTYPE,PKNAME,MODEL,UUID,PARTUUID")
+// DescribeDiskWith 通过 exec 列出主机上的磁盘
+func DescribeDiskWith(ctx context.Context, exec Executor) ([]model.DiskDevice, error) {
+	output, err := exec.CommandContext(ctx, "lsblk -npbP -oNAME,SIZE,SERIAL,TYPE,WWN,VENDOR,MOUNTPOINT,HOTPLUG,ROTA,FSTYPE,PKNAME,MODEL,UUID,PARTUUID")
 	if err != nil {
-		return nil, fmt.Errorf("exec error: %s", err)
+		return nil, fmt.Errorf("exec error: %w", err)
 	}
 
 	blocks := make([]string, 0, 10)
@@ -101,13 +118,17 @@ func DescribeDisk(hostIP string) ([]model.DiskDevice, error) {
 	return disks, nil
 }
 
-func DescribeMountedPoint(hostIP string) ([]model.MountedPoint, error) {
+func DescribeMountedPoint(ctx context.Context, hostIP string) ([]model.MountedPoint, error) {
 	exec := NewExec().SetHost(hostIP)
 	defer exec.Close()
+	return DescribeMountedPointWith(ctx, exec)
+}
 
-	output, err := exec.Command("mount -l")
+// DescribeMountedPointWith 通过 exec 列出主机上已挂载的设备
+func DescribeMountedPointWith(ctx context.Context, exec Executor) ([]model.MountedPoint, error) {
+	output, err := exec.CommandContext(ctx, "mount -l")
 	if err != nil {
-		return nil, fmt.Errorf("exec error: %s", err)
+		return nil, fmt.Errorf("exec error: %w", err)
 	}
 
 	// lines := make([]string, 0, 10)
@@ -146,7 +167,7 @@ func DescribeMountedPoint(hostIP string) ([]model.MountedPoint, error) {
 	return result, nil
 }
 
-func EnsureDiskEmptyForMkfs(hostIP string, device string) error {
+func EnsureDiskEmptyForMkfs(ctx context.Context, hostIP string, device string) error {
 	exec := NewExec().SetHost(hostIP)
 	defer exec.Close()
 
@@ -154,7 +175,7 @@ func EnsureDiskEmptyForMkfs(hostIP string, device string) error {
 		return fmt.Errorf("invalid device: %s", device)
 	}
 
-	out, err := exec.CommandWithoutExitCode(fmt.Sprintf("lsblk -n -o TYPE,FSTYPE,MOUNTPOINT %s", device))
+	out, err := exec.CommandWithoutExitCodeContext(ctx, fmt.Sprintf("lsblk -n -o TYPE,FSTYPE,MOUNTPOINT %s", device))
 	if err != nil {
 		return err
 	}
@@ -198,7 +219,7 @@ func EnsureDiskEmptyForMkfs(hostIP string, device string) error {
 	return nil
 }
 
-func MkfsDisk(hostIP string, device string, fsType string) error {
+func MkfsDisk(ctx context.Context, hostIP string, device string, fsType string) error {
 	exec := NewExec().SetHost(hostIP)
 	defer exec.Close()
 
@@ -210,21 +231,21 @@ func MkfsDisk(hostIP string, device string, fsType string) error {
 	var mkfsCmd string
 	switch fsType {
 	case "ext4":
-		label, err := genUniqueDiskLabel(exec, fsType)
+		label, err := genUniqueDiskLabel(ctx, exec, fsType)
 		if err != nil {
 			return err
 		}
 		labelArg := fmt.Sprintf("-L '%s'", escapeSingleQuotes(label))
 		mkfsCmd = fmt.Sprintf("mkfs.ext4 -F %s %s", labelArg, device)
 	case "xfs":
-		label, err := genUniqueDiskLabel(exec, fsType)
+		label, err := genUniqueDiskLabel(ctx, exec, fsType)
 		if err != nil {
 			return err
 		}
 		labelArg := fmt.Sprintf("-L '%s'", escapeSingleQuotes(label))
 		mkfsCmd = fmt.Sprintf("mkfs.xfs -f %s %s", labelArg, device)
 	case "btrfs":
-		label, err := genUniqueDiskLabel(exec, fsType)
+		label, err := genUniqueDiskLabel(ctx, exec, fsType)
 		if err != nil {
 			return err
 		}
@@ -237,7 +258,7 @@ func MkfsDisk(hostIP string, device string, fsType string) error {
 		mkfsCmd = fmt.Sprintf("mkfs.%s %s", fsType, device)
 	}
 
-	supported, err := listSupportedMkfsFilesystems(exec)
+	supported, err := listSupportedMkfsFilesystems(ctx, exec)
 	if err != nil {
 		return err
 	}
@@ -250,7 +271,7 @@ func MkfsDisk(hostIP string, device string, fsType string) error {
 	}
 
 	cmd := fmt.Sprintf("if command -v wipefs >/dev/null 2>&1; then wipefs -a %s; fi; %s; sync; udevadm settle >/dev/null 2>&1 || true", device, mkfsCmd)
-	bs, err := exec.Command(cmd)
+	bs, err := exec.CommandContext(ctx, cmd)
 	if err != nil {
 		return fmt.Errorf("mkfs failed: %w, output: %s", err, string(bs))
 	}
@@ -258,16 +279,16 @@ func MkfsDisk(hostIP string, device string, fsType string) error {
 	return nil
 }
 
-func ListSupportedMkfsFilesystems(hostIP string) ([]string, error) {
+func ListSupportedMkfsFilesystems(ctx context.Context, hostIP string) ([]string, error) {
 	exec := NewExec().SetHost(hostIP)
 	defer exec.Close()
 
-	return listSupportedMkfsFilesystems(exec)
+	return listSupportedMkfsFilesystems(ctx, exec)
 }
 
-func listSupportedMkfsFilesystems(exec *Exec) ([]string, error) {
+func listSupportedMkfsFilesystems(ctx context.Context, exec Executor) ([]string, error) {
 	cmd := "while read -r f1 f2; do if [ \"$f1\" = \"nodev\" ]; then continue; fi; t=\"$f1\"; if [ -n \"$f2\" ]; then t=\"$f2\"; fi; if command -v \"mkfs.$t\" >/dev/null 2>&1; then echo \"$t\"; fi; done < /proc/filesystems"
-	out, err := exec.CommandWithoutExitCode(cmd)
+	out, err := exec.CommandWithoutExitCodeContext(ctx, cmd)
 	if err != nil {
 		return nil, err
 	}
@@ -292,7 +313,7 @@ func listSupportedMkfsFilesystems(exec *Exec) ([]string, error) {
 	return supportedFsTypes, nil
 }
 
-func genUniqueDiskLabel(exec *Exec, fsType string) (string, error) {
+func genUniqueDiskLabel(ctx context.Context, exec Executor, fsType string) (string, error) {
 	const prefix = "flutedisk"
 
 	maxLen := 16
@@ -314,7 +335,7 @@ func genUniqueDiskLabel(exec *Exec, fsType string) (string, error) {
 		suffixLen = 3
 	}
 
-	existing, err := listExistingDiskLabels(exec)
+	existing, err := listExistingDiskLabels(ctx, exec)
 	if err != nil {
 		return "", err
 	}
@@ -337,8 +358,8 @@ func genUniqueDiskLabel(exec *Exec, fsType string) (string, error) {
 	return "", fmt.Errorf("failed to generate unique label")
 }
 
-func listExistingDiskLabels(exec *Exec) (map[string]struct{}, error) {
-	out, err := exec.CommandWithoutExitCode("if [ -d /dev/disk/by-label ]; then ls -1 /dev/disk/by-label; fi")
+func listExistingDiskLabels(ctx context.Context, exec Executor) (map[string]struct{}, error) {
+	out, err := exec.CommandWithoutExitCodeContext(ctx, "if [ -d /dev/disk/by-label ]; then ls -1 /dev/disk/by-label; fi")
 	if err != nil {
 		return nil, err
 	}
@@ -1,12 +1,13 @@
 package node
 
 import (
+	"context"
 	"fmt"
 	"testing"
 )
 
 func TestDescribeDisk(t *testing.T) {
-	got, err := DescribeDisk("127.0.0.1")
+	got, err := DescribeDisk(context.Background(), "127.0.0.1")
 	if err != nil {
 		t.Errorf("DescribeDisk() error = %v", err)
 		return
@@ -15,7 +16,7 @@ func TestDescribeDisk(t *testing.T) {
 }
 
 func TestDescribeMountedPoint(t *testing.T) {
-	got, err := DescribeMountedPoint("127.0.0.1")
+	got, err := DescribeMountedPoint(context.Background(), "127.0.0.1")
 	if err != nil {
 		t.Errorf("DescribeMountedPoint() error = %v", err)
 		return
@@ -3,6 +3,7 @@ package node
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"strings"
 )
@@ -17,7 +18,7 @@ type DistroInfo struct {
 }
 
 // DetectDistro 检测远程主机的Linux发行版信息
-func DetectDistro(host string) (DistroInfo, error) {
+func DetectDistro(ctx context.Context, host string) (DistroInfo, error) {
 	exec := NewExec().SetHost(host)
 	defer exec.Close()
 
@@ -30,7 +31,7 @@ func DetectDistro(host string) (DistroInfo, error) {
 	}
 
 	// 读取 /etc/os-release 文件
-	output, err := exec.Command("cat /etc/os-release")
+	output, err := exec.CommandContext(ctx, "cat /etc/os-release")
 	if err != nil {
 		return info, fmt.Errorf("failed to read /etc/os-release: %v", err)
 	}
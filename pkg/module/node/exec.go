@@ -2,13 +2,16 @@ package node
 
 import (
 	"bytes"
-	"flutelake/fluteNAS/pkg/module/flog"
-	"flutelake/fluteNAS/pkg/util"
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -28,6 +31,10 @@ func (x *Exec) SetHost(host string) *Exec {
 	return x
 }
 
+func (x *Exec) Host() string {
+	return x.host
+}
+
 func (x *Exec) SetPort(port string) *Exec {
 	x.port = port
 	return x
@@ -42,7 +49,18 @@ func (x *Exec) isLocalHost() bool {
 	}
 }
 
+// SSH建立连接和握手的超时时间，主机不可达时尽快返回
+var sshDialTimeout = 10 * time.Second
+
+// 取消后等待本机进程退出和输出关闭的时间，超过后不再等待
+var localKillWaitDelay = 5 * time.Second
+
 func (x *Exec) Connect() error {
+	return x.ConnectContext(context.Background())
+}
+
+// ConnectContext 连接远程主机，ctx 取消或超时后中断连接
+func (x *Exec) ConnectContext(ctx context.Context) error {
 	if x.isLocalHost() {
 		return nil
 	}
@@ -50,6 +68,7 @@ func (x *Exec) Connect() error {
 	config := &ssh.ClientConfig{
 		User:            "root",
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // 注意：在生产环境中应该更严格地验证主机密钥
+		Timeout:         sshDialTimeout,
 	}
 	signers, err := ReadPrivateKeys("/root/.ssh")
 	if err != nil {
@@ -66,11 +85,26 @@ func (x *Exec) Connect() error {
 	if x.port == "" {
 		x.port = "22"
 	}
-	client, err := ssh.Dial("tcp", x.host+":"+x.port, config)
+	addr := net.JoinHostPort(x.host, x.port)
+	dialer := net.Dialer{Timeout: sshDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	// 握手同样受超时和 ctx 控制
+	conn.SetDeadline(time.Now().Add(sshDialTimeout))
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
 	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %v", ctx.Err(), err)
+		}
 		return err
 	}
-	x.client = client
+	conn.SetDeadline(time.Time{})
+	x.client = ssh.NewClient(c, chans, reqs)
 	return nil
 }
 
@@ -81,12 +115,29 @@ func (x *Exec) Close() {
 }
 
 func (x *Exec) Command(cmd string) ([]byte, error) {
+	return x.CommandContext(context.Background(), cmd)
+}
+
+// CommandContext 执行命令，ctx 取消或超时后结束本机的进程组或远程的会话
+func (x *Exec) CommandContext(ctx context.Context, cmd string) ([]byte, error) {
 	cmd = cmd + " 2>&1"
+	var output []byte
+	var err error
 	if x.isLocalHost() {
-		return x.localCommand(cmd)
+		output, err = x.localCommand(ctx, cmd)
+	} else {
+		output, err = x.remoteCommand(ctx, cmd)
 	}
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// remoteCommand 在远程主机上执行命令，命令失败时同时返回已有的输出
+func (x *Exec) remoteCommand(ctx context.Context, cmd string) ([]byte, error) {
 	if x.client == nil {
-		if err := x.Connect(); err != nil {
+		if err := x.ConnectContext(ctx); err != nil {
 			return nil, err
 		}
 	}
@@ -105,32 +156,44 @@ func (x *Exec) Command(cmd string) ([]byte, error) {
 	session.Stdout = &stdoutBuf
 
 	// run the command on the remote server
-	err = session.Run(cmd)
-	if err != nil {
+	if err := session.Start(cmd); err != nil {
 		return nil, err
 	}
-
-	return stdoutBuf.Bytes(), nil
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+	select {
+	case err := <-done:
+		return stdoutBuf.Bytes(), err
+	case <-ctx.Done():
+		// 结束远程进程并关闭会话，不再读取输出
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		return nil, fmt.Errorf("%w: remote command killed", ctx.Err())
+	}
 }
 
 // WriteFile 写入文件内容到远程主机或本地
 func (x *Exec) WriteFile(path string, content []byte, perm os.FileMode) error {
+	return x.WriteFileContext(context.Background(), path, content, perm)
+}
+
+// WriteFileContext 同 WriteFile，ctx 取消或超时后停止写入远程主机
+func (x *Exec) WriteFileContext(ctx context.Context, path string, content []byte, perm os.FileMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if x.isLocalHost() {
 		return os.WriteFile(path, content, perm)
 	}
 
 	if x.client == nil {
-		if err := x.Connect(); err != nil {
+		if err := x.ConnectContext(ctx); err != nil {
 			return fmt.Errorf("connect error: %v", err)
 		}
 	}
 
-	session, err := x.client.NewSession()
-	if err != nil {
-		return fmt.Errorf("create session error: %v", err)
-	}
-	defer session.Close()
-
 	// 创建目标文件的父目录
 	// if _, err := x.Command(fmt.Sprintf("mkdir -p %s", filepath.Dir(path))); err != nil {
 	// 	return fmt.Errorf("create directory error: %v", err)
@@ -138,12 +201,12 @@ func (x *Exec) WriteFile(path string, content []byte, perm os.FileMode) error {
 
 	// 使用 echo 和重定向来写入文件
 	cmd := fmt.Sprintf("echo '%s' > %s", escapeContent(string(content)), path)
-	if _, err := x.Command(cmd); err != nil {
-		return fmt.Errorf("write file error: %v", err)
+	if _, err := x.CommandContext(ctx, cmd); err != nil {
+		return fmt.Errorf("write file error: %w", err)
 	}
 
 	// 设置文件权限
-	if _, err := x.Command(fmt.Sprintf("chmod %o %s", perm, path)); err != nil {
+	if _, err := x.CommandContext(ctx, fmt.Sprintf("chmod %o %s", perm, path)); err != nil {
 		return fmt.Errorf("chmod error: %v", err)
 	}
 
@@ -151,35 +214,12 @@ func (x *Exec) WriteFile(path string, content []byte, perm os.FileMode) error {
 }
 
 func (x *Exec) RemoveDir(p string) error {
-	isEmpty, err := x.Command(fmt.Sprintf("ls -A %s | wc -l", p))
-	if err != nil {
-		return fmt.Errorf("检查目录 %s 是否为空失败: %v", p, err)
-	} else {
-		// 如果目录为空（输出为0），则删除该目录
-		if util.Trim(string(isEmpty)) == "0" {
-			_, err := x.Command(fmt.Sprintf("rmdir %s", p))
-			if err != nil {
-				return fmt.Errorf("删除空目录 %s 失败: %v", p, err)
-			} else {
-				flog.Infof("成功删除空目录: %s", p)
-				return nil
-			}
-		}
-	}
-	return nil
+	return RemoveDir(context.Background(), x, p)
 }
 
 // 解除挂载，解除挂载成功后，判断挂载点路径是否为空，如果为空则删除该路径目录(清理目录报错不返回错误)
 func (x *Exec) UmountDir(p string) error {
-	bs, err := x.Command(fmt.Sprintf("umount -f %s", p))
-	if err != nil {
-		// 解挂失败的问题，暂时不返回错误，等控制器来解挂
-		return fmt.Errorf("umount -f %s failed: %v, stdout: %s", p, err, string(bs))
-	}
-	if err = x.RemoveDir(p); err != nil {
-		flog.Errorf("remove empty mount point dir error: %v", err)
-	}
-	return nil
+	return UmountDir(context.Background(), x, p)
 }
 
 // escapeContent 转义文件内容中的特殊字符
@@ -190,63 +230,53 @@ func escapeContent(content string) string {
 	return content
 }
 
-func (x *Exec) localCommand(cmd string) ([]byte, error) {
-	command := exec.Command("sh", "-c", cmd)
+// localCommand 在本机执行命令，命令在单独的进程组中运行，ctx 取消时结束整个进程组。
+// 命令失败时同时返回已有的输出
+func (x *Exec) localCommand(ctx context.Context, cmd string) ([]byte, error) {
+	command := exec.CommandContext(ctx, "sh", "-c", cmd)
 	command.Env = append(os.Environ(), "LANG=en_US.UTF-8")
+	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	command.Cancel = func() error {
+		return syscall.Kill(-command.Process.Pid, syscall.SIGKILL)
+	}
+	// 后台子进程持有输出管道时，不会一直等待
+	command.WaitDelay = localKillWaitDelay
 	output, err := command.CombinedOutput()
-	if err != nil {
-		return nil, err
+	if err != nil && ctx.Err() != nil {
+		return output, fmt.Errorf("%w: %v", ctx.Err(), err)
 	}
-	return output, nil
+	return output, err
 }
 
 // CommandWithExitCode runs a command and returns its output and exit code regardless of success/failure
 func (x *Exec) CommandWithoutExitCode(cmd string) ([]byte, error) {
+	return x.CommandWithoutExitCodeContext(context.Background(), cmd)
+}
+
+// CommandWithoutExitCodeContext 同 CommandWithoutExitCode，只在连接失败、ctx 取消或超时时返回错误
+func (x *Exec) CommandWithoutExitCodeContext(ctx context.Context, cmd string) ([]byte, error) {
 	cmd = cmd + " 2>&1"
+	var output []byte
+	var err error
 	if x.isLocalHost() {
-		return x.localCommandWithoutExitCode(cmd)
-	}
-	if x.client == nil {
-		if err := x.Connect(); err != nil {
-			return nil, err
-		}
+		output, err = x.localCommand(ctx, cmd)
+	} else {
+		output, err = x.remoteCommand(ctx, cmd)
 	}
-
-	session, err := x.client.NewSession()
-	if err != nil {
+	if err != nil && ctx.Err() != nil {
 		return nil, err
 	}
-	defer session.Close()
-
-	if err := session.Setenv("LANG", "en_US.UTF-8"); err != nil {
-		return nil, fmt.Errorf("set env error: %v", err)
+	// 远程主机连接或创建会话失败时返回错误
+	var exitErr *ssh.ExitError
+	var exitMissingErr *ssh.ExitMissingError
+	if err != nil && !x.isLocalHost() && !errors.As(err, &exitErr) && !errors.As(err, &exitMissingErr) {
+		return nil, err
 	}
-
-	var stdoutBuf bytes.Buffer
-	session.Stdout = &stdoutBuf
-
-	// run the command on the remote server, don't return error on non-zero exit code
-	err = session.Run(cmd)
 	// We always return the output, even if there was an error (non-zero exit code)
-	output := stdoutBuf.Bytes()
-
-	// If there was no error, return normally
-	if err == nil {
-		return output, nil
-	}
-
-	// If there was an error but we got output, return the output anyway
 	// This handles cases like systemctl is-active where different exit codes indicate different states
 	return output, nil
 }
 
-func (x *Exec) localCommandWithoutExitCode(cmd string) ([]byte, error) {
-	command := exec.Command("sh", "-c", cmd)
-	command.Env = append(os.Environ(), "LANG=en_US.UTF-8")
-	output, _ := command.CombinedOutput() // Ignore error to always return output
-	return output, nil
-}
-
 // readPrivateKeys 读取私钥文件
 func ReadPrivateKeys(path string) ([]ssh.Signer, error) {
 	info, err := os.Stat(path)
@@ -1,9 +1,13 @@
 package node
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestExec_Command1(t *testing.T) {
@@ -39,3 +43,25 @@ func TestExec_Command2(t *testing.T) {
 	}
 	fmt.Print(string(bs))
 }
+
+func TestExec_CommandContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// 后台的 sleep 持有输出管道，只结束 sh 时会一直等到 WaitDelay
+	_, err := NewExec().CommandContext(ctx, "sleep 30 & sleep 30")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > localKillWaitDelay/2 {
+		t.Fatalf("expected process group to be killed, command returned after %v", elapsed)
+	}
+
+	out, err := NewExec().CommandWithoutExitCodeContext(context.Background(), "echo inactive; exit 3")
+	if err != nil || strings.TrimSpace(string(out)) != "inactive" {
+		t.Fatalf("expected output regardless of exit code, got %q %v", out, err)
+	}
+	if _, err := NewExec().CommandWithoutExitCodeContext(ctx, "echo inactive"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected canceled context to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package node
+
+import (
+	"context"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/util"
+	"fmt"
+	"os"
+)
+
+// Executor 在一台主机上执行命令和写文件。Exec 通过SSH或本机shell执行，测试中使用 FakeExecutor。
+// ctx 取消或超时后结束正在执行的命令并返回包含 ctx.Err() 的错误
+type Executor interface {
+	// Host 返回执行命令的主机
+	Host() string
+	// CommandContext 执行命令，退出码不为0时返回错误
+	CommandContext(ctx context.Context, cmd string) ([]byte, error)
+	// CommandWithoutExitCodeContext 执行命令，忽略退出码，总是返回输出
+	CommandWithoutExitCodeContext(ctx context.Context, cmd string) ([]byte, error)
+	WriteFileContext(ctx context.Context, path string, content []byte, perm os.FileMode) error
+	Close()
+}
+
+// ExecutorFactory 返回在指定主机上执行命令的 Executor，控制器通过它访问主机
+type ExecutorFactory func(host string) Executor
+
+// NewHostExecutor 默认的 ExecutorFactory，远程主机通过SSH执行，本机直接执行
+func NewHostExecutor(host string) Executor {
+	return NewExec().SetHost(host)
+}
+
+// RemoveDir 目录为空时删除目录
+func RemoveDir(ctx context.Context, x Executor, p string) error {
+	isEmpty, err := x.CommandContext(ctx, fmt.Sprintf("ls -A %s | wc -l", p))
+	if err != nil {
+		return fmt.Errorf("检查目录 %s 是否为空失败: %v", p, err)
+	}
+	// 如果目录为空（输出为0），则删除该目录
+	if util.Trim(string(isEmpty)) == "0" {
+		if _, err := x.CommandContext(ctx, fmt.Sprintf("rmdir %s", p)); err != nil {
+			return fmt.Errorf("删除空目录 %s 失败: %v", p, err)
+		}
+		flog.Infof("成功删除空目录: %s", p)
+	}
+	return nil
+}
+
+// UmountDir 解除挂载，解除挂载成功后，判断挂载点路径是否为空，如果为空则删除该路径目录(清理目录报错不返回错误)
+func UmountDir(ctx context.Context, x Executor, p string) error {
+	bs, err := x.CommandContext(ctx, fmt.Sprintf("umount -f %s", p))
+	if err != nil {
+		// 解挂失败的问题，暂时不返回错误，等控制器来解挂
+		return fmt.Errorf("umount -f %s failed: %w, stdout: %s", p, err, string(bs))
+	}
+	if err = RemoveDir(ctx, x, p); err != nil {
+		flog.Errorf("remove empty mount point dir error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// FakeExecutor 按脚本返回命令输出的 Executor，记录执行过的命令和写入的文件，用于测试控制器。
+// 没有匹配脚本的命令执行成功且输出为空，ctx 已经取消时命令不执行直接返回错误
+type FakeExecutor struct {
+	mu      sync.Mutex
+	scripts []fakeScript
+	calls   []FakeCall
+	files   map[string][]byte
+}
+
+// FakeCall 一次命令执行或文件写入，写文件记录为 "write <path>"
+type FakeCall struct {
+	Host    string
+	Command string
+}
+
+type fakeScript struct {
+	host   string
+	prefix string
+	output string
+	err    error
+	// 一直执行到 ctx 取消或超时
+	block bool
+	// 命令执行前调用
+	hook func()
+}
+
+func NewFakeExecutor() *FakeExecutor {
+	return &FakeExecutor{
+		files: make(map[string][]byte),
+	}
+}
+
+// On 设置以 prefix 开头的命令在所有主机上的输出和错误，后设置的脚本优先匹配。
+// 写文件时匹配 "write <path>"，设置错误可以模拟写入失败
+func (f *FakeExecutor) On(prefix string, output string, err error) *FakeExecutor {
+	return f.OnHost("", prefix, output, err)
+}
+
+// OnHost 同 On，只匹配指定主机上的命令
+func (f *FakeExecutor) OnHost(host string, prefix string, output string, err error) *FakeExecutor {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts = append(f.scripts, fakeScript{host: host, prefix: prefix, output: output, err: err})
+	return f
+}
+
+// Block 以 prefix 开头的命令一直不返回，直到 ctx 取消或超时，用于模拟卡住的命令
+func (f *FakeExecutor) Block(prefix string) *FakeExecutor {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts = append(f.scripts, fakeScript{prefix: prefix, block: true})
+	return f
+}
+
+// Do 以 prefix 开头的命令执行前调用 fn，用于模拟命令执行期间发生的修改
+func (f *FakeExecutor) Do(prefix string, fn func()) *FakeExecutor {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts = append(f.scripts, fakeScript{prefix: prefix, hook: fn})
+	return f
+}
+
+// Factory 返回在指定主机上执行的 ExecutorFactory，所有主机共享脚本和记录
+func (f *FakeExecutor) Factory() ExecutorFactory {
+	return func(host string) Executor {
+		return &fakeHostExecutor{fake: f, host: host}
+	}
+}
+
+// Calls 返回按顺序执行过的命令
+func (f *FakeExecutor) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeCall(nil), f.calls...)
+}
+
+// Commands 返回指定主机上按顺序执行过的命令
+func (f *FakeExecutor) Commands(host string) []string {
+	var cmds []string
+	for _, c := range f.Calls() {
+		if c.Host == host {
+			cmds = append(cmds, c.Command)
+		}
+	}
+	return cmds
+}
+
+// File 返回写入指定主机的文件内容
+func (f *FakeExecutor) File(host string, path string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	content, ok := f.files[host+":"+path]
+	return content, ok
+}
+
+func (f *FakeExecutor) run(ctx context.Context, host string, cmd string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.calls = append(f.calls, FakeCall{Host: host, Command: cmd})
+	script := fakeScript{}
+	for i := len(f.scripts) - 1; i >= 0; i-- {
+		s := f.scripts[i]
+		if (s.host == "" || s.host == host) && strings.HasPrefix(cmd, s.prefix) {
+			script = s
+			break
+		}
+	}
+	f.mu.Unlock()
+
+	if script.hook != nil {
+		script.hook()
+	}
+	if script.block {
+		<-ctx.Done()
+		return nil, fmt.Errorf("%w: command killed", ctx.Err())
+	}
+	return []byte(script.output), script.err
+}
+
+type fakeHostExecutor struct {
+	fake *FakeExecutor
+	host string
+}
+
+func (x *fakeHostExecutor) Host() string {
+	return x.host
+}
+
+func (x *fakeHostExecutor) CommandContext(ctx context.Context, cmd string) ([]byte, error) {
+	output, err := x.fake.run(ctx, x.host, cmd)
+	if err != nil {
+		// 与 Exec 一致，命令失败时不返回输出
+		return nil, err
+	}
+	return output, nil
+}
+
+func (x *fakeHostExecutor) CommandWithoutExitCodeContext(ctx context.Context, cmd string) ([]byte, error) {
+	output, err := x.fake.run(ctx, x.host, cmd)
+	if err != nil && ctx.Err() != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func (x *fakeHostExecutor) WriteFileContext(ctx context.Context, path string, content []byte, perm os.FileMode) error {
+	if _, err := x.fake.run(ctx, x.host, "write "+path); err != nil {
+		return fmt.Errorf("write file error: %w", err)
+	}
+	x.fake.mu.Lock()
+	defer x.fake.mu.Unlock()
+	x.fake.files[x.host+":"+path] = append([]byte(nil), content...)
+	return nil
+}
+
+func (x *fakeHostExecutor) Close() {}
@@ -3,7 +3,9 @@ package node
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/event"
 	"flutelake/fluteNAS/pkg/module/flog"
 	"flutelake/fluteNAS/pkg/module/metricsvm"
 	"flutelake/fluteNAS/pkg/util"
@@ -66,22 +68,33 @@ var diskUsageCache = struct {
 	data: make(map[string]diskUsageCacheEntry),
 }
 
-func CollectSelfMonitoringMetrics() {
-	GetMonitoringMetrics("127.0.0.1")
+// 定时采集本机监控指标的超时时间，避免卡住的命令阻塞后续的采集
+var collectMetricsTimeout = 10 * time.Second
+
+func CollectSelfMonitoringMetrics() error {
+	ctx, cancel := context.WithTimeout(context.Background(), collectMetricsTimeout)
+	defer cancel()
+	metrics, err := GetMonitoringMetrics(ctx, "127.0.0.1")
+	if err != nil {
+		return err
+	}
+	// 推送给订阅了监控指标的客户端
+	event.Publish(event.TopicMetrics, model.EventMetricsSample, metrics)
+	return nil
 }
 
-func GetMonitoringMetrics(hostIP string) (MonitoringMetrics, error) {
-	nodeMetrics, err := collectNodeMetrics(hostIP)
+func GetMonitoringMetrics(ctx context.Context, hostIP string) (MonitoringMetrics, error) {
+	nodeMetrics, err := collectNodeMetrics(ctx, hostIP)
 	if err != nil {
 		return MonitoringMetrics{}, err
 	}
 
-	sambaMetrics, err := collectSambaMetrics(hostIP)
+	sambaMetrics, err := collectSambaMetrics(ctx, hostIP)
 	if err != nil {
 		flog.Warnf("collect samba metrics failed on host %s: %v", hostIP, err)
 	}
 
-	nfsMetrics, err := collectNFSMetrics(hostIP)
+	nfsMetrics, err := collectNFSMetrics(ctx, hostIP)
 	if err != nil {
 		flog.Warnf("collect nfs metrics failed on host %s: %v", hostIP, err)
 	}
@@ -132,28 +145,28 @@ func GetMonitoringMetrics(hostIP string) (MonitoringMetrics, error) {
 	}, nil
 }
 
-func collectNodeMetrics(hostIP string) (NodeMetrics, error) {
-	cpuUsage, err := collectCPUUsage(hostIP)
+func collectNodeMetrics(ctx context.Context, hostIP string) (NodeMetrics, error) {
+	cpuUsage, err := collectCPUUsage(ctx, hostIP)
 	if err != nil {
 		return NodeMetrics{}, err
 	}
 
-	load1, load5, load15, err := collectLoadAverage(hostIP)
+	load1, load5, load15, err := collectLoadAverage(ctx, hostIP)
 	if err != nil {
 		return NodeMetrics{}, err
 	}
 
-	memTotal, memUsed, memUsagePercent, err := collectMemoryUsage(hostIP)
+	memTotal, memUsed, memUsagePercent, err := collectMemoryUsage(ctx, hostIP)
 	if err != nil {
 		return NodeMetrics{}, err
 	}
 
-	rootTotal, rootUsed, rootUsagePercent, err := collectRootDiskUsage(hostIP)
+	rootTotal, rootUsed, rootUsagePercent, err := collectRootDiskUsage(ctx, hostIP)
 	if err != nil {
 		return NodeMetrics{}, err
 	}
 
-	dataDisks, err := collectDataDiskUsages(hostIP)
+	dataDisks, err := collectDataDiskUsages(ctx, hostIP)
 	if err != nil {
 		return NodeMetrics{}, err
 	}
@@ -173,11 +186,11 @@ func collectNodeMetrics(hostIP string) (NodeMetrics, error) {
 	}, nil
 }
 
-func collectCPUUsage(hostIP string) (float64, error) {
+func collectCPUUsage(ctx context.Context, hostIP string) (float64, error) {
 	exec := NewExec().SetHost(hostIP)
 	defer exec.Close()
 
-	output, err := exec.Command("head -n 1 /proc/stat; sleep 0.1; head -n 1 /proc/stat")
+	output, err := exec.CommandContext(ctx, "head -n 1 /proc/stat; sleep 0.1; head -n 1 /proc/stat")
 	if err != nil {
 		return 0, err
 	}
@@ -247,11 +260,11 @@ func parseCPUSample(line string) (uint64, uint64, error) {
 	return idle, total, nil
 }
 
-func collectLoadAverage(hostIP string) (float64, float64, float64, error) {
+func collectLoadAverage(ctx context.Context, hostIP string) (float64, float64, float64, error) {
 	exec := NewExec().SetHost(hostIP)
 	defer exec.Close()
 
-	output, err := exec.Command("cat /proc/loadavg")
+	output, err := exec.CommandContext(ctx, "cat /proc/loadavg")
 	if err != nil {
 		return 0, 0, 0, err
 	}
@@ -277,11 +290,11 @@ func collectLoadAverage(hostIP string) (float64, float64, float64, error) {
 	return l1, l5, l15, nil
 }
 
-func collectMemoryUsage(hostIP string) (uint64, uint64, float64, error) {
+func collectMemoryUsage(ctx context.Context, hostIP string) (uint64, uint64, float64, error) {
 	exec := NewExec().SetHost(hostIP)
 	defer exec.Close()
 
-	output, err := exec.Command("cat /proc/meminfo")
+	output, err := exec.CommandContext(ctx, "cat /proc/meminfo")
 	if err != nil {
 		return 0, 0, 0, err
 	}
@@ -324,11 +337,11 @@ func collectMemoryUsage(hostIP string) (uint64, uint64, float64, error) {
 	return memTotal, memUsed, usage, nil
 }
 
-func collectRootDiskUsage(hostIP string) (uint64, uint64, float64, error) {
+func collectRootDiskUsage(ctx context.Context, hostIP string) (uint64, uint64, float64, error) {
 	exec := NewExec().SetHost(hostIP)
 	defer exec.Close()
 
-	output, err := exec.Command("df -B1 / | tail -n +2")
+	output, err := exec.CommandContext(ctx, "df -B1 / | tail -n +2")
 	if err != nil {
 		return 0, 0, 0, err
 	}
@@ -356,12 +369,12 @@ func collectRootDiskUsage(hostIP string) (uint64, uint64, float64, error) {
 	return total, used, usage, nil
 }
 
-func collectDataDiskUsages(hostIP string) ([]DiskUsage, error) {
-	disks, err := DescribeDisk(hostIP)
+func collectDataDiskUsages(ctx context.Context, hostIP string) ([]DiskUsage, error) {
+	disks, err := DescribeDisk(ctx, hostIP)
 	if err != nil {
 		return nil, err
 	}
-	points, err := DescribeMountedPoint(hostIP)
+	points, err := DescribeMountedPoint(ctx, hostIP)
 	if err != nil {
 		return nil, err
 	}
@@ -373,7 +386,7 @@ func collectDataDiskUsages(hostIP string) ([]DiskUsage, error) {
 
 	result := make([]DiskUsage, 0)
 	for _, p := range points {
-		if !strings.HasPrefix(p.Point, "/mnt/") {
+		if !strings.HasPrefix(p.Point, mountRoot+"/") {
 			continue
 		}
 		deviceDisk, ok := diskByDevice[p.Device]
@@ -381,7 +394,7 @@ func collectDataDiskUsages(hostIP string) ([]DiskUsage, error) {
 			continue
 		}
 		isHDD := deviceDisk.Rota
-		usage, err := getDiskUsageWithCache(hostIP, p.Point, p.Device, isHDD)
+		usage, err := getDiskUsageWithCache(ctx, hostIP, p.Point, p.Device, isHDD)
 		if err != nil {
 			flog.Warnf("collect disk usage failed on host %s, point %s: %v", hostIP, p.Point, err)
 			continue
@@ -399,7 +412,7 @@ func collectDataDiskUsages(hostIP string) ([]DiskUsage, error) {
 	return result, nil
 }
 
-func getDiskUsageWithCache(hostIP, mountPoint, device string, isHDD bool) (DiskUsage, error) {
+func getDiskUsageWithCache(ctx context.Context, hostIP, mountPoint, device string, isHDD bool) (DiskUsage, error) {
 	key := hostIP + "|" + mountPoint
 
 	now := time.Now()
@@ -423,7 +436,7 @@ func getDiskUsageWithCache(hostIP, mountPoint, device string, isHDD bool) (DiskU
 	defer exec.Close()
 
 	cmd := fmt.Sprintf("df -B1 %s | tail -n +2", mountPoint)
-	output, err := exec.Command(cmd)
+	output, err := exec.CommandContext(ctx, cmd)
 	if err != nil {
 		return DiskUsage{}, err
 	}
@@ -465,7 +478,7 @@ func getDiskUsageWithCache(hostIP, mountPoint, device string, isHDD bool) (DiskU
 	return usage, nil
 }
 
-func collectSambaMetrics(hostIP string) (ServiceMetrics, error) {
+func collectSambaMetrics(ctx context.Context, hostIP string) (ServiceMetrics, error) {
 	cmd := NewExec().SetHost(hostIP)
 	defer cmd.Close()
 
@@ -476,7 +489,7 @@ func collectSambaMetrics(hostIP string) (ServiceMetrics, error) {
             echo "not_installed"
         fi`
 
-	resBs, err := cmd.Command(checkInstalled)
+	resBs, err := cmd.CommandContext(ctx, checkInstalled)
 	if err != nil {
 		return ServiceMetrics{}, err
 	}
@@ -490,7 +503,7 @@ func collectSambaMetrics(hostIP string) (ServiceMetrics, error) {
 		}, nil
 	}
 
-	activeOutput, err := cmd.CommandWithoutExitCode("systemctl is-active smbd")
+	activeOutput, err := cmd.CommandWithoutExitCodeContext(ctx, "systemctl is-active smbd")
 	if err != nil {
 		return ServiceMetrics{}, err
 	}
@@ -508,7 +521,7 @@ func collectSambaMetrics(hostIP string) (ServiceMetrics, error) {
 		status = "unknown"
 	}
 
-	connOutput, err := cmd.CommandWithoutExitCode("smbstatus -b 2>/dev/null | tail -n +5 | wc -l")
+	connOutput, err := cmd.CommandWithoutExitCodeContext(ctx, "smbstatus -b 2>/dev/null | tail -n +5 | wc -l")
 	if err != nil {
 		flog.Warnf("collect samba connections failed on host %s: %v", hostIP, err)
 		return ServiceMetrics{
@@ -532,8 +545,8 @@ func collectSambaMetrics(hostIP string) (ServiceMetrics, error) {
 	}, nil
 }
 
-func collectNFSMetrics(hostIP string) (ServiceMetrics, error) {
-	installed, _, serviceStatus, err := CheckNFSGaneshaInstallation(hostIP)
+func collectNFSMetrics(ctx context.Context, hostIP string) (ServiceMetrics, error) {
+	installed, _, serviceStatus, err := CheckNFSGaneshaInstallation(ctx, hostIP)
 	if err != nil {
 		return ServiceMetrics{}, err
 	}
@@ -546,7 +559,7 @@ func collectNFSMetrics(hostIP string) (ServiceMetrics, error) {
 	cmd := NewExec().SetHost(hostIP)
 	defer cmd.Close()
 
-	connOutput, err := cmd.CommandWithoutExitCode("ss -tna 2>/dev/null | grep ':2049' | wc -l")
+	connOutput, err := cmd.CommandWithoutExitCodeContext(ctx, "ss -tna 2>/dev/null | grep ':2049' | wc -l")
 	if err != nil {
 		flog.Warnf("collect nfs connections failed on host %s: %v", hostIP, err)
 		return ServiceMetrics{
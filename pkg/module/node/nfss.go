@@ -1,8 +1,10 @@
 package node
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"flutelake/fluteNAS/pkg/model"
 	"flutelake/fluteNAS/pkg/module/flog"
 	"fmt"
@@ -14,6 +16,9 @@ import (
 	"github.com/flosch/pongo2"
 )
 
+// ErrNFSNotRunning NFS-Ganesha 没有运行，不能热重载配置
+var ErrNFSNotRunning = errors.New("NFS-Ganesha process not found")
+
 func (x *Exec) StartNFSGanesha(nfs []model.NFSExport) error {
 	// 安装应用
 	bs, err := x.Command("apt install nfs-ganesha nfs-ganesha-vfs")
@@ -125,8 +130,9 @@ EXPORT
 }
 
 // StartNFSServerControl 启动NFS服务（独立函数）
-func StartNFSServerControl(hostIP string) error {
+func StartNFSServerControl(ctx context.Context, hostIP string) error {
 	cmd := NewExec().SetHost(hostIP)
+	defer cmd.Close()
 
 	// 验证配置文件语法
 	if err := ValidateNFSConfigFile("/etc/ganesha/ganesha.conf"); err != nil {
@@ -135,7 +141,7 @@ func StartNFSServerControl(hostIP string) error {
 	}
 
 	// 启动服务
-	bs, err := cmd.Command("systemctl start nfs-ganesha")
+	bs, err := cmd.CommandContext(ctx, "systemctl start nfs-ganesha")
 	if err != nil {
 		return fmt.Errorf("start nfs-ganesha failed: %w, output: %s", err, string(bs))
 	}
@@ -145,11 +151,12 @@ func StartNFSServerControl(hostIP string) error {
 }
 
 // StopNFSServerControl 停止NFS服务（独立函数）
-func StopNFSServerControl(hostIP string) error {
+func StopNFSServerControl(ctx context.Context, hostIP string) error {
 	cmd := NewExec().SetHost(hostIP)
+	defer cmd.Close()
 
 	// 停止服务
-	bs, err := cmd.Command("systemctl stop nfs-ganesha")
+	bs, err := cmd.CommandContext(ctx, "systemctl stop nfs-ganesha")
 	if err != nil {
 		return fmt.Errorf("stop nfs-ganesha failed: %w, output: %s", err, string(bs))
 	}
@@ -159,12 +166,13 @@ func StopNFSServerControl(hostIP string) error {
 }
 
 // GetNFSServerStatusControl 获取NFS服务状态（独立函数）
-func GetNFSServerStatusControl(hostIP string) (status string, uptime string, err error) {
+func GetNFSServerStatusControl(ctx context.Context, hostIP string) (status string, uptime string, err error) {
 	cmd := NewExec().SetHost(hostIP)
+	defer cmd.Close()
 
 	// 服务存在，检查其活动状态
 	// Using CommandWithExitCode to capture output even when systemctl returns non-zero exit code
-	bs, err := cmd.CommandWithoutExitCode("systemctl is-active nfs-ganesha")
+	bs, err := cmd.CommandWithoutExitCodeContext(ctx, "systemctl is-active nfs-ganesha")
 	if err != nil {
 		return "unknown", "", fmt.Errorf("get nfs-ganesha status failed: %w", err)
 	}
@@ -185,7 +193,7 @@ func GetNFSServerStatusControl(hostIP string) (status string, uptime string, err
 
 	// 获取运行时间（如果服务正在运行）
 	if status == "running" {
-		uptimeBs, _ := cmd.Command("systemctl show nfs-ganesha --property=ActiveEnterTimestamp --value")
+		uptimeBs, _ := cmd.CommandContext(ctx, "systemctl show nfs-ganesha --property=ActiveEnterTimestamp --value")
 		uptime = strings.TrimSpace(string(uptimeBs))
 	} else {
 		uptime = ""
@@ -221,7 +229,7 @@ func ValidateNFSConfigFile(configPath string) error {
 //   - version: 版本号（如果已安装）
 //   - serviceStatus: 服务状态 (running, stopped, not_installed)
 //   - err: 错误信息
-func CheckNFSGaneshaInstallation(host string) (installed bool, version string, serviceStatus string, err error) {
+func CheckNFSGaneshaInstallation(ctx context.Context, host string) (installed bool, version string, serviceStatus string, err error) {
 	cmd := NewExec().SetHost(host)
 	defer cmd.Close()
 
@@ -232,7 +240,7 @@ func CheckNFSGaneshaInstallation(host string) (installed bool, version string, s
 	err = nil
 
 	// 步骤1: 检测发行版类型，确定包管理器
-	distroInfo, err := DetectDistro(host)
+	distroInfo, err := DetectDistro(ctx, host)
 	if err != nil {
 		return false, "", "unknown", fmt.Errorf("failed to detect distro: %v", err)
 	}
@@ -241,7 +249,7 @@ func CheckNFSGaneshaInstallation(host string) (installed bool, version string, s
 	switch distroInfo.PackageManager {
 	case "apt":
 		// Debian/Ubuntu系统使用dpkg，检查状态为ii (installed)的包，（如果包被remove但没有purge， dpkg -l仍然会列出来）
-		output, err := cmd.Command("dpkg -l nfs-ganesha 2>/dev/null | grep '^ii'")
+		output, err := cmd.CommandContext(ctx, "dpkg -l nfs-ganesha 2>/dev/null | grep '^ii'")
 		if err != nil || len(output) == 0 {
 			// 未安装或查询失败
 			return false, "", "not_installed", nil
@@ -259,7 +267,7 @@ func CheckNFSGaneshaInstallation(host string) (installed bool, version string, s
 
 	case "yum", "dnf":
 		// RHEL/CentOS系统使用rpm，检查确切的包名
-		output, err := cmd.Command("rpm -q nfs-ganesha 2>/dev/null")
+		output, err := cmd.CommandContext(ctx, "rpm -q nfs-ganesha 2>/dev/null")
 		if err != nil || len(output) == 0 {
 			// 未安装或查询失败
 			return false, "", "not_installed", nil
@@ -284,7 +292,7 @@ func CheckNFSGaneshaInstallation(host string) (installed bool, version string, s
 
 	// 步骤3: 如果已安装，检查服务状态
 	if installed {
-		status, _, err := GetNFSServerStatusControl(host)
+		status, _, err := GetNFSServerStatusControl(ctx, host)
 		if err != nil {
 			// 获取状态失败，标记为unknown
 			serviceStatus = "unknown"
@@ -296,19 +304,17 @@ func CheckNFSGaneshaInstallation(host string) (installed bool, version string, s
 	return installed, version, serviceStatus, nil
 }
 
-func CheckAndMaintainNFSService() error {
-
-	cmd := NewExec().SetHost("127.0.0.1")
-	defer cmd.Close()
-	output, err := cmd.CommandWithoutExitCode("systemctl is-active nfs-ganesha")
+// CheckAndMaintainNFSService 检查 cmd 所在主机的nfs-ganesha服务，未运行或未开机自启时启动并设置自启
+func CheckAndMaintainNFSService(ctx context.Context, cmd Executor) error {
+	output, err := cmd.CommandWithoutExitCodeContext(ctx, "systemctl is-active nfs-ganesha")
 	if err != nil {
 		return fmt.Errorf("failed to check NFS-Ganesha enable status: %w", err)
 	}
 	if strings.TrimSpace(string(output)) != "active" {
-		cmd.CommandWithoutExitCode("systemctl start nfs-ganesha")
+		cmd.CommandWithoutExitCodeContext(ctx, "systemctl start nfs-ganesha")
 	}
 
-	output, err = cmd.CommandWithoutExitCode("systemctl is-enabled nfs-ganesha")
+	output, err = cmd.CommandWithoutExitCodeContext(ctx, "systemctl is-enabled nfs-ganesha")
 	if err != nil {
 		return fmt.Errorf("failed to check NFS-Ganesha enable status: %w", err)
 	}
@@ -316,7 +322,7 @@ func CheckAndMaintainNFSService() error {
 	enabledState := strings.TrimSpace(string(output))
 	if enabledState != "enabled" {
 		flog.Warnf("NFS-Ganesha service is not enabled at boot: %s", enabledState)
-		cmd.CommandWithoutExitCode("systemctl enable nfs-ganesha")
+		cmd.CommandWithoutExitCodeContext(ctx, "systemctl enable nfs-ganesha")
 	}
 
 	return nil
@@ -393,7 +399,7 @@ EXPORT
 			// If parsing fails, use empty array
 			acls = []model.NFSAcl{}
 		}
-		export.Path = filepath.Join("/mnt", export.Path)
+		export.Path = filepath.Join(mountRoot, export.Path)
 		nfss[i] = model.NFSExportMapped{
 			NFSExport:  export,
 			AclsMapped: acls,
@@ -424,13 +430,10 @@ func WriteFile(host string, filePath string, content []byte, perm os.FileMode) e
 	return cmd.WriteFile(filePath, content, perm)
 }
 
-// MoveFile moves/renames a file on the specified host
-func MoveFile(host string, srcPath string, dstPath string) error {
-	cmd := NewExec().SetHost(host)
-	defer cmd.Close()
-
+// MoveFile moves/renames a file on the host of cmd
+func MoveFile(ctx context.Context, cmd Executor, srcPath string, dstPath string) error {
 	mvCmd := fmt.Sprintf("mv '%s' '%s'", srcPath, dstPath)
-	output, err := cmd.Command(mvCmd)
+	output, err := cmd.CommandContext(ctx, mvCmd)
 	if err != nil {
 		return fmt.Errorf("move file failed: %w, output: %s", err, string(output))
 	}
@@ -438,13 +441,10 @@ func MoveFile(host string, srcPath string, dstPath string) error {
 	return nil
 }
 
-// BackupFile creates a backup of a file on the specified host
-func BackupFile(host string, srcPath string, backupPath string) error {
-	cmd := NewExec().SetHost(host)
-	defer cmd.Close()
-
+// BackupFile creates a backup of a file on the host of cmd
+func BackupFile(ctx context.Context, cmd Executor, srcPath string, backupPath string) error {
 	cpCmd := fmt.Sprintf("cp '%s' '%s'", srcPath, backupPath)
-	output, err := cmd.Command(cpCmd)
+	output, err := cmd.CommandContext(ctx, cpCmd)
 	if err != nil {
 		return fmt.Errorf("backup file failed: %w, output: %s", err, string(output))
 	}
@@ -452,13 +452,10 @@ func BackupFile(host string, srcPath string, backupPath string) error {
 	return nil
 }
 
-// RemoveFile removes a file on the specified host
-func RemoveFile(host string, filePath string) error {
-	cmd := NewExec().SetHost(host)
-	defer cmd.Close()
-
+// RemoveFile removes a file on the host of cmd
+func RemoveFile(ctx context.Context, cmd Executor, filePath string) error {
 	rmCmd := fmt.Sprintf("rm -f '%s'", filePath)
-	output, err := cmd.Command(rmCmd)
+	output, err := cmd.CommandContext(ctx, rmCmd)
 	if err != nil {
 		return fmt.Errorf("remove file failed: %w, output: %s", err, string(output))
 	}
@@ -466,21 +463,30 @@ func RemoveFile(host string, filePath string) error {
 	return nil
 }
 
-// ReloadNFSConfig sends SIGHUP signal to trigger NFS-Ganesha to reload its configuration
-func ReloadNFSConfig(host string) error {
-	cmd := NewExec().SetHost(host)
+// FileExists checks whether a regular file exists on the host of cmd
+func FileExists(ctx context.Context, cmd Executor, filePath string) (bool, error) {
+	checkCmd := fmt.Sprintf("test -f '%s' && echo 'exists' || echo 'not_found'", filePath)
+	output, err := cmd.CommandContext(ctx, checkCmd)
+	if err != nil {
+		return false, fmt.Errorf("check file failed: %w, output: %s", err, string(output))
+	}
 
+	return strings.TrimSpace(string(output)) == "exists", nil
+}
+
+// ReloadNFSConfig sends SIGHUP signal to trigger NFS-Ganesha to reload its configuration
+func ReloadNFSConfig(ctx context.Context, cmd Executor) error {
 	// Send SIGHUP signal to trigger NFS-Ganesha to reload configuration
 	reloadCmd := "pid=$(pgrep ganesha.nfsd) && if [ -n \"$pid\" ]; then kill -HUP $pid; echo 'reload-success'; else echo 'process-not-found'; fi"
 
-	output, err := cmd.Command(reloadCmd)
+	output, err := cmd.CommandContext(ctx, reloadCmd)
 	if err != nil {
 		return fmt.Errorf("reload NFS config failed: %w, output: %s", err, string(output))
 	}
 
 	outputStr := strings.TrimSpace(string(output))
 	if outputStr == "process-not-found" {
-		return fmt.Errorf("NFS-Ganesha process not found, cannot reload configuration")
+		return fmt.Errorf("%w, cannot reload configuration", ErrNFSNotRunning)
 	}
 
 	if outputStr != "reload-success" {
@@ -602,20 +608,17 @@ EXPORT
 
 // CompareAndReplaceNFSConfig compares the current NFS config with the new config using MD5 checksum
 // and only replaces if the content is different
-func CompareAndReplaceNFSConfig(hostIP string, newConfig string) error {
+func CompareAndReplaceNFSConfig(ctx context.Context, cmd Executor, newConfig string) error {
+	hostIP := cmd.Host()
 	configPath := "/etc/ganesha/ganesha.conf"
 
 	// Calculate MD5 of the new config using Go's crypto/md5
 	newConfigHash := md5.Sum([]byte(newConfig))
 	newConfigHashStr := hex.EncodeToString(newConfigHash[:])
 
-	// Read current config file and calculate its MD5 using Go's crypto/md5
-	cmd := NewExec().SetHost(hostIP)
-	defer cmd.Close()
-
 	// Check if config file exists
 	checkCmd := fmt.Sprintf("test -f '%s' && echo 'exists' || echo 'not_found'", configPath)
-	existsOutput, err := cmd.Command(checkCmd)
+	existsOutput, err := cmd.CommandContext(ctx, checkCmd)
 	if err != nil {
 		return fmt.Errorf("failed to check if config file exists: %w", err)
 	}
@@ -628,7 +631,7 @@ func CompareAndReplaceNFSConfig(hostIP string, newConfig string) error {
 
 	// Read the current config file content
 	readCmd := fmt.Sprintf("cat '%s'", configPath)
-	currentConfigContent, err := cmd.Command(readCmd)
+	currentConfigContent, err := cmd.CommandContext(ctx, readCmd)
 	if err != nil {
 		return fmt.Errorf("failed to read current config file: %w", err)
 	}
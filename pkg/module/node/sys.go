@@ -3,6 +3,7 @@ package node
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"flutelake/fluteNAS/pkg/module/flog"
 	"os"
 	"os/user"
@@ -23,11 +24,11 @@ HOME_URL="https://www.debian.org/"
 SUPPORT_URL="https://www.debian.org/support"
 BUG_REPORT_URL="https://bugs.debian.org/"
 */
-func GetOS(host string) (osRelease string, version string) {
+func GetOS(ctx context.Context, host string) (osRelease string, version string) {
 	exec := NewExec().SetHost(host)
 	defer exec.Close()
 	osRelease, version = "Unknown", "Unknown"
-	file, err := exec.Command("cat /etc/os-release")
+	file, err := exec.CommandContext(ctx, "cat /etc/os-release")
 	if err != nil {
 		return
 	}
@@ -50,32 +51,38 @@ func GetOS(host string) (osRelease string, version string) {
 	return
 }
 
-func GetKernelVersion(host string) string {
+func GetKernelVersion(ctx context.Context, host string) string {
 	exec := NewExec().SetHost(host)
 	defer exec.Close()
-	output, err := exec.Command("uname -r")
+	output, err := exec.CommandContext(ctx, "uname -r")
 	if err != nil {
-		flog.Fatalf("Error getting kernel version: %v", err)
+		// 接口请求取消或主机不可达时不能退出进程
+		flog.Errorf("Error getting kernel version of host %s: %v", host, err)
+		return ""
 	}
 	return strings.TrimSpace(string(output))
 }
 
-func GetArch(host string) string {
+func GetArch(ctx context.Context, host string) string {
 	exec := NewExec().SetHost(host)
 	defer exec.Close()
-	output, err := exec.Command("uname -m")
+	output, err := exec.CommandContext(ctx, "uname -m")
 	if err != nil {
-		flog.Fatalf("Error getting architecture: %v", err)
+		// 接口请求取消或主机不可达时不能退出进程
+		flog.Errorf("Error getting architecture of host %s: %v", host, err)
+		return ""
 	}
 	return strings.TrimSpace(string(output))
 }
 
-func GetHostname(host string) string {
+func GetHostname(ctx context.Context, host string) string {
 	exec := NewExec().SetHost(host)
 	defer exec.Close()
-	output, err := exec.Command("hostname")
+	output, err := exec.CommandContext(ctx, "hostname")
 	if err != nil {
-		flog.Fatalf("Error getting hostname: %v", err)
+		// 接口请求取消或主机不可达时不能退出进程
+		flog.Errorf("Error getting hostname of host %s: %v", host, err)
+		return ""
 	}
 	return strings.TrimSpace(string(output))
 }
@@ -139,6 +146,36 @@ func GetFluteUIDGID() (uid, gid int) {
 	return uid, gid
 }
 
+// 拥有这些组的本机用户视为系统管理员
+var adminGroups = []string{"root", "sudo", "wheel", "admin"}
+
+// IsLocalAdminUser 判断本机用户是否为root或属于sudo/wheel等管理员组
+func IsLocalAdminUser(username string) bool {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return false
+	}
+	if u.Uid == "0" {
+		return true
+	}
+	gids, err := u.GroupIds()
+	if err != nil {
+		return false
+	}
+	for _, gid := range gids {
+		g, err := user.LookupGroupId(gid)
+		if err != nil {
+			continue
+		}
+		for _, name := range adminGroups {
+			if g.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func CreateFluteUserAndGroup() error {
 	// 检查 flute 用户是否存在
 	_, uErr := user.Lookup(OS_USER_FLUTE)
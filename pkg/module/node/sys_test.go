@@ -1,28 +1,29 @@
 package node
 
 import (
+	"context"
 	"fmt"
 	"testing"
 )
 
 func TestGetOS(t *testing.T) {
-	os, ver := GetOS("127.0.0.1")
+	os, ver := GetOS(context.Background(), "127.0.0.1")
 	fmt.Println(os)
 	fmt.Println(ver)
 }
 
 func TestGetHostname(t *testing.T) {
-	hn := GetHostname("127.0.0.1")
+	hn := GetHostname(context.Background(), "127.0.0.1")
 	fmt.Println(hn)
 }
 
 func TestGetKernel(t *testing.T) {
-	hn := GetKernelVersion("127.0.0.1")
+	hn := GetKernelVersion(context.Background(), "127.0.0.1")
 	fmt.Println(hn)
 }
 
 func TestGetArch(t *testing.T) {
-	hn := GetArch("127.0.0.1")
+	hn := GetArch(context.Background(), "127.0.0.1")
 	fmt.Println(hn)
 }
 
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit 令牌桶的速率和容量
+type Limit struct {
+	// 每秒补充的令牌数
+	Rate float64 `json:"Rate" yaml:"rate"`
+	// 桶的容量，即允许的突发请求数
+	Burst int `json:"Burst" yaml:"burst"`
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter 按key分别限流的令牌桶
+type Limiter struct {
+	limit   Limit
+	buckets map[string]*bucket
+	mu      sync.Mutex
+	// 上次清理空闲令牌桶的时间
+	lastSweep time.Time
+	// 方便测试替换时钟
+	now func() time.Time
+}
+
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow 消耗key的一个令牌，令牌不足时返回false和需要等待的时长
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l.limit.Rate <= 0 || l.limit.Burst <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep 删除已经补满的令牌桶，避免key过多时占用内存
+func (l *Limiter) sweep(now time.Time) {
+	// 补满一个桶需要的时间
+	full := time.Duration(float64(l.limit.Burst) / l.limit.Rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < full && now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Len 返回当前记录的key数量
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewLimiter(Limit{Rate: 2, Burst: 3})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d within burst should be allowed", i)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok || wait != time.Millisecond*500 {
+		t.Fatalf("expect to wait 500ms, got %v %v", ok, wait)
+	}
+	// 其他key不受影响
+	if ok, _ := l.Allow("b"); !ok {
+		t.Fatal("other keys should have their own bucket")
+	}
+
+	now = now.Add(time.Millisecond * 500)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("token should be refilled after 500ms")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatal("only one token should be refilled")
+	}
+
+	// 补满后空闲的令牌桶会被清理
+	now = now.Add(time.Minute)
+	l.Allow("c")
+	if n := l.Len(); n != 1 {
+		t.Fatalf("idle buckets should be removed, got %d", n)
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	l := NewLimiter(Limit{})
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatal("zero limit means unlimited")
+		}
+	}
+}
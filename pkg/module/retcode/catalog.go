@@ -0,0 +1,91 @@
+package retcode
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// 返回码分类，对应 code 目录下的yaml文件名，每个分类使用固定的号段
+const (
+	CategoryCommon = "common" // 1xxx，以及 0 和 9999
+	CategoryDisk   = "disk"   // 2xxx
+	CategoryAuth   = "auth"   // 3xxx
+	CategorySamba  = "samba"  // 4xxx
+	CategoryNFS    = "nfs"    // 5xxx
+	CategoryFiles  = "files"  // 6xxx
+	CategoryHost   = "host"   // 7xxx
+)
+
+// Entry 返回码目录中的一项，由 code 目录下的yaml生成
+type Entry struct {
+	Code       int    `json:"code"`
+	Name       string `json:"name"`
+	Category   string `json:"category"`
+	HTTPStatus int    `json:"http_status"`
+	// 在 trans 翻译文件中的ID
+	I18nKey string `json:"i18n_key"`
+	Message string `json:"message"`
+}
+
+// Lookup 查询返回码的目录信息
+func Lookup(code int) (Entry, bool) {
+	e, ok := catalog[code]
+	return e, ok
+}
+
+// Catalog 返回按返回码排序的完整目录
+func Catalog() []Entry {
+	entries := make([]Entry, 0, len(catalog))
+	for _, e := range catalog {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Code < entries[j].Code })
+	return entries
+}
+
+// HTTPStatus 返回码对应的HTTP状态码，不在目录中的返回码按成功或服务端错误处理
+func (r *RetCode) HTTPStatus() int {
+	if e, ok := catalog[r.Code]; ok {
+		return e.HTTPStatus
+	}
+	if r.Code == RetOK {
+		return http.StatusOK
+	}
+	return http.StatusInternalServerError
+}
+
+// Error 携带返回码的错误，内部函数返回后由处理函数原样写入响应
+type Error struct {
+	RetCode *RetCode
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("retcode %d: %s", e.RetCode.Code, e.RetCode.Message)
+	}
+	return fmt.Sprintf("retcode %d: %v", e.RetCode.Code, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap 给错误附加返回码，err为nil时返回nil
+func Wrap(err error, rc *RetCode) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{RetCode: rc, Err: err}
+}
+
+// FromError 取出错误链中的返回码，没有附加返回码时返回 StatusError
+func FromError(err error) *RetCode {
+	var e *Error
+	if errors.As(err, &e) && e.RetCode != nil {
+		return e.RetCode
+	}
+	return StatusError(nil)
+}
@@ -1,7 +1,50 @@
 package retcode
 
+import (
+	"flutelake/fluteNAS/pkg/module/trans"
+	"fmt"
+)
+
 type RetCode struct {
 	Code    int         `json:"code"`
 	Message string      `json:"message,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
+	// 填充 Message 中占位符的参数
+	Args []any `json:"-"`
+}
+
+// WithArgs 设置 Message 中占位符的参数，例如 StatusParamInvalid 的参数名
+func (r *RetCode) WithArgs(args ...any) *RetCode {
+	r.Args = args
+	return r
+}
+
+// I18nKey 返回码在 trans 翻译文件中的ID，默认为 RET 加四位返回码，例如 RET1002
+func (r *RetCode) I18nKey() string {
+	if e, ok := catalog[r.Code]; ok && e.I18nKey != "" {
+		return e.I18nKey
+	}
+	return defaultI18nKey(r.Code)
+}
+
+func defaultI18nKey(code int) string {
+	return fmt.Sprintf("RET%04d", code)
+}
+
+// Localize 使用指定语言的翻译替换 Message 并填充参数，缺少翻译时使用英文
+func (r *RetCode) Localize(locale trans.Locale) *RetCode {
+	format := r.Message
+	if t := trans.GetTransMap(r.I18nKey()); len(t) > 0 {
+		if s := t.Get(locale); s != "" {
+			format = s
+		} else if s := t.Get(trans.LocaleEnglish); s != "" {
+			format = s
+		}
+	}
+	// 没有参数时保留占位符，避免输出 %!s(MISSING)
+	if len(r.Args) > 0 {
+		format = fmt.Sprintf(format, r.Args...)
+	}
+	r.Message = format
+	return r
 }
@@ -2,9 +2,98 @@
 
 package retcode
 
+var StatusLoginFailed = func(data any) *RetCode { return &RetCode{Code: 3000, Message: "username or password incorrect", Data: data}}
+var StatusLoginLocked = func(data any) *RetCode { return &RetCode{Code: 3001, Message: "too many failed login attempts, please try again later", Data: data}}
+var StatusMFACodeInvalid = func(data any) *RetCode { return &RetCode{Code: 3002, Message: "two-factor authentication code invalid", Data: data}}
+var StatusMFATokenExpired = func(data any) *RetCode { return &RetCode{Code: 3003, Message: "two-factor authentication expired, please sign in again", Data: data}}
+var StatusMFAAlreadyEnabled = func(data any) *RetCode { return &RetCode{Code: 3004, Message: "two-factor authentication is already enabled", Data: data}}
+var StatusMFANotEnabled = func(data any) *RetCode { return &RetCode{Code: 3005, Message: "two-factor authentication is not enabled", Data: data}}
+var StatusSessionInvalid = func(data any) *RetCode { return &RetCode{Code: 3006, Message: "session is invalid, please sign in again", Data: data}}
+var StatusTokenNotAllowed = func(data any) *RetCode { return &RetCode{Code: 3007, Message: "operation is not allowed with api token authentication", Data: data}}
 var StatusOK = func(data any) *RetCode { return &RetCode{Code: 0, Message: "request success", Data: data}}
 var StatusDirNotExist = func(data any) *RetCode { return &RetCode{Code: 1000, Message: "directory path not exist", Data: data}}
 var StatusDirEmpty = func(data any) *RetCode { return &RetCode{Code: 1001, Message: "directory path is empty", Data: data}}
 var StatusParamInvalid = func(data any) *RetCode { return &RetCode{Code: 1002, Message: "parameter %s invalid", Data: data}}
-var StatusUmountDiskFailed = func(data any) *RetCode { return &RetCode{Code: 2000, Message: "umount disk on path %s failed, maybe you can umount manually in terminal first.", Data: data}}
+var StatusTooManyRequests = func(data any) *RetCode { return &RetCode{Code: 1003, Message: "too many requests, please try again later", Data: data}}
+var StatusRequestTooLarge = func(data any) *RetCode { return &RetCode{Code: 1004, Message: "request body too large", Data: data}}
+var StatusDatabaseError = func(data any) *RetCode { return &RetCode{Code: 1005, Message: "database operation failed", Data: data}}
+var StatusNotFound = func(data any) *RetCode { return &RetCode{Code: 1006, Message: "%s not found", Data: data}}
+var StatusForbidden = func(data any) *RetCode { return &RetCode{Code: 1007, Message: "permission denied", Data: data}}
+var StatusJobRunning = func(data any) *RetCode { return &RetCode{Code: 1008, Message: "job %s is already running", Data: data}}
 var StatusError = func(data any) *RetCode { return &RetCode{Code: 9999, Message: "request failed", Data: data}}
+var StatusUmountDiskFailed = func(data any) *RetCode { return &RetCode{Code: 2000, Message: "umount disk on path %s failed, maybe you can umount manually in terminal first.", Data: data}}
+var StatusDiskNotFound = func(data any) *RetCode { return &RetCode{Code: 2001, Message: "disk %s not found", Data: data}}
+var StatusDiskDescribeFailed = func(data any) *RetCode { return &RetCode{Code: 2002, Message: "query disks of the host failed", Data: data}}
+var StatusSystemDiskProtected = func(data any) *RetCode { return &RetCode{Code: 2003, Message: "system disk %s cannot be formatted", Data: data}}
+var StatusDiskNotEmpty = func(data any) *RetCode { return &RetCode{Code: 2004, Message: "disk %s is not empty", Data: data}}
+var StatusMkfsFailed = func(data any) *RetCode { return &RetCode{Code: 2005, Message: "format disk %s failed", Data: data}}
+var StatusMountPointConflict = func(data any) *RetCode { return &RetCode{Code: 2006, Message: "disk %s has more than one mount point record", Data: data}}
+var StatusFileOperationFailed = func(data any) *RetCode { return &RetCode{Code: 6000, Message: "file operation on %s failed", Data: data}}
+var StatusFileAlreadyExists = func(data any) *RetCode { return &RetCode{Code: 6001, Message: "file %s already exists", Data: data}}
+var StatusFilePermissionDenied = func(data any) *RetCode { return &RetCode{Code: 6002, Message: "permission denied on %s", Data: data}}
+var StatusUploadInvalid = func(data any) *RetCode { return &RetCode{Code: 6003, Message: "upload request invalid", Data: data}}
+var StatusHostNotFound = func(data any) *RetCode { return &RetCode{Code: 7000, Message: "host %s not found", Data: data}}
+var StatusMetricsUnavailable = func(data any) *RetCode { return &RetCode{Code: 7001, Message: "monitoring metrics unavailable", Data: data}}
+var StatusCertificateInvalid = func(data any) *RetCode { return &RetCode{Code: 7002, Message: "certificate or private key invalid", Data: data}}
+var StatusHTTPSDisabled = func(data any) *RetCode { return &RetCode{Code: 7003, Message: "https is not enabled", Data: data}}
+var StatusSSHConfigFailed = func(data any) *RetCode { return &RetCode{Code: 7004, Message: "read ssh config of the host failed", Data: data}}
+var StatusConfigArchiveInvalid = func(data any) *RetCode { return &RetCode{Code: 7005, Message: "configuration archive is invalid or damaged", Data: data}}
+var StatusConfigPassphraseInvalid = func(data any) *RetCode { return &RetCode{Code: 7006, Message: "passphrase of the configuration archive is wrong", Data: data}}
+var StatusConfigArchiveTooNew = func(data any) *RetCode { return &RetCode{Code: 7007, Message: "configuration archive is created by a newer version", Data: data}}
+var StatusNFSExportNotFound = func(data any) *RetCode { return &RetCode{Code: 5000, Message: "nfs export not found", Data: data}}
+var StatusNFSServiceCheckFailed = func(data any) *RetCode { return &RetCode{Code: 5001, Message: "check NFS service on host %s failed", Data: data}}
+var StatusNFSInstallFailed = func(data any) *RetCode { return &RetCode{Code: 5002, Message: "install NFS service on host %s failed", Data: data}}
+var StatusNFSServiceControlFailed = func(data any) *RetCode { return &RetCode{Code: 5003, Message: "control NFS service on host %s failed", Data: data}}
+var StatusSambaShareNotFound = func(data any) *RetCode { return &RetCode{Code: 4000, Message: "samba share not found", Data: data}}
+var StatusSambaUserNotFound = func(data any) *RetCode { return &RetCode{Code: 4001, Message: "samba user not found", Data: data}}
+var StatusSambaServiceCheckFailed = func(data any) *RetCode { return &RetCode{Code: 4002, Message: "check samba service on host %s failed", Data: data}}
+var StatusSambaInstallFailed = func(data any) *RetCode { return &RetCode{Code: 4003, Message: "install samba service on host %s failed", Data: data}}
+
+var catalog = map[int]Entry{
+	3000: {Code: 3000, Name: "LoginFailed", Category: "auth", HTTPStatus: 401, I18nKey: "RET3000", Message: "username or password incorrect"},
+	3001: {Code: 3001, Name: "LoginLocked", Category: "auth", HTTPStatus: 429, I18nKey: "RET3001", Message: "too many failed login attempts, please try again later"},
+	3002: {Code: 3002, Name: "MFACodeInvalid", Category: "auth", HTTPStatus: 400, I18nKey: "RET3002", Message: "two-factor authentication code invalid"},
+	3003: {Code: 3003, Name: "MFATokenExpired", Category: "auth", HTTPStatus: 401, I18nKey: "RET3003", Message: "two-factor authentication expired, please sign in again"},
+	3004: {Code: 3004, Name: "MFAAlreadyEnabled", Category: "auth", HTTPStatus: 409, I18nKey: "RET3004", Message: "two-factor authentication is already enabled"},
+	3005: {Code: 3005, Name: "MFANotEnabled", Category: "auth", HTTPStatus: 409, I18nKey: "RET3005", Message: "two-factor authentication is not enabled"},
+	3006: {Code: 3006, Name: "SessionInvalid", Category: "auth", HTTPStatus: 401, I18nKey: "RET3006", Message: "session is invalid, please sign in again"},
+	3007: {Code: 3007, Name: "TokenNotAllowed", Category: "auth", HTTPStatus: 403, I18nKey: "RET3007", Message: "operation is not allowed with api token authentication"},
+	0: {Code: 0, Name: "OK", Category: "common", HTTPStatus: 200, I18nKey: "RET0000", Message: "request success"},
+	1000: {Code: 1000, Name: "DirNotExist", Category: "common", HTTPStatus: 404, I18nKey: "RET1000", Message: "directory path not exist"},
+	1001: {Code: 1001, Name: "DirEmpty", Category: "common", HTTPStatus: 400, I18nKey: "RET1001", Message: "directory path is empty"},
+	1002: {Code: 1002, Name: "ParamInvalid", Category: "common", HTTPStatus: 400, I18nKey: "RET1002", Message: "parameter %s invalid"},
+	1003: {Code: 1003, Name: "TooManyRequests", Category: "common", HTTPStatus: 429, I18nKey: "RET1003", Message: "too many requests, please try again later"},
+	1004: {Code: 1004, Name: "RequestTooLarge", Category: "common", HTTPStatus: 413, I18nKey: "RET1004", Message: "request body too large"},
+	1005: {Code: 1005, Name: "DatabaseError", Category: "common", HTTPStatus: 500, I18nKey: "RET1005", Message: "database operation failed"},
+	1006: {Code: 1006, Name: "NotFound", Category: "common", HTTPStatus: 404, I18nKey: "RET1006", Message: "%s not found"},
+	1007: {Code: 1007, Name: "Forbidden", Category: "common", HTTPStatus: 403, I18nKey: "RET1007", Message: "permission denied"},
+	1008: {Code: 1008, Name: "JobRunning", Category: "common", HTTPStatus: 409, I18nKey: "RET1008", Message: "job %s is already running"},
+	9999: {Code: 9999, Name: "Error", Category: "common", HTTPStatus: 500, I18nKey: "RET9999", Message: "request failed"},
+	2000: {Code: 2000, Name: "UmountDiskFailed", Category: "disk", HTTPStatus: 500, I18nKey: "RET2000", Message: "umount disk on path %s failed, maybe you can umount manually in terminal first."},
+	2001: {Code: 2001, Name: "DiskNotFound", Category: "disk", HTTPStatus: 404, I18nKey: "RET2001", Message: "disk %s not found"},
+	2002: {Code: 2002, Name: "DiskDescribeFailed", Category: "disk", HTTPStatus: 500, I18nKey: "RET2002", Message: "query disks of the host failed"},
+	2003: {Code: 2003, Name: "SystemDiskProtected", Category: "disk", HTTPStatus: 409, I18nKey: "RET2003", Message: "system disk %s cannot be formatted"},
+	2004: {Code: 2004, Name: "DiskNotEmpty", Category: "disk", HTTPStatus: 409, I18nKey: "RET2004", Message: "disk %s is not empty"},
+	2005: {Code: 2005, Name: "MkfsFailed", Category: "disk", HTTPStatus: 500, I18nKey: "RET2005", Message: "format disk %s failed"},
+	2006: {Code: 2006, Name: "MountPointConflict", Category: "disk", HTTPStatus: 409, I18nKey: "RET2006", Message: "disk %s has more than one mount point record"},
+	6000: {Code: 6000, Name: "FileOperationFailed", Category: "files", HTTPStatus: 500, I18nKey: "RET6000", Message: "file operation on %s failed"},
+	6001: {Code: 6001, Name: "FileAlreadyExists", Category: "files", HTTPStatus: 409, I18nKey: "RET6001", Message: "file %s already exists"},
+	6002: {Code: 6002, Name: "FilePermissionDenied", Category: "files", HTTPStatus: 403, I18nKey: "RET6002", Message: "permission denied on %s"},
+	6003: {Code: 6003, Name: "UploadInvalid", Category: "files", HTTPStatus: 400, I18nKey: "RET6003", Message: "upload request invalid"},
+	7000: {Code: 7000, Name: "HostNotFound", Category: "host", HTTPStatus: 404, I18nKey: "RET7000", Message: "host %s not found"},
+	7001: {Code: 7001, Name: "MetricsUnavailable", Category: "host", HTTPStatus: 502, I18nKey: "RET7001", Message: "monitoring metrics unavailable"},
+	7002: {Code: 7002, Name: "CertificateInvalid", Category: "host", HTTPStatus: 400, I18nKey: "RET7002", Message: "certificate or private key invalid"},
+	7003: {Code: 7003, Name: "HTTPSDisabled", Category: "host", HTTPStatus: 409, I18nKey: "RET7003", Message: "https is not enabled"},
+	7004: {Code: 7004, Name: "SSHConfigFailed", Category: "host", HTTPStatus: 500, I18nKey: "RET7004", Message: "read ssh config of the host failed"},
+	7005: {Code: 7005, Name: "ConfigArchiveInvalid", Category: "host", HTTPStatus: 400, I18nKey: "RET7005", Message: "configuration archive is invalid or damaged"},
+	7006: {Code: 7006, Name: "ConfigPassphraseInvalid", Category: "host", HTTPStatus: 400, I18nKey: "RET7006", Message: "passphrase of the configuration archive is wrong"},
+	7007: {Code: 7007, Name: "ConfigArchiveTooNew", Category: "host", HTTPStatus: 409, I18nKey: "RET7007", Message: "configuration archive is created by a newer version"},
+	5000: {Code: 5000, Name: "NFSExportNotFound", Category: "nfs", HTTPStatus: 404, I18nKey: "RET5000", Message: "nfs export not found"},
+	5001: {Code: 5001, Name: "NFSServiceCheckFailed", Category: "nfs", HTTPStatus: 500, I18nKey: "RET5001", Message: "check NFS service on host %s failed"},
+	5002: {Code: 5002, Name: "NFSInstallFailed", Category: "nfs", HTTPStatus: 500, I18nKey: "RET5002", Message: "install NFS service on host %s failed"},
+	5003: {Code: 5003, Name: "NFSServiceControlFailed", Category: "nfs", HTTPStatus: 500, I18nKey: "RET5003", Message: "control NFS service on host %s failed"},
+	4000: {Code: 4000, Name: "SambaShareNotFound", Category: "samba", HTTPStatus: 404, I18nKey: "RET4000", Message: "samba share not found"},
+	4001: {Code: 4001, Name: "SambaUserNotFound", Category: "samba", HTTPStatus: 404, I18nKey: "RET4001", Message: "samba user not found"},
+	4002: {Code: 4002, Name: "SambaServiceCheckFailed", Category: "samba", HTTPStatus: 500, I18nKey: "RET4002", Message: "check samba service on host %s failed"},
+	4003: {Code: 4003, Name: "SambaInstallFailed", Category: "samba", HTTPStatus: 500, I18nKey: "RET4003", Message: "install samba service on host %s failed"},
+}
@@ -1,49 +1,188 @@
 package retcode
 
 import (
+	"errors"
+	"flutelake/fluteNAS/pkg/module/trans"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
 	"gopkg.in/yaml.v3"
 )
 
 type code struct {
-	Name    string `json:"name"`
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Name    string `yaml:"name"`
+	Code    int    `yaml:"code"`
+	Message string `yaml:"message"`
+	// 响应的HTTP状态码，默认200
+	HTTP int `yaml:"http"`
+	// 翻译ID，默认为 RET 加四位返回码
+	I18n string `yaml:"i18n"`
+}
+
+// loadCodes 读取 code 目录下的所有返回码，文件名即为分类
+func loadCodes(t *testing.T, dir string) map[string][]code {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	categories := map[string][]code{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yml" {
+			continue
+		}
+		bs, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		codes := []code{}
+		if err := yaml.Unmarshal(bs, &codes); err != nil {
+			t.Fatalf("parse %s failed: %v", entry.Name(), err)
+		}
+		for i := range codes {
+			if codes[i].HTTP == 0 {
+				codes[i].HTTP = http.StatusOK
+			}
+			if codes[i].I18n == "" {
+				codes[i].I18n = defaultI18nKey(codes[i].Code)
+			}
+		}
+		categories[strings.TrimSuffix(entry.Name(), ".yml")] = codes
+	}
+	return categories
 }
 
 func Test_generateRetCodes(t *testing.T) {
 	currentDir, _ := os.Getwd()
-	targetDir := filepath.Join(currentDir, "code")
-	entries, _ := os.ReadDir(targetDir)
+	categories := loadCodes(t, filepath.Join(currentDir, "code"))
+	names := make([]string, 0, len(categories))
+	for category := range categories {
+		names = append(names, category)
+	}
+	sort.Strings(names)
 
 	generatedFile := filepath.Join(currentDir, "retcode_generate.go")
 	f, err := os.OpenFile(generatedFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer f.Close()
 
 	f.WriteString("// Code generated by fluteNAS. DO NOT EDIT.\n\n")
 
 	f.WriteString("package retcode\n\n")
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+	for _, category := range names {
+		for _, c := range categories[category] {
+			f.WriteString(fmt.Sprintf(`var Status%s = func(data any) *RetCode { return &RetCode{Code: %d, Message: "%s", Data: data}}`, c.Name, c.Code, c.Message))
+			f.WriteString("\n")
 		}
-		bs, err := os.ReadFile(filepath.Join(targetDir, entry.Name()))
-		if err != nil {
-			t.Fatal(err)
+	}
+
+	f.WriteString("\nvar catalog = map[int]Entry{\n")
+	for _, category := range names {
+		for _, c := range categories[category] {
+			f.WriteString(fmt.Sprintf("\t%d: {Code: %d, Name: %q, Category: %q, HTTPStatus: %d, I18nKey: %q, Message: %q},\n",
+				c.Code, c.Code, c.Name, category, c.HTTP, c.I18n, c.Message))
 		}
-		codes := []code{}
-		yaml.Unmarshal(bs, &codes)
+	}
+	f.WriteString("}\n")
+}
+
+// TestCatalog 返回码和名称不能重复，并且位于所属分类的号段内
+func TestCatalog(t *testing.T) {
+	ranges := map[string]int{
+		CategoryDisk:  2000,
+		CategoryAuth:  3000,
+		CategorySamba: 4000,
+		CategoryNFS:   5000,
+		CategoryFiles: 6000,
+		CategoryHost:  7000,
+	}
+	codes, names := map[int]string{}, map[string]int{}
+	for category, cs := range loadCodes(t, "code") {
+		for _, c := range cs {
+			if other, ok := codes[c.Code]; ok {
+				t.Errorf("code %d is used by both %s and %s", c.Code, other, c.Name)
+			}
+			if other, ok := names[c.Name]; ok {
+				t.Errorf("name %s is used by both %d and %d", c.Name, other, c.Code)
+			}
+			codes[c.Code], names[c.Name] = c.Name, c.Code
+
+			if start, ok := ranges[category]; ok && (c.Code < start || c.Code >= start+1000) {
+				t.Errorf("code %d of %s is out of the %s range", c.Code, c.Name, category)
+			}
+			if category == CategoryCommon && c.Code != RetOK && c.Code != RetFailed && (c.Code < 1000 || c.Code >= 2000) {
+				t.Errorf("code %d of %s is out of the %s range", c.Code, c.Name, category)
+			}
+			if http.StatusText(c.HTTP) == "" {
+				t.Errorf("code %d of %s has invalid http status %d", c.Code, c.Name, c.HTTP)
+			}
+
+			// 生成的目录需要与yaml一致
+			e, ok := Lookup(c.Code)
+			if !ok || e.Name != c.Name || e.Category != category || e.HTTPStatus != c.HTTP || e.I18nKey != c.I18n {
+				t.Errorf("catalog of code %d is out of date, run Test_generateRetCodes", c.Code)
+			}
+		}
+	}
+	if len(Catalog()) != len(codes) {
+		t.Errorf("catalog has %d codes, but code directory has %d", len(Catalog()), len(codes))
+	}
+}
+
+func TestFromError(t *testing.T) {
+	err := fmt.Errorf("describe disk: %w", Wrap(errors.New("lsblk failed"), StatusDiskDescribeFailed(nil)))
+	if rc := FromError(err); rc.Code != 2002 || rc.HTTPStatus() != http.StatusInternalServerError {
+		t.Errorf("unexpected retcode %+v", rc)
+	}
+	if !strings.Contains(err.Error(), "lsblk failed") {
+		t.Errorf("wrapped error should keep the cause, got %s", err)
+	}
+	if rc := FromError(errors.New("unknown")); rc.Code != RetFailed {
+		t.Errorf("error without retcode should be %d, got %d", RetFailed, rc.Code)
+	}
+	if Wrap(nil, StatusError(nil)) != nil {
+		t.Error("wrap nil error should return nil")
+	}
+	if got := (&RetCode{Code: 123456}).HTTPStatus(); got != http.StatusInternalServerError {
+		t.Errorf("unknown code should be %d, got %d", http.StatusInternalServerError, got)
+	}
+}
 
+// TestRetCodeTranslations 每个返回码在所有语言中都需要翻译，并且占位符数量与英文一致
+func TestRetCodeTranslations(t *testing.T) {
+	for _, codes := range loadCodes(t, "code") {
 		for _, c := range codes {
-			f.WriteString(fmt.Sprintf(`var Status%s = func(data any) *RetCode { return &RetCode{Code: %d, Message: "%s", Data: data}}`, c.Name, c.Code, c.Message))
-			f.WriteString("\n")
+			ts := trans.GetTransMap(c.I18n)
+			for _, lang := range trans.Langs {
+				msg := ts.Get(lang)
+				if msg == "" {
+					t.Errorf("%s (%s) has no %s translation", c.I18n, c.Name, lang)
+					continue
+				}
+				if strings.Count(msg, "%s") != strings.Count(c.Message, "%s") {
+					t.Errorf("%s (%s) %s translation %q does not match the placeholders of %q", c.I18n, c.Name, lang, msg, c.Message)
+				}
+			}
 		}
 	}
 }
+
+func TestLocalize(t *testing.T) {
+	rc := StatusParamInvalid(nil).WithArgs("HostIP").Localize(trans.LocaleChinese)
+	if rc.Message != "参数 HostIP 无效" {
+		t.Errorf("unexpected message %q", rc.Message)
+	}
+	if rc := StatusParamInvalid(nil).Localize(trans.LocaleFrench); rc.Message != "le paramètre %s est invalide" {
+		t.Errorf("message without args should keep the placeholder, got %q", rc.Message)
+	}
+	if rc := (&RetCode{Code: 123456, Message: "unknown"}).Localize(trans.LocaleChinese); rc.Message != "unknown" {
+		t.Errorf("message without translation should be kept, got %q", rc.Message)
+	}
+}
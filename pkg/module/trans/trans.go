@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"embed"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -33,8 +35,13 @@ func (t Trans) Default() string {
 	return t[defalutLocale]
 }
 
+// Sprintf 格式化指定语言的翻译，缺少该语言时使用英文
 func (t Trans) Sprintf(locale Locale, args ...interface{}) string {
-	return fmt.Sprintf(t[locale], args...)
+	format, ok := t[locale]
+	if !ok || format == "" {
+		format = t[LocaleEnglish]
+	}
+	return fmt.Sprintf(format, args...)
 }
 
 var Langs = []Locale{LocaleChinese, LocaleEnglish, LocaleRussian, LocaleSpanish, LocaleFrench, LocaleArabic, LocalePortuguese}
@@ -126,3 +133,44 @@ func GetTranslation(raw string, locale Locale) string {
 
 	return content
 }
+
+// ParseAcceptLanguage 按权重从 Accept-Language 请求头中选择支持的语言，
+// 只匹配主语言时也可以，例如 zh-TW 使用 zh-CN，都不支持时返回默认语言
+func ParseAcceptLanguage(header string) Locale {
+	type candidate struct {
+		tag string
+		q   float64
+	}
+	candidates := []candidate{}
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{tag: tag, q: q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	for _, c := range candidates {
+		for _, lang := range Langs {
+			if strings.EqualFold(c.tag, string(lang)) {
+				return lang
+			}
+		}
+		primary, _, _ := strings.Cut(c.tag, "-")
+		for _, lang := range Langs {
+			if p, _, _ := strings.Cut(string(lang), "-"); strings.EqualFold(primary, p) {
+				return lang
+			}
+		}
+	}
+	return defalutLocale
+}
@@ -14,6 +14,24 @@ import (
 	"testing"
 )
 
+func TestParseAcceptLanguage(t *testing.T) {
+	cases := map[string]Locale{
+		"":                          defalutLocale,
+		"en-US,en;q=0.9":            LocaleEnglish,
+		"zh-TW,zh;q=0.9,en;q=0.8":   LocaleChinese,
+		"de-DE,fr;q=0.5,en;q=0.7":   LocaleEnglish,
+		"pt;q=0.3, ru-RU;q=0.8, ja": LocaleRussian,
+		"ja,ko":                     defalutLocale,
+		"FR-fr":                     LocaleFrench,
+		"en;q=0, es-MX":             LocaleSpanish,
+	}
+	for header, want := range cases {
+		if got := ParseAcceptLanguage(header); got != want {
+			t.Errorf("ParseAcceptLanguage(%q) = %s, want %s", header, got, want)
+		}
+	}
+}
+
 func Test_GeneateFunc(t *testing.T) {
 	if os.Getenv("FLUTENAS_ENABLE_I18N_TESTS") != "1" {
 		t.Skip("i18n tests disabled")
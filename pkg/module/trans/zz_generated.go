@@ -17,3 +17,328 @@ var ACC0001 = func() Trans { return GetTransMap("ACC0001") }
  (若链接无效，请将地址复制到浏览器地址栏并打开)
  */
 var ACC0002 = func() Trans { return GetTransMap("ACC0002") }
+// NFS0000 :
+/* 
+ NFS共享已成功删除
+ */
+var NFS0000 = func() Trans { return GetTransMap("NFS0000") }
+// NFS0001 :
+/* 
+ NFS服务已启动
+ */
+var NFS0001 = func() Trans { return GetTransMap("NFS0001") }
+// NFS0002 :
+/* 
+ NFS服务已停止
+ */
+var NFS0002 = func() Trans { return GetTransMap("NFS0002") }
+// NFS0003 :
+/* 
+ NFS服务状态: %s
+ */
+var NFS0003 = func() Trans { return GetTransMap("NFS0003") }
+// NFS0004 :
+/* 
+ 配置验证失败
+ */
+var NFS0004 = func() Trans { return GetTransMap("NFS0004") }
+// NFS0005 :
+/* 
+ 配置验证通过
+ */
+var NFS0005 = func() Trans { return GetTransMap("NFS0005") }
+// NFS0006 :
+/* 
+ 导出规则状态已更新为%s
+ */
+var NFS0006 = func() Trans { return GetTransMap("NFS0006") }
+// NFS0007 :
+/* 
+ 导出规则配置测试失败
+ */
+var NFS0007 = func() Trans { return GetTransMap("NFS0007") }
+// RET0000 :
+/* 
+ 请求成功
+ */
+var RET0000 = func() Trans { return GetTransMap("RET0000") }
+// RET1000 :
+/* 
+ 目录路径不存在
+ */
+var RET1000 = func() Trans { return GetTransMap("RET1000") }
+// RET1001 :
+/* 
+ 目录路径为空
+ */
+var RET1001 = func() Trans { return GetTransMap("RET1001") }
+// RET1002 :
+/* 
+ 参数 %s 无效
+ */
+var RET1002 = func() Trans { return GetTransMap("RET1002") }
+// RET1003 :
+/* 
+ 请求过于频繁，请稍后再试
+ */
+var RET1003 = func() Trans { return GetTransMap("RET1003") }
+// RET1004 :
+/* 
+ 请求体过大
+ */
+var RET1004 = func() Trans { return GetTransMap("RET1004") }
+// RET1005 :
+/* 
+ 数据库操作失败
+ */
+var RET1005 = func() Trans { return GetTransMap("RET1005") }
+// RET1006 :
+/* 
+ 未找到 %s
+ */
+var RET1006 = func() Trans { return GetTransMap("RET1006") }
+// RET1007 :
+/* 
+ 没有访问权限
+ */
+var RET1007 = func() Trans { return GetTransMap("RET1007") }
+// RET1008 :
+/* 
+ 任务 %s 正在执行
+ */
+var RET1008 = func() Trans { return GetTransMap("RET1008") }
+// RET2000 :
+/* 
+ 卸载路径 %s 上的磁盘失败，可以先在终端中手动卸载
+ */
+var RET2000 = func() Trans { return GetTransMap("RET2000") }
+// RET2001 :
+/* 
+ 未找到磁盘 %s
+ */
+var RET2001 = func() Trans { return GetTransMap("RET2001") }
+// RET2002 :
+/* 
+ 查询主机磁盘失败
+ */
+var RET2002 = func() Trans { return GetTransMap("RET2002") }
+// RET2003 :
+/* 
+ 系统盘 %s 不能格式化
+ */
+var RET2003 = func() Trans { return GetTransMap("RET2003") }
+// RET2004 :
+/* 
+ 磁盘 %s 不是空盘
+ */
+var RET2004 = func() Trans { return GetTransMap("RET2004") }
+// RET2005 :
+/* 
+ 格式化磁盘 %s 失败
+ */
+var RET2005 = func() Trans { return GetTransMap("RET2005") }
+// RET2006 :
+/* 
+ 磁盘 %s 存在多条挂载点记录
+ */
+var RET2006 = func() Trans { return GetTransMap("RET2006") }
+// RET3000 :
+/* 
+ 用户名或密码错误
+ */
+var RET3000 = func() Trans { return GetTransMap("RET3000") }
+// RET3001 :
+/* 
+ 登录失败次数过多，请稍后再试
+ */
+var RET3001 = func() Trans { return GetTransMap("RET3001") }
+// RET3002 :
+/* 
+ 二次验证码无效
+ */
+var RET3002 = func() Trans { return GetTransMap("RET3002") }
+// RET3003 :
+/* 
+ 二次验证已过期，请重新登录
+ */
+var RET3003 = func() Trans { return GetTransMap("RET3003") }
+// RET3004 :
+/* 
+ 已开启二次验证
+ */
+var RET3004 = func() Trans { return GetTransMap("RET3004") }
+// RET3005 :
+/* 
+ 未开启二次验证
+ */
+var RET3005 = func() Trans { return GetTransMap("RET3005") }
+// RET3006 :
+/* 
+ 会话无效，请重新登录
+ */
+var RET3006 = func() Trans { return GetTransMap("RET3006") }
+// RET3007 :
+/* 
+ 使用API token认证时不允许该操作
+ */
+var RET3007 = func() Trans { return GetTransMap("RET3007") }
+// RET4000 :
+/* 
+ 未找到Samba共享
+ */
+var RET4000 = func() Trans { return GetTransMap("RET4000") }
+// RET4001 :
+/* 
+ 未找到Samba用户
+ */
+var RET4001 = func() Trans { return GetTransMap("RET4001") }
+// RET4002 :
+/* 
+ 检查主机 %s 的Samba服务失败
+ */
+var RET4002 = func() Trans { return GetTransMap("RET4002") }
+// RET4003 :
+/* 
+ 在主机 %s 上安装Samba服务失败
+ */
+var RET4003 = func() Trans { return GetTransMap("RET4003") }
+// RET5000 :
+/* 
+ 未找到NFS共享
+ */
+var RET5000 = func() Trans { return GetTransMap("RET5000") }
+// RET5001 :
+/* 
+ 检查主机 %s 的NFS服务失败
+ */
+var RET5001 = func() Trans { return GetTransMap("RET5001") }
+// RET5002 :
+/* 
+ 在主机 %s 上安装NFS服务失败
+ */
+var RET5002 = func() Trans { return GetTransMap("RET5002") }
+// RET5003 :
+/* 
+ 控制主机 %s 的NFS服务失败
+ */
+var RET5003 = func() Trans { return GetTransMap("RET5003") }
+// RET6000 :
+/* 
+ 操作文件 %s 失败
+ */
+var RET6000 = func() Trans { return GetTransMap("RET6000") }
+// RET6001 :
+/* 
+ 文件 %s 已存在
+ */
+var RET6001 = func() Trans { return GetTransMap("RET6001") }
+// RET6002 :
+/* 
+ 没有 %s 的访问权限
+ */
+var RET6002 = func() Trans { return GetTransMap("RET6002") }
+// RET6003 :
+/* 
+ 上传请求无效
+ */
+var RET6003 = func() Trans { return GetTransMap("RET6003") }
+// RET7000 :
+/* 
+ 未找到主机 %s
+ */
+var RET7000 = func() Trans { return GetTransMap("RET7000") }
+// RET7001 :
+/* 
+ 监控指标不可用
+ */
+var RET7001 = func() Trans { return GetTransMap("RET7001") }
+// RET7002 :
+/* 
+ 证书或私钥无效
+ */
+var RET7002 = func() Trans { return GetTransMap("RET7002") }
+// RET7003 :
+/* 
+ 未开启https
+ */
+var RET7003 = func() Trans { return GetTransMap("RET7003") }
+// RET7004 :
+/* 
+ 读取主机的ssh配置失败
+ */
+var RET7004 = func() Trans { return GetTransMap("RET7004") }
+// RET7005 :
+/* 
+ 配置备份文件无效或已损坏
+ */
+var RET7005 = func() Trans { return GetTransMap("RET7005") }
+// RET7006 :
+/* 
+ 配置备份文件的密码错误
+ */
+var RET7006 = func() Trans { return GetTransMap("RET7006") }
+// RET7007 :
+/* 
+ 配置备份文件由更新的版本创建
+ */
+var RET7007 = func() Trans { return GetTransMap("RET7007") }
+// RET9999 :
+/* 
+ 请求失败
+ */
+var RET9999 = func() Trans { return GetTransMap("RET9999") }
+// VAL0000 :
+/* 
+ %s 为必填项
+ */
+var VAL0000 = func() Trans { return GetTransMap("VAL0000") }
+// VAL0001 :
+/* 
+ %s 必须是 [%s] 中的一个
+ */
+var VAL0001 = func() Trans { return GetTransMap("VAL0001") }
+// VAL0002 :
+/* 
+ %s 不能小于 %s
+ */
+var VAL0002 = func() Trans { return GetTransMap("VAL0002") }
+// VAL0003 :
+/* 
+ %s 不能大于 %s
+ */
+var VAL0003 = func() Trans { return GetTransMap("VAL0003") }
+// VAL0004 :
+/* 
+ %s 的长度不能小于 %s
+ */
+var VAL0004 = func() Trans { return GetTransMap("VAL0004") }
+// VAL0005 :
+/* 
+ %s 的长度不能大于 %s
+ */
+var VAL0005 = func() Trans { return GetTransMap("VAL0005") }
+// VAL0006 :
+/* 
+ %s 的长度必须为 %s
+ */
+var VAL0006 = func() Trans { return GetTransMap("VAL0006") }
+// VAL0007 :
+/* 
+ %s 必须以 %s 开头
+ */
+var VAL0007 = func() Trans { return GetTransMap("VAL0007") }
+// VAL0008 :
+/* 
+ %s 的类型必须是 %s
+ */
+var VAL0008 = func() Trans { return GetTransMap("VAL0008") }
+// VAL0009 :
+/* 
+ 请求体不是合法的JSON: %s
+ */
+var VAL0009 = func() Trans { return GetTransMap("VAL0009") }
+// VAL0010 :
+/* 
+ %s 不满足校验规则 %s
+ */
+var VAL0010 = func() Trans { return GetTransMap("VAL0010") }
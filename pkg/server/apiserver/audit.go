@@ -0,0 +1,172 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// 审计日志中请求体的最大长度，超出部分截断
+	auditBodyLimit = 4096
+	// 单个字符串参数的最大长度，证书等较长的内容只记录长度
+	auditValueLimit = 256
+
+	auditMask = "******"
+)
+
+// AuditEntry 一次需要审计的接口调用
+type AuditEntry struct {
+	// 请求的会话，登录接口为登录成功后创建的会话，未认证时为nil
+	Session    *Session
+	ClientIP   string
+	UserAgent  string
+	Route      string
+	Query      string
+	Body       string
+	HTTPStatus int
+	// 响应中的 retcode，没有响应体时为 -1
+	Code     int
+	Duration time.Duration
+	Time     time.Time
+}
+
+// AuditRecorder 保存审计日志
+type AuditRecorder interface {
+	Record(entry *AuditEntry) error
+}
+
+// statusRecorder 记录响应的http状态码
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(bs []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(bs)
+}
+
+// readAuditBody 读取请求体用于审计，并重新设置请求体供处理函数读取，
+// 文件上传等非json请求只记录类型
+func readAuditBody(r *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "multipart/") {
+		return "[" + mediaType + "]"
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		// 处理函数读取时返回同样的错误，例如超出请求体大小上限
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), &errReader{err: err}))
+		return fmt.Sprintf("[read body failed: %v]", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return SanitizeAuditBody(body)
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// SanitizeAuditBody 隐藏请求体中的密码、token等敏感参数，并截断过长的内容
+func SanitizeAuditBody(body []byte) string {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return ""
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("[invalid json, %d bytes]", len(body))
+	}
+	bs, err := json.Marshal(sanitizeAuditValue(v))
+	if err != nil {
+		return fmt.Sprintf("[%d bytes]", len(body))
+	}
+	if len(bs) > auditBodyLimit {
+		return string(bs[:auditBodyLimit]) + "...(truncated)"
+	}
+	return string(bs)
+}
+
+func sanitizeAuditValue(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			if isSensitiveParam(k) {
+				val[k] = auditMask
+			} else {
+				val[k] = sanitizeAuditValue(item)
+			}
+		}
+		return val
+	case []any:
+		for i, item := range val {
+			val[i] = sanitizeAuditValue(item)
+		}
+		return val
+	case string:
+		if len(val) > auditValueLimit {
+			return fmt.Sprintf("[%d bytes]", len(val))
+		}
+	}
+	return v
+}
+
+// isSensitiveParam 判断参数名是否为密码、密钥、token或验证码
+func isSensitiveParam(name string) bool {
+	n := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+	switch n {
+	case "pwd", "passwd", "code", "recoverycodes":
+		return true
+	}
+	for _, s := range []string{"password", "passphrase", "secret", "token", "privatekey"} {
+		if strings.Contains(n, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordAudit 在响应完成后保存审计日志，保存失败不影响请求
+func (h *Route) recordAudit(w *statusRecorder, r *http.Request, req *Request, resp *Response, body string, start time.Time) {
+	entry := &AuditEntry{
+		Session:    req.Session,
+		UserAgent:  r.UserAgent(),
+		Route:      h.GetPath(),
+		Query:      r.URL.RawQuery,
+		Body:       body,
+		HTTPStatus: w.status,
+		Code:       -1,
+		Duration:   time.Since(start),
+		Time:       start,
+	}
+	if ip := req.ClientIP(); ip != nil {
+		entry.ClientIP = ip.String()
+	}
+	if resp.cookie != nil {
+		entry.Session = resp.cookie
+	}
+	if rc, ok := resp.fields.(*retcode.RetCode); ok {
+		entry.Code = rc.Code
+	}
+	if err := h.auditRecorder.Record(entry); err != nil {
+		flog.Errorf("save audit log of %s failed, %v", entry.Route, err)
+	}
+}
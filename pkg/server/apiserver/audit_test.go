@@ -0,0 +1,84 @@
+package apiserver
+
+import (
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testAuditRecorder struct {
+	entries []*AuditEntry
+}
+
+func (r *testAuditRecorder) Record(entry *AuditEntry) error {
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func TestSanitizeAuditBody(t *testing.T) {
+	body := `{"Username":"root","Password":"secret","mfa_token":"abc","code":"123456","Passphrase":"hunter2",
+		"Share":{"Users":[{"Name":"a","password":"b"}]},"Cert":"` + strings.Repeat("x", auditValueLimit+1) + `"}`
+	got := SanitizeAuditBody([]byte(body))
+	for _, secret := range []string{`"secret"`, `"abc"`, `"123456"`, `"hunter2"`, `"b"`, "xxx"} {
+		if strings.Contains(got, secret) {
+			t.Fatalf("%s not hidden in %s", secret, got)
+		}
+	}
+	if !strings.Contains(got, `"Username":"root"`) || !strings.Contains(got, `"Name":"a"`) {
+		t.Fatalf("normal params should be kept, got %s", got)
+	}
+	if got := SanitizeAuditBody([]byte("not json")); got != "[invalid json, 8 bytes]" {
+		t.Fatalf("unexpected result %s", got)
+	}
+}
+
+func TestRouteAudit(t *testing.T) {
+	flog.NewLogger(0)
+	recorder := &testAuditRecorder{}
+	as := NewApiserver(nil, ":0")
+	as.SetAuditRecorder(recorder)
+
+	var handled string
+	handler := func(w *Response, r *Request) {
+		in := map[string]string{}
+		if err := r.Unmarshal(&in); err != nil {
+			w.WriteParamError(err)
+			return
+		}
+		handled = in["Path"]
+		w.Write(retcode.StatusOK(nil))
+	}
+	audited := as.NewRoute().Prefix("/v1").Path("/files/remove").Handler(handler).AllowAnonymous(true).Audit()
+	as.Register(audited)
+	as.Register(as.NewRoute().Prefix("/v1").Path("/files/listdir").Handler(handler).AllowAnonymous(true))
+	as.Register(as.NewRoute().Prefix("/v1").Path("/disk/mkfs").Handler(handler).Audit())
+
+	req := httptest.NewRequest("POST", "/v1/files/remove?force=1", strings.NewReader(`{"Path":"/mnt/a","Password":"x"}`))
+	audited.ServeHTTP(httptest.NewRecorder(), req)
+	if handled != "/mnt/a" {
+		t.Fatal("handler should read the request body after it was audited")
+	}
+	if len(recorder.entries) != 1 {
+		t.Fatalf("expect 1 audit entry, got %d", len(recorder.entries))
+	}
+	e := recorder.entries[0]
+	if e.Route != "/v1/files/remove" || e.Query != "force=1" || e.Code != retcode.RetOK || e.HTTPStatus != http.StatusOK {
+		t.Fatalf("unexpected audit entry %+v", e)
+	}
+	if strings.Contains(e.Body, `"x"`) {
+		t.Fatalf("password should be hidden, got %s", e.Body)
+	}
+
+	// 未审计的路由不记录，认证失败的请求也需要记录
+	as.routes[1].ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/files/listdir", nil))
+	as.routes[2].ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/disk/mkfs", nil))
+	if len(recorder.entries) != 2 {
+		t.Fatalf("expect 2 audit entries, got %d", len(recorder.entries))
+	}
+	if e := recorder.entries[1]; e.HTTPStatus != http.StatusUnauthorized || e.Code != -1 || e.Session != nil {
+		t.Fatalf("unexpected audit entry of unauthorized request %+v", e)
+	}
+}
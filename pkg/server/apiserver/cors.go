@@ -0,0 +1,80 @@
+package apiserver
+
+import (
+	"flutelake/fluteNAS/pkg/module/flog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// originPolicy 跨域请求的来源白名单，同源请求和没有 Origin 的请求总是允许
+type originPolicy struct {
+	allowed map[string]bool
+	// 开发模式允许所有来源，并且不检查CSRF token
+	devMode bool
+}
+
+// SetAllowedOrigins 设置允许跨域访问的来源，例如 https://nas.example.com，需要在注册路由之前调用
+func (a *Apiserver) SetAllowedOrigins(origins []string) {
+	a.origins.allowed = make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		a.origins.allowed[normalizeOrigin(origin)] = true
+	}
+}
+
+// SetDevMode 开发模式允许任意来源的跨域请求并关闭CSRF检查，只用于本地调试前端，需要在注册路由之前调用
+func (a *Apiserver) SetDevMode(dev bool) {
+	a.origins.devMode = dev
+	if dev {
+		flog.Warnf("dev mode enabled, cross origin requests are allowed from any origin and csrf tokens are not checked")
+	}
+}
+
+// CheckOrigin 检查请求的来源，用于 websocket 升级
+func (a *Apiserver) CheckOrigin(r *http.Request) bool {
+	return a.origins.check(r)
+}
+
+func (p *originPolicy) check(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || p.devMode || sameOrigin(r, origin) {
+		return true
+	}
+	return p.allowed[normalizeOrigin(origin)]
+}
+
+// sameOrigin 浏览器请求的 Origin 与请求的 Host 一致
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func normalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+}
+
+// handleCORS 拒绝不在白名单中的跨域请求并处理预检请求，返回false时请求已经处理完成
+func (h *Route) handleCORS(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if !h.origins.check(r) {
+		flog.Warnf("reject cross origin request from %s to %s", origin, h.GetPath())
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+	if origin != "" && !sameOrigin(r, origin) {
+		// 会话使用cookie认证，只能返回具体的来源而不是 *
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+CSRFHeaderName)
+		w.Header().Add("Vary", "Origin")
+	}
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package apiserver
+
+import (
+	"crypto/subtle"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/util"
+	"net/http"
+	"time"
+)
+
+const (
+	// CSRFCookieName 保存CSRF token的cookie，前端可以读取，axios 会自动放到请求头中
+	CSRFCookieName = "XSRF-TOKEN"
+	// CSRFHeaderName 使用cookie会话修改数据时需要携带的请求头
+	CSRFHeaderName = "X-XSRF-TOKEN"
+)
+
+// CSRFToken 由会话ID生成CSRF token，不需要额外保存，会话恢复后仍然有效
+func CSRFToken(sid string) string {
+	return util.SHA256Hex("xsrf:" + sid)
+}
+
+func setCSRFCookie(w http.ResponseWriter, sid string, secure bool, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    CSRFToken(sid),
+		Path:     "/",
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+		Expires:  expires,
+	})
+}
+
+// checkCSRF 使用cookie会话的非GET请求需要在请求头中携带与会话绑定的CSRF token，
+// 使用 Authorization: Bearer 认证的请求不受跨站请求影响，不需要检查
+func (h *Route) checkCSRF(w http.ResponseWriter, req *Request) bool {
+	if h.origins.devMode {
+		return true
+	}
+	switch req.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	if _, ok := req.BearerToken(); ok {
+		return true
+	}
+	cookie, err := req.GetCookie()
+	if err != nil {
+		return true
+	}
+	want := CSRFToken(cookie.Value)
+	got := req.Request.Header.Get(CSRFHeaderName)
+	if got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1 {
+		return true
+	}
+	flog.Warnf("reject request to %s with invalid csrf token", h.GetPath())
+	// 升级前创建的会话没有CSRF cookie，重新下发后前端可以重试
+	if req.Session != nil {
+		setCSRFCookie(w, cookie.Value, req.Request.TLS != nil, req.Session.ExpiresAt)
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package apiserver
+
+import (
+	"flutelake/fluteNAS/pkg/module/cache"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newCSRFTestRoute(t *testing.T, dev bool) (*Route, string) {
+	flog.NewLogger(0)
+	c := cache.NewMemoryCache()
+	as := NewApiserver(c, ":0")
+	as.SetAllowedOrigins([]string{"https://admin.example.com/"})
+	as.SetDevMode(dev)
+	route := as.NewRoute().Prefix("/v1").Path("/files/remove").Handler(func(w *Response, r *Request) {
+		w.Write(retcode.StatusOK(nil))
+	})
+	as.Register(route)
+
+	sid := "test-session-id"
+	c.SetExpired(GenSessionCacheID(sid), &Session{SessionID: sid, ExpiresAt: time.Now().Add(time.Hour)}, time.Hour)
+	return route, sid
+}
+
+func TestRouteOrigin(t *testing.T) {
+	route, sid := newCSRFTestRoute(t, false)
+	call := func(method, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://nas.local/v1/files/remove", nil)
+		req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: sid})
+		req.Header.Set(CSRFHeaderName, CSRFToken(sid))
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		route.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := call("POST", "http://nas.local"); w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("same origin request should be allowed without cors headers, got %d %v", w.Code, w.Header())
+	}
+	if w := call("POST", "https://evil.example.com"); w.Code != http.StatusForbidden {
+		t.Fatalf("unknown origin should be rejected, got %d", w.Code)
+	}
+	w := call("OPTIONS", "https://admin.example.com")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://admin.example.com" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("preflight from allowed origin should pass, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestRouteCSRF(t *testing.T) {
+	route, sid := newCSRFTestRoute(t, false)
+	call := func(token string, bearer bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/files/remove", nil)
+		req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: sid})
+		if token != "" {
+			req.Header.Set(CSRFHeaderName, token)
+		}
+		if bearer {
+			req.Header.Set("Authorization", "Bearer flt_test")
+		}
+		w := httptest.NewRecorder()
+		route.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call("", false)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("request without csrf token should be rejected, got %d", w.Code)
+	}
+	// 拒绝时重新下发 CSRF cookie
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != CSRFToken(sid) {
+		t.Fatalf("csrf cookie should be issued, got %v", cookies)
+	}
+	if w := call("wrong", false); w.Code != http.StatusForbidden {
+		t.Fatalf("request with wrong csrf token should be rejected, got %d", w.Code)
+	}
+	if w := call(CSRFToken(sid), false); w.Code != http.StatusOK {
+		t.Fatalf("request with csrf token should be allowed, got %d", w.Code)
+	}
+	// Bearer 认证不检查 CSRF，没有设置 token 认证时返回401
+	if w := call("", true); w.Code != http.StatusUnauthorized {
+		t.Fatalf("bearer request should skip csrf check, got %d", w.Code)
+	}
+
+	devRoute, sid := newCSRFTestRoute(t, true)
+	req := httptest.NewRequest("POST", "/v1/files/remove", nil)
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: sid})
+	req.Header.Set("Origin", "http://localhost:5173")
+	w = httptest.NewRecorder()
+	devRoute.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "http://localhost:5173" {
+		t.Fatalf("dev mode should allow any origin without csrf token, got %d %v", w.Code, w.Header())
+	}
+}
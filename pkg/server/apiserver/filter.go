@@ -1,12 +1,40 @@
 package apiserver
 
 import (
+	"errors"
 	"flutelake/fluteNAS/pkg/module/cache"
 	"net/http"
 )
 
-// auth
-func filterAuth(c cache.TinyCache, resp *Response, req *Request) int {
+var (
+	ErrTokenInvalid    = errors.New("token is invalid or expired")
+	ErrTokenOutOfScope = errors.New("route is out of token scopes")
+)
+
+// TokenAuthenticator 校验 Authorization: Bearer 请求头中的token
+type TokenAuthenticator interface {
+	// Authenticate 返回token对应的会话，token无效时返回 ErrTokenInvalid，
+	// 请求的路由不在token授权范围内时返回 ErrTokenOutOfScope
+	Authenticate(token string, path string) (*Session, error)
+}
+
+// auth，path 为检查token授权范围时使用的路由
+func filterAuth(c cache.TinyCache, tokenAuth TokenAuthenticator, path string, req *Request) int {
+	if token, ok := req.BearerToken(); ok {
+		if tokenAuth == nil {
+			return http.StatusUnauthorized
+		}
+		sess, err := tokenAuth.Authenticate(token, path)
+		if err != nil {
+			if errors.Is(err, ErrTokenOutOfScope) {
+				return http.StatusForbidden
+			}
+			return http.StatusUnauthorized
+		}
+		req.Session = sess
+		return http.StatusOK
+	}
+
 	cookie, err := req.GetCookie()
 	if err != nil {
 		// Cookie 不存在或读取失败
@@ -32,3 +60,11 @@ func filterAuth(c cache.TinyCache, resp *Response, req *Request) int {
 
 	return http.StatusOK
 }
+
+// Authenticate 校验不通过 Route 注册的接口的会话，例如websocket和事件流，
+// scope 为检查API token授权范围时使用的路由
+func (a *Apiserver) Authenticate(r *http.Request, scope string) (*Session, int) {
+	req := &Request{Request: r}
+	status := filterAuth(a.cache, a.tokenAuth, scope, req)
+	return req.Session, status
+}
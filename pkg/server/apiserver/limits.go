@@ -0,0 +1,118 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/ratelimit"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// RateClass 路由的限流分类，同一客户端在同一分类下的路由共享令牌桶
+type RateClass string
+
+const (
+	RateClassDefault RateClass = "default"
+	// 会执行外部命令等开销较大的接口
+	RateClassExpensive RateClass = "expensive"
+	// 登录等匿名接口，按客户端IP限流
+	RateClassLogin RateClass = "login"
+)
+
+var RateClasses = []RateClass{RateClassDefault, RateClassExpensive, RateClassLogin}
+
+const (
+	// DefaultMaxBodyBytes 默认的请求体大小上限
+	DefaultMaxBodyBytes int64 = 1 << 20
+	// NoBodyLimit 不限制请求体大小，用于上传文件
+	NoBodyLimit int64 = -1
+)
+
+// SetRateLimits 设置各个分类的限流速率，未设置的分类不限流，需要在注册路由之前调用
+func (a *Apiserver) SetRateLimits(limits map[RateClass]ratelimit.Limit) {
+	a.limiters = make(map[RateClass]*ratelimit.Limiter, len(limits))
+	for class, limit := range limits {
+		a.limiters[class] = ratelimit.NewLimiter(limit)
+	}
+}
+
+// SetTrustedProxies 设置可信的反向代理，来自这些地址的请求按 X-Forwarded-For 识别客户端IP，需要在注册路由之前调用
+func (a *Apiserver) SetTrustedProxies(proxies []*net.IPNet) {
+	a.trustedProxies = proxies
+}
+
+// SetMaxBodyBytes 设置请求体大小的默认上限，需要在注册路由之前调用
+func (a *Apiserver) SetMaxBodyBytes(n int64) {
+	a.maxBodyBytes = n
+}
+
+// allowRate 超出限流时写入429响应并返回false
+func (h *Route) allowRate(w http.ResponseWriter, req *Request) bool {
+	class := h.rateClass
+	if class == "" {
+		class = RateClassDefault
+	}
+	limiter, ok := h.limiters[class]
+	if !ok {
+		return true
+	}
+	key := rateLimitKey(req)
+	allowed, wait := limiter.Allow(key)
+	if allowed {
+		return true
+	}
+	flog.Warnf("rate limit of %s exceeded by %s on %s", class, key, h.GetPath())
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeRetCode(w, req, retcode.StatusTooManyRequests(map[string]int{"retry_after": retryAfter}))
+	return false
+}
+
+// limitBody 限制请求体大小，Content-Length 超出上限时写入413响应并返回false
+func (h *Route) limitBody(w http.ResponseWriter, req *Request) bool {
+	r := req.Request
+	limit := h.maxBodyBytes
+	if limit == 0 {
+		limit = h.defaultMaxBodyBytes
+	}
+	if limit <= 0 {
+		return true
+	}
+	if r.ContentLength > limit {
+		writeRetCode(w, req, retcode.StatusRequestTooLarge(map[string]int64{"limit": limit}))
+		return false
+	}
+	// 未设置 Content-Length 的请求在读取时限制
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	return true
+}
+
+// rateLimitKey 已认证的请求按会话或token限流，否则按客户端IP限流
+func rateLimitKey(req *Request) string {
+	if req.Session != nil {
+		if token, ok := req.BearerToken(); ok {
+			return "token:" + SessionHash(token)
+		}
+		if cookie, err := req.GetCookie(); err == nil {
+			return "session:" + SessionHash(cookie.Value)
+		}
+	}
+	if ip := req.ClientIP(); ip != nil {
+		return "ip:" + ip.String()
+	}
+	return "ip:" + req.Request.RemoteAddr
+}
+
+// writeRetCode 在调用处理函数之前拒绝请求时，直接写入返回码对应的状态码和响应
+func writeRetCode(w http.ResponseWriter, req *Request, rc *retcode.RetCode) {
+	bs, err := json.Marshal(rc.Localize(req.Locale()))
+	if err != nil {
+		flog.Errorf("marshal response body data failed, %v", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(rc.HTTPStatus())
+	w.Write(bs)
+}
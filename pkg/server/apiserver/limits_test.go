@@ -0,0 +1,149 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/ratelimit"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"flutelake/fluteNAS/pkg/util"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouteRateLimit(t *testing.T) {
+	flog.NewLogger(0)
+	as := NewApiserver(nil, ":0")
+	as.SetRateLimits(map[RateClass]ratelimit.Limit{
+		RateClassLogin: {Rate: 0.1, Burst: 2},
+	})
+	handler := func(w *Response, r *Request) {
+		w.Write(retcode.StatusOK(nil))
+	}
+	login := as.NewRoute().Prefix("/v1").Path("/login").Handler(handler).AllowAnonymous(true).RateLimit(RateClassLogin)
+	as.Register(login)
+	// 没有配置 default 分类时不限流
+	hello := as.NewRoute().Prefix("/v1").Path("/hello").Handler(handler).AllowAnonymous(true)
+	as.Register(hello)
+
+	call := func(route *Route, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", route.GetPath(), nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		route.ServeHTTP(w, req)
+		return w
+	}
+	for i := 0; i < 2; i++ {
+		if w := call(login, "10.0.0.1:1234"); w.Code != http.StatusOK {
+			t.Fatalf("request %d should be allowed, got %d", i, w.Code)
+		}
+	}
+	w := call(login, "10.0.0.1:1234")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expect 429 with Retry-After, got %d %v", w.Code, w.Header())
+	}
+	rc := retcode.RetCode{}
+	if err := json.Unmarshal(w.Body.Bytes(), &rc); err != nil || rc.Code != retcode.StatusTooManyRequests(nil).Code {
+		t.Fatalf("unexpected response %s", w.Body.String())
+	}
+	// 不同客户端和不同分类使用各自的令牌桶
+	if w := call(login, "10.0.0.2:1234"); w.Code != http.StatusOK {
+		t.Fatalf("other client should be allowed, got %d", w.Code)
+	}
+	for i := 0; i < 5; i++ {
+		if w := call(hello, "10.0.0.1:1234"); w.Code != http.StatusOK {
+			t.Fatalf("unlimited route should be allowed, got %d", w.Code)
+		}
+	}
+}
+
+func TestRouteMaxBodyBytes(t *testing.T) {
+	flog.NewLogger(0)
+	as := NewApiserver(nil, ":0")
+	as.SetMaxBodyBytes(16)
+	handler := func(w *Response, r *Request) {
+		in := map[string]string{}
+		if err := r.Unmarshal(&in); err != nil {
+			w.WriteParamError(err)
+			return
+		}
+		w.Write(retcode.StatusOK(nil))
+	}
+	limited := as.NewRoute().Prefix("/v1").Path("/files/mkdir").Handler(handler).AllowAnonymous(true)
+	as.Register(limited)
+	unlimited := as.NewRoute().Prefix("/v1").Path("/files/upload").Handler(handler).AllowAnonymous(true).MaxBodyBytes(NoBodyLimit)
+	as.Register(unlimited)
+
+	body := `{"Path":"` + strings.Repeat("a", 32) + `"}`
+	w := httptest.NewRecorder()
+	limited.ServeHTTP(w, httptest.NewRequest("POST", "/v1/files/mkdir", strings.NewReader(body)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expect 413, got %d", w.Code)
+	}
+
+	// 没有 Content-Length 时在读取请求体时限制
+	req := httptest.NewRequest("POST", "/v1/files/mkdir", strings.NewReader(body))
+	req.ContentLength = -1
+	w = httptest.NewRecorder()
+	limited.ServeHTTP(w, req)
+	rc := retcode.RetCode{}
+	if err := json.Unmarshal(w.Body.Bytes(), &rc); err != nil || rc.Code != retcode.StatusParamInvalid(nil).Code {
+		t.Fatalf("unexpected response %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	unlimited.ServeHTTP(w, httptest.NewRequest("POST", "/v1/files/upload", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unlimited route should accept the body, got %d", w.Code)
+	}
+}
+
+func TestRouteRateLimitClientIP(t *testing.T) {
+	flog.NewLogger(0)
+	as := NewApiserver(nil, ":0")
+	as.SetRateLimits(map[RateClass]ratelimit.Limit{
+		RateClassLogin: {Rate: 0.1, Burst: 2},
+	})
+	proxies, err := util.ParseNetworks([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	as.SetTrustedProxies(proxies)
+	login := as.NewRoute().Prefix("/v1").Path("/login").AllowAnonymous(true).RateLimit(RateClassLogin).Handler(func(w *Response, r *Request) {
+		w.Write(retcode.StatusOK(nil))
+	})
+	as.Register(login)
+
+	call := func(remoteAddr string, xff string) int {
+		req := httptest.NewRequest("POST", login.GetPath(), nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", xff)
+		req.Header.Set("X-Real-Ip", xff)
+		w := httptest.NewRecorder()
+		login.ServeHTTP(w, req)
+		return w.Code
+	}
+	// 不可信的客户端每次伪造不同的 X-Forwarded-For，仍然使用同一个令牌桶
+	for i, xff := range []string{"1.1.1.1", "2.2.2.2"} {
+		if code := call("10.0.0.1:1234", xff); code != http.StatusOK {
+			t.Fatalf("request %d should be allowed, got %d", i, code)
+		}
+	}
+	if code := call("10.0.0.1:1234", "3.3.3.3"); code != http.StatusTooManyRequests {
+		t.Fatalf("spoofed X-Forwarded-For should not bypass rate limit, got %d", code)
+	}
+
+	// 可信代理转发的请求按 X-Forwarded-For 中的客户端限流
+	for i := 0; i < 2; i++ {
+		if code := call("127.0.0.1:1234", "203.0.113.1"); code != http.StatusOK {
+			t.Fatalf("request %d via proxy should be allowed, got %d", i, code)
+		}
+	}
+	if code := call("127.0.0.1:1234", "203.0.113.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("client behind proxy should be limited, got %d", code)
+	}
+	if code := call("127.0.0.1:1234", "203.0.113.2"); code != http.StatusOK {
+		t.Fatalf("other client behind proxy should be allowed, got %d", code)
+	}
+}
@@ -2,45 +2,72 @@ package apiserver
 
 import (
 	"context"
+	"crypto/tls"
 	"embed"
 	"errors"
 	"flutelake/fluteNAS/pkg/module/cache"
 	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/ratelimit"
 	"flutelake/fluteNAS/pkg/util"
-	"fmt"
 	"io"
 	"io/fs"
 	"mime"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
 )
 
+// ShutdownTimeout 停止服务时等待处理中请求的最长时间
+const ShutdownTimeout = time.Second * 15
+
 type Apiserver struct {
 	DataPath string
 	// Routes   map[string]*Route
 	// Server   *http.Server
-	serveMux   *http.ServeMux
-	cache      cache.TinyCache
-	address    string
-	certKey    string
-	certPerm   string
-	frontendFS embed.FS
+	serveMux  *http.ServeMux
+	cache     cache.TinyCache
+	tokenAuth TokenAuthenticator
+	sessions  SessionStore
+	audit     AuditRecorder
+	locales   LocalePreference
+	limiters  map[RateClass]*ratelimit.Limiter
+	// 可信的反向代理，只有来自这些地址的请求才使用 X-Forwarded-For 中的客户端IP
+	trustedProxies []*net.IPNet
+	// 请求体大小的默认上限
+	maxBodyBytes int64
+	origins      originPolicy
+	onShutdown   []func()
+	// 停止服务时等待处理中请求的最长时间，默认 ShutdownTimeout
+	shutdownTimeout time.Duration
+	address         string
+	// 设置后使用https，每次握手时获取证书，替换证书不需要重启服务
+	getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	// 启用https时，在该地址上监听http请求并重定向到https
+	redirectAddress string
+	frontendFS      embed.FS
+
+	// 已注册的路由，用于生成接口文档
+	routes  []*Route
+	schemas map[reflect.Type]*Schema
 }
 
-func NewApiserver(c cache.TinyCache) *Apiserver {
+func NewApiserver(c cache.TinyCache, address string) *Apiserver {
 	return &Apiserver{
 		// Routes: make(map[string]*Route),
 		// Server: &http.Server{
 		// 	Addr: ":8088",
 		// },
-		serveMux: http.NewServeMux(),
-		cache:    c,
-		address:  ":8088",
-		certKey:  "",
-		certPerm: "",
+		serveMux:        http.NewServeMux(),
+		cache:           c,
+		address:         address,
+		maxBodyBytes:    DefaultMaxBodyBytes,
+		shutdownTimeout: ShutdownTimeout,
 	}
 }
 
@@ -55,7 +82,47 @@ func (a *Apiserver) Register(route *Route) {
 
 	flog.Infof("Register route: %s", route.GetPath())
 	route.cache = a.cache
+	route.tokenAuth = a.tokenAuth
+	route.sessionStore = a.sessions
+	route.auditRecorder = a.audit
+	route.localePref = a.locales
+	route.limiters = a.limiters
+	route.trustedProxies = a.trustedProxies
+	route.defaultMaxBodyBytes = a.maxBodyBytes
+	route.origins = a.origins
 	a.serveMux.Handle(route.GetPath(), route)
+	a.routes = append(a.routes, route)
+}
+
+// SetTokenAuthenticator 设置API token校验，需要在注册路由之前调用
+func (a *Apiserver) SetTokenAuthenticator(auth TokenAuthenticator) {
+	a.tokenAuth = auth
+}
+
+// SetSessionStore 设置会话的持久化存储，需要在注册路由之前调用
+func (a *Apiserver) SetSessionStore(store SessionStore) {
+	a.sessions = store
+}
+
+// RegisterOnShutdown 注册服务停止时调用的函数，用于关闭websocket、事件流等长连接，
+// 否则停止服务时需要等待这些连接超时
+func (a *Apiserver) RegisterOnShutdown(f func()) {
+	a.onShutdown = append(a.onShutdown, f)
+}
+
+// SetShutdownTimeout 设置停止服务时等待处理中请求的最长时间，超时后取消请求的上下文
+func (a *Apiserver) SetShutdownTimeout(d time.Duration) {
+	a.shutdownTimeout = d
+}
+
+// SetLocalePreference 设置用户的语言偏好，需要在注册路由之前调用
+func (a *Apiserver) SetLocalePreference(pref LocalePreference) {
+	a.locales = pref
+}
+
+// SetAuditRecorder 设置审计日志的存储，需要在注册路由之前调用
+func (a *Apiserver) SetAuditRecorder(recorder AuditRecorder) {
+	a.audit = recorder
 }
 
 func (s *Apiserver) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
@@ -63,14 +130,8 @@ func (s *Apiserver) HandleFunc(pattern string, handler func(http.ResponseWriter,
 	s.serveMux.HandleFunc(pattern, handler)
 }
 
+// Run 启动http(s)服务，ctx结束后停止接收新请求，并等待处理中的请求完成后返回
 func (s *Apiserver) Run(ctx context.Context) (err error) {
-	stopChan := ctx.Done()
-	go func() {
-		<-stopChan
-		fmt.Println("shutdown server...")
-		// _ = s.Server.Shutdown(context.Background())
-	}()
-
 	env := os.Getenv("ENV")
 	if env == "prod" {
 		// 生产环境由后端提供前端文件路由服务
@@ -121,16 +182,94 @@ func (s *Apiserver) Run(ctx context.Context) (err error) {
 		// develop for frontend route --------- end
 	}
 
-	flog.Infof("Starting server on %s", s.address)
-	if s.certKey != "" {
-		err = http.ListenAndServeTLS(s.address, s.certKey, s.certPerm, s.serveMux)
+	// 请求的上下文，等待请求结束超时后取消，正在执行的主机命令随之结束
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	server := &http.Server{
+		Addr:        s.address,
+		Handler:     s.serveMux,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+	for _, f := range s.onShutdown {
+		server.RegisterOnShutdown(f)
+	}
+	var redirect *http.Server
+	errCh := make(chan error, 1)
+	if s.getCertificate != nil {
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: s.getCertificate,
+		}
+		if s.redirectAddress != "" {
+			redirect = s.newHTTPRedirectServer()
+			go func() {
+				flog.Infof("Starting http redirect server on %s", s.redirectAddress)
+				if err := redirect.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					flog.Errorf("http redirect server stopped, %v", err)
+				}
+			}()
+		}
+		flog.Infof("Starting server on %s (https)", s.address)
+		go func() { errCh <- server.ListenAndServeTLS("", "") }()
 	} else {
-		err = http.ListenAndServe(s.address, s.serveMux)
+		flog.Infof("Starting server on %s", s.address)
+		go func() { errCh <- server.ListenAndServe() }()
+	}
+
+	select {
+	case err = <-errCh:
+		return err
+	case <-ctx.Done():
 	}
 
+	flog.Infof("Shutting down server, waiting for in-flight requests...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	if redirect != nil {
+		_ = redirect.Shutdown(shutdownCtx)
+	}
+	err = server.Shutdown(shutdownCtx)
+	cancelRequests()
+	if serveErr := <-errCh; serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) && err == nil {
+		err = serveErr
+	}
 	return err
 }
 
+// SetTLS 启用https，getCertificate 用于 tls.Config.GetCertificate
+func (s *Apiserver) SetTLS(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) {
+	s.getCertificate = getCertificate
+}
+
+// SetHTTPRedirect 启用https后，在address上把http请求重定向到https
+func (s *Apiserver) SetHTTPRedirect(address string) {
+	s.redirectAddress = address
+}
+
+func (s *Apiserver) newHTTPRedirectServer() *http.Server {
+	_, port, err := net.SplitHostPort(s.address)
+	if err != nil {
+		flog.Warnf("parse listen address %s failed, %v", s.address, err)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+	return &http.Server{
+		Addr:    s.redirectAddress,
+		Handler: handler,
+	}
+}
+
 func (s *Apiserver) SetFrontendFS(fs embed.FS) {
 	s.frontendFS = fs
 }
@@ -0,0 +1,127 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// startTestServer 在随机端口上启动服务，返回服务地址和 Run 的返回值
+func startTestServer(t *testing.T, as *Apiserver, ctx context.Context) (string, <-chan error) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	as.address = addr
+
+	done := make(chan error, 1)
+	go func() { done <- as.Run(ctx) }()
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return "http://" + addr, done
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("server on %s not started", addr)
+	return "", nil
+}
+
+func TestRunShutdown(t *testing.T) {
+	flog.NewLogger(0)
+	as := NewApiserver(nil, "")
+	as.SetShutdownTimeout(5 * time.Second)
+	// 模拟事件流等长连接，只有停止服务时注册的函数被调用后才结束
+	closed := make(chan struct{})
+	as.RegisterOnShutdown(func() { close(closed) })
+	started := make(chan struct{})
+	as.Register(as.NewRoute().Prefix("/v1").Path("/events").AllowAnonymous(true).Handler(func(w *Response, r *Request) {
+		close(started)
+		<-closed
+		w.Write(retcode.StatusOK(nil))
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	base, done := startTestServer(t, as, ctx)
+	go func() {
+		if resp, err := http.Get(base + "/v1/events"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	start := time.Now()
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expect nil error after in-flight requests finished, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run should return after ctx is canceled")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("shutdown hook should end the long-lived request, Run returned after %v", elapsed)
+	}
+	if _, err := http.Get(base + "/v1/events"); err == nil {
+		t.Fatal("server should not accept requests after shutdown")
+	}
+}
+
+func TestRunShutdownTimeout(t *testing.T) {
+	flog.NewLogger(0)
+	as := NewApiserver(nil, "")
+	as.SetShutdownTimeout(200 * time.Millisecond)
+	started := make(chan struct{})
+	canceled := make(chan bool, 1)
+	// 一直执行到请求的上下文被取消，模拟卡住的主机命令
+	as.Register(as.NewRoute().Prefix("/v1").Path("/slow").AllowAnonymous(true).Handler(func(w *Response, r *Request) {
+		close(started)
+		select {
+		case <-r.Context().Done():
+			canceled <- true
+		case <-time.After(10 * time.Second):
+			canceled <- false
+		}
+		w.Write(retcode.StatusOK(nil))
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	base, done := startTestServer(t, as, ctx)
+	go func() {
+		if resp, err := http.Get(base + "/v1/slow"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	start := time.Now()
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expect shutdown timeout, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run should return after shutdown timeout")
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("expect Run to wait for the shutdown timeout, returned after %v", elapsed)
+	}
+	select {
+	case ok := <-canceled:
+		if !ok {
+			t.Fatal("request context should be canceled after shutdown timeout")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("in-flight request should be canceled after shutdown timeout")
+	}
+}
@@ -0,0 +1,517 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"flutelake/fluteNAS/pkg/version"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OpenAPIVersion = "3.0.3"
+
+	contentTypeJSON      = "application/json"
+	contentTypeMultipart = "multipart/form-data"
+
+	securityCookie = "cookieAuth"
+	securityBearer = "bearerAuth"
+)
+
+// OpenAPIDocument OpenAPI 3 文档，只包含生成接口文档需要的字段
+type OpenAPIDocument struct {
+	OpenAPI    string                      `json:"openapi"`
+	Info       OpenAPIInfo                 `json:"info"`
+	Paths      map[string]*OpenAPIPathItem `json:"paths"`
+	Components OpenAPIComponents           `json:"components"`
+	Security   []map[string][]string       `json:"security,omitempty"`
+	Tags       []OpenAPITag                `json:"tags,omitempty"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type OpenAPITag struct {
+	Name string `json:"name"`
+}
+
+type OpenAPIPathItem struct {
+	Post *OpenAPIOperation `json:"post,omitempty"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []OpenAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+	// 为空数组时表示不需要认证，为nil时使用文档全局的认证方式
+	Security *[]map[string][]string `json:"security,omitempty"`
+	// 路由需要的权限
+	Permission string `json:"x-permission,omitempty"`
+	// 调用是否记录审计日志
+	Audit bool `json:"x-audit,omitempty"`
+}
+
+type OpenAPIParameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required,omitempty"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type OpenAPIComponents struct {
+	Schemas         map[string]*Schema                `json:"schemas"`
+	SecuritySchemes map[string]*OpenAPISecurityScheme `json:"securitySchemes"`
+}
+
+type OpenAPISecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Schema JSON Schema，字段取值参考 OpenAPI 3.0
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+}
+
+// SetSchema 为自定义了json序列化的类型指定文档中的结构，需要在生成文档之前调用
+func (a *Apiserver) SetSchema(v any, schema *Schema) {
+	if a.schemas == nil {
+		a.schemas = map[reflect.Type]*Schema{}
+	}
+	a.schemas[reflect.TypeOf(v)] = schema
+}
+
+// OpenAPI 根据已注册的路由生成接口文档
+func (a *Apiserver) OpenAPI(info OpenAPIInfo) *OpenAPIDocument {
+	gen := newSchemaGenerator(a.schemas)
+	doc := &OpenAPIDocument{
+		OpenAPI: OpenAPIVersion,
+		Info:    info,
+		Paths:   map[string]*OpenAPIPathItem{},
+		Components: OpenAPIComponents{
+			Schemas: gen.components,
+			SecuritySchemes: map[string]*OpenAPISecurityScheme{
+				securityCookie: {
+					Type:        "apiKey",
+					In:          "cookie",
+					Name:        SessionCookieName,
+					Description: "登录后返回的会话cookie，POST等请求需要在 " + CSRFHeaderName + " 请求头中携带 " + CSRFCookieName + " cookie的值",
+				},
+				securityBearer: {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "API token，通过 /v1/token/create 创建",
+				},
+			},
+		},
+		Security: []map[string][]string{
+			{securityCookie: {}},
+			{securityBearer: {}},
+		},
+	}
+
+	envelope := gen.schema(reflect.TypeOf(retcode.RetCode{}))
+	tags := map[string]bool{}
+	for _, route := range a.routes {
+		op := route.operation(gen, envelope)
+		for _, tag := range op.Tags {
+			tags[tag] = true
+		}
+		doc.Paths[route.GetPath()] = &OpenAPIPathItem{Post: op}
+	}
+
+	for tag := range tags {
+		doc.Tags = append(doc.Tags, OpenAPITag{Name: tag})
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool { return doc.Tags[i].Name < doc.Tags[j].Name })
+	return doc
+}
+
+// ServeOpenAPI 返回json格式的接口文档
+func (a *Apiserver) ServeOpenAPI(w http.ResponseWriter, r *http.Request) {
+	doc := a.OpenAPI(OpenAPIInfo{
+		Title:       "fluteNAS API",
+		Description: "所有接口均使用POST方法，响应统一包装在 RetCode 中，code为0表示成功，失败时HTTP状态码与code对应",
+		Version:     version.Get().Version,
+	})
+	w.Header().Set("Content-Type", contentTypeJSON)
+	if err := json.NewEncoder(w).Encode(doc); err != nil {
+		flog.Errorf("write openapi document failed, %v", err)
+	}
+}
+
+var (
+	operationIDSeparator = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+	versionPrefix        = regexp.MustCompile(`^v[0-9]+$`)
+)
+
+func (h *Route) operation(gen *schemaGenerator, envelope *Schema) *OpenAPIOperation {
+	op := &OpenAPIOperation{
+		OperationID: operationID(h.GetPath()),
+		Summary:     h.summary,
+		Permission:  h.permissionRequired,
+		Audit:       h.audit,
+		Responses: map[string]*OpenAPIResponse{
+			"200": {
+				Description: "请求完成，业务结果见code",
+				Content: map[string]*OpenAPIMediaType{
+					contentTypeJSON: {Schema: responseSchema(gen, envelope, h.out)},
+				},
+			},
+			"401": {Description: "未登录或会话已过期"},
+			"default": {
+				Description: "请求失败，HTTP状态码由返回码决定，返回码见 retcode 目录",
+				Content: map[string]*OpenAPIMediaType{
+					contentTypeJSON: {Schema: envelope},
+				},
+			},
+		},
+	}
+	if tag := strings.Split(strings.TrimPrefix(h.path, "/"), "/")[0]; tag != "" {
+		op.Tags = []string{tag}
+	}
+	if h.allowAnonymous {
+		op.Security = &[]map[string][]string{}
+	}
+	if h.permissionRequired != "" {
+		op.Description = "需要权限: " + h.permissionRequired
+		op.Responses["403"] = &OpenAPIResponse{Description: "没有访问权限"}
+	}
+	for _, q := range h.queries {
+		op.Parameters = append(op.Parameters, OpenAPIParameter{
+			Name:        q.name,
+			In:          "query",
+			Description: q.doc,
+			Schema:      &Schema{Type: "string"},
+		})
+	}
+
+	switch {
+	case h.consumes == contentTypeMultipart:
+		op.RequestBody = &OpenAPIRequestBody{
+			Required: true,
+			Content: map[string]*OpenAPIMediaType{
+				contentTypeMultipart: {Schema: &Schema{
+					Type: "object",
+					AdditionalProperties: &Schema{
+						Type:   "string",
+						Format: "binary",
+					},
+				}},
+			},
+		}
+	case h.in != nil:
+		op.RequestBody = &OpenAPIRequestBody{
+			Required: true,
+			Content: map[string]*OpenAPIMediaType{
+				contentTypeJSON: {Schema: gen.schema(h.in)},
+			},
+		}
+	}
+	return op
+}
+
+// responseSchema 把响应数据的结构放到 RetCode 的data字段中
+func responseSchema(gen *schemaGenerator, envelope *Schema, out reflect.Type) *Schema {
+	if out == nil {
+		return envelope
+	}
+	return &Schema{
+		AllOf: []*Schema{
+			envelope,
+			{
+				Type: "object",
+				Properties: map[string]*Schema{
+					"data": gen.schema(out),
+				},
+			},
+		},
+	}
+}
+
+// operationID 由路由路径生成，例如 /v1/disk/set-mountpoint 生成 diskSetMountpoint
+func operationID(p string) string {
+	parts := operationIDSeparator.Split(path.Clean(p), -1)
+	id := ""
+	for _, part := range parts {
+		// 跳过版本前缀
+		if part == "" || (id == "" && versionPrefix.MatchString(part)) {
+			continue
+		}
+		if id == "" {
+			id = part
+		} else {
+			id += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return id
+}
+
+// schemaGenerator 通过反射生成结构体的 Schema，具名结构体放到 components 中引用
+type schemaGenerator struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+	overrides  map[reflect.Type]*Schema
+}
+
+func newSchemaGenerator(overrides map[reflect.Type]*Schema) *schemaGenerator {
+	return &schemaGenerator{
+		components: map[string]*Schema{},
+		names:      map[reflect.Type]string{},
+		overrides:  overrides,
+	}
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+func (g *schemaGenerator) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if s, ok := g.overrides[t]; ok {
+		return s
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawType:
+		return &Schema{}
+	case t.PkgPath() == "gorm.io/gorm" && t.Name() == "DeletedAt":
+		return &Schema{Type: "string", Format: "date-time", Nullable: true}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte 序列化为base64字符串
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + g.componentName(t)}
+	}
+	// interface{} 等无法确定结构的类型
+	return &Schema{}
+}
+
+// componentName 返回具名结构体在 components 中的名称，首次引用时生成结构
+func (g *schemaGenerator) componentName(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := operationIDSeparator.ReplaceAllString(t.Name(), "_")
+	if _, taken := g.components[name]; taken {
+		// 不同包中的同名结构体，加上包名区分
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+	g.names[t] = name
+	// 先占位，避免递归引用时无限循环
+	g.components[name] = &Schema{}
+	*g.components[name] = *g.structSchema(t)
+	return name
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.addFields(s, t)
+	return s
+}
+
+// addFields 添加结构体的字段，匿名嵌入的结构体字段展开，外层字段优先
+func (g *schemaGenerator) addFields(s *Schema, t reflect.Type) {
+	embedded := []reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			embedded = append(embedded, ft)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if _, ok := s.Properties[name]; ok {
+			continue
+		}
+
+		fs := g.schema(f.Type)
+		if doc := f.Tag.Get("doc"); doc != "" || f.Tag.Get("validate") != "" {
+			// 引用类型不能直接添加描述和约束，使用allOf包装
+			if fs.Ref != "" {
+				fs = &Schema{AllOf: []*Schema{fs}}
+			} else {
+				copied := *fs
+				fs = &copied
+			}
+			fs.Description = strings.TrimSpace(doc)
+			if applyValidateTag(fs, ft.Kind(), f.Tag.Get("validate")) {
+				s.Required = append(s.Required, name)
+			}
+		}
+		s.Properties[name] = fs
+	}
+	for _, et := range embedded {
+		g.addFields(s, et)
+	}
+}
+
+// applyValidateTag 把常用的 validator 规则转换为 Schema 约束，返回字段是否必填
+func applyValidateTag(s *Schema, kind reflect.Kind, tag string) (required bool) {
+	if tag == "" {
+		return false
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "dive":
+			// 之后的规则作用于数组元素
+			return required
+		case "oneof":
+			for _, v := range strings.Fields(param) {
+				s.Enum = append(s.Enum, enumValue(kind, v))
+			}
+		case "min", "gte":
+			setLowerBound(s, kind, param)
+		case "max", "lte":
+			setUpperBound(s, kind, param)
+		case "len":
+			setLowerBound(s, kind, param)
+			setUpperBound(s, kind, param)
+		case "startswith":
+			s.Pattern = "^" + regexp.QuoteMeta(param)
+		case "email":
+			s.Format = "email"
+		}
+	}
+	return required
+}
+
+func enumValue(kind reflect.Kind, v string) any {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	}
+	return v
+}
+
+func setLowerBound(s *Schema, kind reflect.Kind, param string) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+	switch kind {
+	case reflect.String:
+		l := int(n)
+		s.MinLength = &l
+	case reflect.Slice, reflect.Array:
+		l := int(n)
+		s.MinItems = &l
+	case reflect.Map:
+	default:
+		s.Minimum = &n
+	}
+}
+
+func setUpperBound(s *Schema, kind reflect.Kind, param string) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+	switch kind {
+	case reflect.String:
+		l := int(n)
+		s.MaxLength = &l
+	case reflect.Slice, reflect.Array:
+		l := int(n)
+		s.MaxItems = &l
+	case reflect.Map:
+	default:
+		s.Maximum = &n
+	}
+}
@@ -0,0 +1,93 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"testing"
+	"time"
+)
+
+type testMount struct {
+	Device string `json:"Device" doc:"设备名" validate:"required"`
+	Action string `json:"Action" validate:"required,oneof=mount umount"`
+	Port   int    `json:"Port" validate:"gte=1,lte=65535"`
+	Parent *testMount
+	Tags   []string `json:"Tags" validate:"dive,startswith=/v1/"`
+	hidden string
+}
+
+type testRecord struct {
+	ID        uint      `json:"ID"`
+	CreatedAt time.Time `json:"CreatedAt"`
+}
+
+type testResult struct {
+	testRecord
+	ID    string      `json:"ID"`
+	Items []testMount `json:"Items"`
+	Skip  string      `json:"-"`
+}
+
+func TestOpenAPI(t *testing.T) {
+	flog.NewLogger(0)
+	as := NewApiserver(nil, ":0")
+	noop := func(*Response, *Request) {}
+	as.Register(as.NewRoute().Prefix("/v1").Path("/disk/set-mountpoint").Handler(noop).In(testMount{}).Out(testResult{}).Permission("disk:write"))
+	as.Register(as.NewRoute().Prefix("/v1").Path("/key").Handler(noop).AllowAnonymous(true))
+
+	doc := as.OpenAPI(OpenAPIInfo{Title: "test", Version: "v1"})
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	op := doc.Paths["/v1/disk/set-mountpoint"].Post
+	if op.OperationID != "diskSetMountpoint" || op.Permission != "disk:write" || op.Security != nil {
+		t.Fatalf("unexpected operation: %+v", op)
+	}
+	if anon := doc.Paths["/v1/key"].Post; anon.Security == nil || len(*anon.Security) != 0 {
+		t.Fatal("anonymous route should not require authentication")
+	}
+
+	in := doc.Components.Schemas["testMount"]
+	if in == nil {
+		t.Fatalf("request schema not in components: %v", doc.Components.Schemas)
+	}
+	if len(in.Required) != 2 || in.Required[0] != "Device" || in.Required[1] != "Action" {
+		t.Fatalf("unexpected required fields %v", in.Required)
+	}
+	if in.Properties["Device"].Description != "设备名" {
+		t.Fatal("doc tag should be used as description")
+	}
+	if enum := in.Properties["Action"].Enum; len(enum) != 2 || enum[0] != "mount" {
+		t.Fatalf("unexpected enum %v", enum)
+	}
+	if p := in.Properties["Port"]; *p.Minimum != 1 || *p.Maximum != 65535 {
+		t.Fatalf("unexpected bounds %v %v", *p.Minimum, *p.Maximum)
+	}
+	if in.Properties["Parent"].Ref != "#/components/schemas/testMount" {
+		t.Fatal("recursive struct should be referenced")
+	}
+	if _, ok := in.Properties["hidden"]; ok {
+		t.Fatal("unexported field should be skipped")
+	}
+	if in.Properties["Tags"].Pattern != "" {
+		t.Fatal("rules after dive apply to elements")
+	}
+
+	out := doc.Components.Schemas["testResult"]
+	if out.Properties["ID"].Type != "string" {
+		t.Fatal("outer field should take precedence over embedded field")
+	}
+	if out.Properties["CreatedAt"].Format != "date-time" {
+		t.Fatal("embedded struct fields should be flattened")
+	}
+	if _, ok := out.Properties["Skip"]; ok {
+		t.Fatal(`json:"-" field should be skipped`)
+	}
+
+	resp := op.Responses["200"].Content[contentTypeJSON].Schema
+	if len(resp.AllOf) != 2 || resp.AllOf[0].Ref != "#/components/schemas/RetCode" ||
+		resp.AllOf[1].Properties["data"].Ref != "#/components/schemas/testResult" {
+		t.Fatal("response data should be wrapped in RetCode")
+	}
+}
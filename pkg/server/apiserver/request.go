@@ -1,12 +1,18 @@
 package apiserver
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"flutelake/fluteNAS/pkg/module/trans"
 	"flutelake/fluteNAS/pkg/util"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"reflect"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -14,35 +20,84 @@ import (
 type Request struct {
 	Request *http.Request
 	Session *Session
+
+	localePref     LocalePreference
+	trustedProxies []*net.IPNet
 }
 
+// Unmarshal 解析json请求体并按 validate 标签校验参数，参数错误时返回 *ParamError，
+// 错误信息使用请求的语言。请求体为空时按 {} 处理，仍然会校验必填参数
 func (r *Request) Unmarshal(v any) error {
 	body, err := io.ReadAll(r.Request.Body)
 	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return newBodyTooLargeError(maxErr.Limit, r.Locale())
+		}
 		return err
 	}
 
-	err = json.Unmarshal(body, v)
-	if err != nil {
-		return err
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, v); err != nil {
+			return newDecodeError(err, r.Locale())
+		}
+	}
+
+	// 只有结构体可以校验
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
 	}
 	err = util.Validator.Struct(v)
 	if err != nil {
 		var validationErrors validator.ValidationErrors
 		if errors.As(err, &validationErrors) {
-			for _, fieldError := range validationErrors {
-				return fmt.Errorf("request params validate failed on field '%s': %v", fieldError.Field(), fieldError)
-			}
+			return newValidationError(validationErrors, r.Locale())
 		}
 		return fmt.Errorf("request params validate failed, %v", err)
 	}
 	return nil
 }
 
+// Context 返回请求的上下文，客户端断开连接或服务关闭超时后取消，
+// 传给主机命令时命令随之结束
+func (r *Request) Context() context.Context {
+	return r.Request.Context()
+}
+
+// Locale 返回请求使用的语言，优先使用用户设置的语言，其次是 Accept-Language
+func (r *Request) Locale() trans.Locale {
+	if r.Session != nil && r.localePref != nil {
+		if locale, ok := r.localePref.PreferredLocale(r.Session); ok {
+			return locale
+		}
+	}
+	return trans.ParseAcceptLanguage(r.Request.Header.Get("Accept-Language"))
+}
+
+// ClientIP 返回客户端IP，只有来自可信代理的请求才使用 X-Forwarded-For 和 X-Real-Ip，
+// 否则使用连接的对端地址，客户端无法通过伪造请求头绕过按IP的限流和锁定
+func (r *Request) ClientIP() net.IP {
+	return util.ClientIP(r.Request, r.trustedProxies)
+}
+
 func (r *Request) GetCookie() (*http.Cookie, error) {
-	cookie, err := r.Request.Cookie("sid")
+	cookie, err := r.Request.Cookie(SessionCookieName)
 	if err != nil {
 		return nil, err
 	}
 	return cookie, nil
 }
+
+// BearerToken 获取 Authorization: Bearer 请求头中的token
+func (r *Request) BearerToken() (string, bool) {
+	auth := r.Request.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(auth[7:])
+	return token, token != ""
+}
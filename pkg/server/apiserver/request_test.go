@@ -0,0 +1,170 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"flutelake/fluteNAS/pkg/module/cache"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"flutelake/fluteNAS/pkg/module/trans"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testMkfsRequest struct {
+	Device string   `json:"Device" validate:"required"`
+	Fstype string   `json:"Fstype" validate:"required,oneof=ext4 xfs"`
+	Size   int      `json:"Size" validate:"gte=0"`
+	Scopes []string `json:"Scopes" validate:"dive,startswith=/v1/"`
+}
+
+func newTestRequest(body string, lang string) *Request {
+	r := httptest.NewRequest("POST", "/v1/disk/mkfs", strings.NewReader(body))
+	if lang != "" {
+		r.Header.Set("Accept-Language", lang)
+	}
+	return &Request{Request: r}
+}
+
+func TestUnmarshal(t *testing.T) {
+	in := &testMkfsRequest{}
+	if err := newTestRequest(`{"Device":"sdb","Fstype":"xfs"}`, "").Unmarshal(in); err != nil {
+		t.Fatal(err)
+	}
+	if in.Device != "sdb" {
+		t.Fatalf("unexpected device %q", in.Device)
+	}
+
+	// 空请求体按 {} 处理，必填参数仍然要校验
+	var pe *ParamError
+	err := newTestRequest("", "en-US").Unmarshal(&testMkfsRequest{})
+	if !errors.As(err, &pe) {
+		t.Fatalf("expect ParamError, got %v", err)
+	}
+	if len(pe.Fields) != 2 || pe.Fields[0].Field != "Device" || pe.Fields[0].Rule != "required" {
+		t.Fatalf("unexpected fields %+v", pe.Fields)
+	}
+	if pe.Fields[0].Message != "Device is required" {
+		t.Fatalf("unexpected message %q", pe.Fields[0].Message)
+	}
+	if pe.FieldNames() != "Device, Fstype" {
+		t.Fatalf("unexpected field names %q", pe.FieldNames())
+	}
+
+	err = newTestRequest(`{"Device":"sdb","Fstype":"ntfs","Size":-1,"Scopes":["/v2/x"]}`, "zh-CN,zh;q=0.9").Unmarshal(&testMkfsRequest{})
+	if !errors.As(err, &pe) || len(pe.Fields) != 3 {
+		t.Fatalf("expect 3 field errors, got %v", err)
+	}
+	if f := pe.Fields[0]; f.Rule != "oneof" || f.Param != "ext4 xfs" || f.Message != "Fstype 必须是 [ext4 xfs] 中的一个" {
+		t.Fatalf("unexpected oneof error %+v", f)
+	}
+	if f := pe.Fields[2]; f.Field != "Scopes[0]" || f.Rule != "startswith" {
+		t.Fatalf("unexpected dive error %+v", f)
+	}
+
+	err = newTestRequest(`{"Device":1}`, "en").Unmarshal(&testMkfsRequest{})
+	if !errors.As(err, &pe) || pe.Fields[0].Rule != "type" || pe.Fields[0].Field != "Device" {
+		t.Fatalf("expect type error, got %v", err)
+	}
+	err = newTestRequest(`{"Device":`, "en").Unmarshal(&testMkfsRequest{})
+	if !errors.As(err, &pe) || pe.Fields[0].Rule != "json" || pe.FieldNames() != "body" {
+		t.Fatalf("expect json error, got %v", err)
+	}
+
+	// 非结构体不校验
+	m := map[string]string{}
+	if err := newTestRequest(`{"a":"b"}`, "").Unmarshal(&m); err != nil || m["a"] != "b" {
+		t.Fatalf("unexpected result %v %v", m, err)
+	}
+}
+
+type testLocalePreference map[string]trans.Locale
+
+func (p testLocalePreference) PreferredLocale(sess *Session) (trans.Locale, bool) {
+	locale, ok := p[sess.SessionID]
+	return locale, ok
+}
+
+func TestResponseLocalize(t *testing.T) {
+	flog.NewLogger(0)
+	c := cache.NewMemoryCache()
+	as := NewApiserver(c, ":0")
+	as.SetLocalePreference(testLocalePreference{"french-user": trans.LocaleFrench})
+	route := as.NewRoute().Prefix("/v1").Path("/disk/mkfs").Handler(func(w *Response, r *Request) {
+		w.WriteParamError(r.Unmarshal(&testMkfsRequest{}))
+	}).AllowAnonymous(true)
+	as.Register(route)
+	c.SetExpired(GenSessionCacheID("french-user"), &Session{SessionID: "french-user", ExpiresAt: time.Now().Add(time.Hour)}, time.Hour)
+
+	call := func(lang string, sid string) string {
+		req := httptest.NewRequest("GET", "/v1/disk/mkfs", strings.NewReader(`{"Device":"sdb"}`))
+		req.Header.Set("Accept-Language", lang)
+		if sid != "" {
+			req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: sid})
+		}
+		w := httptest.NewRecorder()
+		route.ServeHTTP(w, req)
+		rc := retcode.RetCode{}
+		if err := json.Unmarshal(w.Body.Bytes(), &rc); err != nil {
+			t.Fatal(err)
+		}
+		return rc.Message
+	}
+	if msg := call("en-US", ""); msg != "parameter Fstype invalid" {
+		t.Errorf("unexpected english message %q", msg)
+	}
+	if msg := call("zh-CN,zh;q=0.9", ""); msg != "参数 Fstype 无效" {
+		t.Errorf("unexpected chinese message %q", msg)
+	}
+	// 用户设置的语言优先于 Accept-Language
+	if msg := call("en-US", "french-user"); msg != "le paramètre Fstype est invalide" {
+		t.Errorf("unexpected message of user preference %q", msg)
+	}
+}
+
+func TestResponseHTTPStatus(t *testing.T) {
+	flog.NewLogger(0)
+	as := NewApiserver(nil, ":0")
+	var rc *retcode.RetCode
+	var err error
+	route := as.NewRoute().Prefix("/v1").Path("/disk/mkfs").Handler(func(w *Response, r *Request) {
+		if err != nil {
+			w.WriteError(err, nil)
+			return
+		}
+		w.Write(rc)
+	}).AllowAnonymous(true)
+	as.Register(route)
+
+	call := func() (int, int) {
+		w := httptest.NewRecorder()
+		route.ServeHTTP(w, httptest.NewRequest("POST", "/v1/disk/mkfs", nil))
+		body := retcode.RetCode{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, body.Code
+	}
+
+	rc = retcode.StatusOK(nil)
+	if status, code := call(); status != http.StatusOK || code != retcode.RetOK {
+		t.Errorf("unexpected response %d %d", status, code)
+	}
+	rc = retcode.StatusDiskNotFound(nil).WithArgs("sdb")
+	if status, code := call(); status != http.StatusNotFound || code != rc.Code {
+		t.Errorf("unexpected response %d %d", status, code)
+	}
+	// 没有指定返回码时使用错误上附加的返回码
+	err = fmt.Errorf("mkfs: %w", retcode.Wrap(errors.New("device busy"), retcode.StatusDiskNotEmpty(nil).WithArgs("sdb")))
+	if status, code := call(); status != http.StatusConflict || code != retcode.StatusDiskNotEmpty(nil).Code {
+		t.Errorf("unexpected response %d %d", status, code)
+	}
+	err = errors.New("unknown")
+	if status, code := call(); status != http.StatusInternalServerError || code != retcode.RetFailed {
+		t.Errorf("unexpected response %d %d", status, code)
+	}
+}
@@ -1,8 +1,9 @@
 package apiserver
 
 import (
+	"errors"
 	"flutelake/fluteNAS/pkg/module/flog"
-	"flutelake/fluteNAS/pkg/util"
+	"flutelake/fluteNAS/pkg/module/retcode"
 	"net/http"
 	"time"
 )
@@ -13,42 +14,70 @@ type Response struct {
 	fields any
 
 	cookie *Session
+	// 请求通过https发送时，cookie设置Secure标记
+	secure bool
 }
 
 func (r *Response) Write(data any) {
 	r.fields = data
 }
 
+// WriteError 记录错误并写入响应，data为nil时使用 retcode.Wrap 附加在错误上的返回码
 func (r *Response) WriteError(err error, data any) {
 	flog.Errorf("request error: %v", err)
+	if data == nil {
+		data = retcode.FromError(err)
+	}
 	r.fields = data
 }
 
-func (r *Response) SetCookie(userInfo any) {
-	r.cookie = &Session{
-		SessionID: util.RandStringRunes(32),
-		UserInfo:  userInfo,
+// WriteParamError 写入参数错误，Unmarshal 返回的 *ParamError 会在data中列出每个错误参数
+func (r *Response) WriteParamError(err error) {
+	var pe *ParamError
+	if !errors.As(err, &pe) {
+		pe = &ParamError{Fields: []FieldError{}}
+	}
+	r.WriteError(err, retcode.StatusParamInvalid(pe).WithArgs(pe.FieldNames()))
+}
+
+// SetCookie 创建新的会话并写入cookie，生成会话ID失败时返回错误
+func (r *Response) SetCookie(userInfo any) error {
+	sess, err := NewSession(userInfo)
+	if err != nil {
+		return err
 	}
+	r.cookie = sess
 	http.SetCookie(r.ResponseWriter, &http.Cookie{
-		Name:  "sid",
+		Name:  SessionCookieName,
 		Value: r.cookie.SessionID,
 		Path:  "/",
 		// httpOnly 阻止在浏览器控制台中通过document.cookie获取cookie
 		HttpOnly: true,
-		// Secure:   true,
-		Expires: time.Now().Add(time.Hour * 9),
+		Secure:   r.secure,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  r.cookie.ExpiresAt,
 	})
+	setCSRFCookie(r.ResponseWriter, r.cookie.SessionID, r.secure, r.cookie.ExpiresAt)
+	return nil
 }
 
 func (r *Response) NullCookie() {
 	r.cookie = nil
 	http.SetCookie(r.ResponseWriter, &http.Cookie{
-		Name:  "sid",
+		Name:  SessionCookieName,
 		Value: "",
 		Path:  "/",
 		// httpOnly 阻止在浏览器控制台中通过document.cookie获取cookie
 		HttpOnly: true,
-		// Secure:   true,
+		Secure:   r.secure,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  time.Now().Add(time.Minute * 1),
+	})
+	http.SetCookie(r.ResponseWriter, &http.Cookie{
+		Name:    CSRFCookieName,
+		Value:   "",
+		Path:    "/",
+		Secure:  r.secure,
 		Expires: time.Now().Add(time.Minute * 1),
 	})
 }
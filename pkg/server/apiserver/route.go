@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"flutelake/fluteNAS/pkg/module/cache"
 	"flutelake/fluteNAS/pkg/module/flog"
-	"fmt"
+	"flutelake/fluteNAS/pkg/module/ratelimit"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"net"
 	"net/http"
+	"reflect"
 	"time"
 )
 
@@ -16,6 +19,31 @@ type Route struct {
 	allowAnonymous     bool
 	permissionRequired string
 	cache              cache.TinyCache
+	tokenAuth          TokenAuthenticator
+	sessionStore       SessionStore
+	// 修改数据的接口需要记录审计日志
+	audit         bool
+	auditRecorder AuditRecorder
+	localePref    LocalePreference
+	// 限流分类和请求体大小上限，为空时使用默认值
+	rateClass           RateClass
+	limiters            map[RateClass]*ratelimit.Limiter
+	trustedProxies      []*net.IPNet
+	maxBodyBytes        int64
+	defaultMaxBodyBytes int64
+	origins             originPolicy
+
+	// 以下字段只用于生成接口文档
+	summary  string
+	in       reflect.Type
+	out      reflect.Type
+	consumes string
+	queries  []queryParam
+}
+
+type queryParam struct {
+	name string
+	doc  string
 }
 
 // allowAnonymous bool, permissionRequired string, preFilters ...*Filter
@@ -47,21 +75,54 @@ func (h *Route) AllowAnonymous(allow bool) *Route {
 
 func (h *Route) Permission(permission string) *Route { h.permissionRequired = permission; return h }
 
+// RateLimit 设置路由的限流分类，默认为 RateClassDefault
+func (h *Route) RateLimit(class RateClass) *Route { h.rateClass = class; return h }
+
+// MaxBodyBytes 设置请求体大小上限，NoBodyLimit 表示不限制
+func (h *Route) MaxBodyBytes(n int64) *Route { h.maxBodyBytes = n; return h }
+
+// Audit 记录接口的调用者、参数和结果，修改数据的接口都需要设置
+func (h *Route) Audit() *Route { h.audit = true; return h }
+
+// Doc 接口的简要说明
+func (h *Route) Doc(summary string) *Route { h.summary = summary; return h }
+
+// In 请求体的结构，例如 In(model.ListDirRequest{})
+func (h *Route) In(v any) *Route { h.in = reflect.TypeOf(v); return h }
+
+// Out 响应中data字段的结构
+func (h *Route) Out(v any) *Route { h.out = reflect.TypeOf(v); return h }
+
+// Consumes 请求体不是json时设置，例如上传文件使用 multipart/form-data
+func (h *Route) Consumes(contentType string) *Route { h.consumes = contentType; return h }
+
+// Query 通过url参数传递的参数
+func (h *Route) Query(name string, doc string) *Route {
+	h.queries = append(h.queries, queryParam{name: name, doc: doc})
+	return h
+}
+
 func (h *Route) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// todo local develop test
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
+	if !h.handleCORS(w, r) {
 		return
 	}
 
-	resp := &Response{ResponseWriter: w}
-	req := &Request{Request: r}
+	resp := &Response{ResponseWriter: w, secure: r.TLS != nil}
+	req := &Request{Request: r, localePref: h.localePref, trustedProxies: h.trustedProxies}
 
 	// pre filter
-	status := filterAuth(h.cache, resp, req)
+	status := filterAuth(h.cache, h.tokenAuth, r.URL.Path, req)
+	// 限流和请求体大小检查在审计之前，被拒绝的请求不会执行也不记录
+	if !h.allowRate(w, req) || !h.limitBody(w, req) {
+		return
+	}
+	if h.audit && h.auditRecorder != nil {
+		// 认证失败的请求同样记录，参数在处理前读取
+		sw := &statusRecorder{ResponseWriter: w}
+		w, resp.ResponseWriter = sw, sw
+		defer h.recordAudit(sw, r, req, resp, readAuditBody(r), time.Now())
+	}
+
 	switch status {
 	case http.StatusUnauthorized:
 		if h.allowAnonymous {
@@ -70,6 +131,10 @@ func (h *Route) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(status)
 		return
 	case http.StatusOK:
+		if !h.checkCSRF(w, req) || !h.authorized(req) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
 		goto handle
 	default:
 		w.WriteHeader(status)
@@ -81,20 +146,53 @@ handle:
 	h.function(resp, req)
 
 	if resp.cookie != nil {
+		if ip := req.ClientIP(); ip != nil {
+			resp.cookie.ClientIP = ip.String()
+		}
+		resp.cookie.UserAgent = r.UserAgent()
 		// save into cache
-		h.cache.SetExpired(fmt.Sprintf("Session:%s", resp.cookie.SessionID), resp.cookie, time.Hour*9)
+		h.cache.SetExpired(GenSessionCacheID(resp.cookie.SessionID), resp.cookie, time.Until(resp.cookie.ExpiresAt))
+		if h.sessionStore != nil {
+			if err := h.sessionStore.Save(resp.cookie); err != nil {
+				flog.Errorf("save session failed, %v", err)
+			}
+		}
 	}
 
 	if resp.fields == nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	} else {
+		status := http.StatusOK
+		if rc, ok := resp.fields.(*retcode.RetCode); ok {
+			rc.Localize(req.Locale())
+			status = rc.HTTPStatus()
+		}
 		bs, err := json.Marshal(resp.fields)
 		if err != nil {
 			flog.Errorf("marshal response body data failed, %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		// 返回码对应的HTTP状态码见 retcode 目录，响应体中仍然包含具体的返回码
+		if status != http.StatusOK {
+			resp.ResponseWriter.WriteHeader(status)
+		}
 		resp.ResponseWriter.Write(bs)
 	}
 }
+
+// authorized 检查会话用户是否拥有路由所需的权限
+func (h *Route) authorized(req *Request) bool {
+	if h.permissionRequired == "" {
+		return true
+	}
+	if req.Session == nil {
+		return false
+	}
+	checker, ok := req.Session.UserInfo.(PermissionChecker)
+	if !ok {
+		return false
+	}
+	return checker.HasPermission(h.permissionRequired)
+}
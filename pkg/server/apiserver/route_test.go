@@ -0,0 +1,123 @@
+package apiserver
+
+import (
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/cache"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"flutelake/fluteNAS/pkg/module/retcode"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var allPermissions = []string{
+	model.PermissionFileRead, model.PermissionFileWrite,
+	model.PermissionDiskRead, model.PermissionDiskWrite,
+	model.PermissionShareRead, model.PermissionShareWrite,
+	model.PermissionHostRead, model.PermissionTerminal,
+	model.PermissionUserManage, model.PermissionSystemManage,
+	model.PermissionAuditRead,
+}
+
+// newRBACTestServer 返回的函数使用指定的会话用户调用路由，userInfo 为nil时不携带会话
+func newRBACTestServer(t *testing.T) (*Apiserver, func(route *Route, userInfo any) int) {
+	flog.NewLogger(0)
+	c := cache.NewMemoryCache()
+	as := NewApiserver(c, ":0")
+	n := 0
+	call := func(route *Route, userInfo any) int {
+		req := httptest.NewRequest("GET", route.GetPath(), nil)
+		if userInfo != nil {
+			n++
+			sid := fmt.Sprintf("session-%d", n)
+			c.SetExpired(GenSessionCacheID(sid), &Session{SessionID: sid, UserInfo: userInfo, ExpiresAt: time.Now().Add(time.Hour)}, time.Hour)
+			req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: sid})
+		}
+		w := httptest.NewRecorder()
+		route.ServeHTTP(w, req)
+		return w.Code
+	}
+	return as, call
+}
+
+func okHandler(w *Response, r *Request) {
+	w.Write(retcode.StatusOK(nil))
+}
+
+func TestRoutePermission(t *testing.T) {
+	as, call := newRBACTestServer(t)
+	routes := make(map[string]*Route, len(allPermissions))
+	for _, p := range allPermissions {
+		route := as.NewRoute().Prefix("/v1").Path("/" + p).Handler(okHandler).Permission(p)
+		as.Register(route)
+		routes[p] = route
+	}
+
+	// 每个角色拥有的权限，其余权限都应该被拒绝
+	granted := map[string][]string{
+		model.RoleAdmin: allPermissions,
+		model.RoleOperator: {
+			model.PermissionFileRead, model.PermissionFileWrite,
+			model.PermissionDiskRead, model.PermissionDiskWrite,
+			model.PermissionShareRead, model.PermissionShareWrite,
+			model.PermissionHostRead, model.PermissionTerminal,
+		},
+		model.RoleReadOnly: {
+			model.PermissionFileRead, model.PermissionDiskRead,
+			model.PermissionShareRead, model.PermissionHostRead,
+		},
+		model.RoleFileUser: {model.PermissionFileRead, model.PermissionFileWrite},
+		// 未分配或不存在的角色没有任何权限
+		"":        nil,
+		"unknown": nil,
+	}
+	for role, perms := range granted {
+		allowed := make(map[string]bool, len(perms))
+		for _, p := range perms {
+			allowed[p] = true
+		}
+		for _, p := range allPermissions {
+			want := http.StatusForbidden
+			if allowed[p] {
+				want = http.StatusOK
+			}
+			if got := call(routes[p], model.SessionUserInfo{Username: "alice", Role: role}); got != want {
+				t.Errorf("role %q on %s: expect %d, got %d", role, p, want, got)
+			}
+		}
+	}
+}
+
+func TestRouteAuthentication(t *testing.T) {
+	as, call := newRBACTestServer(t)
+	anonymous := as.NewRoute().Prefix("/v1").Path("/login").Handler(okHandler).AllowAnonymous(true)
+	as.Register(anonymous)
+	loggedIn := as.NewRoute().Prefix("/v1").Path("/logout").Handler(okHandler)
+	as.Register(loggedIn)
+	protected := as.NewRoute().Prefix("/v1").Path("/disk/list").Handler(okHandler).Permission(model.PermissionDiskRead)
+	as.Register(protected)
+
+	tests := []struct {
+		name     string
+		route    *Route
+		userInfo any
+		want     int
+	}{
+		{name: "anonymous route without session", route: anonymous, want: http.StatusOK},
+		{name: "anonymous route with session", route: anonymous, userInfo: model.SessionUserInfo{Role: model.RoleReadOnly}, want: http.StatusOK},
+		{name: "no session", route: loggedIn, want: http.StatusUnauthorized},
+		{name: "no session on protected route", route: protected, want: http.StatusUnauthorized},
+		{name: "route without permission allows any role", route: loggedIn, userInfo: model.SessionUserInfo{Role: "unknown"}, want: http.StatusOK},
+		{name: "missing role", route: protected, userInfo: model.SessionUserInfo{Username: "alice"}, want: http.StatusForbidden},
+		{name: "user info without permission checker", route: protected, userInfo: "alice", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := call(tt.route, tt.userInfo); got != tt.want {
+				t.Fatalf("expect %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
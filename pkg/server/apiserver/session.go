@@ -1,20 +1,64 @@
 package apiserver
 
-import "flutelake/fluteNAS/pkg/util"
+import (
+	"flutelake/fluteNAS/pkg/module/trans"
+	"flutelake/fluteNAS/pkg/util"
+	"fmt"
+	"time"
+)
+
+const (
+	// SessionTTL cookie会话的有效期
+	SessionTTL = time.Hour * 9
+	// SessionCookieName 保存会话ID的cookie名称
+	SessionCookieName = "sid"
+)
 
 type Session struct {
 	SessionID string
 	UserInfo  interface{}
+	ExpiresAt time.Time
+	ClientIP  string
+	UserAgent string
 }
 
-func NewSession(userInfo interface{}) *Session {
-	sessionID := util.RandStringRunes(64)
+// NewSession 创建会话，会话ID使用密码学安全的随机数生成
+func NewSession(userInfo interface{}) (*Session, error) {
+	sessionID, err := util.RandSecureString(64)
+	if err != nil {
+		return nil, fmt.Errorf("generate session id failed: %v", err)
+	}
 	return &Session{
 		SessionID: sessionID,
 		UserInfo:  userInfo,
-	}
+		ExpiresAt: time.Now().Add(SessionTTL),
+	}, nil
+}
+
+// SessionHash 缓存和数据库中都只使用会话ID的摘要
+func SessionHash(sid string) string {
+	return util.SHA256Hex(sid)
 }
 
 func GenSessionCacheID(sid string) string {
-	return "Session:" + sid
+	return GenSessionCacheIDByHash(SessionHash(sid))
+}
+
+func GenSessionCacheIDByHash(hash string) string {
+	return "Session:" + hash
+}
+
+// SessionStore 持久化cookie会话，服务重启后可以恢复登录状态
+type SessionStore interface {
+	Save(sess *Session) error
+}
+
+// LocalePreference 用户设置的界面语言，接口返回的错误信息优先使用该语言
+type LocalePreference interface {
+	PreferredLocale(sess *Session) (trans.Locale, bool)
+}
+
+// PermissionChecker 会话中的用户信息实现该接口后，路由声明的 Permission 才会生效
+type PermissionChecker interface {
+	HasPermission(permission string) bool
 }
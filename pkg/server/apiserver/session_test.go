@@ -0,0 +1,17 @@
+package apiserver
+
+import "testing"
+
+func TestNewSession(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		sess, err := NewSession("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sess.SessionID) != 64 || seen[sess.SessionID] {
+			t.Fatalf("unexpected session id %q", sess.SessionID)
+		}
+		seen[sess.SessionID] = true
+	}
+}
@@ -0,0 +1,143 @@
+package apiserver
+
+import (
+	"flutelake/fluteNAS/pkg/model"
+	"flutelake/fluteNAS/pkg/module/cache"
+	"flutelake/fluteNAS/pkg/module/flog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeTokenAuth 按token明文保存 model.APIToken，撤销的token从map中删除
+type fakeTokenAuth map[string]*model.APIToken
+
+func (f fakeTokenAuth) Authenticate(token string, path string) (*Session, error) {
+	t, ok := f[token]
+	if !ok || t.Expired(time.Now()) {
+		return nil, ErrTokenInvalid
+	}
+	if !t.Scopes.Allow(path) {
+		return nil, ErrTokenOutOfScope
+	}
+	return &Session{
+		SessionID: "token:" + t.Name,
+		UserInfo:  model.SessionUserInfo{Username: t.Username, Role: model.RoleOperator, TokenID: t.ID},
+	}, nil
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		token  string
+		ok     bool
+	}{
+		{header: "Bearer fnt_abc", token: "fnt_abc", ok: true},
+		{header: "bearer  fnt_abc ", token: "fnt_abc", ok: true},
+		{header: ""},
+		{header: "Bearer"},
+		{header: "Bearer    "},
+		{header: "Basic YWxpY2U6c2VjcmV0"},
+		{header: "Bearerfnt_abc"},
+		{header: "fnt_abc"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/v1/disk/list", nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		token, ok := (&Request{Request: r}).BearerToken()
+		if token != tt.token || ok != tt.ok {
+			t.Errorf("BearerToken() of %q = %q %v, want %q %v", tt.header, token, ok, tt.token, tt.ok)
+		}
+	}
+}
+
+func TestTokenScopeAllow(t *testing.T) {
+	tests := []struct {
+		scopes model.TokenScopeString
+		path   string
+		want   bool
+	}{
+		{scopes: "[]", path: "/v1/disk/list", want: true},
+		{scopes: "", path: "/v1/disk/list", want: true},
+		{scopes: `["/v1/disk/list"]`, path: "/v1/disk/list", want: true},
+		{scopes: `["/v1/disk/list"]`, path: "/v1/disk/mkfs", want: false},
+		{scopes: `["/v1/samba-share/*"]`, path: "/v1/samba-share/create", want: true},
+		{scopes: `["/v1/samba-share/*"]`, path: "/v1/samba-user/create", want: false},
+		{scopes: `["/v1/disk/list", "/v1/host/*"]`, path: "/v1/host/info", want: true},
+	}
+	for _, tt := range tests {
+		if got := tt.scopes.Allow(tt.path); got != tt.want {
+			t.Errorf("%s.Allow(%s) = %v, want %v", tt.scopes, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRouteTokenAuth(t *testing.T) {
+	flog.NewLogger(0)
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	tokens := fakeTokenAuth{
+		"fnt_valid":   {Name: "valid", Username: "alice", Scopes: "[]", ExpiresAt: &future},
+		"fnt_expired": {Name: "expired", Username: "alice", Scopes: "[]", ExpiresAt: &past},
+		"fnt_revoked": {Name: "revoked", Username: "alice", Scopes: "[]"},
+		"fnt_scoped":  {Name: "scoped", Username: "alice", Scopes: `["/v1/samba-share/*"]`},
+	}
+	delete(tokens, "fnt_revoked")
+
+	c := cache.NewMemoryCache()
+	as := NewApiserver(c, ":0")
+	as.SetTokenAuthenticator(tokens)
+	var sess *Session
+	route := as.NewRoute().Prefix("/v1").Path("/disk/mkfs").Permission(model.PermissionDiskWrite).Handler(func(w *Response, r *Request) {
+		sess = r.Session
+		okHandler(w, r)
+	})
+	as.Register(route)
+
+	tests := []struct {
+		name  string
+		auth  string
+		want  int
+		token bool
+	}{
+		{name: "valid token without csrf header", auth: "Bearer fnt_valid", want: http.StatusOK, token: true},
+		{name: "unknown token", auth: "Bearer fnt_unknown", want: http.StatusUnauthorized},
+		{name: "expired token", auth: "Bearer fnt_expired", want: http.StatusUnauthorized},
+		{name: "revoked token", auth: "Bearer fnt_revoked", want: http.StatusUnauthorized},
+		{name: "route out of token scope", auth: "Bearer fnt_scoped", want: http.StatusForbidden},
+		{name: "malformed authorization header", auth: "Token fnt_valid", want: http.StatusUnauthorized},
+		{name: "empty bearer token", auth: "Bearer ", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess = nil
+			// 修改数据的POST请求，token认证时不需要CSRF token
+			req := httptest.NewRequest("POST", "/v1/disk/mkfs", nil)
+			req.Header.Set("Authorization", tt.auth)
+			w := httptest.NewRecorder()
+			route.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("expect %d, got %d", tt.want, w.Code)
+			}
+			if tt.token && (sess == nil || sess.UserInfo.(model.SessionUserInfo).Username != "alice") {
+				t.Fatalf("expect token session, got %+v", sess)
+			}
+		})
+	}
+
+	// token 无效时不回退到cookie会话
+	sid := "cookie-session"
+	c.SetExpired(GenSessionCacheID(sid), &Session{SessionID: sid, UserInfo: model.SessionUserInfo{Role: model.RoleAdmin}, ExpiresAt: time.Now().Add(time.Hour)}, time.Hour)
+	req := httptest.NewRequest("POST", "/v1/disk/mkfs", nil)
+	req.Header.Set("Authorization", "Bearer fnt_expired")
+	req.Header.Set(CSRFHeaderName, CSRFToken(sid))
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: sid})
+	w := httptest.NewRecorder()
+	route.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expired token should not fall back to cookie session, got %d", w.Code)
+	}
+}
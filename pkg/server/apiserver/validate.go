@@ -0,0 +1,133 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"flutelake/fluteNAS/pkg/module/trans"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError 单个参数的校验错误
+type FieldError struct {
+	// 参数名，嵌套的参数使用 . 和 [] 连接，例如 Scopes[0]
+	Field string `json:"Field"`
+	// 未通过的校验规则，例如 required、oneof，json格式错误时为 json 或 type
+	Rule    string `json:"Rule"`
+	Param   string `json:"Param,omitempty"`
+	Message string `json:"Message"`
+}
+
+// ParamError 请求参数错误，包含所有未通过校验的参数
+type ParamError struct {
+	Fields []FieldError `json:"Fields"`
+}
+
+func (e *ParamError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Message)
+	}
+	return "request params validate failed: " + strings.Join(msgs, "; ")
+}
+
+// FieldNames 返回出错的参数名，没有具体参数时返回 body
+func (e *ParamError) FieldNames() string {
+	names := []string{}
+	for _, f := range e.Fields {
+		if f.Field != "" {
+			names = append(names, f.Field)
+		}
+	}
+	if len(names) == 0 {
+		return "body"
+	}
+	return strings.Join(names, ", ")
+}
+
+// newDecodeError 把json解析错误转换为 ParamError
+func newDecodeError(err error, locale trans.Locale) *ParamError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		field := typeErr.Field
+		if field == "" {
+			field = "body"
+		}
+		param := typeErr.Type.String()
+		return &ParamError{Fields: []FieldError{{
+			Field:   field,
+			Rule:    "type",
+			Param:   param,
+			Message: trans.VAL0008().Sprintf(locale, field, param),
+		}}}
+	}
+	return &ParamError{Fields: []FieldError{{
+		Rule:    "json",
+		Message: trans.VAL0009().Sprintf(locale, err.Error()),
+	}}}
+}
+
+// newBodyTooLargeError 请求体超出大小上限
+func newBodyTooLargeError(limit int64, locale trans.Locale) *ParamError {
+	param := strconv.FormatInt(limit, 10)
+	return &ParamError{Fields: []FieldError{{
+		Field:   "body",
+		Rule:    "max",
+		Param:   param,
+		Message: trans.VAL0005().Sprintf(locale, "body", param),
+	}}}
+}
+
+// newValidationError 把 validator 的校验错误转换为 ParamError
+func newValidationError(errs validator.ValidationErrors, locale trans.Locale) *ParamError {
+	pe := &ParamError{Fields: make([]FieldError, 0, len(errs))}
+	for _, fe := range errs {
+		// Namespace 的第一段是结构体名称
+		field := fe.Namespace()
+		if _, rest, ok := strings.Cut(field, "."); ok {
+			field = rest
+		}
+		pe.Fields = append(pe.Fields, FieldError{
+			Field:   field,
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: validationMessage(fe, field, locale),
+		})
+	}
+	return pe
+}
+
+func validationMessage(fe validator.FieldError, field string, locale trans.Locale) string {
+	// 字符串和数组的大小限制的是长度
+	kind := fe.Kind()
+	isLength := kind == reflect.String || kind == reflect.Slice || kind == reflect.Array || kind == reflect.Map
+
+	switch fe.Tag() {
+	case "required":
+		return trans.VAL0000().Sprintf(locale, field)
+	case "oneof":
+		return trans.VAL0001().Sprintf(locale, field, fe.Param())
+	case "min", "gte":
+		if isLength {
+			return trans.VAL0004().Sprintf(locale, field, fe.Param())
+		}
+		return trans.VAL0002().Sprintf(locale, field, fe.Param())
+	case "max", "lte":
+		if isLength {
+			return trans.VAL0005().Sprintf(locale, field, fe.Param())
+		}
+		return trans.VAL0003().Sprintf(locale, field, fe.Param())
+	case "len":
+		return trans.VAL0006().Sprintf(locale, field, fe.Param())
+	case "startswith":
+		return trans.VAL0007().Sprintf(locale, field, fe.Param())
+	}
+	rule := fe.Tag()
+	if fe.Param() != "" {
+		rule += "=" + fe.Param()
+	}
+	return trans.VAL0010().Sprintf(locale, field, rule)
+}
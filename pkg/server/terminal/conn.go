@@ -51,14 +51,14 @@ func (h *Host) isLocalHost() bool {
 	}
 }
 
-func newTerminalConn(conn *websocket.Conn, host *Host, uniqueID, name string) *TerminalConn {
+func newTerminalConn(conn *websocket.Conn, host *Host, uniqueID, name string, recordPath string) *TerminalConn {
 	return &TerminalConn{
 		conn:         conn,
 		host:         host,
 		uniqueID:     uniqueID,
 		name:         name,
 		lastHeatbeat: time.Now().Unix(),
-		recorder:     NewRecorder(host.Hostname, fmt.Sprintf("%s_%s", uniqueID, name)),
+		recorder:     NewRecorder(recordPath, host.Hostname, fmt.Sprintf("%s_%s", uniqueID, name)),
 	}
 }
 
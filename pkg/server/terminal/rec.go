@@ -20,6 +20,7 @@ import (
 var historyLock *sync.Mutex
 
 type Recorder struct {
+	recordPath   string
 	uniqueID     string
 	serialNumber string
 	outFileName  string
@@ -34,13 +35,12 @@ type Recorder struct {
 	vt          *term.Terminal
 }
 
-const ReocrdFilePathPrefix = "/data/.kunlun-ssh-records"
-
-func NewRecorder(serialNumber string, filename string) *Recorder {
+func NewRecorder(recordPath string, serialNumber string, filename string) *Recorder {
 	w := &Recorder{
+		recordPath:   recordPath,
 		uniqueID:     filename,
 		serialNumber: serialNumber,
-		outFileName:  filepath.Join(ReocrdFilePathPrefix, filename),
+		outFileName:  filepath.Join(recordPath, filename),
 	}
 	if historyLock == nil {
 		historyLock = &sync.Mutex{}
@@ -55,7 +55,7 @@ func (w *Recorder) createRecFile() error {
 		return fmt.Errorf("create record file error: %v", err)
 	}
 	// 历史命令执行记录
-	historyPath := filepath.Join(ReocrdFilePathPrefix, w.serialNumber)
+	historyPath := filepath.Join(w.recordPath, w.serialNumber)
 	w.historyFile, err = os.OpenFile(historyPath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0)
 	if err != nil {
 		return fmt.Errorf("create or open history file error: %v", err)
@@ -173,10 +173,13 @@ func (w *Recorder) ReadLine(handler func(bs []byte)) error {
 }
 
 func (w *Recorder) Close() {
+	// 落盘后再关闭，避免服务停止时丢失录像
 	if w.historyFile != nil {
+		w.historyFile.Sync()
 		w.historyFile.Close()
 	}
 	if w.outputFile != nil {
+		w.outputFile.Sync()
 		w.outputFile.Close()
 	}
 	if w.inr != nil {
@@ -262,7 +265,7 @@ func unescapePrintableChars(escapedStr string) ([]byte, error) {
 const RecordExpireDay = 30
 
 // 每天4点钟，清理一次历史缓存文件
-func recCleanerGo() {
+func recCleanerGo(recordPath string) {
 	now := time.Now()
 
 	target := now.Truncate(4 * time.Hour)
@@ -276,17 +279,17 @@ func recCleanerGo() {
 	<-ticker.C
 
 	// 执行清理方法
-	cleaner()
+	cleaner(recordPath)
 
 	// 重置定时器，等待下一个4点钟
 	ticker.Reset(24 * time.Hour)
 }
 
 // 清理过期的缓存
-func cleaner() {
-	entries, err := os.ReadDir(ReocrdFilePathPrefix)
+func cleaner(recordPath string) {
+	entries, err := os.ReadDir(recordPath)
 	if err != nil {
-		flog.Errorf("ReadDir %s error: %v", ReocrdFilePathPrefix, err)
+		flog.Errorf("ReadDir %s error: %v", recordPath, err)
 		return
 	}
 
@@ -298,12 +301,12 @@ func cleaner() {
 		if entry.IsDir() {
 			continue
 		}
-		filePath := filepath.Join(ReocrdFilePathPrefix, entry.Name())
-		cleanRecordFileContent(filePath)
+		filePath := filepath.Join(recordPath, entry.Name())
+		cleanRecordFileContent(recordPath, filePath)
 	}
 }
 
-func cleanRecordFileContent(filePath string) {
+func cleanRecordFileContent(recordPath string, filePath string) {
 	f, err := os.Open(filePath)
 	if err != nil {
 		flog.Errorf("ReadFile %s error: %v", filePath, err)
@@ -312,7 +315,7 @@ func cleanRecordFileContent(filePath string) {
 	defer f.Close()
 
 	// 创建一个临时文件
-	tmpFilePath := filepath.Join(ReocrdFilePathPrefix, "tmp_record")
+	tmpFilePath := filepath.Join(recordPath, "tmp_record")
 	tmp, err := os.Create(tmpFilePath)
 	if err != nil {
 		flog.Errorf("create record file error: %v", err)
@@ -18,8 +18,11 @@ import (
 type WebTerminal struct {
 	// 超时时间，单位秒
 	timeout int64
+	// 终端录像和历史命令的保存目录
+	recordPath string
 	// websocket 连接池
-	conns map[string]*TerminalConn
+	conns    map[string]*TerminalConn
+	upgrader websocket.Upgrader
 
 	lock sync.Mutex
 }
@@ -27,23 +30,27 @@ type WebTerminal struct {
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
 }
 
-func NewWebTerminal(timeout int) *WebTerminal {
+// SetCheckOrigin 设置websocket连接的来源检查，未设置时只允许同源连接
+func (t *WebTerminal) SetCheckOrigin(check func(r *http.Request) bool) {
+	t.upgrader.CheckOrigin = check
+}
+
+func NewWebTerminal(timeout int, recordPath string) *WebTerminal {
 	// 检查Record目录是否创建
-	_, err := os.Stat(ReocrdFilePathPrefix)
+	_, err := os.Stat(recordPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			os.Mkdir(ReocrdFilePathPrefix, 0o644)
+			os.MkdirAll(recordPath, 0o644)
 		}
 	}
 	return &WebTerminal{
-		timeout: int64(timeout),
-		conns:   make(map[string]*TerminalConn, 0),
-		lock:    sync.Mutex{},
+		timeout:    int64(timeout),
+		recordPath: recordPath,
+		conns:      make(map[string]*TerminalConn, 0),
+		upgrader:   upgrader,
+		lock:       sync.Mutex{},
 	}
 }
 
@@ -53,7 +60,7 @@ func (t *WebTerminal) Start(stopCh <-chan struct{}) {
 	// go wait.Until(t.cleaner, time.Minute*5, stopCh)
 
 	// 清理缓存文件
-	go recCleanerGo()
+	go recCleanerGo(t.recordPath)
 }
 
 func (t *WebTerminal) updateConn(token string, conn *TerminalConn) {
@@ -108,7 +115,7 @@ func (t *WebTerminal) CreateTerminal(param CreateTerminalParam) (string, error)
 		}
 	}
 
-	c := newTerminalConn(nil, &param.Host, uniqueID, param.TerminalName)
+	c := newTerminalConn(nil, &param.Host, uniqueID, param.TerminalName, t.recordPath)
 	t.updateConn(token, c)
 	return token, nil
 }
@@ -131,7 +138,7 @@ func (t *WebTerminal) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	wsConn, err := upgrader.Upgrade(w, r, nil)
+	wsConn, err := t.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		flog.Errorf("Upgrade error: %v", err)
 		return
@@ -146,6 +153,22 @@ func (t *WebTerminal) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Close 关闭所有终端连接并保存录像，服务停止时调用
+func (t *WebTerminal) Close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for token, c := range t.conns {
+		if c.conn != nil {
+			// WriteControl 可以和终端的读写协程并发调用
+			msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down")
+			c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		}
+		c.Close()
+		delete(t.conns, token)
+	}
+}
+
 // 清理过期的连接
 func (t *WebTerminal) cleaner() {
 	t.lock.Lock()
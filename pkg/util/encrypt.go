@@ -1,13 +1,18 @@
 package util
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	crand "crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
-	"log"
+	"math/big"
 	"math/rand"
 	"strings"
 )
@@ -39,6 +44,27 @@ func RandStringRunes(n int) string {
 	return sb.String()
 }
 
+// RandSecureString 使用 crypto/rand 生成随机字符串，用于token等安全敏感的场景
+func RandSecureString(n int) (string, error) {
+	sb := strings.Builder{}
+	sb.Grow(n)
+	max := big.NewInt(int64(len(alphabet)))
+	for i := 0; i < n; i++ {
+		idx, err := crand.Int(crand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(alphabet[idx.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// SHA256Hex 计算字符串的sha256摘要，返回16进制编码
+func SHA256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
 // // 生成一对密钥
 // func GenAccessKeySecret() (accessKey string, accessSecret string) {
 // 	accessKey = RandStringRunes(16)
@@ -117,7 +143,7 @@ func RSAEncrypt(publicKey string, message []byte) ([]byte, error) {
 	// 使用公钥加密
 	encryptedMessage, err := rsa.EncryptPKCS1v15(crand.Reader, rsaPub, message)
 	if err != nil {
-		log.Fatalf("ras encrypt message failed: %v", err)
+		return nil, fmt.Errorf("rsa encrypt message failed: %v", err)
 	}
 
 	return encryptedMessage, nil
@@ -132,8 +158,51 @@ func RSADecrypt(privateKey string, encryptedMessage []byte) (string, error) {
 	// 使用私钥解密
 	decryptedMessage, err := rsa.DecryptPKCS1v15(crand.Reader, rsaPrivate, encryptedMessage)
 	if err != nil {
-		log.Fatalf("decrypt message failed: %v", err)
+		return "", fmt.Errorf("rsa decrypt message failed: %v", err)
 	}
 
 	return string(decryptedMessage), nil
 }
+
+// AESGCMEncrypt 使用AES-GCM加密，返回base64编码的 nonce+密文
+func AESGCMEncrypt(key []byte, plaintext []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := crand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// AESGCMDecrypt 解密 AESGCMEncrypt 的结果
+func AESGCMDecrypt(key []byte, ciphertext string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("aes-gcm ciphertext too short")
+	}
+	nonce, data := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("aes-gcm decrypt failed: %v", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -41,3 +41,25 @@ func TestRasEncrypto(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestAESGCMEncrypt(t *testing.T) {
+	key := make([]byte, 32)
+	message := "hello fluteNAS"
+
+	ciphertext, err := AESGCMEncrypt(key, []byte(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := AESGCMDecrypt(key, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != message {
+		t.Fatalf("AESGCMDecrypt() = %s, want %s", plaintext, message)
+	}
+
+	key[0] = 1
+	if _, err := AESGCMDecrypt(key, ciphertext); err == nil {
+		t.Fatal("decrypt with wrong key should fail")
+	}
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"fmt"
 	"net"
 	"net/http"
 	"strings"
@@ -17,6 +18,64 @@ func GetClientIP(req *http.Request) net.IP {
 	return ips[0]
 }
 
+// ClientIP returns the IP of the client that sent the request.
+// The X-Forwarded-For and X-Real-Ip headers can be set by any client, so they are
+// only used when req.RemoteAddr is one of the trusted proxies. The X-Forwarded-For
+// chain is walked from right to left and the first address that is not a trusted
+// proxy is returned. Without trusted proxies this is the IP of req.RemoteAddr.
+func ClientIP(req *http.Request, trustedProxies []*net.IPNet) net.IP {
+	remoteIP := remoteAddrIP(req)
+	if remoteIP == nil || !containedInNets(trustedProxies, remoteIP) {
+		return remoteIP
+	}
+
+	var chain []net.IP
+	for _, part := range strings.Split(req.Header.Get("X-Forwarded-For"), ",") {
+		if ip := net.ParseIP(strings.TrimSpace(part)); ip != nil {
+			chain = append(chain, ip)
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !containedInNets(trustedProxies, chain[i]) {
+			return chain[i]
+		}
+	}
+	if len(chain) > 0 {
+		return chain[0]
+	}
+	if ip := net.ParseIP(strings.TrimSpace(req.Header.Get("X-Real-Ip"))); ip != nil {
+		return ip
+	}
+	return remoteIP
+}
+
+// ParseNetworks parses IPs and CIDRs like 10.0.0.1 or 10.0.0.0/8, a single IP is
+// treated as a network containing only that address.
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip %q", v)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q: %v", v, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
 // SourceIPs splits the comma separated X-Forwarded-For header and joins it with
 // the X-Real-Ip header and/or req.RemoteAddr, ignoring invalid IPs.
 // The X-Real-Ip is omitted if it's already present in the X-Forwarded-For chain.
@@ -51,6 +110,18 @@ func SourceIPs(req *http.Request) []net.IP {
 	}
 
 	// Always include the request Remote Address as it cannot be easily spoofed.
+	remoteIP := remoteAddrIP(req)
+
+	// Don't duplicate remote IP if it's already the last address in the chain.
+	if remoteIP != nil && (len(srcIPs) == 0 || !remoteIP.Equal(srcIPs[len(srcIPs)-1])) {
+		srcIPs = append(srcIPs, remoteIP)
+	}
+
+	return srcIPs
+}
+
+// remoteAddrIP returns the IP of req.RemoteAddr, the peer of the connection.
+func remoteAddrIP(req *http.Request) net.IP {
 	var remoteIP net.IP
 	// Remote Address in Go's HTTP server is in the form host:port so we need to split that first.
 	host, _, err := net.SplitHostPort(req.RemoteAddr)
@@ -61,13 +132,17 @@ func SourceIPs(req *http.Request) []net.IP {
 	if remoteIP == nil {
 		remoteIP = net.ParseIP(req.RemoteAddr)
 	}
+	return remoteIP
+}
 
-	// Don't duplicate remote IP if it's already the last address in the chain.
-	if remoteIP != nil && (len(srcIPs) == 0 || !remoteIP.Equal(srcIPs[len(srcIPs)-1])) {
-		srcIPs = append(srcIPs, remoteIP)
+// Checks whether the given IP address is contained in one of the networks.
+func containedInNets(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
 	}
-
-	return srcIPs
+	return false
 }
 
 // Checks whether the given IP address is contained in the list of IPs.
@@ -0,0 +1,46 @@
+package util
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseNetworks([]string{"10.0.0.1", "172.16.0.0/12"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		realIP     string
+		want       string
+	}{
+		{name: "direct", remoteAddr: "192.168.1.5:5000", want: "192.168.1.5"},
+		{name: "spoofed headers from untrusted peer", remoteAddr: "192.168.1.5:5000", xff: "1.2.3.4", realIP: "5.6.7.8", want: "192.168.1.5"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.1:5000", xff: "203.0.113.9", want: "203.0.113.9"},
+		{name: "spoofed entry before trusted chain", remoteAddr: "10.0.0.1:5000", xff: "1.2.3.4, 203.0.113.9, 172.16.3.4", want: "203.0.113.9"},
+		{name: "real ip from trusted proxy", remoteAddr: "10.0.0.1:5000", realIP: "203.0.113.9", want: "203.0.113.9"},
+		{name: "trusted proxy without headers", remoteAddr: "10.0.0.1:5000", want: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-Ip", tt.realIP)
+			}
+			if got := ClientIP(req, proxies); got.String() != tt.want {
+				t.Errorf("ClientIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseNetworks([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("expected invalid cidr to be rejected")
+	}
+}
@@ -0,0 +1,48 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录B的SHA1测试向量，取后6位
+func TestTOTPCode(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, c := range cases {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(c.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", c.unix, got, c.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	prev, _ := TOTPCode(secret, TOTPStep(now)-1)
+	if step, ok := ValidateTOTP(secret, prev, now, 1); !ok || step != TOTPStep(now)-1 {
+		t.Errorf("code of previous step should be accepted with skew 1")
+	}
+	if _, ok := ValidateTOTP(secret, prev, now, 0); ok {
+		t.Errorf("code of previous step should be rejected without skew")
+	}
+	if _, ok := ValidateTOTP(secret, "abc", now, 1); ok {
+		t.Errorf("malformed code should be rejected")
+	}
+}
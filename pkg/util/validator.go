@@ -1,9 +1,25 @@
 package util
 
-import "github.com/go-playground/validator/v10"
+import (
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
 
 var Validator *validator.Validate
 
 func init() {
 	Validator = validator.New(validator.WithRequiredStructEnabled())
+	// 校验错误中使用json字段名，和请求参数保持一致
+	Validator.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
 }
@@ -0,0 +1,80 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// 以下变量在编译时通过 -ldflags "-X" 注入，见 Makefile
+var (
+	version   = "dev"
+	gitBranch = ""
+	gitCommit = ""
+	buildUser = ""
+	buildDate = ""
+)
+
+// Info 当前运行的程序的版本信息
+type Info struct {
+	Version   string `json:"Version"`
+	GitBranch string `json:"GitBranch"`
+	GitCommit string `json:"GitCommit"`
+	BuildUser string `json:"BuildUser"`
+	BuildDate string `json:"BuildDate"`
+	GoVersion string `json:"GoVersion"`
+	Platform  string `json:"Platform"`
+}
+
+// Get 返回版本信息，未通过 Makefile 编译时使用 go build 记录的vcs信息
+func Get() Info {
+	info := Info{
+		Version:   version,
+		GitBranch: gitBranch,
+		GitCommit: gitCommit,
+		BuildUser: buildUser,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if info.GitCommit == "" || info.BuildDate == "" {
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range bi.Settings {
+				switch {
+				case s.Key == "vcs.revision" && info.GitCommit == "":
+					info.GitCommit = s.Value
+				case s.Key == "vcs.time" && info.BuildDate == "":
+					info.BuildDate = s.Value
+				}
+			}
+		}
+	}
+	return info
+}
+
+// ShortCommit 返回12位的commit id
+func (i Info) ShortCommit() string {
+	if len(i.GitCommit) > 12 {
+		return i.GitCommit[:12]
+	}
+	return i.GitCommit
+}
+
+func (i Info) String() string {
+	parts := []string{}
+	if i.GitBranch != "" {
+		parts = append(parts, "branch: "+i.GitBranch)
+	}
+	if i.GitCommit != "" {
+		parts = append(parts, "commit: "+i.ShortCommit())
+	}
+	if i.BuildUser != "" {
+		parts = append(parts, "built by: "+i.BuildUser)
+	}
+	if i.BuildDate != "" {
+		parts = append(parts, "build date: "+i.BuildDate)
+	}
+	parts = append(parts, i.GoVersion, i.Platform)
+	return fmt.Sprintf("flute-nas %s (%s)", i.Version, strings.Join(parts, ", "))
+}
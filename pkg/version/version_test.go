@@ -0,0 +1,22 @@
+package version
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	gitBranch, gitCommit, buildDate = "main", "0123456789abcdef0123", "2024-01-02T03:04:05Z"
+	defer func() { gitBranch, gitCommit, buildDate = "", "", "" }()
+
+	info := Get()
+	if info.Version != "dev" || info.GitCommit != "0123456789abcdef0123" || info.BuildDate != "2024-01-02T03:04:05Z" {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	if info.GoVersion == "" || info.Platform == "" {
+		t.Fatalf("runtime info missing %+v", info)
+	}
+	if s := info.String(); !strings.Contains(s, "commit: 0123456789ab,") || !strings.Contains(s, "branch: main") {
+		t.Fatalf("unexpected string %s", s)
+	}
+}